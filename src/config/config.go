@@ -1,29 +1,49 @@
 package config
 
 import (
+	"fmt"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/EdgeCDN-X/edgecdnx-api/src/modules/admin"
 	"github.com/EdgeCDN-X/edgecdnx-api/src/modules/app"
 	"github.com/EdgeCDN-X/edgecdnx-api/src/modules/auth"
+	"github.com/EdgeCDN-X/edgecdnx-api/src/modules/prefixlists"
 	"github.com/EdgeCDN-X/edgecdnx-api/src/modules/projects"
 	"github.com/EdgeCDN-X/edgecdnx-api/src/modules/services"
 	"github.com/EdgeCDN-X/edgecdnx-api/src/modules/zones"
 )
 
 type AppConfig struct {
-	Production          bool
-	Listen              string
-	Namespace           string
-	PrometheusEndpoint  string
-	CorsAllowOrigins    []string
-	CorsAllowedMethods  []string
-	CorsAllowedHeaders  []string
-	ServiceBaseDomain   string
-	DefaultAdminProject string
-	DefaultAdminUser    string
-	OIDCGroupMappings   []auth.OIDCGroupMapping
-	OIDCGroupPrefix     string
+	Production               bool
+	Listen                   string
+	Namespace                string
+	PrometheusEndpoint       string
+	CorsAllowOrigins         []string
+	CorsAllowedMethods       []string
+	CorsAllowedHeaders       []string
+	ServiceBaseDomain        string
+	DefaultAdminProject      string
+	DefaultAdminUser         string
+	OIDCGroupMappings        []auth.OIDCGroupMapping
+	OIDCGroupPrefix          string
+	OIDCIssuers              []auth.OIDCIssuer
+	PolicyResyncInterval     time.Duration
+	PersonalTokenMaxLifetime time.Duration
+	AuditSinks               []string
+	AuditFile                string
+	KeyGracePeriod           time.Duration
+	KeyReaperInterval        time.Duration
+	PurgePort                int
+	PurgeTimeout             time.Duration
+	PurgeJobRetention        time.Duration
+	HostAliasCheckInterval   time.Duration
+	HostAliasPendingTTL      time.Duration
+	WatchHeartbeat           time.Duration
+	WatchBufferSize          int
+	LocationHealthInterval   time.Duration
+	ControllerSettings       []string
 }
 
 func ParseOIDCGroupMappings(s string, prefix string) []auth.OIDCGroupMapping {
@@ -48,6 +68,74 @@ func ParseOIDCGroupMappings(s string, prefix string) []auth.OIDCGroupMapping {
 	return mappings
 }
 
+// ParseOIDCIssuers parses issuers separated by ";". Each issuer is a comma-separated list of key=value pairs:
+// issuer, client_ids (separated by "|"), user_claim, groups_claim, group_prefix, subject_prefix and group_mappings
+// (oidc-group:tenant:group entries separated by "|", prefixed with the group prefix of the issuer).
+// Claims and the group prefix fall back to the given defaults.
+func ParseOIDCIssuers(s string, userClaim string, groupsClaim string, groupPrefix string) ([]auth.OIDCIssuer, error) {
+	issuers := []auth.OIDCIssuer{}
+	if strings.TrimSpace(s) == "" {
+		return issuers, nil
+	}
+
+	for _, entry := range splitAndTrim(s, ";") {
+		if entry == "" {
+			continue
+		}
+
+		issuer := auth.OIDCIssuer{
+			UserClaim:   userClaim,
+			GroupsClaim: groupsClaim,
+			GroupPrefix: groupPrefix,
+		}
+		// group_prefix may follow group_mappings, the mappings are prefixed once the entry is read
+		mappings := []string{}
+
+		for _, field := range splitAndTrim(entry, ",") {
+			key, value, ok := strings.Cut(field, "=")
+			if !ok {
+				return nil, fmt.Errorf("invalid OIDC issuer field %q, expected key=value", field)
+			}
+			value = strings.TrimSpace(value)
+
+			switch strings.TrimSpace(key) {
+			case "issuer":
+				issuer.IssuerURL = value
+			case "client_ids":
+				issuer.ClientIDs = splitAndTrim(value, "|")
+			case "user_claim":
+				issuer.UserClaim = value
+			case "groups_claim":
+				issuer.GroupsClaim = value
+			case "group_prefix":
+				issuer.GroupPrefix = value
+			case "subject_prefix":
+				issuer.SubjectPrefix = value
+			case "group_mappings":
+				mappings = splitAndTrim(value, "|")
+			default:
+				return nil, fmt.Errorf("unknown OIDC issuer field %q", key)
+			}
+		}
+
+		for _, mapping := range mappings {
+			parts := splitAndTrim(mapping, ":")
+			if len(parts) != 3 || slices.Contains(parts, "") {
+				return nil, fmt.Errorf("invalid group mapping %q of OIDC issuer %s, expected oidc-group:tenant:group", mapping, issuer.IssuerURL)
+			}
+			issuer.GroupMappings = append(issuer.GroupMappings, auth.OIDCGroupMapping{
+				OIDCGroup: issuer.GroupPrefix + parts[0],
+				Tenant:    parts[1],
+				Group:     parts[2],
+			})
+		}
+
+		issuers = append(issuers, issuer)
+	}
+
+	return issuers, nil
+}
+
 func splitAndTrim(s1, s2 string) []string {
 	parts := strings.Split(s1, s2)
 	for i := range parts {
@@ -67,9 +155,12 @@ func (a *AppConfig) GetAuthenticatedModules() []ModuleDef {
 			Name: "Admin",
 			Init: func() app.Module {
 				return admin.New(admin.Config{
-					Namespace:           a.Namespace,
-					DefaultAdminProject: a.DefaultAdminProject,
-					DefaultAdminUser:    a.DefaultAdminUser,
+					Namespace:              a.Namespace,
+					DefaultAdminProject:    a.DefaultAdminProject,
+					DefaultAdminUser:       a.DefaultAdminUser,
+					WatchHeartbeat:         a.WatchHeartbeat,
+					WatchBufferSize:        a.WatchBufferSize,
+					LocationHealthInterval: a.LocationHealthInterval,
 				})
 			},
 		},
@@ -80,6 +171,8 @@ func (a *AppConfig) GetAuthenticatedModules() []ModuleDef {
 					Namespace:           a.Namespace,
 					DefaultAdminProject: a.DefaultAdminProject,
 					DefaultAdminUser:    a.DefaultAdminUser,
+					Issuers:             a.OIDCIssuers,
+					OIDCGroupPrefix:     a.OIDCGroupPrefix,
 				})
 			},
 		},
@@ -87,8 +180,26 @@ func (a *AppConfig) GetAuthenticatedModules() []ModuleDef {
 			Name: "Services",
 			Init: func() app.Module {
 				return services.New(services.Config{
-					Namespace:         a.Namespace,
-					ServiceBaseDomain: a.ServiceBaseDomain,
+					Namespace:              a.Namespace,
+					ServiceBaseDomain:      a.ServiceBaseDomain,
+					KeyGracePeriod:         a.KeyGracePeriod,
+					KeyReaperInterval:      a.KeyReaperInterval,
+					PurgePort:              a.PurgePort,
+					PurgeTimeout:           a.PurgeTimeout,
+					PurgeJobRetention:      a.PurgeJobRetention,
+					HostAliasCheckInterval: a.HostAliasCheckInterval,
+					HostAliasPendingTTL:    a.HostAliasPendingTTL,
+					WatchHeartbeat:         a.WatchHeartbeat,
+					WatchBufferSize:        a.WatchBufferSize,
+					ControllerSettings:     a.ControllerSettings,
+				})
+			},
+		},
+		{
+			Name: "PrefixLists",
+			Init: func() app.Module {
+				return prefixlists.New(prefixlists.Config{
+					Namespace: a.Namespace,
 				})
 			},
 		},
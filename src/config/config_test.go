@@ -0,0 +1,43 @@
+package config
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/EdgeCDN-X/edgecdnx-api/src/modules/auth"
+)
+
+func TestParseOIDCIssuers(t *testing.T) {
+	issuers, err := ParseOIDCIssuers("issuer=https://employees.example.com,client_ids=portal; issuer=https://customers.example.com,client_ids=portal|cli,groups_claim=roles,group_mappings=admins:admin:admin|ops:demo:member,group_prefix=customer-,subject_prefix=customer:", "email", "groups", "oidc-")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(issuers) != 2 {
+		t.Fatalf("expected two issuers, got %d", len(issuers))
+	}
+
+	if issuers[0].UserClaim != "email" || issuers[0].GroupsClaim != "groups" || issuers[0].GroupPrefix != "oidc-" || issuers[0].SubjectPrefix != "" {
+		t.Fatalf("expected defaults for the first issuer, got %#v", issuers[0])
+	}
+	if issuers[1].IssuerURL != "https://customers.example.com" || !slices.Equal(issuers[1].ClientIDs, []string{"portal", "cli"}) {
+		t.Fatalf("unexpected second issuer %#v", issuers[1])
+	}
+	if issuers[1].GroupsClaim != "roles" || issuers[1].GroupPrefix != "customer-" || issuers[1].SubjectPrefix != "customer:" {
+		t.Fatalf("unexpected overrides %#v", issuers[1])
+	}
+	if len(issuers[1].GroupMappings) != 2 || issuers[1].GroupMappings[0] != (auth.OIDCGroupMapping{OIDCGroup: "customer-admins", Tenant: "admin", Group: "admin"}) || issuers[1].GroupMappings[1].OIDCGroup != "customer-ops" {
+		t.Fatalf("expected mappings with the issuer group prefix, got %#v", issuers[1].GroupMappings)
+	}
+	if len(issuers[0].GroupMappings) != 0 {
+		t.Fatalf("unexpected mappings for the first issuer %#v", issuers[0].GroupMappings)
+	}
+}
+
+func TestParseOIDCIssuersRejectsUnknownFields(t *testing.T) {
+	if _, err := ParseOIDCIssuers("issuer=https://employees.example.com,audience=portal", "email", "groups", "oidc-"); err == nil {
+		t.Fatal("expected error")
+	}
+	if _, err := ParseOIDCIssuers("issuer=https://employees.example.com,group_mappings=admins:admin", "email", "groups", "oidc-"); err == nil {
+		t.Fatal("expected error for a malformed group mapping")
+	}
+}
@@ -0,0 +1,105 @@
+// Package cidr validates and normalises the IP ranges of allow and deny lists.
+//
+// Ranges are accepted as CIDRs or bare addresses for IPv4 and IPv6. Normalising clears host bits, maps
+// IPv4-mapped IPv6 ranges back to IPv4, drops ranges covered by another one and joins adjacent ranges
+// into their common parent, so equal lists always serialise the same way.
+package cidr
+
+import (
+	"fmt"
+	"net/netip"
+	"slices"
+	"strings"
+)
+
+// Parse reads a CIDR or a single address. Host bits are cleared, e.g. 10.1.2.3/8 becomes 10.0.0.0/8.
+func Parse(value string) (netip.Prefix, error) {
+	value = strings.TrimSpace(value)
+
+	var prefix netip.Prefix
+	if strings.Contains(value, "/") {
+		p, err := netip.ParsePrefix(value)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("invalid CIDR %q", value)
+		}
+		prefix = p
+	} else {
+		addr, err := netip.ParseAddr(value)
+		if err != nil || addr.Zone() != "" {
+			return netip.Prefix{}, fmt.Errorf("invalid IP address %q", value)
+		}
+		prefix = netip.PrefixFrom(addr, addr.BitLen())
+	}
+
+	if prefix.Addr().Is4In6() && prefix.Bits() >= 96 {
+		prefix = netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()-96)
+	}
+	return prefix.Masked(), nil
+}
+
+// Merge returns the smallest sorted list of prefixes covering exactly the same addresses, IPv4 first
+func Merge(prefixes []netip.Prefix) []netip.Prefix {
+	sorted := slices.Clone(prefixes)
+	slices.SortFunc(sorted, func(a, b netip.Prefix) int {
+		if c := a.Addr().Compare(b.Addr()); c != 0 {
+			return c
+		}
+		return a.Bits() - b.Bits()
+	})
+
+	// Prefixes either nest or are disjoint, so in address order only the last kept one can cover the next
+	merged := []netip.Prefix{}
+	for _, prefix := range sorted {
+		if n := len(merged); n > 0 && merged[n-1].Bits() <= prefix.Bits() && merged[n-1].Contains(prefix.Addr()) {
+			continue
+		}
+		merged = append(merged, prefix)
+
+		for n := len(merged); n > 1; n = len(merged) {
+			parent, ok := siblingParent(merged[n-2], merged[n-1])
+			if !ok {
+				break
+			}
+			merged = append(merged[:n-2], parent)
+		}
+	}
+	return merged
+}
+
+// siblingParent returns the parent of two prefixes that are the two halves of it
+func siblingParent(a, b netip.Prefix) (netip.Prefix, bool) {
+	if a == b || a.Bits() != b.Bits() || a.Bits() == 0 || a.Addr().Is4() != b.Addr().Is4() {
+		return netip.Prefix{}, false
+	}
+	parentA := netip.PrefixFrom(a.Addr(), a.Bits()-1).Masked()
+	parentB := netip.PrefixFrom(b.Addr(), b.Bits()-1).Masked()
+	return parentA, parentA == parentB
+}
+
+// Normalize parses and merges a list of ranges. Errors are keyed by the index of the offending value.
+func Normalize(values []string) ([]netip.Prefix, map[int]string) {
+	errs := map[int]string{}
+	prefixes := []netip.Prefix{}
+	for i, value := range values {
+		prefix, err := Parse(value)
+		if err != nil {
+			errs[i] = err.Error()
+			continue
+		}
+		prefixes = append(prefixes, prefix)
+	}
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return Merge(prefixes), nil
+}
+
+// Strings formats prefixes in their canonical CIDR notation
+func Strings(prefixes []netip.Prefix) []string {
+	ret := make([]string, 0, len(prefixes))
+	for _, prefix := range prefixes {
+		ret = append(ret, prefix.String())
+	}
+	return ret
+}
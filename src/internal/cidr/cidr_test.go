@@ -0,0 +1,72 @@
+package cidr
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	for value, expected := range map[string]string{
+		"10.1.2.3/8":              "10.0.0.0/8",
+		"192.0.2.1":               "192.0.2.1/32",
+		" 2001:db8::1 ":           "2001:db8::1/128",
+		"2001:db8:1:2::/32":       "2001:db8::/32",
+		"::ffff:198.51.100.0/120": "198.51.100.0/24",
+	} {
+		prefix, err := Parse(value)
+		if err != nil {
+			t.Fatalf("failed to parse %q: %v", value, err)
+		}
+		if prefix.String() != expected {
+			t.Fatalf("expected %q to normalise to %s, got %s", value, expected, prefix)
+		}
+	}
+
+	for _, value := range []string{"", "10.0.0.0/33", "10.0.0", "fe80::1%eth0", "example.com", "2001:db8::/129"} {
+		if _, err := Parse(value); err == nil {
+			t.Fatalf("expected %q to be rejected", value)
+		}
+	}
+}
+
+func TestNormalizeMergesOverlappingRanges(t *testing.T) {
+	prefixes, errs := Normalize([]string{
+		"2001:db8::/33",
+		"10.0.1.0/24",
+		"10.0.0.0/24",
+		"10.0.0.128/25",
+		"2001:db8:8000::/33",
+		"192.0.2.7",
+		"192.0.2.7/32",
+		"172.16.0.0/12",
+		"172.20.0.0/16",
+	})
+	if len(errs) > 0 {
+		t.Fatalf("expected no errors, got %#v", errs)
+	}
+
+	expected := []string{"10.0.0.0/23", "172.16.0.0/12", "192.0.2.7/32", "2001:db8::/32"}
+	if got := Strings(prefixes); !slices.Equal(got, expected) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestNormalizeMergesRepeatedly(t *testing.T) {
+	prefixes, _ := Normalize([]string{"10.0.0.0/26", "10.0.0.64/26", "10.0.0.128/25", "10.0.1.0/24"})
+	if got := Strings(prefixes); !slices.Equal(got, []string{"10.0.0.0/23"}) {
+		t.Fatalf("unexpected prefixes %v", got)
+	}
+
+	// Both halves of the address space stay apart, there is no common parent across families
+	prefixes, _ = Normalize([]string{"0.0.0.0/1", "128.0.0.0/1", "::/0"})
+	if got := Strings(prefixes); !slices.Equal(got, []string{"0.0.0.0/0", "::/0"}) {
+		t.Fatalf("unexpected prefixes %v", got)
+	}
+}
+
+func TestNormalizeReportsEveryInvalidValue(t *testing.T) {
+	_, errs := Normalize([]string{"10.0.0.0/8", "10.0.0.0/40", "not-an-ip"})
+	if len(errs) != 2 || errs[1] == "" || errs[2] == "" {
+		t.Fatalf("unexpected errors %#v", errs)
+	}
+}
@@ -0,0 +1,102 @@
+// Package dnsverify proves that a tenant controls a hostname before it is served and a certificate is issued for it.
+//
+// Two challenges are supported. A TXT challenge expects the record _edgecdnx-challenge.<hostname> to carry the
+// token handed out when the hostname was added. A CNAME challenge expects the hostname itself to point at the
+// service domain, which is what the tenant has to configure anyway to route traffic to the CDN.
+package dnsverify
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+)
+
+type Method string
+
+const (
+	MethodTXT   Method = "txt"
+	MethodCNAME Method = "cname"
+)
+
+// ChallengePrefix is prepended to the hostname to form the TXT record name
+const ChallengePrefix = "_edgecdnx-challenge."
+
+// TokenPrefix starts every TXT token so it is recognisable among other records of the same name
+const TokenPrefix = "edgecdnx-verification="
+
+// Resolver looks up DNS records. *net.Resolver implements it.
+type Resolver interface {
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+	LookupCNAME(ctx context.Context, host string) (string, error)
+}
+
+// ErrNotVerified is returned when the records were resolved but do not prove ownership
+var ErrNotVerified = errors.New("hostname is not verified")
+
+// Challenge is what has to be found in DNS for a hostname
+type Challenge struct {
+	Hostname string
+	Method   Method
+	// Token is the expected TXT value
+	Token string
+	// Target is the expected CNAME target
+	Target string
+}
+
+// NewToken generates a TXT token
+func NewToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate verification token: %w", err)
+	}
+	return TokenPrefix + hex.EncodeToString(b), nil
+}
+
+// RecordName returns the name of the TXT record checked for a hostname
+func RecordName(hostname string) string {
+	return ChallengePrefix + hostname
+}
+
+// Verify resolves the challenge. Errors wrapping ErrNotVerified mean the records are missing or wrong,
+// other errors are lookup failures worth retrying.
+func Verify(ctx context.Context, resolver Resolver, challenge Challenge) error {
+	switch challenge.Method {
+	case MethodTXT:
+		name := RecordName(challenge.Hostname)
+		records, err := resolver.LookupTXT(ctx, name)
+		if err != nil {
+			if isNotFound(err) {
+				return fmt.Errorf("%w: no TXT record found at %s", ErrNotVerified, name)
+			}
+			return fmt.Errorf("failed to look up TXT records of %s: %w", name, err)
+		}
+		if !slices.Contains(records, challenge.Token) {
+			return fmt.Errorf("%w: TXT record at %s does not contain the token", ErrNotVerified, name)
+		}
+		return nil
+	case MethodCNAME:
+		cname, err := resolver.LookupCNAME(ctx, challenge.Hostname)
+		if err != nil {
+			if isNotFound(err) {
+				return fmt.Errorf("%w: %s does not resolve", ErrNotVerified, challenge.Hostname)
+			}
+			return fmt.Errorf("failed to look up CNAME of %s: %w", challenge.Hostname, err)
+		}
+		if !strings.EqualFold(strings.TrimSuffix(cname, "."), strings.TrimSuffix(challenge.Target, ".")) {
+			return fmt.Errorf("%w: %s points to %s instead of %s", ErrNotVerified, challenge.Hostname, strings.TrimSuffix(cname, "."), challenge.Target)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown verification method %q", challenge.Method)
+	}
+}
+
+func isNotFound(err error) bool {
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr) && dnsErr.IsNotFound
+}
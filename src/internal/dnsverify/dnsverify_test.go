@@ -0,0 +1,93 @@
+package dnsverify
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+)
+
+type fakeResolver struct {
+	txt   map[string][]string
+	cname map[string]string
+	err   error
+}
+
+func (r *fakeResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	records, ok := r.txt[name]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	}
+	return records, nil
+}
+
+func (r *fakeResolver) LookupCNAME(ctx context.Context, host string) (string, error) {
+	if r.err != nil {
+		return "", r.err
+	}
+	cname, ok := r.cname[host]
+	if !ok {
+		return "", &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	return cname, nil
+}
+
+func TestNewToken(t *testing.T) {
+	a, err := NewToken()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	b, _ := NewToken()
+	if !strings.HasPrefix(a, TokenPrefix) || a == b {
+		t.Fatalf("unexpected tokens %q and %q", a, b)
+	}
+}
+
+func TestVerifyTXT(t *testing.T) {
+	resolver := &fakeResolver{txt: map[string][]string{
+		"_edgecdnx-challenge.www.example.com": {"v=spf1 -all", "edgecdnx-verification=abc"},
+	}}
+
+	if err := Verify(context.Background(), resolver, Challenge{Hostname: "www.example.com", Method: MethodTXT, Token: "edgecdnx-verification=abc"}); err != nil {
+		t.Fatalf("expected verification to succeed, got %v", err)
+	}
+
+	err := Verify(context.Background(), resolver, Challenge{Hostname: "www.example.com", Method: MethodTXT, Token: "edgecdnx-verification=def"})
+	if !errors.Is(err, ErrNotVerified) {
+		t.Fatalf("expected a wrong token to fail verification, got %v", err)
+	}
+
+	err = Verify(context.Background(), resolver, Challenge{Hostname: "cdn.example.com", Method: MethodTXT, Token: "edgecdnx-verification=abc"})
+	if !errors.Is(err, ErrNotVerified) {
+		t.Fatalf("expected a missing record to fail verification, got %v", err)
+	}
+}
+
+func TestVerifyCNAME(t *testing.T) {
+	resolver := &fakeResolver{cname: map[string]string{
+		"www.example.com":    "Web-1.cdn.example.net.",
+		"static.example.com": "elsewhere.example.org.",
+	}}
+
+	if err := Verify(context.Background(), resolver, Challenge{Hostname: "www.example.com", Method: MethodCNAME, Target: "web-1.cdn.example.net"}); err != nil {
+		t.Fatalf("expected verification to succeed, got %v", err)
+	}
+
+	err := Verify(context.Background(), resolver, Challenge{Hostname: "static.example.com", Method: MethodCNAME, Target: "web-1.cdn.example.net"})
+	if !errors.Is(err, ErrNotVerified) {
+		t.Fatalf("expected a foreign target to fail verification, got %v", err)
+	}
+}
+
+func TestVerifyReportsLookupFailures(t *testing.T) {
+	resolver := &fakeResolver{err: &net.DNSError{Err: "server misbehaving", Name: "www.example.com", IsTemporary: true}}
+
+	err := Verify(context.Background(), resolver, Challenge{Hostname: "www.example.com", Method: MethodCNAME, Target: "web-1.cdn.example.net"})
+	if err == nil || errors.Is(err, ErrNotVerified) {
+		t.Fatalf("expected a lookup failure, got %v", err)
+	}
+}
@@ -0,0 +1,73 @@
+package purge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+)
+
+// HTTPPurger sends PURGE requests to every cache node of a location, in the format understood by the
+// nginx cache purge module where a trailing * purges a prefix.
+type HTTPPurger struct {
+	Client *http.Client
+	// Port the cache nodes accept PURGE requests on
+	Port int
+}
+
+// paths translates the targets of a request into the paths sent to the cache nodes
+func paths(req Request) []Target {
+	switch req.Scope {
+	case ScopeAll:
+		return []Target{{Path: "/*"}}
+	case ScopePrefix:
+		ret := []Target{}
+		for _, target := range req.Targets {
+			ret = append(ret, Target{Host: target.Host, Path: target.Path + "*"})
+		}
+		return ret
+	default:
+		return req.Targets
+	}
+}
+
+func (p *HTTPPurger) Purge(ctx context.Context, location Location, req Request) error {
+	var errs []error
+	for _, node := range location.Nodes {
+		base := "http://" + net.JoinHostPort(node, strconv.Itoa(p.Port))
+		for _, target := range paths(req) {
+			hosts := req.Hosts
+			if target.Host != "" {
+				hosts = []string{target.Host}
+			}
+			for _, host := range hosts {
+				if err := p.purge(ctx, base+target.Path, host); err != nil {
+					errs = append(errs, fmt.Errorf("node %s: %w", node, err))
+				}
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (p *HTTPPurger) purge(ctx context.Context, url string, host string) error {
+	request, err := http.NewRequestWithContext(ctx, "PURGE", url, nil)
+	if err != nil {
+		return err
+	}
+	request.Host = host
+
+	response, err := p.Client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	// Not found only means nothing was cached
+	if response.StatusCode >= 300 && response.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("purging %s%s returned %s", host, request.URL.RequestURI(), response.Status)
+	}
+	return nil
+}
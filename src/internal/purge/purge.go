@@ -0,0 +1,381 @@
+// Package purge tracks cache invalidations of a service across all edge locations.
+//
+// A purge is a Job fanned out to every location. Each location reports its own progress, the job status
+// is derived from them once all locations are done. The replica that started a job runs it and writes every
+// change to the store's Backend, so any replica can serve the job and it outlives a restart. Jobs are
+// dropped after the store's retention.
+package purge
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/uuid"
+)
+
+// Scope selects what a target matches
+type Scope string
+
+const (
+	// ScopeURL purges exactly one URL including its query string
+	ScopeURL Scope = "url"
+	// ScopePrefix purges every URL starting with the path
+	ScopePrefix Scope = "prefix"
+	// ScopeWildcard purges every URL matching the path, where * matches any sequence of characters
+	ScopeWildcard Scope = "wildcard"
+	// ScopeAll purges everything cached for the service
+	ScopeAll Scope = "all"
+)
+
+type Status string
+
+const (
+	StatusPending   Status = "pending"
+	StatusRunning   Status = "running"
+	StatusSucceeded Status = "succeeded"
+	StatusPartial   Status = "partiallyFailed"
+	StatusFailed    Status = "failed"
+)
+
+// Target is one path to purge. An empty host purges the path on every host of the service.
+type Target struct {
+	Host string `json:"host,omitempty"`
+	Path string `json:"path"`
+}
+
+// Request is what a location has to invalidate
+type Request struct {
+	Service string
+	// Hosts lists the domain and all host aliases of the service
+	Hosts   []string
+	Scope   Scope
+	Targets []Target
+}
+
+// Location is an edge location and the addresses of its cache nodes
+type Location struct {
+	Name  string
+	Nodes []string
+}
+
+// Purger invalidates cached content on one location
+type Purger interface {
+	Purge(ctx context.Context, location Location, req Request) error
+}
+
+type LocationProgress struct {
+	Location   string     `json:"location"`
+	Status     Status     `json:"status"`
+	Error      string     `json:"error,omitempty"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+}
+
+type Job struct {
+	ID         string             `json:"id"`
+	Project    string             `json:"project"`
+	Service    string             `json:"service"`
+	Scope      Scope              `json:"scope"`
+	Targets    []Target           `json:"targets,omitempty"`
+	Status     Status             `json:"status"`
+	CreatedAt  time.Time          `json:"createdAt"`
+	FinishedAt *time.Time         `json:"finishedAt,omitempty"`
+	Locations  []LocationProgress `json:"locations"`
+}
+
+// Backend persists jobs so every replica can serve them. Errors saving the progress of a running job are left
+// to the backend to report, the job keeps running.
+type Backend interface {
+	// Save creates or replaces a job
+	Save(ctx context.Context, job *Job) error
+	// Load returns false when the job does not exist
+	Load(ctx context.Context, id string) (*Job, bool, error)
+	List(ctx context.Context) ([]*Job, error)
+	Delete(ctx context.Context, id string) error
+}
+
+// interruptGrace is how long a job may stay unfinished past the location timeout before it is reported as
+// interrupted. Only a replica that stopped while running the job leaves it unfinished that long.
+const interruptGrace = time.Minute
+
+// Store keeps purge jobs and runs them
+type Store struct {
+	purger Purger
+	// backend is nil when jobs are only kept in memory
+	backend   Backend
+	retention time.Duration
+	// timeout bounds a single location
+	timeout time.Duration
+
+	mu   sync.Mutex
+	jobs map[string]*Job
+	// saveMu orders saves so a job is never overwritten with an older snapshot
+	saveMu sync.Mutex
+}
+
+// NewStore returns a store saving jobs to backend. A nil backend keeps jobs in the memory of this replica only.
+func NewStore(purger Purger, backend Backend, retention time.Duration, timeout time.Duration) *Store {
+	return &Store{
+		purger:    purger,
+		backend:   backend,
+		retention: retention,
+		timeout:   timeout,
+		jobs:      map[string]*Job{},
+	}
+}
+
+// Start creates a job for the request, saves it and runs it in the background on every location
+func (s *Store) Start(ctx context.Context, project string, req Request, locations []Location) (*Job, error) {
+	now := time.Now().UTC()
+	job := &Job{
+		ID:        string(uuid.NewUUID()),
+		Project:   project,
+		Service:   req.Service,
+		Scope:     req.Scope,
+		Targets:   req.Targets,
+		Status:    StatusRunning,
+		CreatedAt: now,
+		Locations: []LocationProgress{},
+	}
+	for _, location := range locations {
+		job.Locations = append(job.Locations, LocationProgress{Location: location.Name, Status: StatusPending})
+	}
+	sort.Slice(job.Locations, func(i, j int) bool { return job.Locations[i].Location < job.Locations[j].Location })
+
+	// A purge without locations has nothing left to do
+	if len(locations) == 0 {
+		derive(job)
+	}
+
+	if s.backend != nil {
+		if err := s.backend.Save(ctx, job); err != nil {
+			return nil, fmt.Errorf("failed to save purge job: %w", err)
+		}
+		if err := s.expire(ctx, now); err != nil {
+			return nil, err
+		}
+	}
+
+	s.mu.Lock()
+	s.evict(now)
+	s.jobs[job.ID] = job
+	snapshot := s.copy(job)
+	s.mu.Unlock()
+
+	for _, location := range locations {
+		go s.run(job.ID, location, req)
+	}
+
+	return snapshot, nil
+}
+
+// Get returns a snapshot of a job. Jobs started by other replicas are read from the backend.
+func (s *Store) Get(ctx context.Context, id string) (*Job, bool, error) {
+	s.mu.Lock()
+	job, ok := s.jobs[id]
+	if ok {
+		job = s.copy(job)
+	}
+	s.mu.Unlock()
+	if ok || s.backend == nil {
+		return job, ok, nil
+	}
+
+	job, ok, err := s.backend.Load(ctx, id)
+	if err != nil || !ok {
+		return nil, false, err
+	}
+	if job.FinishedAt == nil && time.Since(job.CreatedAt) > s.timeout+interruptGrace {
+		interrupt(job)
+	}
+	return job, true, nil
+}
+
+func (s *Store) run(id string, location Location, req Request) {
+	s.setLocation(id, location.Name, StatusRunning, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	err := s.purger.Purge(ctx, location, req)
+	if err != nil {
+		s.setLocation(id, location.Name, StatusFailed, err)
+	} else {
+		s.setLocation(id, location.Name, StatusSucceeded, nil)
+	}
+	s.finish(id)
+	s.save(id)
+}
+
+// save writes the current state of a job to the backend
+func (s *Store) save(id string) {
+	if s.backend == nil {
+		return
+	}
+
+	s.saveMu.Lock()
+	defer s.saveMu.Unlock()
+
+	s.mu.Lock()
+	job, ok := s.jobs[id]
+	if ok {
+		job = s.copy(job)
+	}
+	s.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	// The backend reports its own errors, see Backend
+	_ = s.backend.Save(ctx, job)
+}
+
+func (s *Store) setLocation(id string, name string, status Status, err error) {
+	s.mu.Lock()
+	job, ok := s.jobs[id]
+	if !ok {
+		s.mu.Unlock()
+		return
+	}
+	defer s.save(id)
+	defer s.mu.Unlock()
+
+	for i := range job.Locations {
+		if job.Locations[i].Location != name {
+			continue
+		}
+		job.Locations[i].Status = status
+		if err != nil {
+			job.Locations[i].Error = err.Error()
+		}
+		if status == StatusSucceeded || status == StatusFailed {
+			now := time.Now().UTC()
+			job.Locations[i].FinishedAt = &now
+		}
+	}
+}
+
+// finish derives the job status once every location is done
+func (s *Store) finish(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, ok := s.jobs[id]
+	if !ok || job.FinishedAt != nil {
+		return
+	}
+	derive(job)
+}
+
+// derive sets the job status once every location is done
+func derive(job *Job) {
+	failed := 0
+	for _, location := range job.Locations {
+		switch location.Status {
+		case StatusFailed:
+			failed++
+		case StatusSucceeded:
+		default:
+			return
+		}
+	}
+
+	switch {
+	case failed == 0:
+		job.Status = StatusSucceeded
+	case failed == len(job.Locations):
+		job.Status = StatusFailed
+	default:
+		job.Status = StatusPartial
+	}
+	now := time.Now().UTC()
+	job.FinishedAt = &now
+}
+
+// interrupt fails the locations of a job whose replica stopped before they were done
+func interrupt(job *Job) {
+	now := time.Now().UTC()
+	for i := range job.Locations {
+		if job.Locations[i].Status == StatusPending || job.Locations[i].Status == StatusRunning {
+			job.Locations[i].Status = StatusFailed
+			job.Locations[i].Error = "interrupted, the API replica running the purge stopped"
+			job.Locations[i].FinishedAt = &now
+		}
+	}
+	derive(job)
+}
+
+// evict drops finished jobs older than the retention, callers hold the lock
+func (s *Store) evict(now time.Time) {
+	for id, job := range s.jobs {
+		if job.FinishedAt != nil && now.Sub(*job.FinishedAt) > s.retention {
+			delete(s.jobs, id)
+		}
+	}
+}
+
+// expire deletes saved jobs older than the retention, including interrupted ones that never finished
+func (s *Store) expire(ctx context.Context, now time.Time) error {
+	jobs, err := s.backend.List(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list purge jobs: %w", err)
+	}
+	for _, job := range jobs {
+		done := job.CreatedAt.Add(s.timeout + interruptGrace)
+		if job.FinishedAt != nil {
+			done = *job.FinishedAt
+		}
+		if now.Sub(done) <= s.retention {
+			continue
+		}
+		if err := s.backend.Delete(ctx, job.ID); err != nil {
+			return fmt.Errorf("failed to delete purge job %s: %w", job.ID, err)
+		}
+	}
+	return nil
+}
+
+func (s *Store) copy(job *Job) *Job {
+	ret := *job
+	ret.Locations = append([]LocationProgress{}, job.Locations...)
+	return &ret
+}
+
+// Validate checks the targets against the scope
+func Validate(scope Scope, targets []Target) error {
+	switch scope {
+	case ScopeAll:
+		if len(targets) > 0 {
+			return fmt.Errorf("targets must be empty when purging everything")
+		}
+		return nil
+	case ScopeURL, ScopePrefix, ScopeWildcard:
+	default:
+		return fmt.Errorf("unknown purge scope %q", scope)
+	}
+
+	if len(targets) == 0 {
+		return fmt.Errorf("at least one target is required")
+	}
+	for _, target := range targets {
+		if len(target.Path) == 0 || target.Path[0] != '/' {
+			return fmt.Errorf("target %q must start with /", target.Path)
+		}
+		if scope == ScopeWildcard && !strings.Contains(target.Path, "*") {
+			return fmt.Errorf("wildcard target %q does not contain *", target.Path)
+		}
+		// The cache purge module on the edges only matches a trailing *, anything else would purge nothing
+		if scope == ScopeWildcard && strings.Index(target.Path, "*") != len(target.Path)-1 {
+			return fmt.Errorf("wildcard target %q may only contain * at its end", target.Path)
+		}
+		if scope != ScopeWildcard && strings.Contains(target.Path, "*") {
+			return fmt.Errorf("target %q contains * but the scope is %s", target.Path, scope)
+		}
+	}
+	return nil
+}
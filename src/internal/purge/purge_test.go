@@ -0,0 +1,220 @@
+package purge
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type blockingPurger struct {
+	release chan struct{}
+	fail    map[string]bool
+}
+
+func (p *blockingPurger) Purge(ctx context.Context, location Location, req Request) error {
+	<-p.release
+	if p.fail[location.Name] {
+		return fmt.Errorf("location %s is unreachable", location.Name)
+	}
+	return nil
+}
+
+func waitForJob(t *testing.T, store *Store, id string) *Job {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		job, ok, err := store.Get(context.Background(), id)
+		if err != nil || !ok {
+			t.Fatalf("job %s not found", id)
+		}
+		if job.FinishedAt != nil {
+			return job
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("job %s did not finish", id)
+	return nil
+}
+
+func TestStoreTracksProgressPerLocation(t *testing.T) {
+	purger := &blockingPurger{release: make(chan struct{}), fail: map[string]bool{"sin": true}}
+	store := NewStore(purger, nil, time.Hour, time.Minute)
+
+	job, err := store.Start(context.Background(), "demo", Request{Service: "web", Scope: ScopeAll}, []Location{{Name: "fra"}, {Name: "sin"}})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if job.Status != StatusRunning || len(job.Locations) != 2 {
+		t.Fatalf("unexpected job %#v", job)
+	}
+
+	close(purger.release)
+	job = waitForJob(t, store, job.ID)
+	if job.Status != StatusPartial {
+		t.Fatalf("unexpected status %s", job.Status)
+	}
+	if job.Locations[0].Status != StatusSucceeded || job.Locations[1].Status != StatusFailed || job.Locations[1].Error == "" {
+		t.Fatalf("unexpected progress %#v", job.Locations)
+	}
+
+	if _, ok, _ := store.Get(context.Background(), "missing"); ok {
+		t.Fatal("expected unknown job to be missing")
+	}
+}
+
+// memoryBackend keeps jobs serialized like a real backend, so stores never share state
+type memoryBackend struct {
+	mu   sync.Mutex
+	jobs map[string][]byte
+}
+
+func (b *memoryBackend) Save(ctx context.Context, job *Job) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	b.jobs[job.ID] = data
+	return nil
+}
+
+func (b *memoryBackend) Load(ctx context.Context, id string) (*Job, bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	data, ok := b.jobs[id]
+	if !ok {
+		return nil, false, nil
+	}
+	job := &Job{}
+	return job, true, json.Unmarshal(data, job)
+}
+
+func (b *memoryBackend) List(ctx context.Context) ([]*Job, error) {
+	b.mu.Lock()
+	ids := []string{}
+	for id := range b.jobs {
+		ids = append(ids, id)
+	}
+	b.mu.Unlock()
+
+	jobs := []*Job{}
+	for _, id := range ids {
+		job, ok, err := b.Load(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			jobs = append(jobs, job)
+		}
+	}
+	return jobs, nil
+}
+
+func (b *memoryBackend) Delete(ctx context.Context, id string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.jobs, id)
+	return nil
+}
+
+func TestStoreSharesJobsThroughBackend(t *testing.T) {
+	backend := &memoryBackend{jobs: map[string][]byte{}}
+	purger := &blockingPurger{release: make(chan struct{})}
+	store := NewStore(purger, backend, time.Hour, time.Minute)
+	// Another replica only reads the backend
+	replica := NewStore(purger, backend, time.Hour, time.Minute)
+
+	job, err := store.Start(context.Background(), "demo", Request{Service: "web", Scope: ScopeAll}, []Location{{Name: "fra"}})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if running, ok, _ := replica.Get(context.Background(), job.ID); !ok || running.Status != StatusRunning {
+		t.Fatalf("expected the running job on the replica, got %#v", running)
+	}
+
+	close(purger.release)
+	waitForJob(t, store, job.ID)
+	if finished := waitForJob(t, replica, job.ID); finished.Status != StatusSucceeded {
+		t.Fatalf("unexpected status %s", finished.Status)
+	}
+
+	// A job left unfinished by a stopped replica is reported as interrupted
+	stale := Job{ID: "stale", Status: StatusRunning, CreatedAt: time.Now().Add(-time.Hour), Locations: []LocationProgress{{Location: "fra", Status: StatusRunning}}}
+	if err := backend.Save(context.Background(), &stale); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	interrupted, ok, _ := replica.Get(context.Background(), stale.ID)
+	if !ok || interrupted.Status != StatusFailed || interrupted.Locations[0].Error == "" {
+		t.Fatalf("expected the stale job to be interrupted, got %#v", interrupted)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for name, tc := range map[string]struct {
+		scope   Scope
+		targets []Target
+		valid   bool
+	}{
+		"all":                 {ScopeAll, nil, true},
+		"all with targets":    {ScopeAll, []Target{{Path: "/"}}, false},
+		"url":                 {ScopeURL, []Target{{Path: "/a.jpg?v=1"}}, true},
+		"url without targets": {ScopeURL, nil, false},
+		"relative":            {ScopePrefix, []Target{{Path: "images/"}}, false},
+		"wildcard":            {ScopeWildcard, []Target{{Path: "/images/*"}}, true},
+		"wildcard without *":  {ScopeWildcard, []Target{{Path: "/images/"}}, false},
+		"wildcard in middle":  {ScopeWildcard, []Target{{Path: "/images/*.jpg"}}, false},
+		"wildcard twice":      {ScopeWildcard, []Target{{Path: "/*/images/*"}}, false},
+		"prefix with *":       {ScopePrefix, []Target{{Path: "/images/*"}}, false},
+		"unknown":             {Scope("everything"), nil, false},
+	} {
+		err := Validate(tc.scope, tc.targets)
+		if (err == nil) != tc.valid {
+			t.Fatalf("%s: unexpected result %v", name, err)
+		}
+	}
+}
+
+func TestHTTPPurgerSendsPurgeRequests(t *testing.T) {
+	var mu sync.Mutex
+	received := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		received = append(received, r.Method+" "+r.Host+r.URL.RequestURI())
+		mu.Unlock()
+		if strings.HasPrefix(r.URL.Path, "/missing") {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	port := 0
+	fmt.Sscanf(u.Port(), "%d", &port)
+
+	purger := &HTTPPurger{Client: server.Client(), Port: port}
+	err = purger.Purge(context.Background(), Location{Name: "fra", Nodes: []string{u.Hostname()}}, Request{
+		Hosts:   []string{"cdn.example.com", "www.example.com"},
+		Scope:   ScopePrefix,
+		Targets: []Target{{Path: "/images/"}, {Host: "www.example.com", Path: "/missing"}},
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	expected := []string{"PURGE cdn.example.com/images/*", "PURGE www.example.com/images/*", "PURGE www.example.com/missing*"}
+	if fmt.Sprint(received) != fmt.Sprint(expected) {
+		t.Fatalf("unexpected requests %v", received)
+	}
+}
@@ -0,0 +1,141 @@
+// Package readiness turns the status of the objects making up a service into one normalized model.
+//
+// Every object type is read by a Source reporting conditions and, where it knows about them, the state of
+// single edge locations. Aggregate merges the reports, the overall phase is the worst phase reported.
+// New kinds of status are added by implementing another Source.
+package readiness
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+)
+
+type Phase string
+
+const (
+	// PhaseReady is reported once an object is fully rolled out
+	PhaseReady Phase = "Ready"
+	// PhasePending is reported for objects which do not exist yet
+	PhasePending Phase = "Pending"
+	// PhaseProgressing is reported while an object is being rolled out or updated
+	PhaseProgressing Phase = "Progressing"
+	// PhaseDegraded is reported when an object failed and needs attention
+	PhaseDegraded Phase = "Degraded"
+	// PhaseUnknown is reported when the status could not be read
+	PhaseUnknown Phase = "Unknown"
+)
+
+// severity orders phases, the aggregated phase is the one with the highest severity
+var severity = map[Phase]int{
+	PhaseReady:       0,
+	PhaseUnknown:     1,
+	PhasePending:     2,
+	PhaseProgressing: 3,
+	PhaseDegraded:    4,
+}
+
+func worst(a Phase, b Phase) Phase {
+	if severity[b] > severity[a] {
+		return b
+	}
+	return a
+}
+
+type Condition struct {
+	// Source names the object the condition is read from
+	Source string `json:"source"`
+	Type   string `json:"type"`
+	Phase  Phase  `json:"phase"`
+	// Reason is a machine readable CamelCase reason, Message explains it to humans
+	Reason             string     `json:"reason,omitempty"`
+	Message            string     `json:"message"`
+	Location           string     `json:"location,omitempty"`
+	LastTransitionTime *time.Time `json:"lastTransitionTime,omitempty"`
+}
+
+type LocationStatus struct {
+	Location string `json:"location"`
+	Phase    Phase  `json:"phase"`
+	Ready    bool   `json:"ready"`
+	Message  string `json:"message,omitempty"`
+}
+
+type Status struct {
+	Phase       Phase            `json:"phase"`
+	Ready       bool             `json:"ready"`
+	Conditions  []Condition      `json:"conditions"`
+	PerLocation []LocationStatus `json:"perLocation"`
+}
+
+// Report is what a source contributes to the status
+type Report struct {
+	Conditions []Condition
+	Locations  []LocationStatus
+}
+
+// Target identifies the service whose status is collected
+type Target struct {
+	Name      string
+	Namespace string
+}
+
+// Source reads the status of one kind of object belonging to a service
+type Source interface {
+	// Name is used as the source of conditions reported on failures
+	Name() string
+	Collect(ctx context.Context, target Target) (Report, error)
+}
+
+// Aggregate collects the reports of all sources. A failing source is reported as an unknown condition
+// instead of failing the whole status.
+func Aggregate(ctx context.Context, target Target, sources ...Source) Status {
+	status := Status{Phase: PhaseReady, Conditions: []Condition{}, PerLocation: []LocationStatus{}}
+	locations := map[string]*LocationStatus{}
+
+	for _, source := range sources {
+		report, err := source.Collect(ctx, target)
+		if err != nil {
+			report = Report{Conditions: []Condition{{
+				Source:  source.Name(),
+				Type:    "Available",
+				Phase:   PhaseUnknown,
+				Reason:  "StatusUnavailable",
+				Message: "status could not be read: " + err.Error(),
+			}}}
+		}
+
+		for _, condition := range report.Conditions {
+			status.Phase = worst(status.Phase, condition.Phase)
+			status.Conditions = append(status.Conditions, condition)
+		}
+
+		for _, location := range report.Locations {
+			status.Phase = worst(status.Phase, location.Phase)
+			merged, ok := locations[location.Location]
+			if !ok {
+				location := location
+				locations[location.Location] = &location
+				continue
+			}
+			if severity[location.Phase] > severity[merged.Phase] {
+				merged.Phase = location.Phase
+			}
+			if location.Message != "" {
+				merged.Message = strings.TrimPrefix(merged.Message+"; "+location.Message, "; ")
+			}
+		}
+	}
+
+	for _, location := range locations {
+		location.Ready = location.Phase == PhaseReady
+		status.PerLocation = append(status.PerLocation, *location)
+	}
+	sort.Slice(status.PerLocation, func(i, j int) bool {
+		return status.PerLocation[i].Location < status.PerLocation[j].Location
+	})
+
+	status.Ready = status.Phase == PhaseReady
+	return status
+}
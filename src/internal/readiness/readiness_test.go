@@ -0,0 +1,169 @@
+package readiness
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+var serviceGVR = schema.GroupVersionResource{Group: "infrastructure.edgecdnx.com", Version: "v1alpha1", Resource: "services"}
+
+func object(apiVersion string, kind string, name string, status map[string]any) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": apiVersion,
+		"kind":       kind,
+		"metadata":   map[string]any{"name": name, "namespace": "edgecdnx"},
+	}}
+	if status != nil {
+		obj.Object["status"] = status
+	}
+	return obj
+}
+
+func application(service string, location string, status map[string]any) *unstructured.Unstructured {
+	app := object("argoproj.io/v1alpha1", "Application", "service-"+service+"-at-"+location, status)
+	app.Object["metadata"].(map[string]any)["ownerReferences"] = []any{map[string]any{
+		"apiVersion": "argoproj.io/v1alpha1",
+		"kind":       "ApplicationSet",
+		"name":       service,
+		"uid":        "1",
+	}}
+	return app
+}
+
+func newClient(objects ...runtime.Object) *dynamicfake.FakeDynamicClient {
+	return dynamicfake.NewSimpleDynamicClientWithCustomListKinds(
+		runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{serviceGVR: "ServiceList", ApplicationGVR: "ApplicationList"},
+		objects...,
+	)
+}
+
+func sources(client *dynamicfake.FakeDynamicClient) []Source {
+	return []Source{
+		&ServiceSource{Client: client, GVR: serviceGVR},
+		&CertificateSource{Client: client},
+		&ApplicationSetSource{Client: client},
+		&ApplicationsSource{Client: client},
+	}
+}
+
+func TestAggregateNewService(t *testing.T) {
+	client := newClient(object("infrastructure.edgecdnx.com/v1alpha1", "Service", "web", nil))
+
+	status := Aggregate(context.Background(), Target{Name: "web", Namespace: "edgecdnx"}, sources(client)...)
+	if status.Phase != PhasePending || status.Ready || len(status.Conditions) != 4 || len(status.PerLocation) != 0 {
+		t.Fatalf("unexpected status %#v", status)
+	}
+	for _, c := range status.Conditions {
+		if c.Phase != PhasePending || c.Message == "" {
+			t.Fatalf("unexpected condition %#v", c)
+		}
+	}
+}
+
+func TestAggregateRolledOutService(t *testing.T) {
+	healthy := map[string]any{"health": map[string]any{"status": "Healthy"}, "sync": map[string]any{"status": "Synced"}}
+	client := newClient(
+		object("infrastructure.edgecdnx.com/v1alpha1", "Service", "web", map[string]any{"status": "Healthy"}),
+		object("cert-manager.io/v1", "Certificate", "web", map[string]any{
+			"notAfter":   "2030-01-01T00:00:00Z",
+			"conditions": []any{map[string]any{"type": "Ready", "status": "True", "reason": "Ready", "lastTransitionTime": "2026-01-01T00:00:00Z"}},
+		}),
+		object("argoproj.io/v1alpha1", "ApplicationSet", "web", map[string]any{
+			"conditions": []any{map[string]any{"type": "ResourcesUpToDate", "status": "True"}},
+		}),
+		application("web", "fra", healthy),
+		application("web", "ams", healthy),
+		application("other", "fra", map[string]any{"health": map[string]any{"status": "Degraded"}}),
+	)
+
+	status := Aggregate(context.Background(), Target{Name: "web", Namespace: "edgecdnx"}, sources(client)...)
+	if status.Phase != PhaseReady || !status.Ready {
+		t.Fatalf("unexpected status %#v", status)
+	}
+	if len(status.PerLocation) != 2 || status.PerLocation[0].Location != "ams" || !status.PerLocation[1].Ready {
+		t.Fatalf("unexpected locations %#v", status.PerLocation)
+	}
+	if !strings.Contains(status.Conditions[1].Message, "valid until 2030-01-01") || status.Conditions[1].LastTransitionTime == nil {
+		t.Fatalf("unexpected certificate condition %#v", status.Conditions[1])
+	}
+	if status.Conditions[3].Message != "the service is ready on 2 of 2 locations" {
+		t.Fatalf("unexpected deployment condition %#v", status.Conditions[3])
+	}
+}
+
+func TestAggregateReportsFailures(t *testing.T) {
+	client := newClient(
+		object("infrastructure.edgecdnx.com/v1alpha1", "Service", "web", map[string]any{"status": "Healthy"}),
+		object("cert-manager.io/v1", "Certificate", "web", map[string]any{
+			"conditions": []any{map[string]any{"type": "Ready", "status": "False", "reason": "Failed", "message": "ACME challenge failed"}},
+		}),
+		object("argoproj.io/v1alpha1", "ApplicationSet", "web", nil),
+		application("web", "fra", map[string]any{
+			"health":         map[string]any{"status": "Healthy"},
+			"sync":           map[string]any{"status": "Synced"},
+			"operationState": map[string]any{"phase": "Failed", "message": "one or more objects failed to apply"},
+			"conditions":     []any{map[string]any{"type": "SyncError", "message": "quota exceeded"}},
+		}),
+		application("web", "ams", map[string]any{"health": map[string]any{"status": "Healthy"}, "sync": map[string]any{"status": "OutOfSync"}}),
+	)
+
+	status := Aggregate(context.Background(), Target{Name: "web", Namespace: "edgecdnx"}, sources(client)...)
+	if status.Phase != PhaseDegraded || status.Ready {
+		t.Fatalf("unexpected status %#v", status)
+	}
+	if status.Conditions[1].Phase != PhaseDegraded || !strings.Contains(status.Conditions[1].Message, "ACME challenge failed") {
+		t.Fatalf("unexpected certificate condition %#v", status.Conditions[1])
+	}
+	if status.PerLocation[0].Phase != PhaseProgressing || status.PerLocation[1].Phase != PhaseDegraded || !strings.Contains(status.PerLocation[1].Message, "failed to apply") {
+		t.Fatalf("unexpected locations %#v", status.PerLocation)
+	}
+	last := status.Conditions[len(status.Conditions)-1]
+	if last.Type != "SyncError" || last.Location != "fra" || last.Phase != PhaseDegraded {
+		t.Fatalf("unexpected application condition %#v", last)
+	}
+}
+
+type failingSource struct{}
+
+func (failingSource) Name() string {
+	return "failing"
+}
+
+func (failingSource) Collect(ctx context.Context, target Target) (Report, error) {
+	return Report{}, fmt.Errorf("connection refused")
+}
+
+type locationSource struct {
+	locations []LocationStatus
+}
+
+func (s locationSource) Name() string {
+	return "locations"
+}
+
+func (s locationSource) Collect(ctx context.Context, target Target) (Report, error) {
+	return Report{Locations: s.locations}, nil
+}
+
+func TestAggregateMergesSources(t *testing.T) {
+	status := Aggregate(context.Background(), Target{Name: "web"},
+		locationSource{[]LocationStatus{{Location: "fra", Phase: PhaseReady}}},
+		locationSource{[]LocationStatus{{Location: "fra", Phase: PhaseProgressing, Message: "purging"}}},
+		failingSource{},
+	)
+
+	if status.Phase != PhaseProgressing || len(status.PerLocation) != 1 || status.PerLocation[0].Phase != PhaseProgressing || status.PerLocation[0].Message != "purging" {
+		t.Fatalf("unexpected status %#v", status)
+	}
+	if len(status.Conditions) != 1 || status.Conditions[0].Source != "failing" || status.Conditions[0].Phase != PhaseUnknown {
+		t.Fatalf("unexpected conditions %#v", status.Conditions)
+	}
+}
@@ -0,0 +1,301 @@
+package readiness
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+var (
+	CertificateGVR = schema.GroupVersionResource{
+		Group:    "cert-manager.io",
+		Version:  "v1",
+		Resource: "certificates",
+	}
+	ApplicationSetGVR = schema.GroupVersionResource{
+		Group:    "argoproj.io",
+		Version:  "v1alpha1",
+		Resource: "applicationsets",
+	}
+	ApplicationGVR = schema.GroupVersionResource{
+		Group:    "argoproj.io",
+		Version:  "v1alpha1",
+		Resource: "applications",
+	}
+)
+
+// condition is a Kubernetes style condition read from an unstructured status
+type condition struct {
+	Type               string
+	Status             string
+	Reason             string
+	Message            string
+	LastTransitionTime *time.Time
+}
+
+func conditions(obj *unstructured.Unstructured) []condition {
+	raw, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	result := []condition{}
+	for _, item := range raw {
+		fields, ok := item.(map[string]any)
+		if !ok {
+			continue
+		}
+		c := condition{}
+		c.Type, _, _ = unstructured.NestedString(fields, "type")
+		c.Status, _, _ = unstructured.NestedString(fields, "status")
+		c.Reason, _, _ = unstructured.NestedString(fields, "reason")
+		c.Message, _, _ = unstructured.NestedString(fields, "message")
+		if value, _, _ := unstructured.NestedString(fields, "lastTransitionTime"); value != "" {
+			if t, err := time.Parse(time.RFC3339, value); err == nil {
+				c.LastTransitionTime = &t
+			}
+		}
+		result = append(result, c)
+	}
+	return result
+}
+
+func findCondition(conditions []condition, conditionType string) (condition, bool) {
+	for _, c := range conditions {
+		if c.Type == conditionType {
+			return c, true
+		}
+	}
+	return condition{}, false
+}
+
+// withDetail appends the message of the underlying object to a human readable summary
+func withDetail(summary string, detail string) string {
+	if detail == "" {
+		return summary
+	}
+	return summary + ": " + detail
+}
+
+// ServiceSource reads the status the controller reports on the Service itself
+type ServiceSource struct {
+	Client dynamic.Interface
+	GVR    schema.GroupVersionResource
+}
+
+func (s *ServiceSource) Name() string {
+	return "service"
+}
+
+func (s *ServiceSource) Collect(ctx context.Context, target Target) (Report, error) {
+	obj, err := s.Client.Resource(s.GVR).Namespace(target.Namespace).Get(ctx, target.Name, metav1.GetOptions{})
+	if err != nil {
+		return Report{}, fmt.Errorf("failed to retrieve service: %w", err)
+	}
+
+	value, _, _ := unstructured.NestedString(obj.Object, "status", "status")
+	c := Condition{Source: s.Name(), Type: "Reconciled", Reason: value}
+	switch value {
+	case "Healthy":
+		c.Phase, c.Message = PhaseReady, "service configuration is applied"
+	case "Progressing":
+		c.Phase, c.Message = PhaseProgressing, "the service configuration is being applied"
+	case "Degraded":
+		c.Phase, c.Message = PhaseDegraded, "the service configuration could not be applied"
+	case "":
+		c.Phase, c.Reason, c.Message = PhasePending, "NotReconciled", "the service has not been picked up yet"
+	default:
+		c.Phase, c.Message = PhaseUnknown, "the service reports an unknown status "+value
+	}
+	return Report{Conditions: []Condition{c}}, nil
+}
+
+// CertificateSource reads the cert-manager Certificate issued for the service domain and its host aliases
+type CertificateSource struct {
+	Client dynamic.Interface
+}
+
+func (s *CertificateSource) Name() string {
+	return "certificate"
+}
+
+func (s *CertificateSource) Collect(ctx context.Context, target Target) (Report, error) {
+	obj, err := s.Client.Resource(CertificateGVR).Namespace(target.Namespace).Get(ctx, target.Name, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return Report{Conditions: []Condition{{
+				Source:  s.Name(),
+				Type:    "Issued",
+				Phase:   PhasePending,
+				Reason:  "NotRequested",
+				Message: "the TLS certificate has not been requested yet",
+			}}}, nil
+		}
+		return Report{}, fmt.Errorf("failed to retrieve certificate: %w", err)
+	}
+
+	all := conditions(obj)
+	ready, ok := findCondition(all, "Ready")
+	c := Condition{Source: s.Name(), Type: "Issued", Reason: ready.Reason, LastTransitionTime: ready.LastTransitionTime}
+	switch {
+	case !ok:
+		c.Phase, c.Reason, c.Message = PhaseProgressing, "Requested", "the TLS certificate is waiting to be processed"
+	case ready.Status == "True":
+		c.Phase, c.Message = PhaseReady, "the TLS certificate is issued"
+		if notAfter, _, _ := unstructured.NestedString(obj.Object, "status", "notAfter"); notAfter != "" {
+			c.Message += " and valid until " + notAfter
+		}
+	default:
+		if issuing, ok := findCondition(all, "Issuing"); ok && issuing.Status == "True" {
+			c.Phase, c.Message = PhaseProgressing, withDetail("the TLS certificate is being issued", issuing.Message)
+		} else {
+			c.Phase, c.Message = PhaseDegraded, withDetail("the TLS certificate could not be issued", ready.Message)
+		}
+	}
+	return Report{Conditions: []Condition{c}}, nil
+}
+
+// ApplicationSetSource reads the Argo ApplicationSet deploying the service to the edge locations
+type ApplicationSetSource struct {
+	Client dynamic.Interface
+}
+
+func (s *ApplicationSetSource) Name() string {
+	return "applicationSet"
+}
+
+func (s *ApplicationSetSource) Collect(ctx context.Context, target Target) (Report, error) {
+	obj, err := s.Client.Resource(ApplicationSetGVR).Namespace(target.Namespace).Get(ctx, target.Name, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return Report{Conditions: []Condition{{
+				Source:  s.Name(),
+				Type:    "Generated",
+				Phase:   PhasePending,
+				Reason:  "NotCreated",
+				Message: "the deployment of the service has not been created yet",
+			}}}, nil
+		}
+		return Report{}, fmt.Errorf("failed to retrieve applicationset: %w", err)
+	}
+
+	all := conditions(obj)
+	c := Condition{Source: s.Name(), Type: "Generated", Phase: PhaseReady, Reason: "Generated", Message: "the deployment is generated for all locations"}
+	if failed, ok := findCondition(all, "ErrorOccurred"); ok && failed.Status == "True" {
+		c.Phase, c.Reason, c.LastTransitionTime = PhaseDegraded, failed.Reason, failed.LastTransitionTime
+		c.Message = withDetail("the deployment could not be generated", failed.Message)
+	} else if upToDate, ok := findCondition(all, "ResourcesUpToDate"); ok && upToDate.Status == "False" {
+		c.Phase, c.Reason, c.LastTransitionTime = PhaseProgressing, upToDate.Reason, upToDate.LastTransitionTime
+		c.Message = withDetail("the deployment is being updated", upToDate.Message)
+	}
+	return Report{Conditions: []Condition{c}}, nil
+}
+
+// ApplicationsSource reads the Argo Applications generated for every edge location. Applications are named
+// service-<service>-at-<location> by the ApplicationSet.
+type ApplicationsSource struct {
+	Client dynamic.Interface
+}
+
+func (s *ApplicationsSource) Name() string {
+	return "application"
+}
+
+func (s *ApplicationsSource) Collect(ctx context.Context, target Target) (Report, error) {
+	list, err := s.Client.Resource(ApplicationGVR).Namespace(target.Namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return Report{}, fmt.Errorf("failed to list applications: %w", err)
+	}
+
+	apps := []unstructured.Unstructured{}
+	for _, app := range list.Items {
+		for _, owner := range app.GetOwnerReferences() {
+			if owner.Kind == "ApplicationSet" && owner.Name == target.Name {
+				apps = append(apps, app)
+			}
+		}
+	}
+	sort.Slice(apps, func(i, j int) bool { return apps[i].GetName() < apps[j].GetName() })
+
+	if len(apps) == 0 {
+		return Report{Conditions: []Condition{{
+			Source:  s.Name(),
+			Type:    "Deployed",
+			Phase:   PhasePending,
+			Reason:  "NoLocations",
+			Message: "the service is not deployed to any location yet",
+		}}}, nil
+	}
+
+	report := Report{}
+	phase, ready := PhaseReady, 0
+	for i := range apps {
+		app := &apps[i]
+		location := LocationStatus{Location: strings.TrimPrefix(app.GetName(), "service-"+target.Name+"-at-")}
+		location.Phase, location.Message = applicationPhase(app)
+		location.Ready = location.Phase == PhaseReady
+		if location.Ready {
+			ready++
+		}
+		phase = worst(phase, location.Phase)
+		report.Locations = append(report.Locations, location)
+
+		// Application conditions are only set for errors and warnings, such as failing syncs
+		for _, c := range conditions(app) {
+			conditionPhase := PhaseDegraded
+			if strings.HasSuffix(c.Type, "Warning") {
+				conditionPhase = PhaseReady
+			}
+			report.Conditions = append(report.Conditions, Condition{
+				Source:             s.Name(),
+				Type:               c.Type,
+				Phase:              conditionPhase,
+				Reason:             c.Type,
+				Message:            c.Message,
+				Location:           location.Location,
+				LastTransitionTime: c.LastTransitionTime,
+			})
+		}
+	}
+
+	report.Conditions = append([]Condition{{
+		Source:  s.Name(),
+		Type:    "Deployed",
+		Phase:   phase,
+		Reason:  string(phase),
+		Message: fmt.Sprintf("the service is ready on %d of %d locations", ready, len(apps)),
+	}}, report.Conditions...)
+	return report, nil
+}
+
+// applicationPhase maps the Argo health and sync status of an application to a phase
+func applicationPhase(app *unstructured.Unstructured) (Phase, string) {
+	health, _, _ := unstructured.NestedString(app.Object, "status", "health", "status")
+	healthMessage, _, _ := unstructured.NestedString(app.Object, "status", "health", "message")
+	sync, _, _ := unstructured.NestedString(app.Object, "status", "sync", "status")
+	operation, _, _ := unstructured.NestedString(app.Object, "status", "operationState", "phase")
+	operationMessage, _, _ := unstructured.NestedString(app.Object, "status", "operationState", "message")
+
+	switch {
+	case operation == "Failed" || operation == "Error":
+		return PhaseDegraded, withDetail("the last rollout failed", operationMessage)
+	case health == "Degraded":
+		return PhaseDegraded, withDetail("the service is unhealthy", healthMessage)
+	case health == "Missing":
+		return PhaseDegraded, withDetail("the service resources are missing", healthMessage)
+	case health == "Progressing" || operation == "Running":
+		return PhaseProgressing, withDetail("the service is being rolled out", healthMessage)
+	case health == "Suspended":
+		return PhaseProgressing, "the rollout is suspended"
+	case health == "Healthy" && sync == "OutOfSync":
+		return PhaseProgressing, "a configuration change is waiting to be rolled out"
+	case health == "Healthy":
+		return PhaseReady, ""
+	default:
+		return PhaseUnknown, "the health of the location is not known yet"
+	}
+}
@@ -0,0 +1,273 @@
+// Package rules compiles the header and redirect rules of a service.
+//
+// Header rules run in order. Request header rules set, append or remove headers before the request is sent
+// to the origin, response header rules set or remove headers before the response reaches the client.
+// Redirects are matched in order against the request path, the first match wins. A source is a RE2 regular
+// expression matched against the whole path, the destination may reference its capture groups as $1 or ${name}.
+package rules
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+type HeaderAction string
+
+const (
+	HeaderSet    HeaderAction = "set"
+	HeaderAppend HeaderAction = "append"
+	HeaderRemove HeaderAction = "remove"
+)
+
+const maxRules = 50
+
+var redirectStatusCodes = []int{http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther, http.StatusTemporaryRedirect, http.StatusPermanentRedirect}
+
+// Hop-by-hop and framing headers are owned by the edge
+var protectedHeaders = []string{"Connection", "Content-Length", "Host", "Keep-Alive", "Proxy-Connection", "Te", "Trailer", "Transfer-Encoding", "Upgrade"}
+
+var headerNamePattern = regexp.MustCompile("^[!#$%&'*+.^_`|~0-9A-Za-z-]+$")
+
+// Matches $1, ${1} and ${name} in redirect destinations
+var referencePattern = regexp.MustCompile(`\$(\d+|\{[A-Za-z0-9_]+\})`)
+
+type HeaderRule struct {
+	Action HeaderAction `json:"action"`
+	Name   string       `json:"name"`
+	Value  string       `json:"value,omitempty"`
+}
+
+type Redirect struct {
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+	StatusCode  int    `json:"statusCode"`
+}
+
+type Set struct {
+	RequestHeaders  []HeaderRule `json:"requestHeaders,omitempty"`
+	ResponseHeaders []HeaderRule `json:"responseHeaders,omitempty"`
+	Redirects       []Redirect   `json:"redirects,omitempty"`
+	// ForceHTTPS redirects plain HTTP requests to HTTPS before any other redirect applies
+	ForceHTTPS bool `json:"forceHttps,omitempty"`
+	// ForceHTTPSStatusCode defaults to 301
+	ForceHTTPSStatusCode int `json:"forceHttpsStatusCode,omitempty"`
+}
+
+type compiledRedirect struct {
+	Redirect
+	source *regexp.Regexp
+	// template is the destination with every reference braced, regexp treats $1x as ${1x}
+	template string
+}
+
+// Compiled is a validated rule set ready to be applied
+type Compiled struct {
+	set       Set
+	redirects []compiledRedirect
+}
+
+// Compile validates a rule set. Errors are keyed by the JSON path of the offending field, e.g. redirects[1].source.
+func Compile(set Set) (*Compiled, map[string]string) {
+	errs := map[string]string{}
+
+	compileHeaders(errs, "requestHeaders", set.RequestHeaders, []HeaderAction{HeaderSet, HeaderAppend, HeaderRemove})
+	compileHeaders(errs, "responseHeaders", set.ResponseHeaders, []HeaderAction{HeaderSet, HeaderRemove})
+
+	if set.ForceHTTPSStatusCode != 0 && !slices.Contains(redirectStatusCodes, set.ForceHTTPSStatusCode) {
+		errs["forceHttpsStatusCode"] = fmt.Sprintf("must be one of %v", redirectStatusCodes)
+	}
+	if set.ForceHTTPSStatusCode != 0 && !set.ForceHTTPS {
+		errs["forceHttpsStatusCode"] = "only applies when forceHttps is enabled"
+	}
+
+	compiled := &Compiled{set: set}
+	if len(set.Redirects) > maxRules {
+		errs["redirects"] = fmt.Sprintf("at most %d redirects are allowed", maxRules)
+	} else {
+		compiled.redirects = compileRedirects(errs, set.Redirects)
+	}
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return compiled, nil
+}
+
+func compileHeaders(errs map[string]string, prefix string, headers []HeaderRule, actions []HeaderAction) {
+	if len(headers) > maxRules {
+		errs[prefix] = fmt.Sprintf("at most %d header rules are allowed", maxRules)
+		return
+	}
+
+	// Last action per canonical header name, to detect rules that cancel each other out
+	last := map[string]HeaderAction{}
+	for i, rule := range headers {
+		field := func(name string) string { return fmt.Sprintf("%s[%d].%s", prefix, i, name) }
+
+		if !slices.Contains(actions, rule.Action) {
+			errs[field("action")] = fmt.Sprintf("unknown action %q, must be one of %v", rule.Action, actions)
+			continue
+		}
+
+		if !headerNamePattern.MatchString(rule.Name) {
+			errs[field("name")] = fmt.Sprintf("invalid header name %q", rule.Name)
+			continue
+		}
+		name := http.CanonicalHeaderKey(rule.Name)
+		if slices.Contains(protectedHeaders, name) {
+			errs[field("name")] = fmt.Sprintf("header %s can not be modified", name)
+			continue
+		}
+
+		switch {
+		case rule.Action == HeaderRemove && rule.Value != "":
+			errs[field("value")] = "must be empty when removing a header"
+		case rule.Action != HeaderRemove && rule.Value == "":
+			errs[field("value")] = "is required"
+		case strings.ContainsAny(rule.Value, "\r\n\x00"):
+			errs[field("value")] = "must not contain line breaks"
+		}
+
+		previous, seen := last[name]
+		switch {
+		case seen && rule.Action == HeaderSet:
+			errs[field("action")] = fmt.Sprintf("overrides an earlier %s rule for %s", previous, name)
+		case seen && rule.Action == HeaderRemove:
+			errs[field("action")] = fmt.Sprintf("removes %s after an earlier %s rule", name, previous)
+		case previous == HeaderRemove && rule.Action == HeaderAppend:
+			errs[field("action")] = fmt.Sprintf("appends to %s after it was removed, use set instead", name)
+		}
+		last[name] = rule.Action
+	}
+}
+
+func compileRedirects(errs map[string]string, redirects []Redirect) []compiledRedirect {
+	compiled := []compiledRedirect{}
+	sources := map[string]int{}
+	for i, redirect := range redirects {
+		field := func(name string) string { return fmt.Sprintf("redirects[%d].%s", i, name) }
+
+		if !slices.Contains(redirectStatusCodes, redirect.StatusCode) {
+			errs[field("statusCode")] = fmt.Sprintf("must be one of %v", redirectStatusCodes)
+		}
+
+		if j, ok := sources[redirect.Source]; ok {
+			errs[field("source")] = fmt.Sprintf("never matches, redirects[%d] has the same source", j)
+			continue
+		}
+		sources[redirect.Source] = i
+
+		source, err := regexp.Compile("^(?:" + redirect.Source + ")$")
+		if redirect.Source == "" || err != nil {
+			errs[field("source")] = fmt.Sprintf("invalid regular expression %q", redirect.Source)
+			continue
+		}
+
+		if msg := validateDestination(source, redirect.Destination); msg != "" {
+			errs[field("destination")] = msg
+			continue
+		}
+
+		// A destination without captures that matches its own source redirects forever
+		if !referencePattern.MatchString(redirect.Destination) && strings.HasPrefix(redirect.Destination, "/") && source.MatchString(pathOf(redirect.Destination)) {
+			errs[field("destination")] = "matches its own source and would redirect in a loop"
+			continue
+		}
+
+		template := referencePattern.ReplaceAllStringFunc(redirect.Destination, func(ref string) string {
+			return "${" + strings.Trim(ref[1:], "{}") + "}"
+		})
+		compiled = append(compiled, compiledRedirect{Redirect: redirect, source: source, template: template})
+	}
+	return compiled
+}
+
+func validateDestination(source *regexp.Regexp, destination string) string {
+	if destination == "" {
+		return "is required"
+	}
+	if strings.ContainsAny(destination, "\r\n\x00") {
+		return "must not contain line breaks"
+	}
+	if !strings.HasPrefix(destination, "/") {
+		u, err := url.Parse(referencePattern.ReplaceAllString(destination, "x"))
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return "must be a path or an absolute http(s) URL"
+		}
+	}
+
+	for _, match := range referencePattern.FindAllStringSubmatch(destination, -1) {
+		ref := strings.Trim(match[1], "{}")
+		if n, err := strconv.Atoi(ref); err == nil {
+			if n > source.NumSubexp() {
+				return fmt.Sprintf("references group $%d but the source only has %d", n, source.NumSubexp())
+			}
+			continue
+		}
+		if source.SubexpIndex(ref) < 0 {
+			return fmt.Sprintf("references unknown group ${%s}", ref)
+		}
+	}
+	return ""
+}
+
+func pathOf(destination string) string {
+	if i := strings.IndexAny(destination, "?#"); i >= 0 {
+		return destination[:i]
+	}
+	return destination
+}
+
+// Set returns the rules the compiled set was built from
+func (c *Compiled) Set() Set {
+	return c.set
+}
+
+// Redirect returns where a request has to be redirected to, if any rule matches
+func (c *Compiled) Redirect(scheme string, host string, path string) (string, int, bool) {
+	if c.set.ForceHTTPS && scheme == "http" {
+		status := c.set.ForceHTTPSStatusCode
+		if status == 0 {
+			status = http.StatusMovedPermanently
+		}
+		return "https://" + host + path, status, true
+	}
+
+	for _, redirect := range c.redirects {
+		match := redirect.source.FindStringSubmatchIndex(path)
+		if match == nil {
+			continue
+		}
+		destination := redirect.source.ExpandString(nil, redirect.template, path, match)
+		return string(destination), redirect.StatusCode, true
+	}
+	return "", 0, false
+}
+
+// ApplyRequestHeaders modifies the headers sent to the origin
+func (c *Compiled) ApplyRequestHeaders(header http.Header) {
+	applyHeaders(header, c.set.RequestHeaders)
+}
+
+// ApplyResponseHeaders modifies the headers sent to the client
+func (c *Compiled) ApplyResponseHeaders(header http.Header) {
+	applyHeaders(header, c.set.ResponseHeaders)
+}
+
+func applyHeaders(header http.Header, rules []HeaderRule) {
+	for _, rule := range rules {
+		switch rule.Action {
+		case HeaderSet:
+			header.Set(rule.Name, rule.Value)
+		case HeaderAppend:
+			header.Add(rule.Name, rule.Value)
+		case HeaderRemove:
+			header.Del(rule.Name)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package rules
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestCompileHeaderRules(t *testing.T) {
+	compiled, errs := Compile(Set{
+		RequestHeaders: []HeaderRule{
+			{Action: HeaderRemove, Name: "Cookie"},
+			{Action: HeaderSet, Name: "x-forwarded-proto", Value: "https"},
+			{Action: HeaderAppend, Name: "X-Forwarded-Proto", Value: "edge"},
+		},
+		ResponseHeaders: []HeaderRule{
+			{Action: HeaderSet, Name: "Strict-Transport-Security", Value: "max-age=31536000"},
+			{Action: HeaderSet, Name: "Access-Control-Allow-Origin", Value: "*"},
+			{Action: HeaderRemove, Name: "Server"},
+		},
+	})
+	if len(errs) > 0 {
+		t.Fatalf("expected no errors, got %#v", errs)
+	}
+
+	request := http.Header{"Cookie": {"session=1"}, "Accept": {"*/*"}}
+	compiled.ApplyRequestHeaders(request)
+	if request.Get("Cookie") != "" || request.Values("X-Forwarded-Proto")[1] != "edge" || request.Get("Accept") != "*/*" {
+		t.Fatalf("unexpected request headers %#v", request)
+	}
+
+	response := http.Header{"Server": {"nginx"}}
+	compiled.ApplyResponseHeaders(response)
+	if response.Get("Server") != "" || response.Get("Strict-Transport-Security") == "" {
+		t.Fatalf("unexpected response headers %#v", response)
+	}
+}
+
+func TestCompileRejectsInvalidAndConflictingHeaderRules(t *testing.T) {
+	_, errs := Compile(Set{
+		RequestHeaders: []HeaderRule{
+			{Action: "rename", Name: "X-A"},
+			{Action: HeaderSet, Name: "Bad Header", Value: "x"},
+			{Action: HeaderSet, Name: "Host", Value: "example.com"},
+			{Action: HeaderRemove, Name: "X-B", Value: "x"},
+			{Action: HeaderSet, Name: "X-C", Value: "a\r\nInjected: yes"},
+			{Action: HeaderSet, Name: "X-D", Value: "1"},
+			{Action: HeaderSet, Name: "x-d", Value: "2"},
+			{Action: HeaderRemove, Name: "X-E"},
+			{Action: HeaderAppend, Name: "X-E", Value: "1"},
+		},
+		ResponseHeaders: []HeaderRule{
+			{Action: HeaderAppend, Name: "X-F", Value: "1"},
+			{Action: HeaderSet, Name: "X-G", Value: "1"},
+			{Action: HeaderRemove, Name: "X-G"},
+		},
+	})
+
+	for _, field := range []string{
+		"requestHeaders[0].action",
+		"requestHeaders[1].name",
+		"requestHeaders[2].name",
+		"requestHeaders[3].value",
+		"requestHeaders[4].value",
+		"requestHeaders[6].action",
+		"requestHeaders[8].action",
+		"responseHeaders[0].action",
+		"responseHeaders[2].action",
+	} {
+		if _, ok := errs[field]; !ok {
+			t.Fatalf("expected error for %s, got %#v", field, errs)
+		}
+	}
+	if len(errs) != 9 {
+		t.Fatalf("unexpected errors %#v", errs)
+	}
+}
+
+func TestCompileRedirects(t *testing.T) {
+	compiled, errs := Compile(Set{
+		ForceHTTPS: true,
+		Redirects: []Redirect{
+			{Source: `/blog/(\d+)/(?P<slug>[a-z-]+)`, Destination: "/articles/${slug}-$1x", StatusCode: 301},
+			{Source: `/old(/.*)?`, Destination: "https://new.example.com$1", StatusCode: 308},
+			{Source: `/docs`, Destination: "/docs/", StatusCode: 302},
+		},
+	})
+	if len(errs) > 0 {
+		t.Fatalf("expected no errors, got %#v", errs)
+	}
+
+	for _, tc := range []struct {
+		scheme, path, destination string
+		status                    int
+	}{
+		{"http", "/anything", "https://cdn.example.com/anything", 301},
+		{"https", "/blog/42/hello-world", "/articles/hello-world-42x", 301},
+		{"https", "/old/a/b?c", "https://new.example.com/a/b?c", 308},
+		{"https", "/docs", "/docs/", 302},
+	} {
+		destination, status, ok := compiled.Redirect(tc.scheme, "cdn.example.com", tc.path)
+		if !ok || destination != tc.destination || status != tc.status {
+			t.Fatalf("%s: unexpected redirect %q %d %v", tc.path, destination, status, ok)
+		}
+	}
+
+	// Sources match the whole path
+	if _, _, ok := compiled.Redirect("https", "cdn.example.com", "/docs/intro"); ok {
+		t.Fatal("expected no redirect")
+	}
+}
+
+func TestCompileRejectsInvalidRedirects(t *testing.T) {
+	_, errs := Compile(Set{
+		ForceHTTPSStatusCode: 308,
+		Redirects: []Redirect{
+			{Source: `/a(`, Destination: "/b", StatusCode: 301},
+			{Source: `/c`, Destination: "/d", StatusCode: 200},
+			{Source: `/e/(.*)`, Destination: "/f/$2", StatusCode: 301},
+			{Source: `/g/(.*)`, Destination: "/h/${name}", StatusCode: 301},
+			{Source: `/i.*`, Destination: "/index", StatusCode: 301},
+			{Source: `/c`, Destination: "/x", StatusCode: 301},
+			{Source: `/j`, Destination: "ftp://example.com/j", StatusCode: 301},
+		},
+	})
+
+	for _, field := range []string{
+		"forceHttpsStatusCode",
+		"redirects[0].source",
+		"redirects[1].statusCode",
+		"redirects[2].destination",
+		"redirects[3].destination",
+		"redirects[4].destination",
+		"redirects[5].source",
+		"redirects[6].destination",
+	} {
+		if _, ok := errs[field]; !ok {
+			t.Fatalf("expected error for %s, got %#v", field, errs)
+		}
+	}
+	if len(errs) != 8 {
+		t.Fatalf("unexpected errors %#v", errs)
+	}
+}
@@ -0,0 +1,88 @@
+package signing
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+)
+
+const testKey = "0123456789abcdef0123456789abcdef"
+
+func keys(name string) (string, bool) {
+	if name == "key1" {
+		return testKey, true
+	}
+	return "", false
+}
+
+func mustParse(t *testing.T, raw string) *url.URL {
+	t.Helper()
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	return u
+}
+
+// Pins the scheme so changes that would break URLs validated at the edge are noticed
+func TestSignatureIsStable(t *testing.T) {
+	got := Signature(testKey, Params{Path: "/videos/intro.mp4", Expires: time.Unix(1767225600, 0), KeyName: "key1", ClientIP: "192.0.2.1"})
+	if got != "wmWd6BNCUxv2rG9WU-_ucg6DZBNOysXfd_PTHmyA9r8" {
+		t.Fatalf("unexpected signature %q", got)
+	}
+}
+
+func TestSignAndVerify(t *testing.T) {
+	now := time.Unix(1767225600, 0)
+	signed := SignURL(mustParse(t, "https://cdn.example.com/videos/a%20b.mp4?quality=hd"), testKey, Params{Expires: now.Add(time.Hour), KeyName: "key1"})
+
+	if signed.Query().Get("quality") != "hd" {
+		t.Fatalf("expected existing query parameters to be kept, got %s", signed)
+	}
+
+	p, err := Verify(signed, "198.51.100.7", now, keys)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if p.Path != "/videos/a%20b.mp4" || p.KeyName != "key1" || !p.Expires.Equal(now.Add(time.Hour)) {
+		t.Fatalf("unexpected params %#v", p)
+	}
+
+	if _, err := Verify(signed, "", now.Add(2*time.Hour), keys); !errors.Is(err, ErrExpired) {
+		t.Fatalf("expected expired error, got %v", err)
+	}
+
+	tampered := *signed
+	tampered.Path = "/videos/other.mp4"
+	if _, err := Verify(&tampered, "", now, keys); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("expected invalid signature, got %v", err)
+	}
+
+	if _, err := Verify(mustParse(t, "https://cdn.example.com/videos/a.mp4"), "", now, keys); !errors.Is(err, ErrMalformed) {
+		t.Fatalf("expected malformed error, got %v", err)
+	}
+}
+
+func TestVerifyClientBoundURL(t *testing.T) {
+	now := time.Unix(1767225600, 0)
+	signed := SignURL(mustParse(t, "https://cdn.example.com/a.mp4"), testKey, Params{Expires: now.Add(time.Hour), KeyName: "key1", ClientIP: "192.0.2.1"})
+
+	p, err := Verify(signed, "192.0.2.1", now, keys)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if p.ClientIP != "192.0.2.1" {
+		t.Fatalf("unexpected client IP %q", p.ClientIP)
+	}
+
+	if _, err := Verify(signed, "192.0.2.2", now, keys); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("expected invalid signature for other client, got %v", err)
+	}
+
+	unknown := SignURL(mustParse(t, "https://cdn.example.com/a.mp4"), testKey, Params{Expires: now.Add(time.Hour), KeyName: "key2"})
+	if _, err := Verify(unknown, "", now, keys); !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("expected unknown key error, got %v", err)
+	}
+}
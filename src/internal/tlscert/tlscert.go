@@ -0,0 +1,121 @@
+// Package tlscert validates certificates uploaded by tenants before they are stored.
+//
+// A bundle is a PEM chain starting with the leaf certificate, followed by the intermediates in the order they
+// were issued, and the PEM private key of the leaf. The root may be included but is not required.
+package tlscert
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"time"
+)
+
+// Bundle is a parsed and validated certificate chain with its key
+type Bundle struct {
+	// Chain starts with the leaf
+	Chain []*x509.Certificate
+	// CertificatePEM and KeyPEM are re-encoded without anything but the certificate and key blocks
+	CertificatePEM []byte
+	KeyPEM         []byte
+}
+
+// Info describes a certificate without its key
+type Info struct {
+	Subject     string    `json:"subject"`
+	Issuer      string    `json:"issuer"`
+	DNSNames    []string  `json:"dnsNames"`
+	NotBefore   time.Time `json:"notBefore"`
+	NotAfter    time.Time `json:"notAfter"`
+	Fingerprint string    `json:"fingerprint"`
+}
+
+// Parse decodes a chain and its key and checks that the key belongs to the leaf, that every certificate is
+// issued by the next one and that none of them is expired or not yet valid at now.
+func Parse(chainPEM []byte, keyPEM []byte, now time.Time) (*Bundle, error) {
+	bundle := &Bundle{}
+
+	rest := chainPEM
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			return nil, fmt.Errorf("unexpected %s block in the certificate chain", block.Type)
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("certificate %d can not be parsed: %w", len(bundle.Chain), err)
+		}
+		bundle.Chain = append(bundle.Chain, cert)
+		bundle.CertificatePEM = append(bundle.CertificatePEM, pem.EncodeToMemory(block)...)
+	}
+	if len(bundle.Chain) == 0 {
+		return nil, fmt.Errorf("no PEM encoded certificate found")
+	}
+
+	keyBlock, _ := pem.Decode(keyPEM)
+	if keyBlock == nil {
+		return nil, fmt.Errorf("no PEM encoded private key found")
+	}
+	bundle.KeyPEM = pem.EncodeToMemory(keyBlock)
+
+	// X509KeyPair checks the key against the first certificate, which has to be the leaf
+	if _, err := tls.X509KeyPair(bundle.CertificatePEM, bundle.KeyPEM); err != nil {
+		return nil, fmt.Errorf("private key does not match the certificate: %w", err)
+	}
+
+	for i, cert := range bundle.Chain {
+		if now.Before(cert.NotBefore) {
+			return nil, fmt.Errorf("certificate %d (%s) is not valid before %s", i, cert.Subject, cert.NotBefore.UTC().Format(time.RFC3339))
+		}
+		if now.After(cert.NotAfter) {
+			return nil, fmt.Errorf("certificate %d (%s) expired at %s", i, cert.Subject, cert.NotAfter.UTC().Format(time.RFC3339))
+		}
+		if i == 0 {
+			continue
+		}
+		if err := bundle.Chain[i-1].CheckSignatureFrom(cert); err != nil {
+			return nil, fmt.Errorf("certificate %d (%s) is not issued by certificate %d (%s), list the leaf first followed by its issuers", i-1, bundle.Chain[i-1].Subject, i, cert.Subject)
+		}
+	}
+
+	return bundle, nil
+}
+
+// Leaf returns the certificate served to clients
+func (b *Bundle) Leaf() *x509.Certificate {
+	return b.Chain[0]
+}
+
+// Covers reports whether the leaf is valid for the hostname, including wildcard names
+func (b *Bundle) Covers(hostname string) bool {
+	return b.Leaf().VerifyHostname(hostname) == nil
+}
+
+// Describe returns the details of a certificate
+func Describe(cert *x509.Certificate) Info {
+	sum := sha256.Sum256(cert.Raw)
+	return Info{
+		Subject:     cert.Subject.String(),
+		Issuer:      cert.Issuer.String(),
+		DNSNames:    cert.DNSNames,
+		NotBefore:   cert.NotBefore.UTC(),
+		NotAfter:    cert.NotAfter.UTC(),
+		Fingerprint: hex.EncodeToString(sum[:]),
+	}
+}
+
+// ParseLeaf reads the first certificate of a PEM chain, as stored in the tls.crt key of a TLS secret
+func ParseLeaf(chainPEM []byte) (*x509.Certificate, error) {
+	block, _ := pem.Decode(chainPEM)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("no PEM encoded certificate found")
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
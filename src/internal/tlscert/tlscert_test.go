@@ -0,0 +1,124 @@
+package tlscert
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func (c testCert) keyPEM(t *testing.T) []byte {
+	der, err := x509.MarshalPKCS8PrivateKey(c.key)
+	if err != nil {
+		t.Fatalf("failed to encode key: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+}
+
+// issue creates a certificate signed by parent, or a self-signed one when parent is nil
+func issue(t *testing.T, name string, parent *testCert, notAfter time.Time, dnsNames ...string) testCert {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              notAfter,
+		DNSNames:              dnsNames,
+		IsCA:                  len(dnsNames) == 0,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+	}
+
+	signer, signerKey := template, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("failed to parse certificate: %v", err)
+	}
+	return testCert{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+func TestParseValidatesChain(t *testing.T) {
+	year := time.Now().Add(365 * 24 * time.Hour)
+	root := issue(t, "Root", nil, year)
+	intermediate := issue(t, "Intermediate", &root, year)
+	leaf := issue(t, "www.example.com", &intermediate, year, "www.example.com", "*.static.example.com")
+
+	bundle, err := Parse(bytes.Join([][]byte{leaf.pem, intermediate.pem, root.pem}, nil), leaf.keyPEM(t), time.Now())
+	if err != nil {
+		t.Fatalf("expected a valid bundle, got %v", err)
+	}
+	if len(bundle.Chain) != 3 || !bundle.Covers("www.example.com") || !bundle.Covers("img.static.example.com") || bundle.Covers("example.com") {
+		t.Fatalf("unexpected bundle %#v", Describe(bundle.Leaf()))
+	}
+
+	info := Describe(bundle.Leaf())
+	if info.Subject != "CN=www.example.com" || info.Issuer != "CN=Intermediate" || len(info.Fingerprint) != 64 {
+		t.Fatalf("unexpected info %#v", info)
+	}
+}
+
+func TestParseRejectsInvalidBundles(t *testing.T) {
+	year := time.Now().Add(365 * 24 * time.Hour)
+	root := issue(t, "Root", nil, year)
+	intermediate := issue(t, "Intermediate", &root, year)
+	leaf := issue(t, "www.example.com", &intermediate, year, "www.example.com")
+	other := issue(t, "other.example.com", &intermediate, year, "other.example.com")
+	expired := issue(t, "old.example.com", &intermediate, time.Now().Add(-time.Minute), "old.example.com")
+
+	for name, tc := range map[string]struct {
+		chain [][]byte
+		key   []byte
+		err   string
+	}{
+		"no certificate":     {chain: nil, key: leaf.keyPEM(t), err: "no PEM encoded certificate"},
+		"no key":             {chain: [][]byte{leaf.pem}, key: []byte("garbage"), err: "no PEM encoded private key"},
+		"key mismatch":       {chain: [][]byte{leaf.pem, intermediate.pem}, key: other.keyPEM(t), err: "does not match"},
+		"wrong order":        {chain: [][]byte{leaf.pem, root.pem, intermediate.pem}, key: leaf.keyPEM(t), err: "is not issued by"},
+		"intermediate first": {chain: [][]byte{intermediate.pem, leaf.pem}, key: leaf.keyPEM(t), err: "does not match"},
+		"expired":            {chain: [][]byte{expired.pem, intermediate.pem}, key: expired.keyPEM(t), err: "expired"},
+		"key in chain":       {chain: [][]byte{leaf.pem, leaf.keyPEM(t)}, key: leaf.keyPEM(t), err: "unexpected PRIVATE KEY block"},
+	} {
+		_, err := Parse(bytes.Join(tc.chain, nil), tc.key, time.Now())
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Fatalf("%s: expected an error containing %q, got %v", name, tc.err, err)
+		}
+	}
+}
+
+func TestParseLeaf(t *testing.T) {
+	root := issue(t, "Root", nil, time.Now().Add(time.Hour))
+	leaf := issue(t, "www.example.com", &root, time.Now().Add(time.Hour), "www.example.com")
+
+	cert, err := ParseLeaf(append(leaf.pem, root.pem...))
+	if err != nil || cert.Subject.CommonName != "www.example.com" {
+		t.Fatalf("unexpected leaf %v, %v", cert, err)
+	}
+	if _, err := ParseLeaf([]byte("not pem")); err == nil {
+		t.Fatal("expected an error for invalid input")
+	}
+}
@@ -0,0 +1,148 @@
+package watch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrOverflow ends a stream whose subscriber fell behind, the client should reconnect with its last event ID
+	ErrOverflow = errors.New("subscriber fell behind")
+	// ErrClosed ends a stream whose subscription was closed by the hub owner
+	ErrClosed = errors.New("stream closed")
+)
+
+type StreamOptions struct {
+	// Heartbeat is the interval of comment lines keeping idle connections and proxies alive
+	Heartbeat time.Duration
+	// Authorize is checked before each heartbeat and batch of events. The stream ends with an error event
+	// once it fails, so revoked permissions take effect on open connections.
+	Authorize func() error
+}
+
+// WriteEvent encodes an event in the SSE wire format with its data as JSON
+func WriteEvent(w io.Writer, event Event) error {
+	data, err := json.Marshal(event.Data)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+
+	var b strings.Builder
+	if event.ID != "" {
+		b.WriteString("id: " + event.ID + "\n")
+	}
+	if event.Type != "" {
+		b.WriteString("event: " + event.Type + "\n")
+	}
+	b.WriteString("data: " + string(data) + "\n\n")
+
+	_, err = io.WriteString(w, b.String())
+	return err
+}
+
+// LastEventID returns the ID a client resumes from, sent by browsers as Last-Event-ID on reconnects or
+// passed explicitly as the resourceVersion query parameter
+func LastEventID(r *http.Request) string {
+	if id := r.Header.Get("Last-Event-ID"); id != "" {
+		return id
+	}
+	return r.URL.Query().Get("resourceVersion")
+}
+
+// Serve streams the initial events followed by the events of the subscription until the client disconnects,
+// the subscription is closed or authorization fails. The caller still has to unsubscribe.
+func Serve(ctx context.Context, w http.ResponseWriter, sub *Subscription, initial []Event, opts StreamOptions) error {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return fmt.Errorf("streaming is not supported by the response writer")
+	}
+
+	header := w.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+	// Disables response buffering in nginx based ingresses
+	header.Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	authorize := func() error {
+		if opts.Authorize == nil {
+			return nil
+		}
+		if err := opts.Authorize(); err != nil {
+			_ = WriteEvent(w, Event{Type: "error", Data: map[string]string{"error": err.Error()}})
+			flusher.Flush()
+			return err
+		}
+		return nil
+	}
+
+	if err := authorize(); err != nil {
+		return err
+	}
+	for _, event := range initial {
+		if err := WriteEvent(w, event); err != nil {
+			return err
+		}
+	}
+	flusher.Flush()
+
+	heartbeat := opts.Heartbeat
+	if heartbeat <= 0 {
+		heartbeat = 15 * time.Second
+	}
+	ticker := time.NewTicker(heartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if err := authorize(); err != nil {
+				return err
+			}
+			if _, err := io.WriteString(w, ": heartbeat\n\n"); err != nil {
+				return err
+			}
+			flusher.Flush()
+		case event, ok := <-sub.Events():
+			if !ok {
+				if sub.Overflowed() {
+					_ = WriteEvent(w, Event{Type: "overflow", Data: map[string]string{"error": "too many undelivered events, reconnect with the last event id"}})
+					flusher.Flush()
+					return ErrOverflow
+				}
+				return ErrClosed
+			}
+			if err := authorize(); err != nil {
+				return err
+			}
+			if err := WriteEvent(w, event); err != nil {
+				return err
+			}
+			// Drain what is already buffered before flushing
+			for drained := false; !drained; {
+				select {
+				case event, ok := <-sub.Events():
+					if !ok {
+						drained = true
+						continue
+					}
+					if err := WriteEvent(w, event); err != nil {
+						return err
+					}
+				default:
+					drained = true
+				}
+			}
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,161 @@
+// Package watch fans out change events to long lived client connections streamed as Server-Sent Events.
+//
+// A Hub keeps a bounded history of recent events so a client reconnecting with the ID of the last event it
+// received only misses nothing that is still in the history. Every subscription has its own bounded buffer,
+// a subscriber falling behind is disconnected instead of slowing down the publisher or growing memory.
+package watch
+
+import (
+	"sync"
+)
+
+// Event is one change pushed to subscribers
+type Event struct {
+	// ID is sent as the SSE event id, usually the resourceVersion of the changed object. Clients pass it back
+	// to resume the stream.
+	ID string
+	// Type is sent as the SSE event name
+	Type string
+	// Scope is matched by subscription filters, for example the project of the changed object
+	Scope string
+	Data  any
+}
+
+// Filter selects the events a subscription receives
+type Filter func(Event) bool
+
+type Subscription struct {
+	events chan Event
+	filter Filter
+
+	mu       sync.Mutex
+	overflow bool
+}
+
+// Events delivers the events of the subscription. It is closed when the subscriber fell behind by more than
+// the buffer size or was unsubscribed.
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Overflowed reports whether the subscription was closed because its buffer was full
+func (s *Subscription) Overflowed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.overflow
+}
+
+type Hub struct {
+	historySize int
+	bufferSize  int
+
+	mu          sync.Mutex
+	history     []Event
+	subscribers map[*Subscription]struct{}
+}
+
+// NewHub creates a hub remembering historySize events for resumption, each subscriber may have up to
+// bufferSize undelivered events.
+func NewHub(historySize int, bufferSize int) *Hub {
+	return &Hub{
+		historySize: historySize,
+		bufferSize:  bufferSize,
+		subscribers: map[*Subscription]struct{}{},
+	}
+}
+
+// Publish records an event and hands it to every matching subscriber without blocking
+func (h *Hub) Publish(event Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.historySize > 0 {
+		h.history = append(h.history, event)
+		if len(h.history) > h.historySize {
+			h.history = h.history[len(h.history)-h.historySize:]
+		}
+	}
+
+	for sub := range h.subscribers {
+		if sub.filter != nil && !sub.filter(event) {
+			continue
+		}
+		select {
+		case sub.events <- event:
+		default:
+			sub.mu.Lock()
+			sub.overflow = true
+			sub.mu.Unlock()
+			delete(h.subscribers, sub)
+			close(sub.events)
+		}
+	}
+}
+
+// Subscribe registers a subscriber. When lastID is found in the history, the matching events published after it
+// are returned for replay and resumed is true. Otherwise the caller has to send the full current state.
+// Subscribing happens before the state is read, events racing with it may be delivered twice but are never lost.
+func (h *Hub) Subscribe(lastID string, filter Filter) (sub *Subscription, replay []Event, resumed bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	sub = &Subscription{events: make(chan Event, h.bufferSize), filter: filter}
+	h.subscribers[sub] = struct{}{}
+
+	if lastID == "" {
+		return sub, nil, false
+	}
+	for i := len(h.history) - 1; i >= 0; i-- {
+		if h.history[i].ID != lastID {
+			continue
+		}
+		for _, event := range h.history[i+1:] {
+			if filter == nil || filter(event) {
+				replay = append(replay, event)
+			}
+		}
+		return sub, replay, true
+	}
+	return sub, nil, false
+}
+
+// Unsubscribe removes a subscriber and closes its channel, it is safe to call after an overflow
+func (h *Hub) Unsubscribe(sub *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.subscribers[sub]; ok {
+		delete(h.subscribers, sub)
+		close(sub.events)
+	}
+}
+
+// HasSubscribers reports whether anyone is listening, publishers use it to skip building expensive events
+func (h *Hub) HasSubscribers() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subscribers) > 0
+}
+
+// SkipIfIdle lets publishers skip building an event nobody would receive. When there are no subscribers it
+// forgets the history and returns true, the skipped event is then not covered by the history and clients
+// reconnecting with an earlier ID receive the full current state instead of an incomplete replay.
+func (h *Hub) SkipIfIdle() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.subscribers) > 0 {
+		return false
+	}
+	h.history = nil
+	return true
+}
+
+// Last returns the most recently published event
+func (h *Hub) Last() (Event, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.history) == 0 {
+		return Event{}, false
+	}
+	return h.history[len(h.history)-1], true
+}
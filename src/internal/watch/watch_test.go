@@ -0,0 +1,135 @@
+package watch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func ids(events []Event) string {
+	parts := []string{}
+	for _, event := range events {
+		parts = append(parts, event.ID)
+	}
+	return strings.Join(parts, ",")
+}
+
+func TestHubResumesFromHistory(t *testing.T) {
+	hub := NewHub(3, 10)
+	for i := 1; i <= 5; i++ {
+		hub.Publish(Event{ID: fmt.Sprint(i), Scope: []string{"a", "b"}[i%2]})
+	}
+
+	onlyB := func(event Event) bool { return event.Scope == "b" }
+	_, replay, resumed := hub.Subscribe("3", onlyB)
+	if !resumed || ids(replay) != "5" {
+		t.Fatalf("unexpected replay %q, resumed %v", ids(replay), resumed)
+	}
+
+	// Event 1 dropped out of the history
+	if _, _, resumed := hub.Subscribe("1", nil); resumed {
+		t.Fatal("expected resuming from an evicted event to fail")
+	}
+	if _, _, resumed := hub.Subscribe("", nil); resumed {
+		t.Fatal("expected a new subscription not to resume")
+	}
+	if last, ok := hub.Last(); !ok || last.ID != "5" {
+		t.Fatalf("unexpected last event %#v", last)
+	}
+}
+
+func TestHubSkipIfIdleForgetsHistory(t *testing.T) {
+	hub := NewHub(3, 10)
+	hub.Publish(Event{ID: "1"})
+
+	sub, _, _ := hub.Subscribe("", nil)
+	if hub.SkipIfIdle() {
+		t.Fatal("expected events not to be skipped while subscribed")
+	}
+	hub.Unsubscribe(sub)
+
+	if !hub.SkipIfIdle() {
+		t.Fatal("expected events to be skipped without subscribers")
+	}
+	if _, _, resumed := hub.Subscribe("1", nil); resumed {
+		t.Fatal("expected resuming across a skipped event to fail")
+	}
+}
+
+func TestHubDropsSlowSubscribers(t *testing.T) {
+	hub := NewHub(0, 2)
+	slow, _, _ := hub.Subscribe("", nil)
+	filtered, _, _ := hub.Subscribe("", func(event Event) bool { return event.Scope == "other" })
+
+	for i := 0; i < 3; i++ {
+		hub.Publish(Event{ID: fmt.Sprint(i)})
+	}
+
+	received := []Event{}
+	for event := range slow.Events() {
+		received = append(received, event)
+	}
+	if ids(received) != "0,1" || !slow.Overflowed() {
+		t.Fatalf("expected the subscriber to be dropped after its buffer filled, got %q", ids(received))
+	}
+	if filtered.Overflowed() || !hub.HasSubscribers() {
+		t.Fatal("expected the filtered subscriber to stay connected")
+	}
+
+	hub.Unsubscribe(slow)
+	hub.Unsubscribe(filtered)
+	if hub.HasSubscribers() {
+		t.Fatal("expected no subscribers to be left")
+	}
+}
+
+func TestServeStreamsEvents(t *testing.T) {
+	hub := NewHub(10, 10)
+	sub, _, _ := hub.Subscribe("", nil)
+	hub.Publish(Event{ID: "7", Type: "service", Data: map[string]string{"name": "web"}})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	recorder := httptest.NewRecorder()
+	done := make(chan error)
+	go func() {
+		done <- Serve(ctx, recorder, sub, []Event{{ID: "6", Type: "synced", Data: 1}}, StreamOptions{Heartbeat: 10 * time.Millisecond})
+	}()
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	body := recorder.Body.String()
+	if recorder.Header().Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("unexpected headers %v", recorder.Header())
+	}
+	want := "id: 6\nevent: synced\ndata: 1\n\nid: 7\nevent: service\ndata: {\"name\":\"web\"}\n\n"
+	if !strings.HasPrefix(body, want) || !strings.Contains(body, ": heartbeat\n\n") {
+		t.Fatalf("unexpected stream %q", body)
+	}
+}
+
+func TestServeEndsOnOverflowAndRevokedAccess(t *testing.T) {
+	hub := NewHub(0, 1)
+	sub, _, _ := hub.Subscribe("", nil)
+	hub.Publish(Event{ID: "1"})
+	hub.Publish(Event{ID: "2"})
+
+	recorder := httptest.NewRecorder()
+	err := Serve(context.Background(), recorder, sub, nil, StreamOptions{})
+	if !errors.Is(err, ErrOverflow) || !strings.Contains(recorder.Body.String(), "event: overflow") {
+		t.Fatalf("expected an overflow, got %v: %q", err, recorder.Body.String())
+	}
+
+	sub, _, _ = hub.Subscribe("", nil)
+	recorder = httptest.NewRecorder()
+	err = Serve(context.Background(), recorder, sub, []Event{{ID: "1"}}, StreamOptions{Authorize: func() error { return fmt.Errorf("forbidden") }})
+	if err == nil || strings.Contains(recorder.Body.String(), "id: 1") || !strings.Contains(recorder.Body.String(), `data: {"error":"forbidden"}`) {
+		t.Fatalf("expected the stream to be refused, got %v: %q", err, recorder.Body.String())
+	}
+}
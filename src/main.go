@@ -3,10 +3,12 @@ package main
 import (
 	"flag"
 	"strings"
+	"time"
 
 	"github.com/EdgeCDN-X/edgecdnx-api/src/config"
 	"github.com/EdgeCDN-X/edgecdnx-api/src/internal/logger"
 	"github.com/EdgeCDN-X/edgecdnx-api/src/modules/app"
+	"github.com/EdgeCDN-X/edgecdnx-api/src/modules/audit"
 	"github.com/EdgeCDN-X/edgecdnx-api/src/modules/auth"
 	"github.com/EdgeCDN-X/edgecdnx-api/src/modules/projects"
 	"github.com/gin-contrib/cors"
@@ -27,25 +29,62 @@ func main() {
 	cors_allowed_headers := flag.String("cors_allowed_headers", "Authorization,Content-Type", "Comma-separated list of allowed CORS headers")
 	service_base_domain := flag.String("service_base_domain", "democdn.edgecdnx.com", "Base domain for services")
 	default_admin_project := flag.String("default_admin_project", "admin", "Name of the default admin project to create if it doesn't exist")
-	default_admin_user := flag.String("default_admin_user", "admin@edgecdnx.com", "Email of the default admin user to create if it doesn't exist")
-	oidc_group_mappings := flag.String("oidc_group_mappings", "admin:admin:admin", "Comma-separated list of OIDC group to role mappings in the format oidc-group:tenant:group")
+	default_admin_user := flag.String("default_admin_user", "admin@edgecdnx.com", "Email of the default admin user to create if it doesn't exist, bound with the subject prefix of the first OIDC issuer unless it already carries one")
+	oidc_group_mappings := flag.String("oidc_group_mappings", "admin:admin:admin", "Comma-separated list of OIDC group to role mappings in the format oidc-group:tenant:group. Groups are prefixed with oidc_group_prefix, issuers with another group prefix list their mappings in group_mappings")
 	oidc_group_prefix := flag.String("oidc_group_prefix", "oidc-", "Prefix to add to OIDC groups when creating Casbin policies")
+	oidc_issuers := flag.String("oidc_issuers", "", "Semicolon-separated list of OIDC issuers, each a comma-separated list of issuer=<url>,client_ids=<id>|<id>,user_claim=<claim>,groups_claim=<claim>,group_prefix=<prefix>,subject_prefix=<prefix>,group_mappings=<oidc-group>:<tenant>:<group>|<oidc-group>:<tenant>:<group>. Falls back to OIDC_ISSUER_URL and OIDC_CLIENT_ID when empty")
+	audit_sinks := flag.String("audit_sinks", "zap", "Comma-separated list of audit log sinks: zap, events (Kubernetes Events on the changed object) and file")
+	audit_file := flag.String("audit_file", "", "Append-only JSONL file written by the file audit sink. Required to query the audit log")
+	key_rotation_grace_period := flag.Duration("key_rotation_grace_period", 24*time.Hour, "Default time a rotated secure key keeps validating signed URLs before it is removed")
+	key_reaper_interval := flag.Duration("key_reaper_interval", time.Minute, "Interval at which retired secure keys are removed from services, 0 disables the removal")
+	purge_port := flag.Int("purge_port", 80, "Port cache nodes accept PURGE requests on")
+	purge_timeout := flag.Duration("purge_timeout", 2*time.Minute, "Time a single location may take to purge before it is reported as failed")
+	purge_job_retention := flag.Duration("purge_job_retention", 24*time.Hour, "Time finished purge jobs can be polled for")
+	host_alias_check_interval := flag.Duration("host_alias_check_interval", 5*time.Minute, "Interval at which pending host aliases are verified through DNS, 0 disables the background verification")
+	host_alias_pending_ttl := flag.Duration("host_alias_pending_ttl", 7*24*time.Hour, "Time a host alias may stay unverified before it is removed, 0 keeps it until deleted")
+	watch_heartbeat_interval := flag.Duration("watch_heartbeat_interval", 15*time.Second, "Interval of keep-alive comments sent on idle watch streams")
+	watch_buffer_size := flag.Int("watch_buffer_size", 64, "Number of undelivered events after which a slow watch stream is disconnected")
+	location_health_interval := flag.Duration("location_health_interval", 30*time.Second, "Interval at which location health is queried from Prometheus while health streams are open")
+	personal_token_max_lifetime := flag.Duration("personal_token_max_lifetime", 90*24*time.Hour, "Maximum lifetime of personal API tokens, also applied to tokens created without an expiry")
+	controller_settings := flag.String("controller_settings", "", "Comma-separated list of service settings the deployed controller enforces: access, cache-rules, edge-rules and origin-settings. None of them is read by a released controller yet, settings not listed can only be cleared")
+	policy_resync_interval := flag.Duration("policy_resync_interval", 5*time.Minute, "Interval at which Casbin policies are rebuilt from the Project informer cache, 0 disables the resync")
 
 	flag.Parse()
 
+	issuers, err := config.ParseOIDCIssuers(*oidc_issuers, *auth_user_claim, *auth_groups_claim, *oidc_group_prefix)
+	if err != nil {
+		panic("invalid oidc_issuers: " + err.Error())
+	}
+
 	appcfg := config.AppConfig{
-		Production:          *production,
-		Listen:              *listen,
-		Namespace:           *namespace,
-		PrometheusEndpoint:  *prometheus_endpoint,
-		CorsAllowOrigins:    strings.Split(*cors_allow_origins, ","),
-		CorsAllowedMethods:  strings.Split(*cors_allowed_methods, ","),
-		CorsAllowedHeaders:  strings.Split(*cors_allowed_headers, ","),
-		ServiceBaseDomain:   *service_base_domain,
-		DefaultAdminProject: *default_admin_project,
-		DefaultAdminUser:    *default_admin_user,
-		OIDCGroupMappings:   config.ParseOIDCGroupMappings(*oidc_group_mappings, *oidc_group_prefix),
-		OIDCGroupPrefix:     *oidc_group_prefix,
+		Production:               *production,
+		Listen:                   *listen,
+		Namespace:                *namespace,
+		PrometheusEndpoint:       *prometheus_endpoint,
+		CorsAllowOrigins:         strings.Split(*cors_allow_origins, ","),
+		CorsAllowedMethods:       strings.Split(*cors_allowed_methods, ","),
+		CorsAllowedHeaders:       strings.Split(*cors_allowed_headers, ","),
+		ServiceBaseDomain:        *service_base_domain,
+		DefaultAdminProject:      *default_admin_project,
+		DefaultAdminUser:         *default_admin_user,
+		OIDCGroupMappings:        config.ParseOIDCGroupMappings(*oidc_group_mappings, *oidc_group_prefix),
+		OIDCGroupPrefix:          *oidc_group_prefix,
+		OIDCIssuers:              issuers,
+		PolicyResyncInterval:     *policy_resync_interval,
+		PersonalTokenMaxLifetime: *personal_token_max_lifetime,
+		AuditSinks:               strings.Split(*audit_sinks, ","),
+		AuditFile:                *audit_file,
+		KeyGracePeriod:           *key_rotation_grace_period,
+		KeyReaperInterval:        *key_reaper_interval,
+		PurgePort:                *purge_port,
+		PurgeTimeout:             *purge_timeout,
+		PurgeJobRetention:        *purge_job_retention,
+		HostAliasCheckInterval:   *host_alias_check_interval,
+		HostAliasPendingTTL:      *host_alias_pending_ttl,
+		WatchHeartbeat:           *watch_heartbeat_interval,
+		WatchBufferSize:          *watch_buffer_size,
+		LocationHealthInterval:   *location_health_interval,
+		ControllerSettings:       strings.Split(*controller_settings, ","),
 	}
 
 	logger.Init(appcfg.Production)
@@ -65,13 +104,25 @@ func main() {
 		AllowCredentials: true,
 	}))
 
+	// The audit middleware wraps every route registered below, so it has to be installed before any module
+	auditModule := audit.New(audit.Config{
+		Namespace: appcfg.Namespace,
+		Sinks:     appcfg.AuditSinks,
+		File:      appcfg.AuditFile,
+	})
+	a.Engine.Use(auditModule.Middleware())
+
 	// Register Auth module. This exposes our Auth middleware
 	authModule := auth.New(auth.Config{
-		Namespace:         appcfg.Namespace,
-		AuthClaim:         *auth_user_claim,
-		GroupsClaim:       *auth_groups_claim,
-		OIDCGroupPrefix:   appcfg.OIDCGroupPrefix,
-		OIDCGroupMappings: appcfg.OIDCGroupMappings,
+		Namespace:                appcfg.Namespace,
+		AuthClaim:                *auth_user_claim,
+		GroupsClaim:              *auth_groups_claim,
+		OIDCGroupPrefix:          appcfg.OIDCGroupPrefix,
+		Issuers:                  appcfg.OIDCIssuers,
+		OIDCGroupMappings:        appcfg.OIDCGroupMappings,
+		DefaultAdminProject:      appcfg.DefaultAdminProject,
+		PolicyResyncInterval:     appcfg.PolicyResyncInterval,
+		PersonalTokenMaxLifetime: appcfg.PersonalTokenMaxLifetime,
 	})
 
 	err = a.RegisterModule(authModule, "Auth")
@@ -94,10 +145,32 @@ func main() {
 		}
 	}
 
+	auditModule.SetMiddlewares(authModule.AuthMiddleware())
+	auditModule.SetEnforcer(authModule.Enforcer)
+	err = a.RegisterModule(auditModule, "Audit")
+	if err != nil {
+		logger.L().Error("Module registration failed", zap.Error(err))
+		panic("audit module registration failed")
+	}
+
 	a.Engine.GET("/health", func(c *gin.Context) {
 		c.JSON(200, gin.H{"status": "ok"})
 	})
 
+	// Ready once the informer cache serving module reads has synced
+	a.Engine.GET("/ready", func(c *gin.Context) {
+		k8sCache, err := app.GetK8SCache(appcfg.Namespace)
+		if err != nil {
+			c.JSON(503, gin.H{"status": "unavailable", "error": err.Error()})
+			return
+		}
+		if pending := k8sCache.Pending(); len(pending) > 0 {
+			c.JSON(503, gin.H{"status": "syncing", "pending": pending})
+			return
+		}
+		c.JSON(200, gin.H{"status": "ok"})
+	})
+
 	projects := a.GetModule("Projects").(*projects.Module)
 	if projects == nil {
 		logger.L().Error("Projects module not found")
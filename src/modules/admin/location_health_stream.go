@@ -0,0 +1,114 @@
+package admin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/EdgeCDN-X/edgecdnx-api/src/internal/logger"
+	"github.com/EdgeCDN-X/edgecdnx-api/src/internal/watch"
+	"go.uber.org/zap"
+	"k8s.io/client-go/tools/cache"
+)
+
+// locationHealth queries Prometheus and matches the results against the locations
+func (m *Module) locationHealth(ctx context.Context) (*locationHealthResponse, int, error) {
+	if m.prometheus == nil {
+		return nil, http.StatusServiceUnavailable, fmt.Errorf("prometheus client is not configured")
+	}
+
+	response, err := m.prometheus.Query(ctx, `probe_success{endpoint="location"}`)
+	if err != nil {
+		return nil, http.StatusBadGateway, fmt.Errorf("failed to query prometheus: %w", err)
+	}
+
+	alertResponse, err := m.prometheus.Query(ctx, `ALERTS{alertstate="firing"}`)
+	if err != nil {
+		return nil, http.StatusBadGateway, fmt.Errorf("failed to query prometheus alerts: %w", err)
+	}
+
+	healthResponse, err := m.buildLocationHealthResponse(ctx, response, alertResponse)
+	if err != nil {
+		return nil, http.StatusInternalServerError, fmt.Errorf("failed to build location health response: %w", err)
+	}
+
+	return healthResponse, http.StatusOK, nil
+}
+
+// startHealthStream watches locations and refreshes the health of open streams on every location change and
+// on a fixed interval, Prometheus can not push changes.
+func (m *Module) startHealthStream(stop <-chan struct{}) {
+	// Events carry the full health, only the latest one is kept for resuming
+	m.healthHub = watch.NewHub(1, m.cfg.WatchBufferSize)
+	m.healthRefresh = make(chan struct{}, 1)
+
+	trigger := func() {
+		select {
+		case m.healthRefresh <- struct{}{}:
+		default:
+		}
+	}
+
+	m.k8sCache.Informer(locationGVR).AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj any) { trigger() },
+		UpdateFunc: func(oldObj, newObj any) { trigger() },
+		DeleteFunc: func(obj any) { trigger() },
+	})
+	go m.runHealthRefresh(stop)
+}
+
+func (m *Module) runHealthRefresh(stop <-chan struct{}) {
+	interval := m.cfg.LocationHealthInterval
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		case <-m.healthRefresh:
+		}
+
+		if m.prometheus == nil || m.healthHub.SkipIfIdle() {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), interval)
+		if _, _, _, err := m.refreshLocationHealth(ctx); err != nil {
+			logger.L().Warn("Failed to refresh location health", zap.Error(err))
+		}
+		cancel()
+	}
+}
+
+// refreshLocationHealth publishes the current health when it differs from the last published one. It returns the
+// latest event and whether it was published by this call.
+func (m *Module) refreshLocationHealth(ctx context.Context) (watch.Event, bool, int, error) {
+	health, code, err := m.locationHealth(ctx)
+	if err != nil {
+		return watch.Event{}, false, code, err
+	}
+	encoded, err := json.Marshal(health)
+	if err != nil {
+		return watch.Event{}, false, http.StatusInternalServerError, fmt.Errorf("failed to encode location health: %w", err)
+	}
+
+	m.healthMu.Lock()
+	defer m.healthMu.Unlock()
+
+	if last, ok := m.healthHub.Last(); ok && bytes.Equal(encoded, m.lastHealth) {
+		return last, false, http.StatusOK, nil
+	}
+	m.healthSeq++
+	m.lastHealth = encoded
+	event := watch.Event{ID: strconv.FormatUint(m.healthSeq, 10), Type: "locationHealth", Data: json.RawMessage(encoded)}
+	m.healthHub.Publish(event)
+	return event, true, http.StatusOK, nil
+}
@@ -1,7 +1,11 @@
 package admin
 
 import (
+	"sync"
+	"time"
+
 	"github.com/EdgeCDN-X/edgecdnx-api/src/internal/logger"
+	"github.com/EdgeCDN-X/edgecdnx-api/src/internal/watch"
 	"github.com/EdgeCDN-X/edgecdnx-api/src/modules/app"
 	"github.com/casbin/casbin/v3"
 	"github.com/gin-gonic/gin"
@@ -14,26 +18,45 @@ type Config struct {
 
 	DefaultAdminProject string
 	DefaultAdminUser    string
+
+	// WatchHeartbeat is the interval of keep-alive comments on idle streams
+	WatchHeartbeat time.Duration
+	// WatchBufferSize is how many events a stream may lag behind before it is disconnected
+	WatchBufferSize int
+	// LocationHealthInterval is how often Prometheus is queried while health streams are open
+	LocationHealthInterval time.Duration
 }
 
 type Module struct {
 	cfg         Config
+	k8sCache    *app.Cache
 	dynClient   dynamic.Interface
 	client      *kubernetes.Clientset
 	prometheus  *app.Prometheus
 	middlewares []gin.HandlerFunc
-	enforcer    *casbin.Enforcer
+	enforcer    *casbin.SyncedEnforcer
+
+	stopStream    chan struct{}
+	healthHub     *watch.Hub
+	healthRefresh chan struct{}
+	healthMu      sync.Mutex
+	healthSeq     uint64
+	lastHealth    []byte
 }
 
 func New(cfg Config) *Module {
 	return &Module{cfg: cfg}
 }
 
-func (m *Module) Shutdown() {}
+func (m *Module) Shutdown() {
+	if m.stopStream != nil {
+		close(m.stopStream)
+	}
+}
 
 func (m *Module) Init() error {
 	logger.L().Info("Initializing module")
-	dynClient, _, err := app.GetK8SDynamicClient()
+	k8sCache, err := app.GetK8SCache(m.cfg.Namespace)
 	if err != nil {
 		return err
 	}
@@ -43,9 +66,13 @@ func (m *Module) Init() error {
 		return err
 	}
 
-	m.dynClient = dynClient
+	m.k8sCache = k8sCache
+	m.dynClient = k8sCache.Client(prefixListGVR, zoneGVR, locationGVR)
 	m.client = client
 
+	m.stopStream = make(chan struct{})
+	m.startHealthStream(m.stopStream)
+
 	return nil
 }
 
@@ -53,7 +80,7 @@ func (m *Module) SetMiddlewares(middlewares ...gin.HandlerFunc) {
 	m.middlewares = middlewares
 }
 
-func (m *Module) SetEnforcer(enforcer *casbin.Enforcer) {
+func (m *Module) SetEnforcer(enforcer *casbin.SyncedEnforcer) {
 	m.enforcer = enforcer
 }
 
@@ -1,11 +1,15 @@
 package admin
 
 import (
+	"fmt"
 	"net/http"
 
+	"github.com/EdgeCDN-X/edgecdnx-api/src/internal/logger"
+	"github.com/EdgeCDN-X/edgecdnx-api/src/internal/watch"
 	"github.com/EdgeCDN-X/edgecdnx-api/src/modules/auth"
 	infrastructurev1alpha1 "github.com/EdgeCDN-X/edgecdnx-controller/api/v1alpha1"
 	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
@@ -33,7 +37,8 @@ func (m *Module) RegisterRoutes(r *gin.Engine) {
 	group := r.Group("/admin", m.middlewares...)
 
 	group.GET("/prefixlists", auth.NewAuthzBuilder().E(m.enforcer).ST(m.cfg.DefaultAdminProject).R("prefixlist").S("user_id").A("read").Build(), func(c *gin.Context) {
-		objList, err := m.dynClient.Resource(prefixListGVR).Namespace(m.cfg.Namespace).List(c, metav1.ListOptions{})
+		// Lists carrying a project label belong to a tenant and are managed through the project routes
+		objList, err := m.dynClient.Resource(prefixListGVR).Namespace(m.cfg.Namespace).List(c, metav1.ListOptions{LabelSelector: "!project"})
 		if err != nil {
 			c.JSON(500, gin.H{"error": "failed to list prefixlists: " + err.Error()})
 			return
@@ -87,29 +92,56 @@ func (m *Module) RegisterRoutes(r *gin.Engine) {
 	})
 
 	group.GET("/location-healths", auth.NewAuthzBuilder().E(m.enforcer).ST(m.cfg.DefaultAdminProject).R("location").S("user_id").A("read").Build(), func(c *gin.Context) {
+		healthResponse, code, err := m.locationHealth(c.Request.Context())
+		if err != nil {
+			c.JSON(code, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, healthResponse)
+	})
+
+	group.GET("/location-healths/stream", auth.NewAuthzBuilder().E(m.enforcer).ST(m.cfg.DefaultAdminProject).R("location").S("user_id").A("read").Build(), func(c *gin.Context) {
 		if m.prometheus == nil {
 			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "prometheus client is not configured"})
 			return
 		}
-
-		response, err := m.prometheus.Query(c.Request.Context(), `probe_success{endpoint="location"}`)
-		if err != nil {
-			c.JSON(http.StatusBadGateway, gin.H{"error": "failed to query prometheus: " + err.Error()})
+		if m.healthHub == nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "location health stream is not available"})
 			return
 		}
 
-		alertResponse, err := m.prometheus.Query(c.Request.Context(), `ALERTS{alertstate="firing"}`)
-		if err != nil {
-			c.JSON(http.StatusBadGateway, gin.H{"error": "failed to query prometheus alerts: " + err.Error()})
-			return
+		sub, initial, resumed := m.healthHub.Subscribe(watch.LastEventID(c.Request), nil)
+		defer m.healthHub.Unsubscribe(sub)
+
+		// Every event carries the full health, a client which is not up to date only needs the latest one.
+		// A changed health is published to the new subscription as well and must not be sent twice.
+		if !resumed {
+			event, published, code, err := m.refreshLocationHealth(c.Request.Context())
+			if err != nil {
+				c.JSON(code, gin.H{"error": err.Error()})
+				return
+			}
+			if !published {
+				initial = []watch.Event{event}
+			}
 		}
 
-		healthResponse, err := m.buildLocationHealthResponse(c.Request.Context(), response, alertResponse)
+		err := watch.Serve(c.Request.Context(), c.Writer, sub, initial, watch.StreamOptions{
+			Heartbeat: m.cfg.WatchHeartbeat,
+			Authorize: func() error {
+				allowed, err := auth.AuthorizeRequest(m.enforcer, c, m.cfg.DefaultAdminProject, "location", "read")
+				if err != nil {
+					return fmt.Errorf("internal error")
+				}
+				if !allowed {
+					return fmt.Errorf("forbidden")
+				}
+				return nil
+			},
+		})
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to build location health response: " + err.Error()})
-			return
+			logger.L().Debug("Location health stream ended", zap.Error(err))
 		}
-
-		c.JSON(http.StatusOK, healthResponse)
 	})
 }
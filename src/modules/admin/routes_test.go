@@ -1,11 +1,16 @@
 package admin
 
 import (
+	"bufio"
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"slices"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/EdgeCDN-X/edgecdnx-api/src/modules/app"
 	"github.com/EdgeCDN-X/edgecdnx-api/src/modules/auth"
@@ -19,7 +24,7 @@ import (
 	dynamicfake "k8s.io/client-go/dynamic/fake"
 )
 
-func newTestEnforcer(t *testing.T) *casbin.Enforcer {
+func newTestEnforcer(t *testing.T) *casbin.SyncedEnforcer {
 	t.Helper()
 
 	casbinModel, err := model.NewModelFromString(auth.RBACWithDomainModel)
@@ -27,7 +32,7 @@ func newTestEnforcer(t *testing.T) *casbin.Enforcer {
 		t.Fatalf("expected no error, got %v", err)
 	}
 
-	enforcer, err := casbin.NewEnforcer(casbinModel)
+	enforcer, err := casbin.NewSyncedEnforcer(casbinModel)
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
@@ -35,11 +40,14 @@ func newTestEnforcer(t *testing.T) *casbin.Enforcer {
 	return enforcer
 }
 
-func newTestModule(t *testing.T, prometheus *app.Prometheus, locations ...*infrastructurev1alpha1.Location) *Module {
+func newTestModule(t *testing.T, prometheus *app.Prometheus, objects ...runtime.Object) *Module {
 	t.Helper()
 
 	enforcer := newTestEnforcer(t)
-	_, err := enforcer.AddPolicy("user@example.com", "admin", "location", "read")
+	_, err := enforcer.AddPolicies([][]string{
+		{"user@example.com", "admin", "location", "read"},
+		{"user@example.com", "admin", "prefixlist", "read"},
+	})
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
@@ -49,19 +57,18 @@ func newTestModule(t *testing.T, prometheus *app.Prometheus, locations ...*infra
 		t.Fatalf("expected no error, got %v", err)
 	}
 
-	objects := make([]runtime.Object, 0, len(locations))
-	for _, location := range locations {
-		objects = append(objects, location)
-	}
-
 	dynClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(
 		scheme,
-		map[schema.GroupVersionResource]string{locationGVR: "LocationList"},
+		map[schema.GroupVersionResource]string{locationGVR: "LocationList", prefixListGVR: "PrefixListList"},
 		objects...,
 	)
 
+	k8sCache := app.NewCache(dynClient, "", time.Hour)
+	t.Cleanup(k8sCache.Stop)
+
 	return &Module{
 		cfg:        Config{DefaultAdminProject: "admin"},
+		k8sCache:   k8sCache,
 		dynClient:  dynClient,
 		prometheus: prometheus,
 		enforcer:   enforcer,
@@ -73,6 +80,38 @@ func newTestModule(t *testing.T, prometheus *app.Prometheus, locations ...*infra
 	}
 }
 
+func TestPrefixListsExcludeProjectLists(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	module := newTestModule(t, nil,
+		&infrastructurev1alpha1.PrefixList{
+			TypeMeta:   metav1.TypeMeta{APIVersion: infrastructurev1alpha1.SchemeGroupVersion.String(), Kind: "PrefixList"},
+			ObjectMeta: metav1.ObjectMeta{Name: "edges"},
+		},
+		&infrastructurev1alpha1.PrefixList{
+			TypeMeta:   metav1.TypeMeta{APIVersion: infrastructurev1alpha1.SchemeGroupVersion.String(), Kind: "PrefixList"},
+			ObjectMeta: metav1.ObjectMeta{Name: "office", Labels: map[string]string{"project": "demo"}},
+		},
+	)
+	router := gin.New()
+	module.RegisterRoutes(router)
+
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodGet, "/admin/prefixlists", nil)
+	router.ServeHTTP(recorder, request)
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("unexpected status code %d", recorder.Code)
+	}
+	var items []infrastructurev1alpha1.PrefixList
+	if err := json.Unmarshal(recorder.Body.Bytes(), &items); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(items) != 1 || items[0].Name != "edges" {
+		t.Fatalf("unexpected prefix lists %#v", items)
+	}
+}
+
 func TestLocationHealthWithoutPrometheus(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 
@@ -172,3 +211,84 @@ func TestLocationHealthQueriesPrometheus(t *testing.T) {
 		t.Fatalf("expected no unmatched metrics, got %d", len(response.Data.UnmatchedMetrics))
 	}
 }
+
+func TestLocationHealthStream(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	probe := atomic.Value{}
+	probe.Store("1")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Query().Get("query") == `ALERTS{alertstate="firing"}` {
+			_, _ = w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[]}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[{"metric":{"endpoint":"location","instance":"http://74.220.24.46/healthz","location":"nyc1-c1"},"value":[1775650533.969,"` + probe.Load().(string) + `"]}]}}`))
+	}))
+	defer server.Close()
+
+	prometheus, err := app.NewPrometheus(app.PrometheusConfig{Endpoint: server.URL})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	module := newTestModule(t, prometheus, &infrastructurev1alpha1.Location{
+		ObjectMeta: metav1.ObjectMeta{Name: "nyc1-c1", Namespace: "edgecdnx"},
+		Spec:       infrastructurev1alpha1.LocationSpec{Nodes: []infrastructurev1alpha1.NodeSpec{{Name: "nyc-router-1", Ipv4: "74.220.24.46"}}},
+	})
+	module.cfg.WatchBufferSize = 4
+	module.cfg.LocationHealthInterval = time.Hour
+	stop := make(chan struct{})
+	defer close(stop)
+	module.startHealthStream(stop)
+
+	router := gin.New()
+	module.RegisterRoutes(router)
+	api := httptest.NewServer(router)
+	defer api.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	request, _ := http.NewRequestWithContext(ctx, http.MethodGet, api.URL+"/admin/location-healths/stream", nil)
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer response.Body.Close()
+	reader := bufio.NewReader(response.Body)
+
+	readEvent := func() (string, locationHealthResponse) {
+		id, health := "", locationHealthResponse{}
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				t.Fatalf("failed to read stream: %v", err)
+			}
+			switch {
+			case strings.HasPrefix(line, "id: "):
+				id = strings.TrimSpace(strings.TrimPrefix(line, "id: "))
+			case strings.HasPrefix(line, "data: "):
+				if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &health); err != nil {
+					t.Fatalf("failed to decode event: %v", err)
+				}
+				return id, health
+			}
+		}
+	}
+
+	id, health := readEvent()
+	if id != "1" || !health.Data.Locations[0].Sources[0].Nodes[0].Healthy {
+		t.Fatalf("unexpected first event %s %#v", id, health)
+	}
+
+	// Unchanged health is not sent again
+	if _, _, _, err := module.refreshLocationHealth(ctx); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	probe.Store("0")
+	module.healthRefresh <- struct{}{}
+
+	id, health = readEvent()
+	if id != "2" || health.Data.Locations[0].Sources[0].Nodes[0].Healthy {
+		t.Fatalf("unexpected second event %s %#v", id, health)
+	}
+}
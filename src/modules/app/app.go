@@ -16,7 +16,7 @@ import (
 
 type Module interface {
 	SetMiddlewares(...gin.HandlerFunc)
-	SetEnforcer(enforcer *casbin.Enforcer)
+	SetEnforcer(enforcer *casbin.SyncedEnforcer)
 	RegisterRoutes(r *gin.Engine)
 	Init() error
 	Shutdown()
@@ -88,6 +88,7 @@ func (a *App) Shutdown() {
 	for _, m := range a.Modules {
 		m.Shutdown()
 	}
+	StopK8SCache()
 }
 
 func (a *App) Run(addr string) error {
@@ -122,6 +123,7 @@ func (a *App) Run(addr string) error {
 	for _, m := range a.Modules {
 		m.Shutdown()
 	}
+	StopK8SCache()
 
 	return nil
 }
@@ -0,0 +1,453 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/EdgeCDN-X/edgecdnx-api/src/internal/logger"
+	"go.uber.org/zap"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+)
+
+// ProjectIndex indexes cached objects by their project label
+const ProjectIndex = "project"
+
+// mutationTTL is how long the result of a write is preferred over an informer that has not caught up with it yet
+const mutationTTL = time.Minute
+
+var (
+	k8sCache     *Cache
+	k8sCacheErr  error
+	k8sCacheOnce sync.Once
+)
+
+// GetK8SCache returns the informer cache shared by all modules. It is scoped to the namespace of the first caller,
+// all modules watch the same namespace.
+func GetK8SCache(namespace string) (*Cache, error) {
+	k8sCacheOnce.Do(func() {
+		client, _, err := GetK8SDynamicClient()
+		if err != nil {
+			k8sCacheErr = err
+			return
+		}
+		k8sCache = NewCache(client, namespace, 60*time.Minute)
+	})
+	return k8sCache, k8sCacheErr
+}
+
+// StopK8SCache stops the informers of the shared cache, if it was ever created
+func StopK8SCache() {
+	if k8sCache != nil {
+		k8sCache.Stop()
+	}
+}
+
+type cachedResource struct {
+	informer  cache.SharedIndexInformer
+	mutations cache.MutationCache
+	// selector limits the cached objects, see Cache.Restrict
+	selector labels.Selector
+
+	mu sync.Mutex
+	// deleted holds the resourceVersion of objects deleted through the cache until the informer observes the delete
+	deleted map[string]deletedObject
+}
+
+type deletedObject struct {
+	resourceVersion string
+	expires         time.Time
+}
+
+// Cache serves Get and List calls from shared informers while writes keep going to the API server. Reads fall back
+// to the API server until the informer of a resource has synced.
+type Cache struct {
+	client    dynamic.Interface
+	namespace string
+	resync    time.Duration
+	factory   dynamicinformer.DynamicSharedInformerFactory
+	stop      chan struct{}
+	stopOnce  sync.Once
+
+	mu        sync.Mutex
+	resources map[schema.GroupVersionResource]*cachedResource
+	required  []schema.GroupVersionResource
+	selectors map[schema.GroupVersionResource]labels.Selector
+}
+
+func NewCache(client dynamic.Interface, namespace string, resync time.Duration) *Cache {
+	return &Cache{
+		client:    client,
+		namespace: namespace,
+		resync:    resync,
+		factory:   dynamicinformer.NewFilteredDynamicSharedInformerFactory(client, resync, namespace, nil),
+		stop:      make(chan struct{}),
+		resources: map[schema.GroupVersionResource]*cachedResource{},
+		selectors: map[schema.GroupVersionResource]labels.Selector{},
+	}
+}
+
+// Restrict caches only the objects of a resource matching the label selector, so the API process does not hold
+// objects it never needs, for example every Secret of the namespace. It has to be called before the resource is
+// cached. Reads through Client do not see objects outside the selector.
+func (c *Cache) Restrict(gvr schema.GroupVersionResource, selector string) error {
+	parsed, err := labels.Parse(selector)
+	if err != nil {
+		return fmt.Errorf("invalid selector for %s: %w", gvr.Resource, err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if current, ok := c.selectors[gvr]; ok && current.String() == parsed.String() {
+		return nil
+	}
+	if _, ok := c.resources[gvr]; ok {
+		return fmt.Errorf("%s are already cached, the selector has to be set before", gvr.Resource)
+	}
+	c.selectors[gvr] = parsed
+	return nil
+}
+
+func (c *Cache) resource(gvr schema.GroupVersionResource) *cachedResource {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if res, ok := c.resources[gvr]; ok {
+		return res
+	}
+
+	selector, restricted := c.selectors[gvr]
+	var informer cache.SharedIndexInformer
+	if restricted {
+		// The shared factory applies one set of list options to all resources
+		informer = dynamicinformer.NewFilteredDynamicInformer(c.client, gvr, c.namespace, c.resync,
+			cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc},
+			func(opts *metav1.ListOptions) { opts.LabelSelector = selector.String() },
+		).Informer()
+	} else {
+		selector = labels.Everything()
+		informer = c.factory.ForResource(gvr).Informer()
+	}
+	if err := informer.AddIndexers(cache.Indexers{ProjectIndex: projectIndexFunc}); err != nil {
+		// Only fails for informers started outside the cache, List falls back to the namespace index
+		logger.L().Error("Failed to add project index", zap.String("resource", gvr.String()), zap.Error(err))
+	}
+	res := &cachedResource{
+		informer:  informer,
+		mutations: cache.NewIntegerResourceVersionMutationCache(klog.Background(), informer.GetStore(), informer.GetIndexer(), mutationTTL, true),
+		selector:  selector,
+		deleted:   map[string]deletedObject{},
+	}
+	c.resources[gvr] = res
+
+	select {
+	case <-c.stop:
+	default:
+		if restricted {
+			go informer.Run(c.stop)
+		} else {
+			c.factory.Start(c.stop)
+		}
+	}
+	return res
+}
+
+// lookup returns the resource when it is cached and its informer has synced
+func (c *Cache) lookup(gvr schema.GroupVersionResource) *cachedResource {
+	c.mu.Lock()
+	res, ok := c.resources[gvr]
+	c.mu.Unlock()
+	if !ok || !res.informer.HasSynced() {
+		return nil
+	}
+	return res
+}
+
+// Informer returns the shared informer of a resource and starts it. Informers requested this way do not hold back
+// readiness, the resource may not be installed in the cluster.
+func (c *Cache) Informer(gvr schema.GroupVersionResource) cache.SharedIndexInformer {
+	return c.resource(gvr).informer
+}
+
+// Client starts caching the given resources and returns a client serving reads of all cached resources. The given
+// resources have to sync before the cache reports ready.
+func (c *Cache) Client(resources ...schema.GroupVersionResource) dynamic.Interface {
+	for _, gvr := range resources {
+		c.resource(gvr)
+
+		c.mu.Lock()
+		if !containsResource(c.required, gvr) {
+			c.required = append(c.required, gvr)
+		}
+		c.mu.Unlock()
+	}
+	return &cachedClient{Interface: c.client, cache: c}
+}
+
+// Pending lists the resources required by Client that have not synced yet
+func (c *Cache) Pending() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	pending := []string{}
+	for _, gvr := range c.required {
+		if !c.resources[gvr].informer.HasSynced() {
+			pending = append(pending, gvr.Resource)
+		}
+	}
+	return pending
+}
+
+// HasSynced reports whether all resources required by Client have synced
+func (c *Cache) HasSynced() bool {
+	return len(c.Pending()) == 0
+}
+
+// WaitForSync blocks until HasSynced or the context is done
+func (c *Cache) WaitForSync(ctx context.Context) bool {
+	return cache.WaitForCacheSync(ctx.Done(), c.HasSynced)
+}
+
+func (c *Cache) Stop() {
+	c.stopOnce.Do(func() {
+		close(c.stop)
+	})
+}
+
+func containsResource(resources []schema.GroupVersionResource, gvr schema.GroupVersionResource) bool {
+	for _, r := range resources {
+		if r == gvr {
+			return true
+		}
+	}
+	return false
+}
+
+func projectIndexFunc(obj any) ([]string, error) {
+	raw, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return nil, nil
+	}
+	if project, ok := raw.GetLabels()["project"]; ok {
+		return []string{project}, nil
+	}
+	return nil, nil
+}
+
+// visible hides objects deleted through the cache the informer has not observed the delete of yet. An object with
+// a newer resourceVersion, for example one held back by a finalizer, is visible again.
+func (r *cachedResource) visible(key string, obj *unstructured.Unstructured) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	deleted, ok := r.deleted[key]
+	if !ok {
+		return true
+	}
+	if time.Now().After(deleted.expires) || deleted.resourceVersion != obj.GetResourceVersion() {
+		delete(r.deleted, key)
+		return true
+	}
+	return false
+}
+
+func (r *cachedResource) get(namespace string, name string) (*unstructured.Unstructured, bool, error) {
+	key := namespace + "/" + name
+	item, exists, err := r.mutations.GetByKey(key)
+	if err != nil || !exists {
+		return nil, false, err
+	}
+	obj, ok := item.(*unstructured.Unstructured)
+	if !ok || !r.visible(key, obj) {
+		return nil, false, nil
+	}
+	return obj, true, nil
+}
+
+func (r *cachedResource) list(namespace string, selector labels.Selector) ([]unstructured.Unstructured, error) {
+	indexName, indexKey := cache.NamespaceIndex, namespace
+	requirements, _ := selector.Requirements()
+	_, indexed := r.informer.GetIndexer().GetIndexers()[ProjectIndex]
+	for _, requirement := range requirements {
+		if indexed && requirement.Key() == "project" && (requirement.Operator() == selection.Equals || requirement.Operator() == selection.DoubleEquals) {
+			indexName, indexKey = ProjectIndex, requirement.Values().List()[0]
+		}
+	}
+
+	items, err := r.mutations.ByIndex(indexName, indexKey)
+	if err != nil {
+		return nil, err
+	}
+
+	objs := []unstructured.Unstructured{}
+	for _, item := range items {
+		obj, ok := item.(*unstructured.Unstructured)
+		if !ok || obj.GetNamespace() != namespace || !selector.Matches(labels.Set(obj.GetLabels())) {
+			continue
+		}
+		if !r.visible(namespace+"/"+obj.GetName(), obj) {
+			continue
+		}
+		objs = append(objs, *obj.DeepCopy())
+	}
+	sort.Slice(objs, func(i, j int) bool {
+		return objs[i].GetName() < objs[j].GetName()
+	})
+	return objs, nil
+}
+
+func (r *cachedResource) mutated(obj *unstructured.Unstructured, err error) {
+	if err == nil && obj != nil && r.selector.Matches(labels.Set(obj.GetLabels())) {
+		r.mutations.Mutation(obj.DeepCopy())
+	}
+}
+
+func (r *cachedResource) markDeleted(namespace string, name string) {
+	obj, exists, err := r.get(namespace, name)
+	if err != nil || !exists {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.deleted[namespace+"/"+name] = deletedObject{resourceVersion: obj.GetResourceVersion(), expires: time.Now().Add(mutationTTL)}
+}
+
+type cachedClient struct {
+	dynamic.Interface
+	cache *Cache
+}
+
+func (c *cachedClient) Resource(gvr schema.GroupVersionResource) dynamic.NamespaceableResourceInterface {
+	return &cachedResourceClient{NamespaceableResourceInterface: c.Interface.Resource(gvr), cache: c.cache, gvr: gvr}
+}
+
+// cachedResourceClient passes cluster scoped calls through to the API server
+type cachedResourceClient struct {
+	dynamic.NamespaceableResourceInterface
+	cache *Cache
+	gvr   schema.GroupVersionResource
+}
+
+func (c *cachedResourceClient) Namespace(namespace string) dynamic.ResourceInterface {
+	return &cachedNamespacedClient{
+		ResourceInterface: c.NamespaceableResourceInterface.Namespace(namespace),
+		cache:             c.cache,
+		gvr:               c.gvr,
+		namespace:         namespace,
+	}
+}
+
+type cachedNamespacedClient struct {
+	dynamic.ResourceInterface
+	cache     *Cache
+	gvr       schema.GroupVersionResource
+	namespace string
+}
+
+// cached returns the cached resource when the call can be served from it
+func (c *cachedNamespacedClient) cached() *cachedResource {
+	if c.namespace != c.cache.namespace {
+		return nil
+	}
+	return c.cache.lookup(c.gvr)
+}
+
+func (c *cachedNamespacedClient) Get(ctx context.Context, name string, opts metav1.GetOptions, subresources ...string) (*unstructured.Unstructured, error) {
+	res := c.cached()
+	if res == nil || len(subresources) > 0 || opts.ResourceVersion != "" {
+		return c.ResourceInterface.Get(ctx, name, opts, subresources...)
+	}
+
+	obj, exists, err := res.get(c.namespace, name)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, apierrors.NewNotFound(c.gvr.GroupResource(), name)
+	}
+	return obj.DeepCopy(), nil
+}
+
+func (c *cachedNamespacedClient) List(ctx context.Context, opts metav1.ListOptions) (*unstructured.UnstructuredList, error) {
+	res := c.cached()
+	if res == nil || opts.FieldSelector != "" || opts.Limit > 0 || opts.Continue != "" {
+		return c.ResourceInterface.List(ctx, opts)
+	}
+	selector, err := labels.Parse(opts.LabelSelector)
+	if err != nil {
+		// The API server reports invalid selectors
+		return c.ResourceInterface.List(ctx, opts)
+	}
+
+	items, err := res.list(c.namespace, selector)
+	if err != nil {
+		return nil, err
+	}
+	list := &unstructured.UnstructuredList{Object: map[string]any{"apiVersion": c.gvr.GroupVersion().String()}, Items: items}
+	if len(items) > 0 {
+		list.SetKind(items[0].GetKind() + "List")
+	}
+	list.SetResourceVersion(res.informer.LastSyncResourceVersion())
+	return list, nil
+}
+
+func (c *cachedNamespacedClient) Create(ctx context.Context, obj *unstructured.Unstructured, opts metav1.CreateOptions, subresources ...string) (*unstructured.Unstructured, error) {
+	created, err := c.ResourceInterface.Create(ctx, obj, opts, subresources...)
+	if res := c.cached(); res != nil && isWrite(opts.DryRun, subresources) {
+		res.mutated(created, err)
+	}
+	return created, err
+}
+
+func (c *cachedNamespacedClient) Update(ctx context.Context, obj *unstructured.Unstructured, opts metav1.UpdateOptions, subresources ...string) (*unstructured.Unstructured, error) {
+	updated, err := c.ResourceInterface.Update(ctx, obj, opts, subresources...)
+	if res := c.cached(); res != nil && isWrite(opts.DryRun, subresources) {
+		res.mutated(updated, err)
+	}
+	return updated, err
+}
+
+func (c *cachedNamespacedClient) UpdateStatus(ctx context.Context, obj *unstructured.Unstructured, opts metav1.UpdateOptions) (*unstructured.Unstructured, error) {
+	updated, err := c.ResourceInterface.UpdateStatus(ctx, obj, opts)
+	if res := c.cached(); res != nil && isWrite(opts.DryRun, nil) {
+		res.mutated(updated, err)
+	}
+	return updated, err
+}
+
+func (c *cachedNamespacedClient) Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts metav1.PatchOptions, subresources ...string) (*unstructured.Unstructured, error) {
+	patched, err := c.ResourceInterface.Patch(ctx, name, pt, data, opts, subresources...)
+	if res := c.cached(); res != nil && isWrite(opts.DryRun, subresources) {
+		res.mutated(patched, err)
+	}
+	return patched, err
+}
+
+func (c *cachedNamespacedClient) Delete(ctx context.Context, name string, opts metav1.DeleteOptions, subresources ...string) error {
+	err := c.ResourceInterface.Delete(ctx, name, opts, subresources...)
+	if res := c.cached(); res != nil && err == nil && isWrite(opts.DryRun, subresources) {
+		res.markDeleted(c.namespace, name)
+	}
+	return err
+}
+
+// isWrite reports whether a call returned the stored object, writes to other subresources and dry runs are left to
+// the informer
+func isWrite(dryRun []string, subresources []string) bool {
+	return len(dryRun) == 0 && (len(subresources) == 0 || strings.Join(subresources, "/") == "status")
+}
@@ -0,0 +1,196 @@
+package app
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+var (
+	testGVR    = schema.GroupVersionResource{Group: "infrastructure.edgecdnx.com", Version: "v1alpha1", Resource: "zones"}
+	unknownGVR = schema.GroupVersionResource{Group: "example.com", Version: "v1", Resource: "unknowns"}
+)
+
+func testObject(name string, project string, resourceVersion string) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion("infrastructure.edgecdnx.com/v1alpha1")
+	obj.SetKind("Zone")
+	obj.SetNamespace("edgecdnx")
+	obj.SetName(name)
+	obj.SetLabels(map[string]string{"project": project})
+	obj.SetResourceVersion(resourceVersion)
+	return obj
+}
+
+func names(list *unstructured.UnstructuredList) []string {
+	result := []string{}
+	for _, item := range list.Items {
+		result = append(result, item.GetName())
+	}
+	return result
+}
+
+func newTestCache(t *testing.T) (*Cache, *dynamicfake.FakeDynamicClient, *int) {
+	t.Helper()
+
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(
+		runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{testGVR: "ZoneList", unknownGVR: "UnknownList"},
+		testObject("b.example.com", "demo", "1"),
+		testObject("a.example.com", "demo", "2"),
+		testObject("c.example.com", "other", "3"),
+	)
+	// Counts the gets reaching the API server, the informer only lists and watches
+	reads := 0
+	client.PrependReactor("get", "zones", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		reads++
+		return false, nil, nil
+	})
+
+	cache := NewCache(client, "edgecdnx", time.Hour)
+	t.Cleanup(cache.Stop)
+	return cache, client, &reads
+}
+
+func TestCacheServesReads(t *testing.T) {
+	cache, _, reads := newTestCache(t)
+	client := cache.Client(testGVR)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !cache.WaitForSync(ctx) || len(cache.Pending()) != 0 {
+		t.Fatalf("expected the cache to sync, pending %v", cache.Pending())
+	}
+
+	list, err := client.Resource(testGVR).Namespace("edgecdnx").List(ctx, metav1.ListOptions{LabelSelector: "project=demo"})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if got := names(list); len(got) != 2 || got[0] != "a.example.com" || got[1] != "b.example.com" {
+		t.Fatalf("unexpected items %v", got)
+	}
+
+	obj, err := client.Resource(testGVR).Namespace("edgecdnx").Get(ctx, "c.example.com", metav1.GetOptions{})
+	if err != nil || obj.GetLabels()["project"] != "other" {
+		t.Fatalf("unexpected object %v, error %v", obj, err)
+	}
+	// Callers may modify what they read without touching the cache
+	obj.SetLabels(map[string]string{"project": "demo"})
+	if list, _ = client.Resource(testGVR).Namespace("edgecdnx").List(ctx, metav1.ListOptions{LabelSelector: "project=other"}); len(list.Items) != 1 {
+		t.Fatalf("expected the cached object to be unchanged, got %v", names(list))
+	}
+
+	if _, err := client.Resource(testGVR).Namespace("edgecdnx").Get(ctx, "missing.example.com", metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+	if *reads != 0 {
+		t.Fatalf("expected no reads against the API server, got %d", *reads)
+	}
+
+	// Other namespaces are not cached
+	if _, err := client.Resource(testGVR).Namespace("default").Get(ctx, "c.example.com", metav1.GetOptions{}); !apierrors.IsNotFound(err) || *reads != 1 {
+		t.Fatalf("expected the read to go to the API server, got %v after %d reads", err, *reads)
+	}
+}
+
+func TestCacheReadsOwnWrites(t *testing.T) {
+	cache, fake, _ := newTestCache(t)
+	// Keeps the informer from observing writes, only the write results can make them visible
+	fake.PrependWatchReactor("zones", func(action k8stesting.Action) (bool, watch.Interface, error) {
+		return true, watch.NewFake(), nil
+	})
+	client := cache.Client(testGVR)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !cache.WaitForSync(ctx) {
+		t.Fatal("expected the cache to sync")
+	}
+
+	if _, err := client.Resource(testGVR).Namespace("edgecdnx").Create(ctx, testObject("d.example.com", "demo", "4"), metav1.CreateOptions{}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := client.Resource(testGVR).Namespace("edgecdnx").Delete(ctx, "a.example.com", metav1.DeleteOptions{}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	list, err := client.Resource(testGVR).Namespace("edgecdnx").List(ctx, metav1.ListOptions{LabelSelector: "project=demo"})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if got := names(list); len(got) != 2 || got[0] != "b.example.com" || got[1] != "d.example.com" {
+		t.Fatalf("unexpected items %v", got)
+	}
+	if _, err := client.Resource(testGVR).Namespace("edgecdnx").Get(ctx, "a.example.com", metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+}
+
+func TestCachePendingUntilSynced(t *testing.T) {
+	cache, fake, reads := newTestCache(t)
+	// A resource that is not installed can not be listed, its informer never syncs
+	fake.PrependReactor("list", "unknowns", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewNotFound(unknownGVR.GroupResource(), "")
+	})
+	client := cache.Client(testGVR, unknownGVR)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	if cache.WaitForSync(ctx) {
+		t.Fatal("expected the cache not to sync")
+	}
+	if pending := cache.Pending(); len(pending) != 1 || pending[0] != "unknowns" {
+		t.Fatalf("unexpected pending resources %v", pending)
+	}
+
+	// Synced resources are served from the cache regardless
+	if _, err := client.Resource(testGVR).Namespace("edgecdnx").Get(context.Background(), "a.example.com", metav1.GetOptions{}); err != nil || *reads != 0 {
+		t.Fatalf("expected a cached read, got %v after %d reads", err, *reads)
+	}
+}
+
+func TestCacheRestrictedResource(t *testing.T) {
+	cache, _, _ := newTestCache(t)
+	if err := cache.Restrict(testGVR, "project=demo"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	client := cache.Client(testGVR)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !cache.WaitForSync(ctx) {
+		t.Fatal("expected the cache to sync")
+	}
+
+	list, err := client.Resource(testGVR).Namespace("edgecdnx").List(ctx, metav1.ListOptions{})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if got := names(list); len(got) != 2 || got[0] != "a.example.com" || got[1] != "b.example.com" {
+		t.Fatalf("expected only objects matching the selector, got %v", got)
+	}
+	if _, err := client.Resource(testGVR).Namespace("edgecdnx").Get(ctx, "c.example.com", metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+
+	// Writes outside the selector are not cached either
+	if _, err := client.Resource(testGVR).Namespace("edgecdnx").Create(ctx, testObject("d.example.com", "other", "4"), metav1.CreateOptions{}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, err := client.Resource(testGVR).Namespace("edgecdnx").Get(ctx, "d.example.com", metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+
+	if err := cache.Restrict(testGVR, "project=other"); err == nil {
+		t.Fatal("expected the selector of a cached resource not to change")
+	}
+}
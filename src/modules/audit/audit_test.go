@@ -0,0 +1,222 @@
+package audit
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/EdgeCDN-X/edgecdnx-api/src/internal/logger"
+	"github.com/EdgeCDN-X/edgecdnx-api/src/modules/auth"
+	"github.com/casbin/casbin/v3"
+	"github.com/casbin/casbin/v3/model"
+	"github.com/gin-gonic/gin"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func testService(name string, cache string, keyValue string) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "infrastructure.edgecdnx.com/v1alpha1",
+		"kind":       "Service",
+		"metadata":   map[string]interface{}{"name": name, "namespace": "edgecdnx", "uid": "1234"},
+		"spec": map[string]interface{}{
+			"cache":        cache,
+			"secureKeys":   []interface{}{map[string]interface{}{"name": "key1", "value": keyValue}},
+			"s3OriginSpec": []interface{}{map[string]interface{}{"s3SecretKey": "s3cr3t", "s3BucketName": "bucket"}},
+		},
+	}}
+}
+
+func newTestAuditModule(t *testing.T) (*Module, *gin.Engine) {
+	t.Helper()
+	logger.Init(false)
+	gin.SetMode(gin.TestMode)
+
+	casbinModel, err := model.NewModelFromString(auth.RBACWithDomainModel)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	enforcer, err := casbin.NewSyncedEnforcer(casbinModel)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, err := enforcer.AddPolicy("user@example.com", "demo", "*", "read"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, err := enforcer.AddPolicy("user@example.com", "demo", "service", "update"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	sink, err := newFileSink(filepath.Join(t.TempDir(), "audit.jsonl"))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	t.Cleanup(func() { sink.Close() })
+
+	m := &Module{sinks: []Sink{sink}}
+	m.SetEnforcer(enforcer)
+	m.SetMiddlewares(func(c *gin.Context) {
+		c.Set("user_id", c.GetHeader("X-User"))
+		c.Set("groups", "oidc-ops")
+	})
+
+	router := gin.New()
+	router.Use(m.Middleware())
+	m.RegisterRoutes(router)
+
+	services := router.Group("/project/:project-id/services", m.middlewares...)
+	services.PATCH("/:service-id", auth.NewAuthzBuilder().E(enforcer).T("project-id").R("service").S("user_id").A("update").Build(), func(c *gin.Context) {
+		Change(c, testService(c.Param("service-id"), "1h", "old"), testService(c.Param("service-id"), "2h", "new"))
+		c.Status(http.StatusOK)
+	})
+	services.DELETE("/:service-id", auth.NewAuthzBuilder().E(enforcer).T("project-id").R("service").S("user_id").A("delete").Build(), func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+
+	return m, router
+}
+
+func serve(router *gin.Engine, method string, path string, user string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(method, path, nil)
+	request.Header.Set("X-User", user)
+	router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestSpecDiffRedactsSecrets(t *testing.T) {
+	diff := specDiff(testService("demo", "1h", "old"), testService("demo", "2h", "new"))
+
+	if len(diff) != 2 {
+		t.Fatalf("unexpected diff %#v", diff)
+	}
+	if diff["spec.cache"].Before != "1h" || diff["spec.cache"].After != "2h" {
+		t.Fatalf("unexpected cache change %#v", diff["spec.cache"])
+	}
+	if diff["spec.secureKeys[0].value"].Before != redacted || diff["spec.secureKeys[0].value"].After != redacted {
+		t.Fatalf("expected key value to be redacted, got %#v", diff["spec.secureKeys[0].value"])
+	}
+
+	created := specDiff(nil, testService("demo", "1h", "old"))
+	if created["spec.s3OriginSpec[0].s3SecretKey"].After != redacted {
+		t.Fatalf("expected S3 secret to be redacted, got %#v", created["spec.s3OriginSpec[0].s3SecretKey"])
+	}
+	if created["spec.s3OriginSpec[0].s3BucketName"].After != "bucket" {
+		t.Fatalf("unexpected bucket %#v", created["spec.s3OriginSpec[0].s3BucketName"])
+	}
+}
+
+func TestMiddlewareRecordsMutatingRequests(t *testing.T) {
+	m, router := newTestAuditModule(t)
+
+	if recorder := serve(router, http.MethodPatch, "/project/demo/services/web-abcde", "user@example.com"); recorder.Code != http.StatusOK {
+		t.Fatalf("unexpected status code %d", recorder.Code)
+	} else if recorder.Header().Get(RequestIDHeader) == "" {
+		t.Fatal("expected request ID header")
+	}
+	if recorder := serve(router, http.MethodDelete, "/project/demo/services/web-abcde", "user@example.com"); recorder.Code != http.StatusForbidden {
+		t.Fatalf("unexpected status code %d", recorder.Code)
+	}
+	// Reads are not audited
+	serve(router, http.MethodGet, "/projects/demo/audit", "user@example.com")
+	m.wg.Wait()
+
+	recorder := serve(router, http.MethodGet, "/projects/demo/audit", "user@example.com")
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("unexpected status code %d: %s", recorder.Code, recorder.Body.String())
+	}
+
+	var entries []Entry
+	if err := json.Unmarshal(recorder.Body.Bytes(), &entries); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("unexpected entries %#v", entries)
+	}
+
+	// Newest first
+	denied, updated := entries[0], entries[1]
+	if denied.Action != "delete" || denied.Code != http.StatusForbidden || denied.Target != "web-abcde" {
+		t.Fatalf("unexpected denied entry %#v", denied)
+	}
+	if updated.Actor != "user@example.com" || updated.Project != "demo" || updated.Resource != "service" || updated.Action != "update" {
+		t.Fatalf("unexpected update entry %#v", updated)
+	}
+	if updated.Object == nil || updated.Object.UID != "1234" || updated.Diff["spec.cache"].After != "2h" {
+		t.Fatalf("unexpected change in update entry %#v", updated)
+	}
+	if len(updated.Groups) != 1 || updated.Groups[0] != "oidc-ops" || updated.RequestID == "" {
+		t.Fatalf("unexpected request details %#v", updated)
+	}
+
+	recorder = serve(router, http.MethodGet, "/projects/demo/audit?action=update&limit=5", "user@example.com")
+	if err := json.Unmarshal(recorder.Body.Bytes(), &entries); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Action != "update" {
+		t.Fatalf("unexpected filtered entries %#v", entries)
+	}
+
+	if recorder := serve(router, http.MethodGet, "/projects/other/audit", "user@example.com"); recorder.Code != http.StatusForbidden {
+		t.Fatalf("unexpected status code %d", recorder.Code)
+	}
+}
+
+func TestMiddlewareReplacesInvalidRequestIDs(t *testing.T) {
+	_, router := newTestAuditModule(t)
+
+	for requestID, kept := range map[string]bool{
+		"b7f3c2d1-trace.42":      true,
+		"bad id\nforged: entry":  false,
+		strings.Repeat("a", 129): false,
+		"<script>alert</script>": false,
+	} {
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodGet, "/projects/demo/audit", nil)
+		request.Header.Set("X-User", "user@example.com")
+		request.Header.Set(RequestIDHeader, requestID)
+		router.ServeHTTP(recorder, request)
+
+		got := recorder.Header().Get(RequestIDHeader)
+		if (got == requestID) != kept || got == "" {
+			t.Fatalf("unexpected request ID %q for %q", got, requestID)
+		}
+	}
+}
+
+func TestFileSinkQueryReadsFromTheEnd(t *testing.T) {
+	sink, err := newFileSink(filepath.Join(t.TempDir(), "audit.jsonl"))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	t.Cleanup(func() { sink.Close() })
+
+	// Enough entries to span several chunks
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := range 2000 {
+		entry := Entry{ID: strconv.Itoa(i), Time: start.Add(time.Duration(i) * time.Second), Project: "demo", Action: "update", Path: strings.Repeat("/p", 20)}
+		if err := sink.Write(t.Context(), entry); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+
+	entries, err := sink.Query(t.Context(), "demo", QueryDto{Limit: 3})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(entries) != 3 || entries[0].ID != "1999" || entries[2].ID != "1997" {
+		t.Fatalf("unexpected newest entries %#v", entries)
+	}
+
+	entries, err = sink.Query(t.Context(), "demo", QueryDto{Limit: 2, Until: start.Add(time.Second)})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(entries) != 2 || entries[0].ID != "1" || entries[1].ID != "0" {
+		t.Fatalf("unexpected oldest entries %#v", entries)
+	}
+}
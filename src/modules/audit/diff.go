@@ -0,0 +1,136 @@
+package audit
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const redacted = "[REDACTED]"
+
+// Field names holding credentials, matched case insensitively against the last path segment
+var sensitiveFields = []string{"secret", "password", "token", "privatekey", "accesskey"}
+
+// Parent fields whose "value" children are credentials, e.g. spec.secureKeys[0].value
+var sensitiveValueParents = []string{"securekeys"}
+
+// toUnstructured accepts unstructured objects and typed API objects
+func toUnstructured(obj interface{}) *unstructured.Unstructured {
+	switch o := obj.(type) {
+	case nil:
+		return nil
+	case *unstructured.Unstructured:
+		return o
+	}
+
+	if v := reflect.ValueOf(obj); v.Kind() == reflect.Pointer && v.IsNil() {
+		return nil
+	}
+
+	objMap, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil
+	}
+	return &unstructured.Unstructured{Object: objMap}
+}
+
+func objectRef(obj *unstructured.Unstructured) *ObjectRef {
+	return &ObjectRef{
+		APIVersion: obj.GetAPIVersion(),
+		Kind:       obj.GetKind(),
+		Namespace:  obj.GetNamespace(),
+		Name:       obj.GetName(),
+		UID:        string(obj.GetUID()),
+	}
+}
+
+// specDiff compares the spec of two objects field by field. Either side may be nil on create or delete.
+func specDiff(before *unstructured.Unstructured, after *unstructured.Unstructured) map[string]FieldChange {
+	oldFields := map[string]interface{}{}
+	newFields := map[string]interface{}{}
+	if before != nil {
+		flatten("spec", before.Object["spec"], oldFields)
+	}
+	if after != nil {
+		flatten("spec", after.Object["spec"], newFields)
+	}
+
+	diff := map[string]FieldChange{}
+	for path, oldValue := range oldFields {
+		newValue, ok := newFields[path]
+		if ok && reflect.DeepEqual(oldValue, newValue) {
+			continue
+		}
+		change := FieldChange{Before: oldValue}
+		if ok {
+			change.After = newValue
+		}
+		diff[path] = redact(path, change)
+	}
+	for path, newValue := range newFields {
+		if _, ok := oldFields[path]; !ok {
+			diff[path] = redact(path, FieldChange{After: newValue})
+		}
+	}
+
+	return diff
+}
+
+// flatten turns nested maps and slices into dotted paths, e.g. spec.hostAliases[0].name
+func flatten(prefix string, value interface{}, out map[string]interface{}) {
+	switch v := value.(type) {
+	case nil:
+	case map[string]interface{}:
+		for key, item := range v {
+			flatten(prefix+"."+key, item, out)
+		}
+	case []interface{}:
+		for i, item := range v {
+			flatten(fmt.Sprintf("%s[%d]", prefix, i), item, out)
+		}
+	default:
+		out[prefix] = v
+	}
+}
+
+func redact(path string, change FieldChange) FieldChange {
+	if !isSensitive(path) {
+		return change
+	}
+	if change.Before != nil {
+		change.Before = redacted
+	}
+	if change.After != nil {
+		change.After = redacted
+	}
+	return change
+}
+
+func isSensitive(path string) bool {
+	segments := strings.Split(strings.ToLower(path), ".")
+	for i := range segments {
+		if idx := strings.IndexByte(segments[i], '['); idx >= 0 {
+			segments[i] = segments[i][:idx]
+		}
+	}
+
+	last := segments[len(segments)-1]
+	for _, field := range sensitiveFields {
+		if strings.Contains(last, field) {
+			return true
+		}
+	}
+
+	if last == "value" && len(segments) > 1 {
+		for _, parent := range sensitiveValueParents {
+			if segments[len(segments)-2] == parent {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,47 @@
+package audit
+
+import "time"
+
+// Entry is a single audited request
+type Entry struct {
+	ID        string                 `json:"id"`
+	Time      time.Time              `json:"time"`
+	RequestID string                 `json:"requestId"`
+	Actor     string                 `json:"actor"`
+	Groups    []string               `json:"groups,omitempty"`
+	TokenID   string                 `json:"tokenId,omitempty"`
+	Project   string                 `json:"project"`
+	Resource  string                 `json:"resource"`
+	Action    string                 `json:"action"`
+	Target    string                 `json:"target,omitempty"`
+	Method    string                 `json:"method"`
+	Path      string                 `json:"path"`
+	Code      int                    `json:"code"`
+	Diff      map[string]FieldChange `json:"diff,omitempty"`
+	// Object references the Kubernetes object the request acted on, if known
+	Object *ObjectRef `json:"object,omitempty"`
+}
+
+// FieldChange holds the old and new value of a single spec field. Secrets are redacted.
+type FieldChange struct {
+	Before interface{} `json:"before,omitempty"`
+	After  interface{} `json:"after,omitempty"`
+}
+
+type ObjectRef struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Namespace  string `json:"namespace,omitempty"`
+	Name       string `json:"name"`
+	UID        string `json:"uid,omitempty"`
+}
+
+type QueryDto struct {
+	Actor    string    `form:"actor"`
+	Resource string    `form:"resource"`
+	Action   string    `form:"action"`
+	Target   string    `form:"target"`
+	Since    time.Time `form:"since" time_format:"2006-01-02T15:04:05Z07:00"`
+	Until    time.Time `form:"until" time_format:"2006-01-02T15:04:05Z07:00"`
+	Limit    int       `form:"limit" binding:"omitempty,min=1,max=1000"`
+}
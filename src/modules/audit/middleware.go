@@ -0,0 +1,156 @@
+package audit
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/EdgeCDN-X/edgecdnx-api/src/internal/logger"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const (
+	RequestIDHeader = "X-Request-Id"
+
+	changeKey   = "audit_change"
+	sinkTimeout = 10 * time.Second
+)
+
+// Actions derived from the HTTP method when a request did not pass AuthzBuilder
+var methodActions = map[string]string{
+	"POST":   "create",
+	"PUT":    "update",
+	"PATCH":  "update",
+	"DELETE": "delete",
+}
+
+// Client supplied request IDs end up in audit records and logs, anything else is replaced by a generated one
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+type change struct {
+	before *unstructured.Unstructured
+	after  *unstructured.Unstructured
+}
+
+// Change records the object a mutating request acted on. before is nil on create, after is nil on delete.
+// Handlers call it once the change is persisted, the middleware picks it up when the request completes.
+func Change(c *gin.Context, before interface{}, after interface{}) {
+	c.Set(changeKey, &change{before: toUnstructured(before), after: toUnstructured(after)})
+}
+
+// Middleware assigns a request ID to every request and audits every mutating request that was
+// authorized by AuthzBuilder or reported a change. It has to run before the auth middleware.
+func (m *Module) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := c.GetHeader(RequestIDHeader)
+		if !requestIDPattern.MatchString(requestID) {
+			requestID = newID()
+		}
+		c.Set("request_id", requestID)
+		c.Header(RequestIDHeader, requestID)
+
+		c.Next()
+
+		if _, ok := methodActions[c.Request.Method]; !ok {
+			return
+		}
+
+		entry, ok := entryFromContext(c)
+		if !ok {
+			return
+		}
+
+		m.emit(entry)
+	}
+}
+
+func entryFromContext(c *gin.Context) (Entry, bool) {
+	var ch *change
+	if v, ok := c.Get(changeKey); ok {
+		ch, _ = v.(*change)
+	}
+
+	resource := c.GetString("authz_resource")
+	if resource == "" && ch == nil {
+		return Entry{}, false
+	}
+
+	entry := Entry{
+		ID:        newID(),
+		Time:      time.Now().UTC(),
+		RequestID: c.GetString("request_id"),
+		Actor:     c.GetString("user_id"),
+		TokenID:   c.GetString("token_id"),
+		Project:   c.GetString("authz_tenant"),
+		Resource:  resource,
+		Action:    c.GetString("authz_action"),
+		Method:    c.Request.Method,
+		Path:      c.Request.URL.Path,
+		Code:      c.Writer.Status(),
+	}
+
+	if groups := c.GetString("groups"); groups != "" {
+		entry.Groups = strings.Split(groups, ",")
+	}
+
+	if entry.Project == "" {
+		entry.Project = c.Param("project-id")
+	}
+	if entry.Action == "" {
+		entry.Action = methodActions[c.Request.Method]
+	}
+
+	// Without a reported change the target is the innermost path parameter
+	if len(c.Params) > 0 {
+		entry.Target = c.Params[len(c.Params)-1].Value
+	}
+
+	if ch != nil {
+		obj := ch.after
+		if obj == nil {
+			obj = ch.before
+		}
+		if obj != nil {
+			entry.Object = objectRef(obj)
+			entry.Target = obj.GetName()
+			if entry.Resource == "" {
+				entry.Resource = strings.ToLower(obj.GetKind())
+			}
+			// Projects are created outside of any project scope
+			if entry.Project == "" && obj.GetKind() == "Project" {
+				entry.Project = obj.GetName()
+			}
+		}
+		entry.Diff = specDiff(ch.before, ch.after)
+	}
+
+	return entry, true
+}
+
+// emit hands the entry to every sink without holding up the response
+func (m *Module) emit(entry Entry) {
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+
+		ctx, cancel := context.WithTimeout(context.Background(), sinkTimeout)
+		defer cancel()
+
+		for _, sink := range m.sinks {
+			if err := sink.Write(ctx, entry); err != nil {
+				logger.L().Error("Failed to write audit entry", zap.String("requestId", entry.RequestID), zap.Error(err))
+			}
+		}
+	}()
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
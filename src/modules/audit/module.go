@@ -0,0 +1,94 @@
+package audit
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/EdgeCDN-X/edgecdnx-api/src/internal/logger"
+	"github.com/EdgeCDN-X/edgecdnx-api/src/modules/app"
+	"github.com/casbin/casbin/v3"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	SinkZap    = "zap"
+	SinkEvents = "events"
+	SinkFile   = "file"
+)
+
+type Config struct {
+	Namespace string
+	// Sinks lists the enabled sinks, any of zap, events and file
+	Sinks []string
+	// File is the JSONL file written by the file sink. It also backs the audit query endpoint.
+	File string
+}
+
+type Module struct {
+	cfg         Config
+	middlewares []gin.HandlerFunc
+	enforcer    *casbin.SyncedEnforcer
+	sinks       []Sink
+	wg          sync.WaitGroup
+}
+
+func New(cfg Config) *Module {
+	return &Module{cfg: cfg}
+}
+
+func (m *Module) Init() error {
+	logger.L().Info("Initializing module")
+
+	for _, name := range m.cfg.Sinks {
+		switch name {
+		case "":
+			continue
+		case SinkZap:
+			m.sinks = append(m.sinks, &zapSink{})
+		case SinkEvents:
+			client, _, err := app.GetK8SClient()
+			if err != nil {
+				return err
+			}
+			m.sinks = append(m.sinks, &eventSink{client: client, namespace: m.cfg.Namespace})
+		case SinkFile:
+			sink, err := newFileSink(m.cfg.File)
+			if err != nil {
+				return err
+			}
+			m.sinks = append(m.sinks, sink)
+		default:
+			return fmt.Errorf("unknown audit sink %q", name)
+		}
+	}
+
+	return nil
+}
+
+// Shutdown waits for pending entries to be written before closing the sinks
+func (m *Module) Shutdown() {
+	m.wg.Wait()
+	for _, sink := range m.sinks {
+		if closer, ok := sink.(interface{ Close() error }); ok {
+			closer.Close()
+		}
+	}
+}
+
+func (m *Module) SetMiddlewares(middlewares ...gin.HandlerFunc) {
+	m.middlewares = middlewares
+}
+
+func (m *Module) SetEnforcer(enforcer *casbin.SyncedEnforcer) {
+	m.enforcer = enforcer
+}
+
+// querier returns the first sink able to answer audit queries
+func (m *Module) querier() Querier {
+	for _, sink := range m.sinks {
+		if q, ok := sink.(Querier); ok {
+			return q
+		}
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package audit
+
+import (
+	"github.com/EdgeCDN-X/edgecdnx-api/src/modules/auth"
+	"github.com/gin-gonic/gin"
+)
+
+func (m *Module) RegisterRoutes(r *gin.Engine) {
+	group := r.Group("/projects/:project-id/audit", m.middlewares...)
+
+	group.GET("", auth.NewAuthzBuilder().E(m.enforcer).T("project-id").R("audit").S("user_id").A("read").Build(), func(c *gin.Context) {
+		var query QueryDto
+		if err := c.ShouldBindQuery(&query); err != nil {
+			c.JSON(400, gin.H{"error": "invalid query: " + err.Error()})
+			return
+		}
+
+		querier := m.querier()
+		if querier == nil {
+			c.JSON(501, gin.H{"error": "no queryable audit sink is configured"})
+			return
+		}
+
+		entries, err := querier.Query(c, c.Param("project-id"), query)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "failed to read audit log: " + err.Error()})
+			return
+		}
+
+		c.JSON(200, entries)
+		return
+	})
+}
@@ -0,0 +1,222 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+
+	"github.com/EdgeCDN-X/edgecdnx-api/src/internal/logger"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Sink receives every audit entry
+type Sink interface {
+	Write(ctx context.Context, entry Entry) error
+}
+
+// Querier is implemented by sinks able to read entries back
+type Querier interface {
+	Query(ctx context.Context, project string, query QueryDto) ([]Entry, error)
+}
+
+type zapSink struct{}
+
+func (s *zapSink) Write(ctx context.Context, entry Entry) error {
+	logger.L().Info("Audit",
+		zap.String("requestId", entry.RequestID),
+		zap.String("actor", entry.Actor),
+		zap.Strings("groups", entry.Groups),
+		zap.String("project", entry.Project),
+		zap.String("resource", entry.Resource),
+		zap.String("action", entry.Action),
+		zap.String("target", entry.Target),
+		zap.Int("code", entry.Code),
+		zap.Any("diff", entry.Diff),
+	)
+	return nil
+}
+
+// eventSink records a Kubernetes Event on the object the request acted on
+type eventSink struct {
+	client    kubernetes.Interface
+	namespace string
+}
+
+func (s *eventSink) Write(ctx context.Context, entry Entry) error {
+	if entry.Object == nil {
+		return nil
+	}
+
+	namespace := entry.Object.Namespace
+	if namespace == "" {
+		namespace = s.namespace
+	}
+
+	eventType := corev1.EventTypeNormal
+	if entry.Code >= 400 {
+		eventType = corev1.EventTypeWarning
+	}
+
+	now := metav1.NewTime(entry.Time)
+	_, err := s.client.CoreV1().Events(namespace).Create(ctx, &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: entry.Object.Name + "-audit-",
+			Namespace:    namespace,
+		},
+		InvolvedObject: corev1.ObjectReference{
+			APIVersion: entry.Object.APIVersion,
+			Kind:       entry.Object.Kind,
+			Namespace:  entry.Object.Namespace,
+			Name:       entry.Object.Name,
+			UID:        types.UID(entry.Object.UID),
+		},
+		Reason:         "Audit",
+		Message:        fmt.Sprintf("%s %s %s %s (%d, request %s)", entry.Actor, entry.Action, entry.Resource, entry.Target, entry.Code, entry.RequestID),
+		Type:           eventType,
+		Source:         corev1.EventSource{Component: "edgecdnx-api"},
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+	}, metav1.CreateOptions{})
+	return err
+}
+
+// fileSink appends one JSON document per line. The file is never rewritten.
+type fileSink struct {
+	mu   sync.Mutex
+	path string
+	file *os.File
+}
+
+func newFileSink(path string) (*fileSink, error) {
+	if path == "" {
+		return nil, fmt.Errorf("audit file sink requires a file path")
+	}
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit file: %w", err)
+	}
+
+	return &fileSink{path: path, file: file}, nil
+}
+
+func (s *fileSink) Write(ctx context.Context, entry Entry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.file.Write(append(line, '\n'))
+	return err
+}
+
+const (
+	queryChunkSize = 64 * 1024
+	// maxQueryScan bounds how much of the file a single query reads, counted from its end
+	maxQueryScan = 64 * 1024 * 1024
+)
+
+// Query reads the file backwards and returns the newest matching entries first. It stops once
+// limit entries matched or maxQueryScan bytes were read, older entries are paged with until.
+func (s *fileSink) Query(ctx context.Context, project string, query QueryDto) ([]Entry, error) {
+	file, err := os.Open(s.path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	limit := query.Limit
+	if limit == 0 {
+		limit = 100
+	}
+
+	entries := []Entry{}
+	collect := func(line []byte) {
+		var entry Entry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			// A partially written last line must not break reads
+			return
+		}
+		if entry.Project != project || !matches(entry, query) {
+			return
+		}
+		entries = append(entries, entry)
+	}
+
+	var partial []byte
+	offset := info.Size()
+	for offset > 0 && info.Size()-offset < maxQueryScan && len(entries) < limit {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		size := min(queryChunkSize, offset)
+		offset -= size
+		chunk := make([]byte, size, size+int64(len(partial)))
+		if _, err := file.ReadAt(chunk, offset); err != nil {
+			return nil, err
+		}
+		chunk = append(chunk, partial...)
+
+		// The first line may start in the chunk before this one
+		lines := bytes.Split(chunk, []byte{'\n'})
+		partial = lines[0]
+		for i := len(lines) - 1; i > 0; i-- {
+			collect(lines[i])
+		}
+	}
+	if offset == 0 && len(entries) < limit {
+		collect(partial)
+	}
+
+	// Concurrent requests may be written slightly out of order
+	slices.SortStableFunc(entries, func(a, b Entry) int { return b.Time.Compare(a.Time) })
+	if len(entries) > limit {
+		entries = entries[:limit]
+	}
+	return entries, nil
+}
+
+func (s *fileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
+
+func matches(entry Entry, query QueryDto) bool {
+	if query.Actor != "" && entry.Actor != query.Actor {
+		return false
+	}
+	if query.Resource != "" && entry.Resource != query.Resource {
+		return false
+	}
+	if query.Action != "" && entry.Action != query.Action {
+		return false
+	}
+	if query.Target != "" && entry.Target != query.Target {
+		return false
+	}
+	if !query.Since.IsZero() && entry.Time.Before(query.Since) {
+		return false
+	}
+	if !query.Until.IsZero() && entry.Time.After(query.Until) {
+		return false
+	}
+	return true
+}
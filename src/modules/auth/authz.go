@@ -1,16 +1,26 @@
 package auth
 
 import (
-	"strings"
+	"fmt"
 
 	"github.com/EdgeCDN-X/edgecdnx-api/src/internal/logger"
+	infrastructurev1alpha1 "github.com/EdgeCDN-X/edgecdnx-controller/api/v1alpha1"
 	"github.com/casbin/casbin/v3"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 )
 
+// Resources checked by AuthzBuilder on project scoped routes
+var ProjectResources = []string{"service", "zone", "project", "member", "token", "audit", "secret", "prefixlist"}
+
+// Resources only checked against the default admin project
+var AdminResources = []string{"location", "authz"}
+
+// Actions checked by AuthzBuilder
+var Actions = []string{"create", "read", "update", "delete", "purge"}
+
 type AuthzBuilder struct {
-	Enforcer     *casbin.Enforcer
+	Enforcer     *casbin.SyncedEnforcer
 	Subject      string
 	Tenant       string
 	StaticTenant string
@@ -22,7 +32,7 @@ func NewAuthzBuilder() *AuthzBuilder {
 	return &AuthzBuilder{}
 }
 
-func (b *AuthzBuilder) E(enforcer *casbin.Enforcer) *AuthzBuilder {
+func (b *AuthzBuilder) E(enforcer *casbin.SyncedEnforcer) *AuthzBuilder {
 	b.Enforcer = enforcer
 	return b
 }
@@ -60,34 +70,26 @@ func (b *AuthzBuilder) Build() gin.HandlerFunc {
 			tenant = b.StaticTenant
 		}
 
-		resource := b.Resource
-		action := b.Action
-		groupsStr := c.GetString("groups")
-		groups := strings.SplitSeq(groupsStr, ",")
+		// Exposed for the audit log, which records denied attempts as well
+		c.Set("authz_tenant", tenant)
+		c.Set("authz_resource", b.Resource)
+		c.Set("authz_action", b.Action)
 
-		for g := range groups {
-			allowed, err := b.Enforcer.Enforce(g, tenant, resource, action)
-			if err != nil {
-				logger.L().Error("Failed to enforce policy", zap.Error(err))
-				c.AbortWithStatusJSON(500, gin.H{"error": "internal error"})
-				return
-			}
-			if allowed {
-				logger.L().Debug("Access granted via group policy", zap.String("group", g), zap.String("tenant", tenant), zap.String("resource", resource), zap.String("action", action))
-				c.Next()
-				return
-			}
+		// API tokens are scoped to the project they were issued in
+		if tokenProject := c.GetString("token_project"); tokenProject != "" && tokenProject != tenant {
+			logger.L().Debug("Access denied for token outside of its project", zap.String("subject", subject), zap.String("tenant", tenant), zap.String("tokenProject", tokenProject))
+			c.AbortWithStatusJSON(403, gin.H{"error": "forbidden"})
+			return
 		}
 
-		allowed, err := b.Enforcer.Enforce(subject, tenant, resource, action)
-
+		allowed, err := Authorize(b.Enforcer, subject, callerGroups(c), tenant, b.Resource, b.Action)
 		if err != nil {
 			logger.L().Error("Failed to enforce policy", zap.Error(err))
 			c.AbortWithStatusJSON(500, gin.H{"error": "internal error"})
 			return
 		}
 		if !allowed {
-			logger.L().Debug("Access denied", zap.String("subject", subject), zap.String("tenant", tenant), zap.String("resource", resource), zap.String("action", action))
+			logger.L().Debug("Access denied", zap.String("subject", subject), zap.String("tenant", tenant), zap.String("resource", b.Resource), zap.String("action", b.Action))
 			c.AbortWithStatusJSON(403, gin.H{"error": "forbidden"})
 			return
 		}
@@ -95,3 +97,54 @@ func (b *AuthzBuilder) Build() gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// Authorize evaluates a request the way every route does: each group first, then the subject itself
+func Authorize(enforcer *casbin.SyncedEnforcer, subject string, groups []string, tenant string, resource string, action string) (bool, error) {
+	for _, g := range groups {
+		allowed, err := enforcer.Enforce(g, tenant, resource, action)
+		if err != nil {
+			return false, err
+		}
+		if allowed {
+			logger.L().Debug("Access granted via group policy", zap.String("group", g), zap.String("tenant", tenant), zap.String("resource", resource), zap.String("action", action))
+			return true, nil
+		}
+	}
+
+	return enforcer.Enforce(subject, tenant, resource, action)
+}
+
+// AuthorizeRequest repeats the check a route built by AuthzBuilder does for the caller of c. Long lived streams use it
+// to drop connections once permissions are revoked.
+func AuthorizeRequest(enforcer *casbin.SyncedEnforcer, c *gin.Context, tenant string, resource string, action string) (bool, error) {
+	if tokenProject := c.GetString("token_project"); tokenProject != "" && tokenProject != tenant {
+		return false, nil
+	}
+	return Authorize(enforcer, c.GetString("user_id"), callerGroups(c), tenant, resource, action)
+}
+
+// CheckRoleGrantable makes sure the caller of c holds every permission in the rules of role, so granting or defining
+// the role in the project does not escalate the caller's own access.
+func CheckRoleGrantable(enforcer *casbin.SyncedEnforcer, c *gin.Context, project string, role string, rules []infrastructurev1alpha1.RuleSpec) (int, error) {
+	return checkRulesGrantable(enforcer, c.GetString("user_id"), callerGroups(c), project, role, rules)
+}
+
+func checkRulesGrantable(enforcer *casbin.SyncedEnforcer, subject string, groups []string, project string, role string, rules []infrastructurev1alpha1.RuleSpec) (int, error) {
+	for _, rule := range rules {
+		// Routes only ever check concrete resources, the wildcard stands for all of them
+		resources := []string{rule.V2}
+		if rule.V2 == "*" {
+			resources = ProjectResources
+		}
+		for _, resource := range resources {
+			allowed, err := Authorize(enforcer, subject, groups, project, resource, rule.V3)
+			if err != nil {
+				return 500, fmt.Errorf("failed to authorize: %w", err)
+			}
+			if !allowed {
+				return 403, fmt.Errorf("role %s grants %s %s, which you do not hold yourself", role, rule.V3, resource)
+			}
+		}
+	}
+	return 200, nil
+}
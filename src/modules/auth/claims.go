@@ -0,0 +1,118 @@
+package auth
+
+import (
+	"fmt"
+	"strings"
+)
+
+// parseClaimPath splits a claim path into its keys. Paths are dotted, may start with "$." and may
+// quote keys containing dots in brackets, e.g. resource_access["my.client"].roles.
+func parseClaimPath(path string) ([]string, error) {
+	path = strings.TrimPrefix(strings.TrimSpace(path), "$.")
+	if path == "" {
+		return nil, fmt.Errorf("empty claim path")
+	}
+
+	keys := []string{}
+	var current strings.Builder
+	for i := 0; i < len(path); i++ {
+		switch path[i] {
+		case '.':
+			if current.Len() > 0 {
+				keys = append(keys, current.String())
+				current.Reset()
+			}
+		case '[':
+			if current.Len() > 0 {
+				keys = append(keys, current.String())
+				current.Reset()
+			}
+			end := strings.IndexByte(path[i:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated bracket in claim path %q", path)
+			}
+			key := strings.Trim(path[i+1:i+end], `"'`)
+			if key == "" {
+				return nil, fmt.Errorf("empty key in claim path %q", path)
+			}
+			keys = append(keys, key)
+			i += end
+		default:
+			current.WriteByte(path[i])
+		}
+	}
+	if current.Len() > 0 {
+		keys = append(keys, current.String())
+	}
+
+	return keys, nil
+}
+
+// lookupClaim resolves a claim path. A top-level claim named exactly like the path wins, so namespaced
+// claims such as https://example.com/groups keep working.
+func lookupClaim(claims map[string]interface{}, path string) (interface{}, bool) {
+	if v, ok := claims[path]; ok {
+		return v, true
+	}
+
+	keys, err := parseClaimPath(path)
+	if err != nil {
+		return nil, false
+	}
+
+	var current interface{} = claims
+	for _, key := range keys {
+		obj, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		current, ok = obj[key]
+		if !ok {
+			return nil, false
+		}
+	}
+
+	return current, true
+}
+
+// claimString resolves a claim that has to be a non empty string
+func claimString(claims map[string]interface{}, path string) (string, error) {
+	v, ok := lookupClaim(claims, path)
+	if !ok {
+		return "", fmt.Errorf("claim %q not found in token", path)
+	}
+
+	s, ok := v.(string)
+	if !ok || s == "" {
+		return "", fmt.Errorf("claim %q is not a non-empty string", path)
+	}
+
+	return s, nil
+}
+
+// claimStrings resolves a claim holding a list of strings, either as an array or as a space or comma separated string
+func claimStrings(claims map[string]interface{}, path string) ([]string, error) {
+	v, ok := lookupClaim(claims, path)
+	if !ok {
+		return nil, fmt.Errorf("claim %q not found in token", path)
+	}
+
+	switch value := v.(type) {
+	case string:
+		return strings.FieldsFunc(value, func(r rune) bool { return r == ' ' || r == ',' }), nil
+	case []interface{}:
+		ret := make([]string, 0, len(value))
+		for _, item := range value {
+			s, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("claim %q contains a non-string value", path)
+			}
+			if s = strings.TrimSpace(s); s != "" {
+				ret = append(ret, s)
+			}
+		}
+		return ret, nil
+	default:
+		return nil, fmt.Errorf("claim %q is neither a string nor an array", path)
+	}
+}
@@ -0,0 +1,82 @@
+package auth
+
+import (
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+var keycloakClaims = map[string]interface{}{
+	"email": "jane@example.com",
+	"realm_access": map[string]interface{}{
+		"roles": []interface{}{"offline_access", "ops"},
+	},
+	"resource_access": map[string]interface{}{
+		"edgecdnx.portal": map[string]interface{}{
+			"roles": []interface{}{"admin"},
+		},
+	},
+	"scope":                      "openid profile email",
+	"https://example.com/groups": []interface{}{"namespaced"},
+	"count":                      3.0,
+}
+
+func TestClaimStringsResolvesPaths(t *testing.T) {
+	for path, want := range map[string][]string{
+		"realm_access.roles":                          {"offline_access", "ops"},
+		"$.realm_access.roles":                        {"offline_access", "ops"},
+		`resource_access["edgecdnx.portal"].roles`:    {"admin"},
+		`resource_access['edgecdnx.portal']['roles']`: {"admin"},
+		"scope":                      {"openid", "profile", "email"},
+		"https://example.com/groups": {"namespaced"},
+	} {
+		got, err := claimStrings(keycloakClaims, path)
+		if err != nil {
+			t.Fatalf("%s: expected no error, got %v", path, err)
+		}
+		if !slices.Equal(got, want) {
+			t.Fatalf("%s: unexpected values %#v", path, got)
+		}
+	}
+}
+
+func TestClaimLookupFailures(t *testing.T) {
+	for _, path := range []string{"groups", "realm_access.groups", "email.domain", `resource_access["edgecdnx.portal"`, "count"} {
+		if _, err := claimStrings(keycloakClaims, path); err == nil {
+			t.Fatalf("%s: expected error", path)
+		}
+	}
+
+	if _, err := claimString(keycloakClaims, "realm_access"); err == nil {
+		t.Fatal("expected error for non-string user claim")
+	}
+}
+
+func TestAuthMiddlewareUsesNestedClaims(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	m := newTestAuthModule(t, Config{})
+
+	key := newTestSigningKey(t)
+	addTestIssuer(m, OIDCIssuer{IssuerURL: "https://sso.example.com", ClientIDs: []string{"portal"}, UserClaim: "email", GroupsClaim: "realm_access.roles", GroupPrefix: "oidc-"}, key)
+
+	claims := map[string]interface{}{"iss": "https://sso.example.com", "aud": "portal"}
+	for k, v := range keycloakClaims {
+		claims[k] = v
+	}
+
+	recorder, captured := serveWithToken(t, m, signTestToken(t, key, claims))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("unexpected status code %d: %s", recorder.Code, recorder.Body.String())
+	}
+	if captured["groups"] != "oidc-offline_access,oidc-ops" {
+		t.Fatalf("unexpected groups %q", captured["groups"])
+	}
+
+	delete(claims, "realm_access")
+	recorder, _ = serveWithToken(t, m, signTestToken(t, key, claims))
+	if recorder.Code != http.StatusUnauthorized {
+		t.Fatalf("expected missing groups claim to be rejected, got %d", recorder.Code)
+	}
+}
@@ -0,0 +1,59 @@
+package auth
+
+import "time"
+
+type CreateTokenDto struct {
+	Name      string     `json:"name" binding:"required,min=3,max=63"`
+	Kind      string     `json:"kind" binding:"required,oneof=personal serviceaccount"`
+	Role      string     `json:"role,omitempty" binding:"omitempty,max=63"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+type TokenDto struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Kind       string     `json:"kind"`
+	Project    string     `json:"project"`
+	Subject    string     `json:"subject"`
+	Role       string     `json:"role,omitempty"`
+	Groups     []string   `json:"groups,omitempty"`
+	CreatedBy  string     `json:"createdBy"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	ExpiresAt  *time.Time `json:"expiresAt,omitempty"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+	// Token holds the plaintext bearer token. It is only returned once, on creation.
+	Token string `json:"token,omitempty"`
+}
+
+type PermissionDto struct {
+	Resource string `json:"resource"`
+	Action   string `json:"action"`
+}
+
+type MeDto struct {
+	UserId      string                     `json:"user_id"`
+	Groups      []string                   `json:"groups"`
+	Claims      map[string]interface{}     `json:"claims"`
+	Permissions map[string][]PermissionDto `json:"permissions"`
+}
+
+type AuthzCheckDto struct {
+	Project  string `json:"project" binding:"required"`
+	Resource string `json:"resource" binding:"required"`
+	Action   string `json:"action" binding:"required"`
+}
+
+type AuthzCheckRequestDto struct {
+	Checks []AuthzCheckDto `json:"checks" binding:"required,min=1,max=100,dive"`
+}
+
+type AuthzCheckResultDto struct {
+	AuthzCheckDto
+	Allowed bool `json:"allowed"`
+}
+
+type AuthzCheckResponseDto struct {
+	Subject string                `json:"subject"`
+	Groups  []string              `json:"groups"`
+	Results []AuthzCheckResultDto `json:"results"`
+}
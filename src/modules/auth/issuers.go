@@ -0,0 +1,152 @@
+package auth
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+)
+
+// OIDCIssuer describes one trusted identity provider
+type OIDCIssuer struct {
+	IssuerURL string
+	// ClientIDs lists the accepted audiences. At least one has to be present in the token.
+	ClientIDs   []string
+	UserClaim   string
+	GroupsClaim string
+	// GroupPrefix is prepended to every group of this issuer before it reaches Casbin
+	GroupPrefix string
+	// SubjectPrefix is prepended to the user id so identical users of different issuers stay apart
+	SubjectPrefix string
+	// GroupMappings binds groups of this issuer to roles, their OIDCGroup already carries GroupPrefix
+	GroupMappings []OIDCGroupMapping
+}
+
+type issuerVerifier struct {
+	OIDCIssuer
+	verifier *oidc.IDTokenVerifier
+}
+
+// validateIssuers makes sure a subject or group name can always be traced back to exactly one issuer
+func validateIssuers(issuers []OIDCIssuer) error {
+	if len(issuers) == 0 {
+		return fmt.Errorf("at least one OIDC issuer has to be configured")
+	}
+
+	urls := []string{}
+	subjectPrefixes := []string{}
+	groupPrefixes := []string{}
+	for _, issuer := range issuers {
+		if issuer.IssuerURL == "" {
+			return fmt.Errorf("OIDC issuer URL must not be empty")
+		}
+		if len(issuer.ClientIDs) == 0 {
+			return fmt.Errorf("OIDC issuer %s has no client IDs", issuer.IssuerURL)
+		}
+		if slices.Contains(urls, issuer.IssuerURL) {
+			return fmt.Errorf("OIDC issuer %s is configured twice", issuer.IssuerURL)
+		}
+		if slices.Contains(subjectPrefixes, issuer.SubjectPrefix) {
+			return fmt.Errorf("OIDC issuer %s reuses subject prefix %q, subjects of different issuers could collide", issuer.IssuerURL, issuer.SubjectPrefix)
+		}
+		if slices.Contains(groupPrefixes, issuer.GroupPrefix) {
+			return fmt.Errorf("OIDC issuer %s reuses group prefix %q, groups of different issuers could collide", issuer.IssuerURL, issuer.GroupPrefix)
+		}
+		urls = append(urls, issuer.IssuerURL)
+		subjectPrefixes = append(subjectPrefixes, issuer.SubjectPrefix)
+		groupPrefixes = append(groupPrefixes, issuer.GroupPrefix)
+	}
+
+	return nil
+}
+
+// validateGroupMappings makes sure every mapped group carries the group prefix of a configured issuer,
+// a mapping no issuer can produce would never match
+func validateGroupMappings(issuers []OIDCIssuer, mappings []OIDCGroupMapping) error {
+	for _, mapping := range mappings {
+		if !slices.ContainsFunc(issuers, func(issuer OIDCIssuer) bool { return strings.HasPrefix(mapping.OIDCGroup, issuer.GroupPrefix) }) {
+			return fmt.Errorf("OIDC group mapping %s does not carry the group prefix of any configured issuer", mapping.OIDCGroup)
+		}
+	}
+	return nil
+}
+
+// groupMappings returns the global OIDC group mappings followed by the mappings of every issuer
+func (m *Module) groupMappings() []OIDCGroupMapping {
+	mappings := slices.Clone(m.cfg.OIDCGroupMappings)
+	for _, issuer := range m.cfg.Issuers {
+		mappings = append(mappings, issuer.GroupMappings...)
+	}
+	return mappings
+}
+
+// tokenIssuer reads the iss claim without verifying the token, only to pick the verifier that will
+func tokenIssuer(raw string) (string, error) {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return "", fmt.Errorf("malformed jwt")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", fmt.Errorf("malformed jwt payload: %w", err)
+	}
+
+	var claims struct {
+		Issuer string `json:"iss"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return "", fmt.Errorf("malformed jwt payload: %w", err)
+	}
+	if claims.Issuer == "" {
+		return "", fmt.Errorf("missing iss claim")
+	}
+
+	return claims.Issuer, nil
+}
+
+func (m *Module) addIssuer(ctx context.Context, issuer OIDCIssuer) error {
+	provider, err := oidc.NewProvider(ctx, issuer.IssuerURL)
+	if err != nil {
+		return fmt.Errorf("failed to get provider %s: %w", issuer.IssuerURL, err)
+	}
+
+	// Audiences are checked against the whole client ID list in verifyOIDCToken
+	m.setIssuerVerifier(issuer, provider.Verifier(&oidc.Config{SkipClientIDCheck: true}))
+	return nil
+}
+
+func (m *Module) setIssuerVerifier(issuer OIDCIssuer, verifier *oidc.IDTokenVerifier) {
+	if m.verifiers == nil {
+		m.verifiers = map[string]*issuerVerifier{}
+	}
+	m.verifiers[issuer.IssuerURL] = &issuerVerifier{OIDCIssuer: issuer, verifier: verifier}
+}
+
+// verifyOIDCToken picks the verifier by the token's issuer, verifies the token and checks its audience
+func (m *Module) verifyOIDCToken(ctx context.Context, raw string) (*oidc.IDToken, *issuerVerifier, error) {
+	iss, err := tokenIssuer(raw)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	issuer, ok := m.verifiers[iss]
+	if !ok {
+		return nil, nil, fmt.Errorf("untrusted issuer %s", iss)
+	}
+
+	idToken, err := issuer.verifier.Verify(ctx, raw)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if !slices.ContainsFunc(idToken.Audience, func(aud string) bool { return slices.Contains(issuer.ClientIDs, aud) }) {
+		return nil, nil, fmt.Errorf("token audience %v is not accepted for issuer %s", idToken.Audience, iss)
+	}
+
+	return idToken, issuer, nil
+}
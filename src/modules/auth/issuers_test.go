@@ -0,0 +1,159 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/gin-gonic/gin"
+	jose "github.com/go-jose/go-jose/v4"
+)
+
+func newTestSigningKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	return key
+}
+
+func signTestToken(t *testing.T, key *rsa.PrivateKey, claims map[string]interface{}) string {
+	t.Helper()
+
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.RS256, Key: key}, nil)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if _, ok := claims["exp"]; !ok {
+		claims["exp"] = time.Now().Add(time.Hour).Unix()
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	jws, err := signer.Sign(payload)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	token, err := jws.CompactSerialize()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	return token
+}
+
+func addTestIssuer(m *Module, issuer OIDCIssuer, key *rsa.PrivateKey) {
+	keySet := &oidc.StaticKeySet{PublicKeys: []crypto.PublicKey{&key.PublicKey}}
+	m.setIssuerVerifier(issuer, oidc.NewVerifier(issuer.IssuerURL, keySet, &oidc.Config{SkipClientIDCheck: true}))
+}
+
+func serveWithToken(t *testing.T, m *Module, token string) (*httptest.ResponseRecorder, map[string]string) {
+	t.Helper()
+
+	captured := map[string]string{}
+	router := gin.New()
+	router.GET("/whoami", m.AuthMiddleware(), func(c *gin.Context) {
+		captured["user_id"] = c.GetString("user_id")
+		captured["groups"] = c.GetString("groups")
+		c.Status(http.StatusOK)
+	})
+
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodGet, "/whoami", nil)
+	request.Header.Set("Authorization", "Bearer "+token)
+	router.ServeHTTP(recorder, request)
+	return recorder, captured
+}
+
+func TestAuthMiddlewareSelectsIssuerAndNamespacesSubjects(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	m := newTestAuthModule(t, Config{})
+
+	employeeKey := newTestSigningKey(t)
+	customerKey := newTestSigningKey(t)
+	addTestIssuer(m, OIDCIssuer{IssuerURL: "https://employees.example.com", ClientIDs: []string{"portal"}, UserClaim: "email", GroupsClaim: "groups", GroupPrefix: "oidc-"}, employeeKey)
+	addTestIssuer(m, OIDCIssuer{IssuerURL: "https://customers.example.com", ClientIDs: []string{"portal", "cli"}, UserClaim: "email", GroupsClaim: "groups", GroupPrefix: "customer-", SubjectPrefix: "customer:"}, customerKey)
+
+	recorder, captured := serveWithToken(t, m, signTestToken(t, employeeKey, map[string]interface{}{
+		"iss": "https://employees.example.com", "aud": "portal", "email": "jane@example.com", "groups": []string{"ops"},
+	}))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("unexpected status code %d: %s", recorder.Code, recorder.Body.String())
+	}
+	if captured["user_id"] != "jane@example.com" || captured["groups"] != "oidc-ops" {
+		t.Fatalf("unexpected identity %#v", captured)
+	}
+
+	recorder, captured = serveWithToken(t, m, signTestToken(t, customerKey, map[string]interface{}{
+		"iss": "https://customers.example.com", "aud": []string{"cli"}, "email": "jane@example.com", "groups": []string{"ops"},
+	}))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("unexpected status code %d: %s", recorder.Code, recorder.Body.String())
+	}
+	if captured["user_id"] != "customer:jane@example.com" || captured["groups"] != "customer-ops" {
+		t.Fatalf("unexpected identity %#v", captured)
+	}
+}
+
+func TestAuthMiddlewareRejectsForeignTokens(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	m := newTestAuthModule(t, Config{})
+
+	key := newTestSigningKey(t)
+	addTestIssuer(m, OIDCIssuer{IssuerURL: "https://employees.example.com", ClientIDs: []string{"portal"}, UserClaim: "email"}, key)
+
+	for name, token := range map[string]string{
+		"unknown issuer": signTestToken(t, key, map[string]interface{}{"iss": "https://evil.example.com", "aud": "portal", "email": "jane@example.com"}),
+		"wrong audience": signTestToken(t, key, map[string]interface{}{"iss": "https://employees.example.com", "aud": "other", "email": "jane@example.com"}),
+		"wrong key":      signTestToken(t, newTestSigningKey(t), map[string]interface{}{"iss": "https://employees.example.com", "aud": "portal", "email": "jane@example.com"}),
+		"malformed":      "not-a-jwt",
+	} {
+		recorder, _ := serveWithToken(t, m, token)
+		if recorder.Code != http.StatusUnauthorized {
+			t.Fatalf("%s: unexpected status code %d", name, recorder.Code)
+		}
+	}
+}
+
+func TestValidateIssuersRejectsCollidingPrefixes(t *testing.T) {
+	err := validateIssuers([]OIDCIssuer{
+		{IssuerURL: "https://employees.example.com", ClientIDs: []string{"portal"}, GroupPrefix: "oidc-"},
+		{IssuerURL: "https://customers.example.com", ClientIDs: []string{"portal"}, GroupPrefix: "customer-"},
+	})
+	if err == nil {
+		t.Fatal("expected error for shared subject prefix")
+	}
+
+	err = validateIssuers([]OIDCIssuer{
+		{IssuerURL: "https://employees.example.com", ClientIDs: []string{"portal"}, GroupPrefix: "oidc-"},
+		{IssuerURL: "https://customers.example.com", ClientIDs: []string{"portal"}, GroupPrefix: "customer-", SubjectPrefix: "customer:"},
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+}
+
+func TestValidateGroupMappingsRequiresAnIssuerPrefix(t *testing.T) {
+	issuers := []OIDCIssuer{
+		{IssuerURL: "https://employees.example.com", ClientIDs: []string{"portal"}, GroupPrefix: "oidc-"},
+		{IssuerURL: "https://customers.example.com", ClientIDs: []string{"portal"}, GroupPrefix: "customer-", SubjectPrefix: "customer:"},
+	}
+
+	if err := validateGroupMappings(issuers, []OIDCGroupMapping{{OIDCGroup: "oidc-admins", Tenant: "admin", Group: "admin"}, {OIDCGroup: "customer-ops", Tenant: "demo", Group: "member"}}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := validateGroupMappings(issuers, []OIDCGroupMapping{{OIDCGroup: "partner-ops", Tenant: "demo", Group: "member"}}); err == nil {
+		t.Fatal("expected error for a group no issuer produces")
+	}
+}
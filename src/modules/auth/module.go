@@ -7,24 +7,19 @@ import (
 	"net/http"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/EdgeCDN-X/edgecdnx-api/src/internal/logger"
 	"github.com/EdgeCDN-X/edgecdnx-api/src/modules/app"
-	infrastructurev1alpha1 "github.com/EdgeCDN-X/edgecdnx-controller/api/v1alpha1"
 	"go.uber.org/zap"
 
 	"github.com/casbin/casbin/v3"
 	"github.com/casbin/casbin/v3/model"
 	"github.com/casbin/casbin/v3/persist"
 	stringadapter "github.com/casbin/casbin/v3/persist/string-adapter"
-	"github.com/coreos/go-oidc/v3/oidc"
 	"github.com/gin-gonic/gin"
-	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
-	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/dynamic"
-	"k8s.io/client-go/dynamic/dynamicinformer"
 	"k8s.io/client-go/tools/cache"
 )
 
@@ -45,6 +40,8 @@ e = some(where (p.eft == allow))
 m = g(r.sub, p.sub, r.dom) && r.dom == p.dom && (keyMatch2(r.res, p.res)) && r.act == p.act
 `
 
+// OIDCGroupMapping binds an OIDC group to a role of a tenant. OIDCGroup includes the group prefix of its issuer,
+// see OIDCIssuer.GroupMappings for issuers whose prefix differs from OIDCGroupPrefix.
 type OIDCGroupMapping struct {
 	OIDCGroup string
 	Tenant    string
@@ -52,24 +49,38 @@ type OIDCGroupMapping struct {
 }
 
 type Config struct {
-	oidc.Config
-	verifier          *oidc.IDTokenVerifier
-	authMiddleware    gin.HandlerFunc
-	Namespace         string
+	Namespace string
+	// Issuers lists the trusted identity providers. When empty a single issuer is built from the
+	// OIDC_ISSUER_URL and OIDC_CLIENT_ID environment variables with AuthClaim, GroupsClaim and OIDCGroupPrefix.
+	Issuers           []OIDCIssuer
 	AuthClaim         string
 	GroupsClaim       string
 	OIDCGroupMappings []OIDCGroupMapping
 	OIDCGroupPrefix   string
+	// DefaultAdminProject is the tenant checked for platform wide admin actions
+	DefaultAdminProject string
+	// PolicyResyncInterval controls how often the enforcer is rebuilt from the informer store. Zero disables it.
+	PolicyResyncInterval time.Duration
+	// PersonalTokenMaxLifetime caps how long personal API tokens stay valid, 90 days when not set
+	PersonalTokenMaxLifetime time.Duration
 }
 
 type Module struct {
 	cfg          Config
-	client       *dynamic.DynamicClient
+	client       dynamic.Interface
 	informerChan chan struct{}
 	Informer     cache.SharedIndexInformer
 	casbinModel  model.Model
 	Adapter      persist.Adapter
-	Enforcer     *casbin.Enforcer
+	Enforcer     *casbin.SyncedEnforcer
+	policyMu     sync.Mutex
+	verifiers    map[string]*issuerVerifier
+
+	// tokenUses holds the last use of API tokens until it is written back, keyed by Secret name
+	tokenUsesMu sync.Mutex
+	tokenUses   map[string]time.Time
+	// ownerGroups holds the groups of subjects signed in through OIDC until their personal tokens are narrowed to them
+	ownerGroups map[string][]string
 }
 
 func (m *Module) AuthMiddleware() gin.HandlerFunc {
@@ -88,29 +99,67 @@ func (m *Module) AuthMiddleware() gin.HandlerFunc {
 
 		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
 
+		// API tokens are an alternative to OIDC, they resolve to the same context keys
+		if strings.HasPrefix(tokenString, tokenPrefix) {
+			identity, err := m.validateToken(c.Request.Context(), tokenString)
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid token: " + err.Error()})
+				return
+			}
+
+			c.Set("claims", map[string]interface{}{
+				"sub":      identity.Subject,
+				"token_id": identity.ID,
+				"kind":     identity.Kind,
+				"project":  identity.Project,
+			})
+			c.Set("user_id", identity.Subject)
+			// Only personal tokens carry groups, see tokenIdentity
+			c.Set("groups", strings.Join(identity.Groups, ","))
+			c.Set("token_id", identity.ID)
+			c.Set("token_project", identity.Project)
+			c.Next()
+			return
+		}
+
 		// Validate with OIDC
-		idToken, err := m.cfg.verifier.Verify(c.Request.Context(), tokenString)
+		idToken, issuer, err := m.verifyOIDCToken(c.Request.Context(), tokenString)
 		if err != nil {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid token: " + err.Error()})
 			return
 		}
 
-		// extract claims if you need them
 		var claims map[string]interface{}
-		if err := idToken.Claims(&claims); err == nil {
-			c.Set("claims", claims)
-			c.Set("user_id", claims[m.cfg.AuthClaim])
-			// Convert groups claim array to comma-separated string. Seems like there's bug retreiving it as a slice directly from the context, maybe due to how Gin stores values.
-			if groups, ok := claims[m.cfg.GroupsClaim].([]interface{}); ok {
-				groupStrs := make([]string, len(groups))
-				for i, g := range groups {
-					groupStrs[i] = fmt.Sprintf("%s%s", m.cfg.OIDCGroupPrefix, g)
-				}
-				c.Set("groups", strings.Join(groupStrs, ","))
-			}
+		if err := idToken.Claims(&claims); err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid token claims: " + err.Error()})
+			return
+		}
 
+		userId, err := claimString(claims, issuer.UserClaim)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unresolvable user claim: " + err.Error()})
+			return
 		}
 
+		groupStrs := []string{}
+		if issuer.GroupsClaim != "" {
+			groups, err := claimStrings(claims, issuer.GroupsClaim)
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unresolvable groups claim: " + err.Error()})
+				return
+			}
+			for _, g := range groups {
+				groupStrs = append(groupStrs, fmt.Sprintf("%s%s", issuer.GroupPrefix, g))
+			}
+		}
+
+		m.recordOwnerGroups(issuer.SubjectPrefix+userId, groupStrs)
+
+		c.Set("claims", claims)
+		c.Set("user_id", issuer.SubjectPrefix+userId)
+		// Groups are kept as a comma-separated string. Seems like there's bug retreiving it as a slice directly from the context, maybe due to how Gin stores values.
+		c.Set("groups", strings.Join(groupStrs, ","))
+
 		c.Next()
 	}
 }
@@ -120,7 +169,7 @@ func New(cfg Config) *Module {
 }
 
 func (m *Module) Shutdown() {
-	logger.L().Info("Shutting down informer")
+	logger.L().Info("Shutting down policy resync")
 	close(m.informerChan)
 }
 
@@ -128,17 +177,31 @@ func (m *Module) Init() error {
 
 	logger.L().Info("Initializing Auth module")
 
-	provider, err := oidc.NewProvider(context.Background(), os.Getenv("OIDC_ISSUER_URL"))
+	issuers := m.cfg.Issuers
+	if len(issuers) == 0 {
+		issuers = []OIDCIssuer{{
+			IssuerURL:   os.Getenv("OIDC_ISSUER_URL"),
+			ClientIDs:   []string{os.Getenv("OIDC_CLIENT_ID")},
+			UserClaim:   m.cfg.AuthClaim,
+			GroupsClaim: m.cfg.GroupsClaim,
+			GroupPrefix: m.cfg.OIDCGroupPrefix,
+		}}
+	}
+
+	err := validateIssuers(issuers)
 	if err != nil {
-		return fmt.Errorf("failed to get provider: %w", err)
+		return err
+	}
+	if err := validateGroupMappings(issuers, m.groupMappings()); err != nil {
+		return err
 	}
 
-	// Configure an OpenID Connect aware OAuth2 client.
-	oidcConfig := &oidc.Config{
-		ClientID: os.Getenv("OIDC_CLIENT_ID"),
+	for _, issuer := range issuers {
+		logger.L().Info("Adding OIDC issuer", zap.String("issuer", issuer.IssuerURL), zap.Strings("clientIds", issuer.ClientIDs), zap.String("subjectPrefix", issuer.SubjectPrefix), zap.String("groupPrefix", issuer.GroupPrefix))
+		if err := m.addIssuer(context.Background(), issuer); err != nil {
+			return err
+		}
 	}
-	m.cfg.Config = *oidcConfig
-	m.cfg.verifier = provider.Verifier(oidcConfig)
 
 	// Initialize RBAC Model
 	m.casbinModel, err = model.NewModelFromString(RBACWithDomainModel)
@@ -148,101 +211,71 @@ func (m *Module) Init() error {
 	}
 
 	// Initialize with super admin rights
-	adapter := stringadapter.NewAdapter("p, portal-admin, *, *, *")
+	adapter := stringadapter.NewAdapter("p, " + strings.Join(superAdminPolicy, ", "))
 
-	client, _, err := app.GetK8SDynamicClient()
+	k8sCache, err := app.GetK8SCache(m.cfg.Namespace)
 	if err != nil {
 		return err
 	}
 
-	m.client = client
-	fac := dynamicinformer.NewFilteredDynamicSharedInformerFactory(client, 60*time.Minute, m.cfg.Namespace, nil)
-	informer := fac.ForResource(schema.GroupVersionResource{
-		Group:    infrastructurev1alpha1.SchemeGroupVersion.Group,
-		Version:  infrastructurev1alpha1.SchemeGroupVersion.Version,
-		Resource: "projects",
-	}).Informer()
+	if err := k8sCache.Restrict(secretGVR, tokenLabel+"=true"); err != nil {
+		return err
+	}
+	m.client = k8sCache.Client(projectGVR, secretGVR)
+
+	informer := k8sCache.Informer(projectGVR)
 
 	m.Adapter = adapter
-	m.Enforcer, err = casbin.NewEnforcer(m.casbinModel, m.Adapter)
+	// Routes enforce concurrently with the informer handlers and the resync changing the policy
+	m.Enforcer, err = casbin.NewSyncedEnforcer(m.casbinModel, m.Adapter)
 
 	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
 		AddFunc: func(obj any) {
-			p_raw, ok := obj.(*unstructured.Unstructured)
-			if !ok {
-				logger.L().Error("Failed to cast added project to Unstructured")
-				return
-			}
-
-			project := &infrastructurev1alpha1.Project{}
-			err := runtime.DefaultUnstructuredConverter.FromUnstructured(p_raw.Object, project)
+			project, err := projectFromObject(obj)
 			if err != nil {
-				logger.L().Error("Failed to convert added project from Unstructured", zap.Error(err))
+				logger.L().Error("Failed to convert added project", zap.Error(err))
 				return
 			}
 
-			for _, r := range project.Spec.Rbac.Rules {
-				logger.L().Debug("Adding policy", zap.String("sub", r.V0), zap.String("dom", r.V1), zap.String("res", r.V2), zap.String("act", r.V3))
-				m.Enforcer.AddPolicy(r.V0, r.V1, r.V2, r.V3)
-			}
-
-			for _, g := range project.Spec.Rbac.Groups {
-				logger.L().Debug("Adding grouping policy", zap.String("user", g.V0), zap.String("role", g.V1), zap.String("domain", g.V2))
-				m.Enforcer.AddGroupingPolicy(g.V0, g.V1, g.V2)
-			}
+			m.policyMu.Lock()
+			defer m.policyMu.Unlock()
+			m.addProjectPolicies(project)
 		},
 		UpdateFunc: func(oldObj, newObj any) {
-			old_raw, ok := oldObj.(*unstructured.Unstructured)
-			if !ok {
-				logger.L().Error("Failed to cast old project to Unstructured")
-				return
-			}
-			new_raw, ok := newObj.(*unstructured.Unstructured)
-			if !ok {
-				logger.L().Error("Failed to cast new project to Unstructured")
+			oldProject, err := projectFromObject(oldObj)
+			if err != nil {
+				logger.L().Error("Failed to convert old project", zap.Error(err))
 				return
 			}
 
-			oldProject := &infrastructurev1alpha1.Project{}
-			err := runtime.DefaultUnstructuredConverter.FromUnstructured(old_raw.Object, oldProject)
+			newProject, err := projectFromObject(newObj)
 			if err != nil {
-				logger.L().Error("Failed to convert old project from Unstructured", zap.Error(err))
+				logger.L().Error("Failed to convert new project", zap.Error(err))
 				return
 			}
 
-			newProject := &infrastructurev1alpha1.Project{}
-			err = runtime.DefaultUnstructuredConverter.FromUnstructured(new_raw.Object, newProject)
+			m.policyMu.Lock()
+			defer m.policyMu.Unlock()
+			m.removeProjectPolicies(oldProject)
+			m.addProjectPolicies(newProject)
+		},
+		DeleteFunc: func(obj any) {
+			project, err := projectFromObject(obj)
 			if err != nil {
-				logger.L().Error("Failed to convert new project from Unstructured", zap.Error(err))
+				logger.L().Error("Failed to convert deleted project", zap.Error(err))
 				return
 			}
 
-			// Remove old policies
-			for _, r := range oldProject.Spec.Rbac.Rules {
-				logger.L().Debug("Removing policy", zap.String("sub", r.V0), zap.String("dom", r.V1), zap.String("res", r.V2), zap.String("act", r.V3))
-				m.Enforcer.RemovePolicy(r.V0, r.V1, r.V2, r.V3)
-			}
-			for _, g := range oldProject.Spec.Rbac.Groups {
-				logger.L().Debug("Removing grouping policy", zap.String("user", g.V0), zap.String("role", g.V1), zap.String("domain", g.V2))
-				m.Enforcer.RemoveGroupingPolicy(g.V0, g.V1, g.V2)
-			}
-
-			// Add new policies
-			for _, r := range newProject.Spec.Rbac.Rules {
-				logger.L().Debug("Adding policy", zap.String("sub", r.V0), zap.String("dom", r.V1), zap.String("res", r.V2), zap.String("act", r.V3))
-				m.Enforcer.AddPolicy(r.V0, r.V1, r.V2, r.V3)
-			}
-			for _, g := range newProject.Spec.Rbac.Groups {
-				logger.L().Debug("Adding grouping policy", zap.String("user", g.V0), zap.String("role", g.V1), zap.String("domain", g.V2))
-				m.Enforcer.AddGroupingPolicy(g.V0, g.V1, g.V2)
-			}
+			logger.L().Info("Project deleted, revoking policies", zap.String("project", project.Name))
+			m.policyMu.Lock()
+			defer m.policyMu.Unlock()
+			m.removeProjectPolicies(project)
 		},
 	})
 
 	stop := make(chan struct{})
 	m.Informer = informer
 	m.informerChan = stop
-	go informer.Run(stop)
 
 	if !cache.WaitForCacheSync(stop, informer.HasSynced) {
 		logger.L().Error("Failed to sync informer cache")
@@ -252,11 +285,16 @@ func (m *Module) Init() error {
 	// Caches synced. Add OIDC mappings
 	logger.L().Info("Informer cache synced, loading OIDC policies")
 
-	for _, mapping := range m.cfg.OIDCGroupMappings {
+	for _, mapping := range m.groupMappings() {
 		logger.L().Info("Adding OIDC group mapping", zap.String("oidc_group", mapping.OIDCGroup), zap.String("tenant", mapping.Tenant), zap.String("group", mapping.Group))
 		m.Enforcer.AddGroupingPolicy(mapping.OIDCGroup, mapping.Group, mapping.Tenant)
 	}
 
+	if m.cfg.PolicyResyncInterval > 0 {
+		go m.runPolicyResync(stop)
+	}
+	go m.runTokenUseFlush(stop)
+
 	pols, err := m.Enforcer.GetGroupingPolicy()
 	if err != nil {
 		logger.L().Error("Failed to get policies", zap.Error(err))
@@ -274,6 +312,6 @@ func (a *Module) SetMiddlewares(middlewares ...gin.HandlerFunc) {
 	// No-op for this module
 }
 
-func (m *Module) SetEnforcer(enforcer *casbin.Enforcer) {
+func (m *Module) SetEnforcer(enforcer *casbin.SyncedEnforcer) {
 	// No-op for this module
 }
@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// callerGroups returns the prefixed groups the middleware stored on the context
+func callerGroups(c *gin.Context) []string {
+	groups := []string{}
+	if g := c.GetString("groups"); g != "" {
+		groups = strings.Split(g, ",")
+	}
+	return groups
+}
+
+// policyDomains lists every tenant the enforcer knows about, from project rules, project bindings and OIDC group mappings
+func (m *Module) policyDomains() ([]string, error) {
+	m.policyMu.Lock()
+	defer m.policyMu.Unlock()
+
+	rules, err := m.Enforcer.GetPolicy()
+	if err != nil {
+		return nil, err
+	}
+	groups, err := m.Enforcer.GetGroupingPolicy()
+	if err != nil {
+		return nil, err
+	}
+
+	domains := []string{}
+	add := func(d string) {
+		if d != "" && d != "*" && !slices.Contains(domains, d) {
+			domains = append(domains, d)
+		}
+	}
+	for _, r := range rules {
+		if len(r) > 1 {
+			add(r[1])
+		}
+	}
+	for _, g := range groups {
+		if len(g) > 2 {
+			add(g[2])
+		}
+	}
+
+	sort.Strings(domains)
+	return domains, nil
+}
+
+// permissionMatrix evaluates every resource and action in every known tenant for the caller.
+// Tenants without any permission are left out. Tokens only ever see the project they were issued in.
+func (m *Module) permissionMatrix(subject string, groups []string, tokenProject string) (map[string][]PermissionDto, error) {
+	domains, err := m.policyDomains()
+	if err != nil {
+		return nil, err
+	}
+
+	resources := append(slices.Clone(ProjectResources), AdminResources...)
+	matrix := map[string][]PermissionDto{}
+	for _, domain := range domains {
+		if tokenProject != "" && domain != tokenProject {
+			continue
+		}
+
+		for _, resource := range resources {
+			for _, action := range Actions {
+				allowed, err := Authorize(m.Enforcer, subject, groups, domain, resource, action)
+				if err != nil {
+					return nil, err
+				}
+				if allowed {
+					matrix[domain] = append(matrix[domain], PermissionDto{Resource: resource, Action: action})
+				}
+			}
+		}
+	}
+
+	return matrix, nil
+}
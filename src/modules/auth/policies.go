@@ -0,0 +1,201 @@
+package auth
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/EdgeCDN-X/edgecdnx-api/src/internal/logger"
+	infrastructurev1alpha1 "github.com/EdgeCDN-X/edgecdnx-controller/api/v1alpha1"
+	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/cache"
+)
+
+// superAdminPolicy is loaded into every enforcer and kept across resyncs
+var superAdminPolicy = []string{"portal-admin", "*", "*", "*"}
+
+// projectFromObject converts an informer object to a Project. Tombstones delivered on missed deletes are unwrapped.
+func projectFromObject(obj any) (*infrastructurev1alpha1.Project, error) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+
+	raw, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return nil, fmt.Errorf("unexpected object type %T", obj)
+	}
+
+	project := &infrastructurev1alpha1.Project{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(raw.Object, project); err != nil {
+		return nil, err
+	}
+
+	return project, nil
+}
+
+// legacyAdminActions are the actions the admin role template granted on every resource before purge existed
+var legacyAdminActions = []string{"create", "read", "update", "delete"}
+
+// projectRules returns the p rules of a project. Admin roles created from the template before the purge
+// action existed hold create, read, update and delete on every resource only, they are granted purge as well.
+func projectRules(project *infrastructurev1alpha1.Project) []infrastructurev1alpha1.RuleSpec {
+	wildcardActions := map[string]bool{}
+	for _, r := range project.Spec.Rbac.Rules {
+		if r.V0 == "admin" && r.V1 == project.Name && r.V2 == "*" {
+			wildcardActions[r.V3] = true
+		}
+	}
+
+	if wildcardActions["purge"] {
+		return project.Spec.Rbac.Rules
+	}
+	for _, action := range legacyAdminActions {
+		if !wildcardActions[action] {
+			return project.Spec.Rbac.Rules
+		}
+	}
+	return append(slices.Clip(project.Spec.Rbac.Rules), infrastructurev1alpha1.RuleSpec{PType: "p", V0: "admin", V1: project.Name, V2: "*", V3: "purge"})
+}
+
+func (m *Module) addProjectPolicies(project *infrastructurev1alpha1.Project) {
+	for _, r := range projectRules(project) {
+		logger.L().Debug("Adding policy", zap.String("sub", r.V0), zap.String("dom", r.V1), zap.String("res", r.V2), zap.String("act", r.V3))
+		m.Enforcer.AddPolicy(r.V0, r.V1, r.V2, r.V3)
+	}
+
+	for _, g := range project.Spec.Rbac.Groups {
+		logger.L().Debug("Adding grouping policy", zap.String("user", g.V0), zap.String("role", g.V1), zap.String("domain", g.V2))
+		m.Enforcer.AddGroupingPolicy(g.V0, g.V1, g.V2)
+	}
+}
+
+func (m *Module) removeProjectPolicies(project *infrastructurev1alpha1.Project) {
+	for _, r := range projectRules(project) {
+		logger.L().Debug("Removing policy", zap.String("sub", r.V0), zap.String("dom", r.V1), zap.String("res", r.V2), zap.String("act", r.V3))
+		m.Enforcer.RemovePolicy(r.V0, r.V1, r.V2, r.V3)
+	}
+
+	for _, g := range project.Spec.Rbac.Groups {
+		logger.L().Debug("Removing grouping policy", zap.String("user", g.V0), zap.String("role", g.V1), zap.String("domain", g.V2))
+		m.Enforcer.RemoveGroupingPolicy(g.V0, g.V1, g.V2)
+	}
+}
+
+func (m *Module) runPolicyResync(stop <-chan struct{}) {
+	ticker := time.NewTicker(m.cfg.PolicyResyncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if err := m.resyncPolicies(m.Informer.GetStore().List()); err != nil {
+				logger.L().Error("Failed to resync policies", zap.Error(err))
+			}
+		}
+	}
+}
+
+// resyncPolicies brings the enforcer in line with the given projects, the super admin policy and the OIDC group mappings.
+// Policies are diffed rather than cleared so concurrent requests never see an empty enforcer.
+func (m *Module) resyncPolicies(objs []any) error {
+	desiredRules := [][]string{superAdminPolicy}
+	desiredGroups := [][]string{}
+	for _, mapping := range m.groupMappings() {
+		desiredGroups = append(desiredGroups, []string{mapping.OIDCGroup, mapping.Group, mapping.Tenant})
+	}
+
+	for _, obj := range objs {
+		project, err := projectFromObject(obj)
+		if err != nil {
+			return err
+		}
+		for _, r := range projectRules(project) {
+			desiredRules = append(desiredRules, []string{r.V0, r.V1, r.V2, r.V3})
+		}
+		for _, g := range project.Spec.Rbac.Groups {
+			desiredGroups = append(desiredGroups, []string{g.V0, g.V1, g.V2})
+		}
+	}
+
+	m.policyMu.Lock()
+	defer m.policyMu.Unlock()
+
+	currentRules, err := m.Enforcer.GetPolicy()
+	if err != nil {
+		return err
+	}
+	currentGroups, err := m.Enforcer.GetGroupingPolicy()
+	if err != nil {
+		return err
+	}
+
+	staleRules, missingRules := diffPolicies(currentRules, desiredRules)
+	staleGroups, missingGroups := diffPolicies(currentGroups, desiredGroups)
+
+	if len(staleRules) > 0 {
+		if _, err := m.Enforcer.RemovePolicies(staleRules); err != nil {
+			return err
+		}
+	}
+	if len(missingRules) > 0 {
+		if _, err := m.Enforcer.AddPolicies(missingRules); err != nil {
+			return err
+		}
+	}
+	if len(staleGroups) > 0 {
+		if _, err := m.Enforcer.RemoveGroupingPolicies(staleGroups); err != nil {
+			return err
+		}
+	}
+	if len(missingGroups) > 0 {
+		if _, err := m.Enforcer.AddGroupingPolicies(missingGroups); err != nil {
+			return err
+		}
+	}
+
+	if len(staleRules)+len(missingRules)+len(staleGroups)+len(missingGroups) > 0 {
+		logger.L().Info("Policy drift corrected",
+			zap.Int("removedRules", len(staleRules)), zap.Int("addedRules", len(missingRules)),
+			zap.Int("removedGroups", len(staleGroups)), zap.Int("addedGroups", len(missingGroups)))
+	}
+
+	return nil
+}
+
+// diffPolicies returns the entries of current missing from desired, and the entries of desired missing from current
+func diffPolicies(current [][]string, desired [][]string) ([][]string, [][]string) {
+	key := func(p []string) string { return strings.Join(p, "\x00") }
+
+	desiredSet := map[string]struct{}{}
+	for _, p := range desired {
+		desiredSet[key(p)] = struct{}{}
+	}
+	currentSet := map[string]struct{}{}
+	for _, p := range current {
+		currentSet[key(p)] = struct{}{}
+	}
+
+	stale := [][]string{}
+	for _, p := range current {
+		if _, ok := desiredSet[key(p)]; !ok {
+			stale = append(stale, p)
+		}
+	}
+
+	missing := [][]string{}
+	for _, p := range desired {
+		k := key(p)
+		if _, ok := currentSet[k]; ok {
+			continue
+		}
+		currentSet[k] = struct{}{}
+		missing = append(missing, p)
+	}
+
+	return stale, missing
+}
@@ -0,0 +1,228 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/EdgeCDN-X/edgecdnx-api/src/internal/logger"
+	infrastructurev1alpha1 "github.com/EdgeCDN-X/edgecdnx-controller/api/v1alpha1"
+	"github.com/casbin/casbin/v3"
+	"github.com/casbin/casbin/v3/model"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/cache"
+)
+
+func newTestAuthModule(t *testing.T, cfg Config) *Module {
+	t.Helper()
+	logger.Init(false)
+
+	casbinModel, err := model.NewModelFromString(RBACWithDomainModel)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	enforcer, err := casbin.NewSyncedEnforcer(casbinModel)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	return &Module{cfg: cfg, Enforcer: enforcer}
+}
+
+func testProjectObject(t *testing.T, name string, member string) *unstructured.Unstructured {
+	t.Helper()
+
+	project := &infrastructurev1alpha1.Project{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: infrastructurev1alpha1.ProjectSpec{
+			Rbac: infrastructurev1alpha1.RBACSpec{
+				Groups: []infrastructurev1alpha1.RuleSpec{{PType: "g", V0: member, V1: "admin", V2: name}},
+				Rules:  []infrastructurev1alpha1.RuleSpec{{PType: "p", V0: "admin", V1: name, V2: "*", V3: "read"}},
+			},
+		},
+	}
+
+	objMap, err := runtime.DefaultUnstructuredConverter.ToUnstructured(project)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	return &unstructured.Unstructured{Object: objMap}
+}
+
+func mustEnforce(t *testing.T, m *Module, sub string, dom string) bool {
+	t.Helper()
+
+	allowed, err := m.Enforcer.Enforce(sub, dom, "service", "read")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	return allowed
+}
+
+func TestProjectFromObjectUnwrapsTombstone(t *testing.T) {
+	obj := testProjectObject(t, "demo", "user@example.com")
+
+	project, err := projectFromObject(cache.DeletedFinalStateUnknown{Key: "edgecdnx/demo", Obj: obj})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if project.Name != "demo" {
+		t.Fatalf("unexpected project %q", project.Name)
+	}
+
+	if _, err := projectFromObject("demo"); err == nil {
+		t.Fatal("expected error for unexpected object type")
+	}
+}
+
+func TestRemoveProjectPoliciesRevokesAccess(t *testing.T) {
+	m := newTestAuthModule(t, Config{})
+
+	project, err := projectFromObject(testProjectObject(t, "demo", "user@example.com"))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	m.addProjectPolicies(project)
+	if !mustEnforce(t, m, "user@example.com", "demo") {
+		t.Fatal("expected access after adding project policies")
+	}
+
+	m.removeProjectPolicies(project)
+	if mustEnforce(t, m, "user@example.com", "demo") {
+		t.Fatal("expected access to be revoked after removing project policies")
+	}
+}
+
+func TestResyncPoliciesCorrectsDrift(t *testing.T) {
+	m := newTestAuthModule(t, Config{
+		OIDCGroupMappings: []OIDCGroupMapping{{OIDCGroup: "oidc-admins", Tenant: "admin", Group: "admin"}},
+		Issuers: []OIDCIssuer{{
+			IssuerURL:     "https://customers.example.com",
+			GroupPrefix:   "customer-",
+			GroupMappings: []OIDCGroupMapping{{OIDCGroup: "customer-ops", Tenant: "demo", Group: "member"}},
+		}},
+	})
+
+	// A project that was deleted while the watch was down, its rules are still loaded
+	stale, err := projectFromObject(testProjectObject(t, "stale", "old@example.com"))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	m.addProjectPolicies(stale)
+
+	if err := m.resyncPolicies([]any{testProjectObject(t, "demo", "user@example.com")}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if mustEnforce(t, m, "old@example.com", "stale") {
+		t.Fatal("expected stale project policies to be removed")
+	}
+	if !mustEnforce(t, m, "user@example.com", "demo") {
+		t.Fatal("expected current project policies to be loaded")
+	}
+
+	hasMapping, err := m.Enforcer.HasGroupingPolicy("oidc-admins", "admin", "admin")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !hasMapping {
+		t.Fatal("expected OIDC group mapping to be kept")
+	}
+	hasMapping, err = m.Enforcer.HasGroupingPolicy("customer-ops", "member", "demo")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !hasMapping {
+		t.Fatal("expected the group mapping of the issuer to be loaded")
+	}
+
+	hasSuperAdmin, err := m.Enforcer.HasPolicy(superAdminPolicy)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !hasSuperAdmin {
+		t.Fatal("expected super admin policy to be kept")
+	}
+}
+
+func TestAuthorizeDuringResync(t *testing.T) {
+	m := newTestAuthModule(t, Config{})
+	projects := []any{testProjectObject(t, "demo", "user@example.com")}
+	if err := m.resyncPolicies(projects); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// Routes enforce while project changes are applied, run with -race
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 50; i++ {
+			if err := m.resyncPolicies([]any{testProjectObject(t, "other", "user@example.com")}); err != nil {
+				t.Errorf("expected no error, got %v", err)
+			}
+			if err := m.resyncPolicies(projects); err != nil {
+				t.Errorf("expected no error, got %v", err)
+			}
+		}
+	}()
+
+	for i := 0; i < 200; i++ {
+		if _, err := Authorize(m.Enforcer, "user@example.com", []string{"team"}, "demo", "service", "read"); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+	<-done
+
+	if !mustEnforce(t, m, "user@example.com", "demo") {
+		t.Fatal("expected the last resync to win")
+	}
+}
+
+func TestLegacyAdminRoleCanPurge(t *testing.T) {
+	m := newTestAuthModule(t, Config{})
+
+	rules := []infrastructurev1alpha1.RuleSpec{}
+	for _, action := range legacyAdminActions {
+		rules = append(rules, infrastructurev1alpha1.RuleSpec{PType: "p", V0: "admin", V1: "demo", V2: "*", V3: action})
+	}
+	rules = append(rules, infrastructurev1alpha1.RuleSpec{PType: "p", V0: "viewer", V1: "demo", V2: "*", V3: "read"})
+	project := &infrastructurev1alpha1.Project{
+		ObjectMeta: metav1.ObjectMeta{Name: "demo"},
+		Spec: infrastructurev1alpha1.ProjectSpec{
+			Rbac: infrastructurev1alpha1.RBACSpec{
+				Groups: []infrastructurev1alpha1.RuleSpec{
+					{PType: "g", V0: "admin@example.com", V1: "admin", V2: "demo"},
+					{PType: "g", V0: "viewer@example.com", V1: "viewer", V2: "demo"},
+				},
+				Rules: rules,
+			},
+		},
+	}
+
+	objMap, err := runtime.DefaultUnstructuredConverter.ToUnstructured(project)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := m.resyncPolicies([]any{&unstructured.Unstructured{Object: objMap}}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	for user, expected := range map[string]bool{"admin@example.com": true, "viewer@example.com": false} {
+		allowed, err := m.Enforcer.Enforce(user, "demo", "service", "purge")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if allowed != expected {
+			t.Fatalf("expected purge allowed %v for %s, got %v", expected, user, allowed)
+		}
+	}
+
+	// Admin roles that were edited to drop one of the actions are left alone
+	project.Spec.Rbac.Rules = rules[1:]
+	if len(projectRules(project)) != len(rules)-1 {
+		t.Fatalf("unexpected rules %v", projectRules(project))
+	}
+}
@@ -1,5 +1,131 @@
 package auth
 
-import "github.com/gin-gonic/gin"
+import (
+	"strings"
 
-func (m *Module) RegisterRoutes(r *gin.Engine) {}
+	"github.com/gin-gonic/gin"
+)
+
+func (m *Module) RegisterRoutes(r *gin.Engine) {
+	r.GET("/me", m.AuthMiddleware(), func(c *gin.Context) {
+		groups := callerGroups(c)
+
+		permissions, err := m.permissionMatrix(c.GetString("user_id"), groups, c.GetString("token_project"))
+		if err != nil {
+			c.JSON(500, gin.H{"error": "failed to evaluate permissions: " + err.Error()})
+			return
+		}
+
+		claims, _ := c.Get("claims")
+		claimsMap, _ := claims.(map[string]interface{})
+
+		c.JSON(200, MeDto{
+			UserId:      c.GetString("user_id"),
+			Groups:      groups,
+			Claims:      claimsMap,
+			Permissions: permissions,
+		})
+		return
+	})
+
+	r.POST("/authz/check", m.AuthMiddleware(), func(c *gin.Context) {
+		var dto AuthzCheckRequestDto
+		if err := c.ShouldBindJSON(&dto); err != nil {
+			c.JSON(400, gin.H{"error": "invalid request body: " + err.Error()})
+			return
+		}
+
+		subject := c.GetString("user_id")
+		groups := callerGroups(c)
+		tokenProject := c.GetString("token_project")
+
+		// Admins may evaluate the checks for someone else. Only the direct bindings of that subject and the groups passed along are considered.
+		if as := c.Query("as"); as != "" {
+			allowed, err := Authorize(m.Enforcer, subject, groups, m.cfg.DefaultAdminProject, "authz", "read")
+			if err != nil {
+				c.JSON(500, gin.H{"error": "internal error"})
+				return
+			}
+			if !allowed || (tokenProject != "" && tokenProject != m.cfg.DefaultAdminProject) {
+				c.JSON(403, gin.H{"error": "forbidden"})
+				return
+			}
+
+			subject = as
+			groups = []string{}
+			if asGroups := c.Query("as_groups"); asGroups != "" {
+				groups = strings.Split(asGroups, ",")
+			}
+			tokenProject = ""
+		}
+
+		ret := AuthzCheckResponseDto{
+			Subject: subject,
+			Groups:  groups,
+			Results: []AuthzCheckResultDto{},
+		}
+
+		for _, check := range dto.Checks {
+			allowed := false
+			if tokenProject == "" || tokenProject == check.Project {
+				var err error
+				allowed, err = Authorize(m.Enforcer, subject, groups, check.Project, check.Resource, check.Action)
+				if err != nil {
+					c.JSON(500, gin.H{"error": "failed to evaluate permissions: " + err.Error()})
+					return
+				}
+			}
+			ret.Results = append(ret.Results, AuthzCheckResultDto{AuthzCheckDto: check, Allowed: allowed})
+		}
+
+		c.JSON(200, ret)
+		return
+	})
+
+	tokens := r.Group("/projects/:project-id/tokens", m.AuthMiddleware())
+
+	tokens.GET("", NewAuthzBuilder().E(m.Enforcer).T("project-id").R("token").S("user_id").A("read").Build(), func(c *gin.Context) {
+		ret, err := m.listTokens(c, c.Param("project-id"))
+		if err != nil {
+			c.JSON(500, gin.H{"error": "failed to list tokens: " + err.Error()})
+			return
+		}
+
+		c.JSON(200, ret)
+		return
+	})
+
+	tokens.POST("", NewAuthzBuilder().E(m.Enforcer).T("project-id").R("token").S("user_id").A("create").Build(), func(c *gin.Context) {
+		// A leaked token must not be able to mint longer-lived ones
+		if c.GetString("token_id") != "" {
+			c.JSON(403, gin.H{"error": "tokens cannot be created with token authentication"})
+			return
+		}
+
+		var dto CreateTokenDto
+		if err := c.ShouldBindJSON(&dto); err != nil {
+			c.JSON(400, gin.H{"error": "invalid request body: " + err.Error()})
+			return
+		}
+
+		ret, code, err := m.createToken(c, c.Param("project-id"), c.GetString("user_id"), callerGroups(c), dto)
+		if err != nil {
+			c.JSON(code, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(code, ret)
+		return
+	})
+
+	tokens.DELETE("/:token-id", NewAuthzBuilder().E(m.Enforcer).T("project-id").R("token").S("user_id").A("delete").Build(), func(c *gin.Context) {
+		code, err := m.revokeToken(c, c.Param("project-id"), c.Param("token-id"))
+		if err != nil {
+			c.JSON(code, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.Status(code)
+		return
+	})
+}
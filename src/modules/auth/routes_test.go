@@ -0,0 +1,148 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMeReturnsPermissionMatrix(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	m := newTestTokenModule(t)
+
+	project, err := projectFromObject(testProjectObject(t, "demo", "user@example.com"))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	m.addProjectPolicies(project)
+	if _, err := m.Enforcer.AddPolicy("user@example.com", "other", "zone", "read"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	token, _, err := m.createToken(context.Background(), "demo", "user@example.com", nil, CreateTokenDto{Name: "ci", Kind: tokenKindPersonal})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	router := gin.New()
+	m.RegisterRoutes(router)
+
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodGet, "/me", nil)
+	request.Header.Set("Authorization", "Bearer "+token.Token)
+	router.ServeHTTP(recorder, request)
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("unexpected status code %d: %s", recorder.Code, recorder.Body.String())
+	}
+
+	var me MeDto
+	if err := json.Unmarshal(recorder.Body.Bytes(), &me); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if me.UserId != "user@example.com" {
+		t.Fatalf("unexpected user %q", me.UserId)
+	}
+	if me.Claims["token_id"] != token.ID {
+		t.Fatalf("unexpected claims %#v", me.Claims)
+	}
+
+	// The test project grants read on every resource
+	if got := len(me.Permissions["demo"]); got != len(ProjectResources)+len(AdminResources) {
+		t.Fatalf("unexpected permissions for demo %#v", me.Permissions["demo"])
+	}
+	if _, ok := me.Permissions["other"]; ok {
+		t.Fatal("expected token to be limited to its own project")
+	}
+}
+
+func TestMeRequiresAuthentication(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	m := newTestTokenModule(t)
+
+	router := gin.New()
+	m.RegisterRoutes(router)
+
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodGet, "/me", nil)
+	request.Header.Set("Authorization", "Bearer edgecdnx_0000_ffff")
+	router.ServeHTTP(recorder, request)
+
+	if recorder.Code != http.StatusUnauthorized {
+		t.Fatalf("unexpected status code %d", recorder.Code)
+	}
+}
+
+func TestAuthzCheckEvaluatesBatch(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	m := newTestTokenModule(t)
+	m.cfg.DefaultAdminProject = "admin"
+
+	if _, err := m.Enforcer.AddPolicy("user@example.com", "admin", "*", "read"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, err := m.Enforcer.AddPolicy("viewer", "demo", "service", "read"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, err := m.Enforcer.AddGroupingPolicy("oidc-support", "viewer", "demo"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	token, _, err := m.createToken(context.Background(), "admin", "user@example.com", nil, CreateTokenDto{Name: "ci", Kind: tokenKindPersonal})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	router := gin.New()
+	m.RegisterRoutes(router)
+
+	body := `{"checks":[{"project":"demo","resource":"service","action":"read"},{"project":"demo","resource":"service","action":"delete"}]}`
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodPost, "/authz/check?as=someone@example.com&as_groups=oidc-support", strings.NewReader(body))
+	request.Header.Set("Authorization", "Bearer "+token.Token)
+	router.ServeHTTP(recorder, request)
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("unexpected status code %d: %s", recorder.Code, recorder.Body.String())
+	}
+
+	var response AuthzCheckResponseDto
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if response.Subject != "someone@example.com" {
+		t.Fatalf("unexpected subject %q", response.Subject)
+	}
+	if len(response.Results) != 2 || !response.Results[0].Allowed || response.Results[1].Allowed {
+		t.Fatalf("unexpected results %#v", response.Results)
+	}
+}
+
+func TestAuthzCheckImpersonationRequiresAdmin(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	m := newTestTokenModule(t)
+	m.cfg.DefaultAdminProject = "admin"
+
+	token, _, err := m.createToken(context.Background(), "demo", "user@example.com", nil, CreateTokenDto{Name: "ci", Kind: tokenKindPersonal})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	router := gin.New()
+	m.RegisterRoutes(router)
+
+	body := `{"checks":[{"project":"demo","resource":"service","action":"read"}]}`
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodPost, "/authz/check?as=someone@example.com", strings.NewReader(body))
+	request.Header.Set("Authorization", "Bearer "+token.Token)
+	router.ServeHTTP(recorder, request)
+
+	if recorder.Code != http.StatusForbidden {
+		t.Fatalf("unexpected status code %d", recorder.Code)
+	}
+}
@@ -0,0 +1,539 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/EdgeCDN-X/edgecdnx-api/src/internal/logger"
+	infrastructurev1alpha1 "github.com/EdgeCDN-X/edgecdnx-controller/api/v1alpha1"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/util/retry"
+)
+
+// Bearer tokens issued by the API look like edgecdnx_<id>_<secret>. The id names the Secret holding the hash.
+const tokenPrefix = "edgecdnx_"
+
+const (
+	tokenKindPersonal       = "personal"
+	tokenKindServiceAccount = "serviceaccount"
+
+	tokenSecretPrefix = "edgecdnx-token-"
+	tokenHashKey      = "hash"
+
+	tokenLabel     = "edgecdnx.com/token"
+	tokenKindLabel = "edgecdnx.com/token-kind"
+
+	tokenNameAnnotation      = "edgecdnx.com/token-name"
+	tokenSubjectAnnotation   = "edgecdnx.com/token-subject"
+	tokenRoleAnnotation      = "edgecdnx.com/token-role"
+	tokenCreatedByAnnotation = "edgecdnx.com/created-by"
+	tokenExpiresAnnotation   = "edgecdnx.com/expires-at"
+	tokenGroupsAnnotation    = "edgecdnx.com/token-groups"
+	tokenLastUsedAnnotation  = "edgecdnx.com/last-used-at"
+
+	// Last-used timestamps are batched and written back once per this interval, so busy tokens don't turn every request into a write
+	tokenLastUsedResolution = time.Minute
+
+	// defaultPersonalTokenMaxLifetime applies when Config.PersonalTokenMaxLifetime is not set
+	defaultPersonalTokenMaxLifetime = 90 * 24 * time.Hour
+)
+
+var projectGVR = schema.GroupVersionResource{
+	Group:    infrastructurev1alpha1.SchemeGroupVersion.Group,
+	Version:  infrastructurev1alpha1.SchemeGroupVersion.Version,
+	Resource: "projects",
+}
+
+// Token Secrets are read from the shared informer cache, so authenticating a request does not reach the API server.
+// The cache is restricted to Secrets carrying tokenLabel, other Secrets of the namespace are never held in memory.
+var secretGVR = corev1.SchemeGroupVersion.WithResource("secrets")
+
+var errInvalidToken = errors.New("invalid token")
+
+// tokenIdentity is the caller resolved from an API token. Personal tokens carry the groups their owner had when
+// creating them. Groups the owner loses are dropped the next time the owner signs in through OIDC, see
+// narrowTokenGroups, the maximum lifetime bounds how long a token can keep them otherwise. Service accounts have none.
+type tokenIdentity struct {
+	ID      string
+	Kind    string
+	Project string
+	Subject string
+	Groups  []string
+}
+
+func generateToken() (string, string, error) {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return "", "", err
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", err
+	}
+	return hex.EncodeToString(id), hex.EncodeToString(secret), nil
+}
+
+func parseToken(raw string) (string, string, bool) {
+	if !strings.HasPrefix(raw, tokenPrefix) {
+		return "", "", false
+	}
+	parts := strings.SplitN(strings.TrimPrefix(raw, tokenPrefix), "_", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
+
+func hashTokenSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func serviceAccountSubject(project string, name string) string {
+	return "serviceaccount:" + project + ":" + name
+}
+
+func tokenFromSecret(secret *corev1.Secret) TokenDto {
+	dto := TokenDto{
+		ID:        strings.TrimPrefix(secret.Name, tokenSecretPrefix),
+		Name:      secret.Annotations[tokenNameAnnotation],
+		Kind:      secret.Labels[tokenKindLabel],
+		Project:   secret.Labels["project"],
+		Subject:   secret.Annotations[tokenSubjectAnnotation],
+		Role:      secret.Annotations[tokenRoleAnnotation],
+		CreatedBy: secret.Annotations[tokenCreatedByAnnotation],
+		CreatedAt: secret.CreationTimestamp.Time,
+	}
+	if t, err := time.Parse(time.RFC3339, secret.Annotations[tokenExpiresAnnotation]); err == nil {
+		dto.ExpiresAt = &t
+	}
+	if t, err := time.Parse(time.RFC3339, secret.Annotations[tokenLastUsedAnnotation]); err == nil {
+		dto.LastUsedAt = &t
+	}
+	if groups := secret.Annotations[tokenGroupsAnnotation]; groups != "" {
+		dto.Groups = strings.Split(groups, ",")
+	}
+	return dto
+}
+
+// tokenSecrets returns the client for token Secrets. Writes go through the cache as well so reads see them at once.
+func (m *Module) tokenSecrets() dynamic.ResourceInterface {
+	return m.client.Resource(secretGVR).Namespace(m.cfg.Namespace)
+}
+
+func (m *Module) getTokenSecret(ctx context.Context, name string) (*corev1.Secret, error) {
+	obj, err := m.tokenSecrets().Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	secret := &corev1.Secret{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, secret); err != nil {
+		return nil, err
+	}
+	return secret, nil
+}
+
+func (m *Module) listTokens(ctx context.Context, project string) ([]TokenDto, error) {
+	objList, err := m.tokenSecrets().List(ctx, metav1.ListOptions{
+		LabelSelector: tokenLabel + "=true,project=" + project,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	tokens := []TokenDto{}
+	for _, item := range objList.Items {
+		secret := &corev1.Secret{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(item.Object, secret); err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, tokenFromSecret(secret))
+	}
+	return tokens, nil
+}
+
+func (m *Module) personalTokenMaxLifetime() time.Duration {
+	if m.cfg.PersonalTokenMaxLifetime > 0 {
+		return m.cfg.PersonalTokenMaxLifetime
+	}
+	return defaultPersonalTokenMaxLifetime
+}
+
+// tokenExpiry returns when a token stops being valid. Personal tokens never outlive the maximum lifetime, including
+// the ones created before it was enforced.
+func (m *Module) tokenExpiry(token TokenDto) *time.Time {
+	if token.Kind != tokenKindPersonal || token.CreatedAt.IsZero() {
+		return token.ExpiresAt
+	}
+	limit := token.CreatedAt.Add(m.personalTokenMaxLifetime())
+	if token.ExpiresAt == nil || token.ExpiresAt.After(limit) {
+		return &limit
+	}
+	return token.ExpiresAt
+}
+
+// checkRoleGrantable makes sure the caller holds every permission of the role it binds a service account to, so the
+// token create permission can't be used to obtain more rights than the caller has
+func (m *Module) checkRoleGrantable(ctx context.Context, project string, subject string, groups []string, role string) (int, error) {
+	obj, err := m.client.Resource(projectGVR).Namespace(m.cfg.Namespace).Get(ctx, project, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return 404, fmt.Errorf("project not found")
+		}
+		return 500, fmt.Errorf("failed to retrieve project: %w", err)
+	}
+
+	p := &infrastructurev1alpha1.Project{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, p); err != nil {
+		return 500, fmt.Errorf("failed to convert project: %w", err)
+	}
+
+	rules := []infrastructurev1alpha1.RuleSpec{}
+	for _, rule := range projectRules(p) {
+		if rule.V0 == role {
+			rules = append(rules, rule)
+		}
+	}
+	if len(rules) == 0 {
+		return 400, fmt.Errorf("role %s is not defined in the project", role)
+	}
+
+	return checkRulesGrantable(m.Enforcer, subject, groups, project, role, rules)
+}
+
+// createToken stores a new token for the project and returns it with its plaintext value. Personal tokens act as
+// the creator with the given groups and expire within the maximum lifetime, service accounts get their own
+// subject bound to dto.Role. For service accounts groups are only used to check the role can be granted.
+func (m *Module) createToken(ctx context.Context, project string, createdBy string, groups []string, dto CreateTokenDto) (TokenDto, int, error) {
+	now := time.Now()
+	if dto.ExpiresAt != nil && !dto.ExpiresAt.After(now) {
+		return TokenDto{}, 400, fmt.Errorf("expiresAt must be in the future")
+	}
+
+	subject := createdBy
+	expiresAt := dto.ExpiresAt
+	if dto.Kind == tokenKindServiceAccount {
+		if dto.Role == "" {
+			return TokenDto{}, 400, fmt.Errorf("role is required for service accounts")
+		}
+		subject = serviceAccountSubject(project, dto.Name)
+
+		if code, err := m.checkRoleGrantable(ctx, project, createdBy, groups, dto.Role); err != nil {
+			return TokenDto{}, code, err
+		}
+
+		existing, err := m.listTokens(ctx, project)
+		if err != nil {
+			return TokenDto{}, 500, fmt.Errorf("failed to list tokens: %w", err)
+		}
+		if slices.ContainsFunc(existing, func(t TokenDto) bool { return t.Subject == subject }) {
+			return TokenDto{}, 409, fmt.Errorf("service account with the same name already exists in the project")
+		}
+	} else {
+		if dto.Role != "" {
+			return TokenDto{}, 400, fmt.Errorf("role can only be set for service accounts, personal tokens use the roles of their owner")
+		}
+
+		limit := now.Add(m.personalTokenMaxLifetime())
+		if expiresAt == nil {
+			expiresAt = &limit
+		} else if expiresAt.After(limit) {
+			return TokenDto{}, 400, fmt.Errorf("expiresAt of personal tokens must be within %s", m.personalTokenMaxLifetime())
+		}
+	}
+
+	id, secretValue, err := generateToken()
+	if err != nil {
+		return TokenDto{}, 500, fmt.Errorf("failed to generate token: %w", err)
+	}
+
+	secret := &corev1.Secret{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: corev1.SchemeGroupVersion.String(),
+			Kind:       "Secret",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      tokenSecretPrefix + id,
+			Namespace: m.cfg.Namespace,
+			Labels: map[string]string{
+				tokenLabel:     "true",
+				tokenKindLabel: dto.Kind,
+				"project":      project,
+			},
+			Annotations: map[string]string{
+				tokenNameAnnotation:      dto.Name,
+				tokenSubjectAnnotation:   subject,
+				tokenRoleAnnotation:      dto.Role,
+				tokenCreatedByAnnotation: createdBy,
+			},
+		},
+		Type: corev1.SecretTypeOpaque,
+		Data: map[string][]byte{
+			tokenHashKey: []byte(hashTokenSecret(secretValue)),
+		},
+	}
+	if expiresAt != nil {
+		secret.Annotations[tokenExpiresAnnotation] = expiresAt.UTC().Format(time.RFC3339)
+	}
+	if dto.Kind == tokenKindPersonal && len(groups) > 0 {
+		secret.Annotations[tokenGroupsAnnotation] = strings.Join(groups, ",")
+	}
+
+	objMap, err := runtime.DefaultUnstructuredConverter.ToUnstructured(secret)
+	if err != nil {
+		return TokenDto{}, 500, fmt.Errorf("internal error")
+	}
+	createdObj, err := m.tokenSecrets().Create(ctx, &unstructured.Unstructured{Object: objMap}, metav1.CreateOptions{})
+	if err != nil {
+		return TokenDto{}, 500, fmt.Errorf("failed to store token: %w", err)
+	}
+	created := &corev1.Secret{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(createdObj.Object, created); err != nil {
+		return TokenDto{}, 500, fmt.Errorf("internal error")
+	}
+
+	if dto.Kind == tokenKindServiceAccount {
+		code, err := m.updateProjectGroups(ctx, project, func(groups []infrastructurev1alpha1.RuleSpec, rules []infrastructurev1alpha1.RuleSpec) ([]infrastructurev1alpha1.RuleSpec, error) {
+			if !slices.ContainsFunc(rules, func(r infrastructurev1alpha1.RuleSpec) bool { return r.V0 == dto.Role }) {
+				return nil, fmt.Errorf("role %s is not defined in the project", dto.Role)
+			}
+			return append(groups, infrastructurev1alpha1.RuleSpec{PType: "g", V0: subject, V1: dto.Role, V2: project}), nil
+		})
+		if err != nil {
+			// Don't leave a usable credential behind without its role binding
+			if delErr := m.tokenSecrets().Delete(ctx, created.Name, metav1.DeleteOptions{}); delErr != nil {
+				logger.L().Error("Failed to clean up token after binding failure", zap.String("token", created.Name), zap.Error(delErr))
+			}
+			return TokenDto{}, code, err
+		}
+	}
+
+	ret := tokenFromSecret(created)
+	ret.Token = tokenPrefix + id + "_" + secretValue
+	return ret, 201, nil
+}
+
+// revokeToken deletes the token and, for service accounts, the role binding of its subject
+func (m *Module) revokeToken(ctx context.Context, project string, id string) (int, error) {
+	secret, err := m.getTokenSecret(ctx, tokenSecretPrefix+id)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return 404, fmt.Errorf("token not found")
+		}
+		return 500, fmt.Errorf("failed to retrieve token: %w", err)
+	}
+
+	if secret.Labels[tokenLabel] != "true" || secret.Labels["project"] != project {
+		return 404, fmt.Errorf("token not found")
+	}
+
+	if secret.Labels[tokenKindLabel] == tokenKindServiceAccount {
+		subject := secret.Annotations[tokenSubjectAnnotation]
+		code, err := m.updateProjectGroups(ctx, project, func(groups []infrastructurev1alpha1.RuleSpec, _ []infrastructurev1alpha1.RuleSpec) ([]infrastructurev1alpha1.RuleSpec, error) {
+			return slices.DeleteFunc(groups, func(g infrastructurev1alpha1.RuleSpec) bool { return g.V0 == subject }), nil
+		})
+		if err != nil && code != 404 {
+			return code, err
+		}
+	}
+
+	err = m.tokenSecrets().Delete(ctx, secret.Name, metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return 500, fmt.Errorf("failed to delete token: %w", err)
+	}
+
+	return 204, nil
+}
+
+// validateToken resolves a bearer token to its identity. Every failure is reported as errInvalidToken so callers can't probe for ids.
+func (m *Module) validateToken(ctx context.Context, raw string) (*tokenIdentity, error) {
+	id, secretValue, ok := parseToken(raw)
+	if !ok {
+		return nil, errInvalidToken
+	}
+
+	secret, err := m.getTokenSecret(ctx, tokenSecretPrefix+id)
+	if err != nil {
+		if !apierrors.IsNotFound(err) {
+			logger.L().Error("Failed to retrieve token", zap.String("id", id), zap.Error(err))
+		}
+		return nil, errInvalidToken
+	}
+
+	if secret.Labels[tokenLabel] != "true" {
+		return nil, errInvalidToken
+	}
+
+	if subtle.ConstantTimeCompare(secret.Data[tokenHashKey], []byte(hashTokenSecret(secretValue))) != 1 {
+		return nil, errInvalidToken
+	}
+
+	token := tokenFromSecret(secret)
+	now := time.Now()
+	if expiresAt := m.tokenExpiry(token); expiresAt != nil && now.After(*expiresAt) {
+		return nil, errInvalidToken
+	}
+
+	if token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) > tokenLastUsedResolution {
+		m.recordTokenUse(secret.Name, now)
+	}
+
+	return &tokenIdentity{
+		ID:      token.ID,
+		Kind:    token.Kind,
+		Project: token.Project,
+		Subject: token.Subject,
+		Groups:  token.Groups,
+	}, nil
+}
+
+// recordTokenUse remembers when a token was used, flushTokenUses writes it back later
+func (m *Module) recordTokenUse(name string, at time.Time) {
+	m.tokenUsesMu.Lock()
+	defer m.tokenUsesMu.Unlock()
+	if m.tokenUses == nil {
+		m.tokenUses = map[string]time.Time{}
+	}
+	m.tokenUses[name] = at
+}
+
+// runTokenUseFlush writes recorded token uses back once per tokenLastUsedResolution, so the number of writes is bound
+// by the number of tokens in use rather than the number of requests
+func (m *Module) runTokenUseFlush(stop <-chan struct{}) {
+	ticker := time.NewTicker(tokenLastUsedResolution)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			m.flushTokenUses(context.Background())
+			return
+		case <-ticker.C:
+			m.flushTokenUses(context.Background())
+		}
+	}
+}
+
+// recordOwnerGroups remembers the current groups of a subject signed in through OIDC, flushTokenUses narrows the
+// groups of its personal tokens to them
+func (m *Module) recordOwnerGroups(subject string, groups []string) {
+	m.tokenUsesMu.Lock()
+	defer m.tokenUsesMu.Unlock()
+	if m.ownerGroups == nil {
+		m.ownerGroups = map[string][]string{}
+	}
+	m.ownerGroups[subject] = groups
+}
+
+func (m *Module) flushTokenUses(ctx context.Context) {
+	m.tokenUsesMu.Lock()
+	uses := m.tokenUses
+	m.tokenUses = nil
+	owners := m.ownerGroups
+	m.ownerGroups = nil
+	m.tokenUsesMu.Unlock()
+
+	if len(owners) > 0 {
+		m.narrowTokenGroups(ctx, owners)
+	}
+
+	for name, at := range uses {
+		patch := fmt.Sprintf(`{"metadata":{"annotations":{%q:%q}}}`, tokenLastUsedAnnotation, at.UTC().Format(time.RFC3339))
+		_, err := m.tokenSecrets().Patch(ctx, name, types.MergePatchType, []byte(patch), metav1.PatchOptions{})
+		if err != nil && !apierrors.IsNotFound(err) {
+			logger.L().Warn("Failed to record token usage", zap.String("token", name), zap.Error(err))
+		}
+	}
+}
+
+// narrowTokenGroups drops the groups owners no longer have from their personal tokens. Tokens never gain groups,
+// a group added at the identity provider needs a new token.
+func (m *Module) narrowTokenGroups(ctx context.Context, owners map[string][]string) {
+	list, err := m.tokenSecrets().List(ctx, metav1.ListOptions{
+		LabelSelector: tokenLabel + "=true," + tokenKindLabel + "=" + tokenKindPersonal,
+	})
+	if err != nil {
+		logger.L().Warn("Failed to list personal tokens", zap.Error(err))
+		return
+	}
+
+	for _, item := range list.Items {
+		annotations := item.GetAnnotations()
+		current, ok := owners[annotations[tokenSubjectAnnotation]]
+		if !ok || annotations[tokenGroupsAnnotation] == "" {
+			continue
+		}
+
+		groups := strings.Split(annotations[tokenGroupsAnnotation], ",")
+		kept := slices.DeleteFunc(slices.Clone(groups), func(g string) bool { return !slices.Contains(current, g) })
+		if len(kept) == len(groups) {
+			continue
+		}
+
+		// A null value removes the annotation once no group is left
+		value := "null"
+		if len(kept) > 0 {
+			value = fmt.Sprintf("%q", strings.Join(kept, ","))
+		}
+		patch := fmt.Sprintf(`{"metadata":{"annotations":{%q:%s}}}`, tokenGroupsAnnotation, value)
+		_, err := m.tokenSecrets().Patch(ctx, item.GetName(), types.MergePatchType, []byte(patch), metav1.PatchOptions{})
+		if err != nil && !apierrors.IsNotFound(err) {
+			logger.L().Warn("Failed to narrow token groups", zap.String("token", item.GetName()), zap.Error(err))
+		}
+	}
+}
+
+// updateProjectGroups rewrites the grouping rules of a project, retrying on conflicts. The informer picks the change up from there.
+func (m *Module) updateProjectGroups(ctx context.Context, project string, mutate func(groups []infrastructurev1alpha1.RuleSpec, rules []infrastructurev1alpha1.RuleSpec) ([]infrastructurev1alpha1.RuleSpec, error)) (int, error) {
+	code := 500
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		obj, err := m.client.Resource(projectGVR).Namespace(m.cfg.Namespace).Get(ctx, project, metav1.GetOptions{})
+		if err != nil {
+			if apierrors.IsNotFound(err) {
+				code = 404
+				return fmt.Errorf("project not found")
+			}
+			return err
+		}
+
+		p := &infrastructurev1alpha1.Project{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, p); err != nil {
+			return err
+		}
+
+		groups, err := mutate(p.Spec.Rbac.Groups, p.Spec.Rbac.Rules)
+		if err != nil {
+			code = 400
+			return err
+		}
+		p.Spec.Rbac.Groups = groups
+
+		objMap, err := runtime.DefaultUnstructuredConverter.ToUnstructured(p)
+		if err != nil {
+			return err
+		}
+
+		_, err = m.client.Resource(projectGVR).Namespace(m.cfg.Namespace).Update(ctx, &unstructured.Unstructured{Object: objMap}, metav1.UpdateOptions{})
+		return err
+	})
+	if err != nil {
+		return code, err
+	}
+	return 200, nil
+}
@@ -0,0 +1,315 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	infrastructurev1alpha1 "github.com/EdgeCDN-X/edgecdnx-controller/api/v1alpha1"
+	"github.com/gin-gonic/gin"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+func newTestTokenModule(t *testing.T) *Module {
+	t.Helper()
+
+	m := newTestAuthModule(t, Config{Namespace: "edgecdnx"})
+
+	scheme := runtime.NewScheme()
+	if err := infrastructurev1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	project := testProjectObject(t, "demo", "user@example.com")
+	project.SetNamespace("edgecdnx")
+	project.SetAPIVersion(infrastructurev1alpha1.SchemeGroupVersion.String())
+	project.SetKind("Project")
+
+	m.client = dynamicfake.NewSimpleDynamicClientWithCustomListKinds(scheme, map[schema.GroupVersionResource]string{secretGVR: "SecretList"}, project)
+	if err := m.resyncPolicies([]any{project}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	return m
+}
+
+func updateTestSecret(t *testing.T, m *Module, secret *corev1.Secret) {
+	t.Helper()
+
+	objMap, err := runtime.DefaultUnstructuredConverter.ToUnstructured(secret)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, err := m.tokenSecrets().Update(context.Background(), &unstructured.Unstructured{Object: objMap}, metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+}
+
+func TestPersonalTokenRoundTrip(t *testing.T) {
+	m := newTestTokenModule(t)
+	ctx := context.Background()
+
+	token, code, err := m.createToken(ctx, "demo", "user@example.com", []string{"oidc-ops"}, CreateTokenDto{Name: "ci", Kind: tokenKindPersonal})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if code != 201 {
+		t.Fatalf("unexpected status code %d", code)
+	}
+	if token.Token == "" {
+		t.Fatal("expected plaintext token on creation")
+	}
+
+	identity, err := m.validateToken(ctx, token.Token)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if identity.Subject != "user@example.com" || identity.Project != "demo" {
+		t.Fatalf("unexpected identity %#v", identity)
+	}
+	// Without an expiry the token gets the maximum lifetime
+	if token.ExpiresAt == nil || token.ExpiresAt.Before(time.Now().Add(defaultPersonalTokenMaxLifetime-time.Hour)) {
+		t.Fatalf("unexpected expiry %v", token.ExpiresAt)
+	}
+
+	if _, err := m.validateToken(ctx, token.Token+"x"); err == nil {
+		t.Fatal("expected tampered token to be rejected")
+	}
+
+	listed, err := m.listTokens(ctx, "demo")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(listed) != 1 || listed[0].Token != "" {
+		t.Fatalf("expected one listed token without its value, got %#v", listed)
+	}
+
+	if code, err := m.revokeToken(ctx, "demo", token.ID); err != nil || code != 204 {
+		t.Fatalf("unexpected revoke result %d %v", code, err)
+	}
+	if _, err := m.validateToken(ctx, token.Token); err == nil {
+		t.Fatal("expected revoked token to be rejected")
+	}
+}
+
+func TestExpiredTokenIsRejected(t *testing.T) {
+	m := newTestTokenModule(t)
+	ctx := context.Background()
+
+	expiresAt := time.Now().Add(time.Hour)
+	token, _, err := m.createToken(ctx, "demo", "user@example.com", nil, CreateTokenDto{Name: "ci", Kind: tokenKindPersonal, ExpiresAt: &expiresAt})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	secret, err := m.getTokenSecret(ctx, tokenSecretPrefix+token.ID)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	secret.Annotations[tokenExpiresAnnotation] = time.Now().Add(-time.Minute).UTC().Format(time.RFC3339)
+	updateTestSecret(t, m, secret)
+
+	if _, err := m.validateToken(ctx, token.Token); err == nil {
+		t.Fatal("expected expired token to be rejected")
+	}
+}
+
+func TestServiceAccountRequiresKnownRole(t *testing.T) {
+	m := newTestTokenModule(t)
+	ctx := context.Background()
+
+	_, code, err := m.createToken(ctx, "demo", "user@example.com", nil, CreateTokenDto{Name: "deployer", Kind: tokenKindServiceAccount, Role: "viewer"})
+	if err == nil || code != 400 {
+		t.Fatalf("expected unknown role to be rejected, got %d %v", code, err)
+	}
+
+	listed, err := m.listTokens(ctx, "demo")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(listed) != 0 {
+		t.Fatalf("expected the token to be cleaned up, got %#v", listed)
+	}
+
+	token, _, err := m.createToken(ctx, "demo", "user@example.com", nil, CreateTokenDto{Name: "deployer", Kind: tokenKindServiceAccount, Role: "admin"})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if token.Subject != "serviceaccount:demo:deployer" {
+		t.Fatalf("unexpected subject %q", token.Subject)
+	}
+}
+
+func TestAuthzBuilderScopesTokensToTheirProject(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	m := newTestAuthModule(t, Config{})
+	for _, dom := range []string{"demo", "other"} {
+		if _, err := m.Enforcer.AddPolicy("user@example.com", dom, "service", "read"); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+
+	router := gin.New()
+	router.GET("/project/:project-id/services", func(c *gin.Context) {
+		c.Set("user_id", "user@example.com")
+		c.Set("token_project", "demo")
+		c.Next()
+	}, NewAuthzBuilder().E(m.Enforcer).T("project-id").R("service").S("user_id").A("read").Build(), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	for project, want := range map[string]int{"demo": http.StatusOK, "other": http.StatusForbidden} {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/project/"+project+"/services", nil))
+		if recorder.Code != want {
+			t.Fatalf("unexpected status code %d for project %s", recorder.Code, project)
+		}
+	}
+}
+
+func TestPersonalTokenLifetimeIsCapped(t *testing.T) {
+	m := newTestTokenModule(t)
+	m.cfg.PersonalTokenMaxLifetime = 24 * time.Hour
+	ctx := context.Background()
+
+	expiresAt := time.Now().Add(48 * time.Hour)
+	if _, code, err := m.createToken(ctx, "demo", "user@example.com", nil, CreateTokenDto{Name: "ci", Kind: tokenKindPersonal, ExpiresAt: &expiresAt}); err == nil || code != 400 {
+		t.Fatalf("expected an expiry beyond the maximum lifetime to be rejected, got %d %v", code, err)
+	}
+
+	// A token created before the maximum lifetime was enforced, without an expiry
+	token, _, err := m.createToken(ctx, "demo", "user@example.com", nil, CreateTokenDto{Name: "ci", Kind: tokenKindPersonal})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	secret, err := m.getTokenSecret(ctx, tokenSecretPrefix+token.ID)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	delete(secret.Annotations, tokenExpiresAnnotation)
+	secret.CreationTimestamp = metav1.NewTime(time.Now().Add(-25 * time.Hour))
+	updateTestSecret(t, m, secret)
+	if _, err := m.validateToken(ctx, token.Token); err == nil {
+		t.Fatal("expected a token older than the maximum lifetime to be rejected")
+	}
+}
+
+func TestPersonalTokenActsWithOwnerGroups(t *testing.T) {
+	m := newTestTokenModule(t)
+	ctx := context.Background()
+
+	token, _, err := m.createToken(ctx, "demo", "user@example.com", []string{"oidc-ops", "oidc-dev"}, CreateTokenDto{Name: "ci", Kind: tokenKindPersonal})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	account, _, err := m.createToken(ctx, "demo", "user@example.com", []string{"oidc-ops"}, CreateTokenDto{Name: "deployer", Kind: tokenKindServiceAccount, Role: "admin"})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	router := gin.New()
+	router.GET("/me", m.AuthMiddleware(), func(c *gin.Context) {
+		c.String(http.StatusOK, c.GetString("groups"))
+	})
+	groups := func(token string) string {
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodGet, "/me", nil)
+		request.Header.Set("Authorization", "Bearer "+token)
+		router.ServeHTTP(recorder, request)
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("unexpected status code %d", recorder.Code)
+		}
+		return recorder.Body.String()
+	}
+
+	if got := groups(token.Token); got != "oidc-ops,oidc-dev" {
+		t.Fatalf("expected the groups of the owner, got %q", got)
+	}
+	if got := groups(account.Token); got != "" {
+		t.Fatalf("expected service accounts to carry no groups, got %q", got)
+	}
+
+	// The owner signed in without one of the groups
+	m.recordOwnerGroups("user@example.com", []string{"oidc-ops", "oidc-new"})
+	m.recordOwnerGroups("other@example.com", nil)
+	m.flushTokenUses(ctx)
+	if got := groups(token.Token); got != "oidc-ops" {
+		t.Fatalf("expected the removed group to be dropped and no group to be added, got %q", got)
+	}
+
+	m.recordOwnerGroups("user@example.com", nil)
+	m.flushTokenUses(ctx)
+	if got := groups(token.Token); got != "" {
+		t.Fatalf("expected no groups to be left, got %q", got)
+	}
+}
+
+func TestServiceAccountRoleCannotExceedCaller(t *testing.T) {
+	m := newTestTokenModule(t)
+	ctx := context.Background()
+
+	// May create tokens and read services, but the admin role reads everything
+	for _, rule := range [][]string{{"token", "create"}, {"service", "read"}} {
+		if _, err := m.Enforcer.AddPolicy("dev@example.com", "demo", rule[0], rule[1]); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+
+	_, code, err := m.createToken(ctx, "demo", "dev@example.com", nil, CreateTokenDto{Name: "deployer", Kind: tokenKindServiceAccount, Role: "admin"})
+	if err == nil || code != 403 {
+		t.Fatalf("expected the binding to be refused, got %d %v", code, err)
+	}
+
+	// Permissions held through a group count
+	if _, err := m.Enforcer.AddGroupingPolicy("oidc-ops", "admin", "demo"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, _, err := m.createToken(ctx, "demo", "dev@example.com", []string{"oidc-ops"}, CreateTokenDto{Name: "deployer", Kind: tokenKindServiceAccount, Role: "admin"}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+}
+
+func TestTokenUsesAreWrittenInBatches(t *testing.T) {
+	m := newTestTokenModule(t)
+	ctx := context.Background()
+
+	token, _, err := m.createToken(ctx, "demo", "user@example.com", nil, CreateTokenDto{Name: "ci", Kind: tokenKindPersonal})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	for range 3 {
+		if _, err := m.validateToken(ctx, token.Token); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+	if len(m.tokenUses) != 1 {
+		t.Fatalf("expected one pending use, got %#v", m.tokenUses)
+	}
+
+	m.flushTokenUses(ctx)
+	if len(m.tokenUses) != 0 {
+		t.Fatalf("expected pending uses to be flushed, got %#v", m.tokenUses)
+	}
+	secret, err := m.getTokenSecret(ctx, tokenSecretPrefix+token.ID)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if tokenFromSecret(secret).LastUsedAt == nil {
+		t.Fatal("expected the last use to be recorded")
+	}
+
+	// Recently used tokens are not recorded again
+	if _, err := m.validateToken(ctx, token.Token); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(m.tokenUses) != 0 {
+		t.Fatalf("expected no pending use, got %#v", m.tokenUses)
+	}
+}
@@ -0,0 +1,12 @@
+package prefixlists
+
+type CreatePrefixListDto struct {
+	Name string `json:"name" binding:"required,min=3,max=63"`
+	// Prefixes are IPv4 or IPv6 CIDRs or single addresses
+	Prefixes []string `json:"prefixes" binding:"required,min=1,max=1000"`
+}
+
+type UpdatePrefixListDto struct {
+	// Prefixes replaces all prefixes of the list
+	Prefixes []string `json:"prefixes" binding:"required,min=1,max=1000"`
+}
@@ -0,0 +1,46 @@
+package prefixlists
+
+import (
+	"github.com/EdgeCDN-X/edgecdnx-api/src/internal/logger"
+	"github.com/EdgeCDN-X/edgecdnx-api/src/modules/app"
+	"github.com/casbin/casbin/v3"
+	"github.com/gin-gonic/gin"
+	"k8s.io/client-go/dynamic"
+)
+
+type Config struct {
+	Namespace string
+}
+
+type Module struct {
+	cfg         Config
+	client      dynamic.Interface
+	middlewares []gin.HandlerFunc
+	enforcer    *casbin.SyncedEnforcer
+}
+
+func New(cfg Config) *Module {
+	return &Module{cfg: cfg}
+}
+
+func (m *Module) Shutdown() {}
+
+func (m *Module) Init() error {
+	logger.L().Info("Initializing module")
+	k8sCache, err := app.GetK8SCache(m.cfg.Namespace)
+	if err != nil {
+		return err
+	}
+
+	m.client = k8sCache.Client(gvr, serviceGVR)
+
+	return nil
+}
+
+func (m *Module) SetMiddlewares(middlewares ...gin.HandlerFunc) {
+	m.middlewares = middlewares
+}
+
+func (m *Module) SetEnforcer(enforcer *casbin.SyncedEnforcer) {
+	m.enforcer = enforcer
+}
@@ -0,0 +1,279 @@
+package prefixlists
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/EdgeCDN-X/edgecdnx-api/src/internal/cidr"
+	"github.com/EdgeCDN-X/edgecdnx-api/src/modules/audit"
+	"github.com/EdgeCDN-X/edgecdnx-api/src/modules/auth"
+	infrastructurev1alpha1 "github.com/EdgeCDN-X/edgecdnx-controller/api/v1alpha1"
+	"github.com/gin-gonic/gin"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+var gvr = schema.GroupVersionResource{
+	Group:    infrastructurev1alpha1.SchemeGroupVersion.Group,
+	Version:  infrastructurev1alpha1.SchemeGroupVersion.Version,
+	Resource: "prefixlists",
+}
+
+var serviceGVR = schema.GroupVersionResource{
+	Group:    infrastructurev1alpha1.SchemeGroupVersion.Group,
+	Version:  infrastructurev1alpha1.SchemeGroupVersion.Version,
+	Resource: "services",
+}
+
+// Project lists are access lists, not routing input. The controller merges Static and Bgp lists into the
+// routing of their destination and only manages Controller lists carrying its values hash, so project lists
+// are written as Controller lists without a destination or hash and are left alone.
+const projectListSource = "Controller"
+
+// ReferenceLabel is set on every service that uses the prefix list in its access rules
+func ReferenceLabel(name string) string {
+	return "prefixlist.edgecdnx.com/" + name
+}
+
+func (m *Module) RegisterRoutes(r *gin.Engine) {
+	group := r.Group("project/:project-id/prefixlists", m.middlewares...)
+
+	group.GET("", auth.NewAuthzBuilder().E(m.enforcer).T("project-id").R("prefixlist").S("user_id").A("read").Build(), func(c *gin.Context) {
+		objList, err := m.client.Resource(gvr).Namespace(m.cfg.Namespace).List(c, metav1.ListOptions{
+			LabelSelector: "project=" + c.Param("project-id"),
+		})
+		if err != nil {
+			c.JSON(500, gin.H{"error": "failed to list prefix lists: " + err.Error()})
+			return
+		}
+
+		prefixLists := []infrastructurev1alpha1.PrefixList{}
+		for _, item := range objList.Items {
+			prefixList := &infrastructurev1alpha1.PrefixList{}
+			if err := runtime.DefaultUnstructuredConverter.FromUnstructured(item.UnstructuredContent(), prefixList); err != nil {
+				c.JSON(500, gin.H{"error": "failed to convert prefix list: " + err.Error()})
+				return
+			}
+			prefixLists = append(prefixLists, *prefixList)
+		}
+
+		c.JSON(200, prefixLists)
+		return
+	})
+
+	group.POST("", auth.NewAuthzBuilder().E(m.enforcer).T("project-id").R("prefixlist").S("user_id").A("create").Build(), func(c *gin.Context) {
+		var dto CreatePrefixListDto
+		if err := c.ShouldBindJSON(&dto); err != nil {
+			c.JSON(400, gin.H{"error": "invalid request body: " + err.Error()})
+			return
+		}
+
+		if msgs := validation.IsDNS1123Label(dto.Name); len(msgs) > 0 {
+			c.JSON(400, gin.H{"error": "invalid name: " + strings.Join(msgs, ", ")})
+			return
+		}
+
+		spec, errs := prefixSpec(dto.Prefixes)
+		if len(errs) > 0 {
+			c.JSON(400, gin.H{"error": "invalid prefixes", "fields": errs})
+			return
+		}
+
+		prefixList := &infrastructurev1alpha1.PrefixList{
+			TypeMeta: metav1.TypeMeta{
+				APIVersion: infrastructurev1alpha1.SchemeGroupVersion.String(),
+				Kind:       "PrefixList",
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      dto.Name,
+				Namespace: m.cfg.Namespace,
+				Labels: map[string]string{
+					"project": c.Param("project-id"),
+				},
+			},
+			Spec: infrastructurev1alpha1.PrefixListSpec{
+				Source: projectListSource,
+				Prefix: spec,
+			},
+		}
+
+		objMap, err := runtime.DefaultUnstructuredConverter.ToUnstructured(prefixList)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "failed to convert prefix list: " + err.Error()})
+			return
+		}
+
+		createdObj, err := m.client.Resource(gvr).Namespace(m.cfg.Namespace).Create(c, &unstructured.Unstructured{Object: objMap}, metav1.CreateOptions{})
+		if err != nil {
+			if apierrors.IsAlreadyExists(err) {
+				c.JSON(409, gin.H{"error": "prefix list with the same name already exists. Prefix lists must have unique names within the platform."})
+				return
+			}
+			c.JSON(500, gin.H{"error": "failed to create prefix list: " + err.Error()})
+			return
+		}
+
+		audit.Change(c, nil, createdObj)
+
+		created := &infrastructurev1alpha1.PrefixList{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(createdObj.UnstructuredContent(), created); err != nil {
+			c.JSON(500, gin.H{"error": "failed to convert created prefix list: " + err.Error()})
+			return
+		}
+
+		c.JSON(201, created)
+		return
+	})
+
+	group.GET("/:prefixlist-id", auth.NewAuthzBuilder().E(m.enforcer).T("project-id").R("prefixlist").S("user_id").A("read").Build(), func(c *gin.Context) {
+		prefixList, code, err := m.getPrefixList(c, c.Param("project-id"), c.Param("prefixlist-id"))
+		if err != nil {
+			c.JSON(code, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(200, prefixList)
+		return
+	})
+
+	group.PUT("/:prefixlist-id", auth.NewAuthzBuilder().E(m.enforcer).T("project-id").R("prefixlist").S("user_id").A("update").Build(), func(c *gin.Context) {
+		var dto UpdatePrefixListDto
+		if err := c.ShouldBindJSON(&dto); err != nil {
+			c.JSON(400, gin.H{"error": "invalid request body: " + err.Error()})
+			return
+		}
+
+		spec, errs := prefixSpec(dto.Prefixes)
+		if len(errs) > 0 {
+			c.JSON(400, gin.H{"error": "invalid prefixes", "fields": errs})
+			return
+		}
+
+		prefixList, code, err := m.getPrefixList(c, c.Param("project-id"), c.Param("prefixlist-id"))
+		if err != nil {
+			c.JSON(code, gin.H{"error": err.Error()})
+			return
+		}
+		before := prefixList.DeepCopy()
+
+		prefixList.Spec.Prefix = spec
+
+		objMap, err := runtime.DefaultUnstructuredConverter.ToUnstructured(prefixList)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "failed to convert prefix list: " + err.Error()})
+			return
+		}
+
+		updatedObj, err := m.client.Resource(gvr).Namespace(m.cfg.Namespace).Update(c, &unstructured.Unstructured{Object: objMap}, metav1.UpdateOptions{})
+		if err != nil {
+			if apierrors.IsConflict(err) {
+				c.JSON(409, gin.H{"error": "prefix list was modified concurrently, please retry"})
+				return
+			}
+			c.JSON(500, gin.H{"error": "failed to update prefix list: " + err.Error()})
+			return
+		}
+
+		audit.Change(c, before, updatedObj)
+
+		updated := &infrastructurev1alpha1.PrefixList{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(updatedObj.UnstructuredContent(), updated); err != nil {
+			c.JSON(500, gin.H{"error": "failed to convert updated prefix list: " + err.Error()})
+			return
+		}
+
+		c.JSON(200, updated)
+		return
+	})
+
+	group.DELETE("/:prefixlist-id", auth.NewAuthzBuilder().E(m.enforcer).T("project-id").R("prefixlist").S("user_id").A("delete").Build(), func(c *gin.Context) {
+		prefixList, code, err := m.getPrefixList(c, c.Param("project-id"), c.Param("prefixlist-id"))
+		if err != nil {
+			c.JSON(code, gin.H{"error": err.Error()})
+			return
+		}
+
+		// Removing a list still referenced would silently change who may reach those services
+		services, err := m.client.Resource(serviceGVR).Namespace(m.cfg.Namespace).List(c, metav1.ListOptions{
+			LabelSelector: ReferenceLabel(prefixList.Name),
+		})
+		if err != nil {
+			c.JSON(500, gin.H{"error": "failed to list services: " + err.Error()})
+			return
+		}
+		if len(services.Items) > 0 {
+			names := []string{}
+			for _, item := range services.Items {
+				names = append(names, item.GetName())
+			}
+			c.JSON(409, gin.H{"error": "prefix list is still used by services", "services": names})
+			return
+		}
+
+		err = m.client.Resource(gvr).Namespace(m.cfg.Namespace).Delete(c, prefixList.Name, metav1.DeleteOptions{})
+		if err != nil {
+			if apierrors.IsNotFound(err) {
+				c.JSON(404, gin.H{"error": "prefix list not found"})
+				return
+			}
+			c.JSON(500, gin.H{"error": "failed to delete prefix list: " + err.Error()})
+			return
+		}
+
+		audit.Change(c, prefixList, nil)
+
+		c.Status(204)
+		return
+	})
+}
+
+// getPrefixList fetches a prefix list of the project, lists of other projects and admin lists are reported as not found
+func (m *Module) getPrefixList(ctx context.Context, project string, name string) (*infrastructurev1alpha1.PrefixList, int, error) {
+	obj, err := m.client.Resource(gvr).Namespace(m.cfg.Namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, 404, fmt.Errorf("prefix list not found")
+		}
+		return nil, 500, fmt.Errorf("failed to retrieve prefix list: %w", err)
+	}
+
+	if obj.GetLabels()["project"] != project {
+		return nil, 404, fmt.Errorf("prefix list not found")
+	}
+
+	prefixList := &infrastructurev1alpha1.PrefixList{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, prefixList); err != nil {
+		return nil, 500, fmt.Errorf("internal error")
+	}
+
+	return prefixList, 200, nil
+}
+
+// prefixSpec normalises the prefixes and splits them by address family.
+// Errors are keyed by the JSON path of the offending value, e.g. prefixes[3].
+func prefixSpec(values []string) (infrastructurev1alpha1.PrefixSpec, map[string]string) {
+	spec := infrastructurev1alpha1.PrefixSpec{}
+
+	prefixes, errs := cidr.Normalize(values)
+	if len(errs) > 0 {
+		fields := map[string]string{}
+		for i, msg := range errs {
+			fields[fmt.Sprintf("prefixes[%d]", i)] = msg
+		}
+		return spec, fields
+	}
+
+	for _, prefix := range prefixes {
+		if prefix.Addr().Is4() {
+			spec.V4 = append(spec.V4, infrastructurev1alpha1.V4PrefixSpec{Address: prefix.Addr().String(), Size: prefix.Bits()})
+		} else {
+			spec.V6 = append(spec.V6, infrastructurev1alpha1.V6PrefixSpec{Address: prefix.Addr().String(), Size: prefix.Bits()})
+		}
+	}
+	return spec, nil
+}
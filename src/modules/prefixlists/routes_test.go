@@ -0,0 +1,194 @@
+package prefixlists
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/EdgeCDN-X/edgecdnx-api/src/internal/logger"
+	"github.com/EdgeCDN-X/edgecdnx-api/src/modules/auth"
+	infrastructurev1alpha1 "github.com/EdgeCDN-X/edgecdnx-controller/api/v1alpha1"
+	"github.com/casbin/casbin/v3"
+	"github.com/casbin/casbin/v3/model"
+	"github.com/gin-gonic/gin"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+const testNamespace = "edgecdnx"
+
+func newTestModule(t *testing.T, objects ...runtime.Object) (*Module, *dynamicfake.FakeDynamicClient) {
+	t.Helper()
+	logger.Init(false)
+
+	casbinModel, err := model.NewModelFromString(auth.RBACWithDomainModel)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	enforcer, err := casbin.NewSyncedEnforcer(casbinModel)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	for _, act := range auth.Actions {
+		if _, err := enforcer.AddPolicy("user@example.com", "demo", "*", act); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+
+	seed := []runtime.Object{}
+	for _, obj := range objects {
+		content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		seed = append(seed, &unstructured.Unstructured{Object: content})
+	}
+
+	dynClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(
+		runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{gvr: "PrefixListList", serviceGVR: "ServiceList"},
+		seed...,
+	)
+
+	return &Module{
+		cfg:      Config{Namespace: testNamespace},
+		client:   dynClient,
+		enforcer: enforcer,
+		middlewares: []gin.HandlerFunc{func(c *gin.Context) {
+			c.Set("user_id", "user@example.com")
+			c.Set("groups", "")
+			c.Next()
+		}},
+	}, dynClient
+}
+
+func testPrefixList(name string, project string) *infrastructurev1alpha1.PrefixList {
+	return &infrastructurev1alpha1.PrefixList{
+		TypeMeta:   metav1.TypeMeta{APIVersion: infrastructurev1alpha1.SchemeGroupVersion.String(), Kind: "PrefixList"},
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: testNamespace, Labels: map[string]string{"project": project}},
+		Spec:       infrastructurev1alpha1.PrefixListSpec{Source: projectListSource},
+	}
+}
+
+func serve(router *gin.Engine, method string, path string, body string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(method, path, strings.NewReader(body))
+	request.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestCreatePrefixListNormalizesPrefixes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	m, _ := newTestModule(t)
+
+	router := gin.New()
+	m.RegisterRoutes(router)
+
+	recorder := serve(router, http.MethodPost, "/project/demo/prefixlists", `{"name":"office","prefixes":["10.0.0.0/33","bad"]}`)
+	if recorder.Code != http.StatusBadRequest {
+		t.Fatalf("unexpected status code %d: %s", recorder.Code, recorder.Body.String())
+	}
+	var body struct {
+		Fields map[string]string `json:"fields"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(body.Fields) != 2 || body.Fields["prefixes[0]"] == "" || body.Fields["prefixes[1]"] == "" {
+		t.Fatalf("unexpected field errors %#v", body.Fields)
+	}
+
+	recorder = serve(router, http.MethodPost, "/project/demo/prefixlists", `{"name":"office","prefixes":["192.0.2.9/24","192.0.2.0/25","2001:db8::1","198.51.100.7"]}`)
+	if recorder.Code != http.StatusCreated {
+		t.Fatalf("unexpected status code %d: %s", recorder.Code, recorder.Body.String())
+	}
+	var created infrastructurev1alpha1.PrefixList
+	if err := json.Unmarshal(recorder.Body.Bytes(), &created); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if created.Labels["project"] != "demo" || created.Spec.Source != projectListSource || created.Spec.Destination != "" {
+		t.Fatalf("unexpected prefix list %#v", created)
+	}
+	if len(created.Spec.Prefix.V4) != 2 || created.Spec.Prefix.V4[0] != (infrastructurev1alpha1.V4PrefixSpec{Address: "192.0.2.0", Size: 24}) {
+		t.Fatalf("unexpected IPv4 prefixes %#v", created.Spec.Prefix.V4)
+	}
+	if len(created.Spec.Prefix.V6) != 1 || created.Spec.Prefix.V6[0] != (infrastructurev1alpha1.V6PrefixSpec{Address: "2001:db8::1", Size: 128}) {
+		t.Fatalf("unexpected IPv6 prefixes %#v", created.Spec.Prefix.V6)
+	}
+
+	recorder = serve(router, http.MethodPost, "/project/demo/prefixlists", `{"name":"office","prefixes":["10.0.0.0/8"]}`)
+	if recorder.Code != http.StatusConflict {
+		t.Fatalf("unexpected status code %d: %s", recorder.Code, recorder.Body.String())
+	}
+}
+
+func TestPrefixListsOfOtherProjectsAreHidden(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	m, _ := newTestModule(t, testPrefixList("office", "demo"), testPrefixList("partner", "other"))
+
+	router := gin.New()
+	m.RegisterRoutes(router)
+
+	recorder := serve(router, http.MethodGet, "/project/demo/prefixlists", "")
+	var lists []infrastructurev1alpha1.PrefixList
+	if err := json.Unmarshal(recorder.Body.Bytes(), &lists); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(lists) != 1 || lists[0].Name != "office" {
+		t.Fatalf("unexpected prefix lists %#v", lists)
+	}
+
+	recorder = serve(router, http.MethodPut, "/project/demo/prefixlists/partner", `{"prefixes":["10.0.0.0/8"]}`)
+	if recorder.Code != http.StatusNotFound {
+		t.Fatalf("unexpected status code %d: %s", recorder.Code, recorder.Body.String())
+	}
+
+	recorder = serve(router, http.MethodPut, "/project/demo/prefixlists/office", `{"prefixes":["10.0.0.0/8","10.1.0.0/16"]}`)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("unexpected status code %d: %s", recorder.Code, recorder.Body.String())
+	}
+	var updated infrastructurev1alpha1.PrefixList
+	if err := json.Unmarshal(recorder.Body.Bytes(), &updated); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(updated.Spec.Prefix.V4) != 1 || updated.Spec.Prefix.V4[0].Size != 8 {
+		t.Fatalf("unexpected prefixes %#v", updated.Spec.Prefix)
+	}
+}
+
+func TestDeletePrefixListRefusesWhileReferenced(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	service := &infrastructurev1alpha1.Service{
+		TypeMeta: metav1.TypeMeta{APIVersion: infrastructurev1alpha1.SchemeGroupVersion.String(), Kind: "Service"},
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: testNamespace, Labels: map[string]string{
+			"project":                "demo",
+			ReferenceLabel("office"): "",
+		}},
+	}
+	m, client := newTestModule(t, testPrefixList("office", "demo"), testPrefixList("unused", "demo"), service)
+
+	router := gin.New()
+	m.RegisterRoutes(router)
+
+	recorder := serve(router, http.MethodDelete, "/project/demo/prefixlists/office", "")
+	if recorder.Code != http.StatusConflict {
+		t.Fatalf("unexpected status code %d: %s", recorder.Code, recorder.Body.String())
+	}
+
+	recorder = serve(router, http.MethodDelete, "/project/demo/prefixlists/unused", "")
+	if recorder.Code != http.StatusNoContent {
+		t.Fatalf("unexpected status code %d: %s", recorder.Code, recorder.Body.String())
+	}
+	if _, err := client.Resource(gvr).Namespace(testNamespace).Get(context.Background(), "unused", metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+		t.Fatalf("expected prefix list to be deleted, got %v", err)
+	}
+}
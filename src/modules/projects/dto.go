@@ -5,3 +5,26 @@ type ProjectDto struct {
 	Name        string `json:"name" binding:"required,min=3,max=63"`
 	Description string `json:"description" binding:"max=255"`
 }
+
+type ProjectUpdateDto struct {
+	Name        string  `json:"name,omitempty" binding:"omitempty,min=3,max=63"`
+	Description *string `json:"description,omitempty" binding:"omitempty,max=255"`
+}
+
+type MemberDto struct {
+	Subject string `json:"subject" binding:"required,max=255"`
+	Kind    string `json:"kind" binding:"required,oneof=user group"`
+	// Issuer is the URL of the OIDC issuer the subject belongs to, its group or subject prefix is added to the subject
+	Issuer string `json:"issuer,omitempty" binding:"omitempty,max=255"`
+	Role   string `json:"role" binding:"required,max=63"`
+}
+
+type PermissionDto struct {
+	Resource string `json:"resource" binding:"required"`
+	Action   string `json:"action" binding:"required"`
+}
+
+type RoleDto struct {
+	Name        string          `json:"name"`
+	Permissions []PermissionDto `json:"permissions" binding:"required,min=1,dive"`
+}
@@ -6,6 +6,7 @@ import (
 
 	"github.com/EdgeCDN-X/edgecdnx-api/src/internal/logger"
 	"github.com/EdgeCDN-X/edgecdnx-api/src/modules/app"
+	"github.com/EdgeCDN-X/edgecdnx-api/src/modules/auth"
 	"github.com/casbin/casbin/v3"
 	"github.com/gin-gonic/gin"
 	"github.com/gosimple/slug"
@@ -15,14 +16,18 @@ import (
 type Config struct {
 	Namespace           string
 	DefaultAdminProject string
-	DefaultAdminUser    string
+	// DefaultAdminUser is bound with the subject prefix of the first issuer unless it carries the prefix of another
+	DefaultAdminUser string
+	// Issuers are the trusted OIDC issuers, used to prefix member subjects. OIDCGroupPrefix applies when empty.
+	Issuers         []auth.OIDCIssuer
+	OIDCGroupPrefix string
 }
 
 type Module struct {
 	cfg         Config
-	client      *dynamic.DynamicClient
+	client      dynamic.Interface
 	middlewares []gin.HandlerFunc
-	enforcer    *casbin.Enforcer
+	enforcer    *casbin.SyncedEnforcer
 }
 
 func New(cfg Config) *Module {
@@ -33,12 +38,12 @@ func (m *Module) Shutdown() {}
 
 func (m *Module) Init() error {
 	logger.L().Info("Initializing module")
-	client, _, err := app.GetK8SDynamicClient()
+	k8sCache, err := app.GetK8SCache(m.cfg.Namespace)
 	if err != nil {
 		return err
 	}
 
-	m.client = client
+	m.client = k8sCache.Client(gvr, serviceGVR, zoneGVR, prefixListGVR)
 
 	return nil
 }
@@ -47,7 +52,7 @@ func (m *Module) SetMiddlewares(middlewares ...gin.HandlerFunc) {
 	m.middlewares = middlewares
 }
 
-func (m *Module) SetEnforcer(enforcer *casbin.Enforcer) {
+func (m *Module) SetEnforcer(enforcer *casbin.SyncedEnforcer) {
 	m.enforcer = enforcer
 }
 
@@ -61,7 +66,7 @@ func (m *Module) EnsureAdmin() error {
 	ctx := context.Background()
 
 	created_by := slug.Make(strings.ReplaceAll(m.cfg.DefaultAdminUser, "@", "-at-"))
-	_, code, err := m.createProject(ctx, m.cfg.DefaultAdminUser, created_by, createProjectDto)
+	_, code, err := m.createProject(ctx, m.adminSubject(), created_by, createProjectDto)
 	if err != nil {
 		if code == 409 {
 			logger.L().Info("Admin project already exists, skipping creation")
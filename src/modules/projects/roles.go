@@ -0,0 +1,107 @@
+package projects
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+
+	"github.com/EdgeCDN-X/edgecdnx-api/src/modules/auth"
+	infrastructurev1alpha1 "github.com/EdgeCDN-X/edgecdnx-controller/api/v1alpha1"
+)
+
+// Role rules may only reference resources and actions AuthzBuilder checks on project routes.
+// The wildcard resource matches every resource and is what the admin template uses.
+var enforcedResources = append([]string{"*"}, auth.ProjectResources...)
+var enforcedActions = auth.Actions
+
+var roleNamePattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+// Built-in roles created with every project, in the order they are written to the spec
+var builtinRoles = []string{projectAdminRole, "operator", "viewer"}
+
+var roleTemplates = map[string][]PermissionDto{
+	projectAdminRole: {
+		{Resource: "*", Action: "create"},
+		{Resource: "*", Action: "read"},
+		{Resource: "*", Action: "update"},
+		{Resource: "*", Action: "delete"},
+		{Resource: "*", Action: "purge"},
+	},
+	"operator": {
+		{Resource: "project", Action: "read"},
+		{Resource: "member", Action: "read"},
+		{Resource: "service", Action: "read"},
+		{Resource: "service", Action: "update"},
+		{Resource: "service", Action: "purge"},
+		{Resource: "zone", Action: "read"},
+		{Resource: "zone", Action: "update"},
+		{Resource: "prefixlist", Action: "read"},
+		{Resource: "prefixlist", Action: "update"},
+	},
+	"viewer": {
+		{Resource: "project", Action: "read"},
+		{Resource: "member", Action: "read"},
+		{Resource: "service", Action: "read"},
+		{Resource: "zone", Action: "read"},
+		{Resource: "prefixlist", Action: "read"},
+	},
+}
+
+// validatePermissions checks every permission against the enforced resources and actions
+// and returns one message per offending field
+func validatePermissions(permissions []PermissionDto) map[string]string {
+	errs := map[string]string{}
+	for i, p := range permissions {
+		if !slices.Contains(enforcedResources, p.Resource) {
+			errs[fmt.Sprintf("permissions[%d].resource", i)] = fmt.Sprintf("unknown resource %q, must be one of %v", p.Resource, enforcedResources)
+		}
+		if !slices.Contains(enforcedActions, p.Action) {
+			errs[fmt.Sprintf("permissions[%d].action", i)] = fmt.Sprintf("unknown action %q, must be one of %v", p.Action, enforcedActions)
+		}
+	}
+	return errs
+}
+
+// roleRules converts permissions into Casbin p rules for the given project, dropping duplicates
+func roleRules(project string, role string, permissions []PermissionDto) []infrastructurev1alpha1.RuleSpec {
+	rules := []infrastructurev1alpha1.RuleSpec{}
+	for _, p := range permissions {
+		rule := infrastructurev1alpha1.RuleSpec{
+			PType: "p",
+			V0:    role,
+			V1:    project,
+			V2:    p.Resource,
+			V3:    p.Action,
+		}
+		if slices.Contains(rules, rule) {
+			continue
+		}
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// templateRules returns the p rules for all built-in roles of a project
+func templateRules(project string) []infrastructurev1alpha1.RuleSpec {
+	rules := []infrastructurev1alpha1.RuleSpec{}
+	for _, role := range builtinRoles {
+		rules = append(rules, roleRules(project, role, roleTemplates[role])...)
+	}
+	return rules
+}
+
+// projectRoles groups the p rules of a project by role, keeping the order roles first appear in
+func projectRoles(project *infrastructurev1alpha1.Project) []RoleDto {
+	roles := []RoleDto{}
+	index := map[string]int{}
+	for _, r := range project.Spec.Rbac.Rules {
+		i, ok := index[r.V0]
+		if !ok {
+			i = len(roles)
+			index[r.V0] = i
+			roles = append(roles, RoleDto{Name: r.V0, Permissions: []PermissionDto{}})
+		}
+		roles[i].Permissions = append(roles[i].Permissions, PermissionDto{Resource: r.V2, Action: r.V3})
+	}
+	return roles
+}
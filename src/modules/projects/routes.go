@@ -3,9 +3,11 @@ package projects
 import (
 	"context"
 	"fmt"
+	"slices"
 	"strings"
 
 	"github.com/EdgeCDN-X/edgecdnx-api/src/internal/logger"
+	"github.com/EdgeCDN-X/edgecdnx-api/src/modules/audit"
 	"github.com/EdgeCDN-X/edgecdnx-api/src/modules/auth"
 	infrastructurev1alpha1 "github.com/EdgeCDN-X/edgecdnx-controller/api/v1alpha1"
 	"github.com/gin-gonic/gin"
@@ -18,12 +20,32 @@ import (
 	"k8s.io/apimachinery/pkg/runtime/schema"
 )
 
+const projectAdminRole = "admin"
+
 var gvr = schema.GroupVersionResource{
 	Group:    infrastructurev1alpha1.SchemeGroupVersion.Group,
 	Version:  infrastructurev1alpha1.SchemeGroupVersion.Version,
 	Resource: "projects",
 }
 
+var serviceGVR = schema.GroupVersionResource{
+	Group:    infrastructurev1alpha1.SchemeGroupVersion.Group,
+	Version:  infrastructurev1alpha1.SchemeGroupVersion.Version,
+	Resource: "services",
+}
+
+var zoneGVR = schema.GroupVersionResource{
+	Group:    infrastructurev1alpha1.SchemeGroupVersion.Group,
+	Version:  infrastructurev1alpha1.SchemeGroupVersion.Version,
+	Resource: "zones",
+}
+
+var prefixListGVR = schema.GroupVersionResource{
+	Group:    infrastructurev1alpha1.SchemeGroupVersion.Group,
+	Version:  infrastructurev1alpha1.SchemeGroupVersion.Version,
+	Resource: "prefixlists",
+}
+
 func (m *Module) RegisterRoutes(r *gin.Engine) {
 	group := r.Group("/projects", m.middlewares...)
 
@@ -36,8 +58,14 @@ func (m *Module) RegisterRoutes(r *gin.Engine) {
 		}
 
 		projects := []infrastructurev1alpha1.Project{}
+		tokenProject := c.GetString("token_project")
 
 		for _, item := range objList.Items {
+			// API tokens only see the project they were issued in
+			if tokenProject != "" && item.GetName() != tokenProject {
+				continue
+			}
+
 			project := &infrastructurev1alpha1.Project{}
 			err = runtime.DefaultUnstructuredConverter.FromUnstructured(item.Object, project)
 			if err != nil {
@@ -110,9 +138,521 @@ func (m *Module) RegisterRoutes(r *gin.Engine) {
 			return
 		}
 
+		audit.Change(c, nil, &proj)
+
 		c.JSON(retCode, proj)
 		return
 	})
+
+	group.PATCH(":project-id", auth.NewAuthzBuilder().E(m.enforcer).T("project-id").R("project").S("user_id").A("update").Build(), func(c *gin.Context) {
+		var dto ProjectUpdateDto
+		if err := c.ShouldBindJSON(&dto); err != nil {
+			c.JSON(400, gin.H{"error": "invalid request body: " + err.Error()})
+			return
+		}
+
+		project, code, err := m.getProject(c, c.Param("project-id"))
+		if err != nil {
+			c.JSON(code, gin.H{"error": err.Error()})
+			return
+		}
+
+		before := project.DeepCopy()
+
+		if dto.Name != "" {
+			project.Spec.Name = dto.Name
+		}
+
+		if dto.Description != nil {
+			project.Spec.Description = *dto.Description
+		}
+
+		returnedProject, code, err := m.updateProject(c, project)
+		if err != nil {
+			c.JSON(code, gin.H{"error": err.Error()})
+			return
+		}
+
+		audit.Change(c, before, returnedProject)
+
+		c.JSON(200, returnedProject)
+		return
+	})
+
+	group.GET(":project-id/members", auth.NewAuthzBuilder().E(m.enforcer).T("project-id").R("member").S("user_id").A("read").Build(), func(c *gin.Context) {
+		project, code, err := m.getProject(c, c.Param("project-id"))
+		if err != nil {
+			c.JSON(code, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(200, m.projectMembers(project))
+		return
+	})
+
+	group.POST(":project-id/members", auth.NewAuthzBuilder().E(m.enforcer).T("project-id").R("member").S("user_id").A("create").Build(), func(c *gin.Context) {
+		var dto MemberDto
+		if err := c.ShouldBindJSON(&dto); err != nil {
+			c.JSON(400, gin.H{"error": "invalid request body: " + err.Error()})
+			return
+		}
+
+		project, code, err := m.getProject(c, c.Param("project-id"))
+		if err != nil {
+			c.JSON(code, gin.H{"error": err.Error()})
+			return
+		}
+
+		before := project.DeepCopy()
+
+		granted := []infrastructurev1alpha1.RuleSpec{}
+		for _, r := range project.Spec.Rbac.Rules {
+			if r.V0 == dto.Role {
+				granted = append(granted, r)
+			}
+		}
+		if len(granted) == 0 {
+			c.JSON(400, gin.H{"error": "role " + dto.Role + " is not defined in the project"})
+			return
+		}
+
+		// Member managers can not hand out more than they hold themselves
+		if code, err := auth.CheckRoleGrantable(m.enforcer, c, project.Name, dto.Role, granted); err != nil {
+			c.JSON(code, gin.H{"error": err.Error()})
+			return
+		}
+
+		subject, err := m.memberSubject(dto.Kind, dto.Issuer, dto.Subject)
+		if err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+
+		if slices.ContainsFunc(project.Spec.Rbac.Groups, func(g infrastructurev1alpha1.RuleSpec) bool {
+			return g.V0 == subject && g.V1 == dto.Role
+		}) {
+			c.JSON(409, gin.H{"error": "member already has this role in the project"})
+			return
+		}
+
+		project.Spec.Rbac.Groups = append(project.Spec.Rbac.Groups, infrastructurev1alpha1.RuleSpec{
+			PType: "g",
+			V0:    subject,
+			V1:    dto.Role,
+			V2:    project.Name,
+		})
+
+		returnedProject, code, err := m.updateProject(c, project)
+		if err != nil {
+			c.JSON(code, gin.H{"error": err.Error()})
+			return
+		}
+
+		audit.Change(c, before, returnedProject)
+
+		c.JSON(201, m.projectMembers(returnedProject))
+		return
+	})
+
+	group.DELETE(":project-id/members/:subject", auth.NewAuthzBuilder().E(m.enforcer).T("project-id").R("member").S("user_id").A("delete").Build(), func(c *gin.Context) {
+		kind := c.DefaultQuery("kind", "user")
+		if kind != "user" && kind != "group" {
+			c.JSON(400, gin.H{"error": "kind must be user or group"})
+			return
+		}
+		subject, err := m.memberSubject(kind, c.Query("issuer"), c.Param("subject"))
+		if err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		role := c.Query("role")
+
+		project, code, err := m.getProject(c, c.Param("project-id"))
+		if err != nil {
+			c.JSON(code, gin.H{"error": err.Error()})
+			return
+		}
+
+		before := project.DeepCopy()
+
+		groups := project.Spec.Rbac.Groups
+		newGroups := []infrastructurev1alpha1.RuleSpec{}
+		removesAdmin := false
+		for _, g := range groups {
+			if g.V0 == subject && (role == "" || g.V1 == role) {
+				removesAdmin = removesAdmin || g.V1 == projectAdminRole
+				continue
+			}
+			newGroups = append(newGroups, g)
+		}
+
+		if len(groups) == len(newGroups) {
+			c.JSON(404, gin.H{"error": "member not found"})
+			return
+		}
+
+		// Several bindings are only removed together when asked for explicitly
+		if role == "" && len(groups)-len(newGroups) > 1 && c.Query("all") != "true" {
+			c.JSON(400, gin.H{"error": "member has several roles in the project. Pass ?role= to remove one or ?all=true to remove all of them"})
+			return
+		}
+
+		// Only removing an admin binding can leave the project without admins
+		if removesAdmin && !slices.ContainsFunc(newGroups, func(g infrastructurev1alpha1.RuleSpec) bool {
+			return g.V1 == projectAdminRole
+		}) {
+			c.JSON(409, gin.H{"error": "cannot remove the last admin of the project"})
+			return
+		}
+
+		project.Spec.Rbac.Groups = newGroups
+
+		returnedProject, code, err := m.updateProject(c, project)
+		if err != nil {
+			c.JSON(code, gin.H{"error": err.Error()})
+			return
+		}
+
+		audit.Change(c, before, returnedProject)
+
+		c.JSON(200, m.projectMembers(returnedProject))
+		return
+	})
+
+	group.GET(":project-id/roles", auth.NewAuthzBuilder().E(m.enforcer).T("project-id").R("member").S("user_id").A("read").Build(), func(c *gin.Context) {
+		project, code, err := m.getProject(c, c.Param("project-id"))
+		if err != nil {
+			c.JSON(code, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(200, projectRoles(project))
+		return
+	})
+
+	group.GET(":project-id/roles/:role", auth.NewAuthzBuilder().E(m.enforcer).T("project-id").R("member").S("user_id").A("read").Build(), func(c *gin.Context) {
+		project, code, err := m.getProject(c, c.Param("project-id"))
+		if err != nil {
+			c.JSON(code, gin.H{"error": err.Error()})
+			return
+		}
+
+		for _, role := range projectRoles(project) {
+			if role.Name == c.Param("role") {
+				c.JSON(200, role)
+				return
+			}
+		}
+
+		c.JSON(404, gin.H{"error": "role not found"})
+		return
+	})
+
+	group.PUT(":project-id/roles/:role", auth.NewAuthzBuilder().E(m.enforcer).T("project-id").R("member").S("user_id").A("update").Build(), func(c *gin.Context) {
+		roleName := c.Param("role")
+		if !roleNamePattern.MatchString(roleName) {
+			c.JSON(400, gin.H{"error": "invalid role name, must be a lowercase DNS label"})
+			return
+		}
+
+		if roleName == projectAdminRole {
+			c.JSON(403, gin.H{"error": "the admin role cannot be modified"})
+			return
+		}
+
+		var dto RoleDto
+		if err := c.ShouldBindJSON(&dto); err != nil {
+			c.JSON(400, gin.H{"error": "invalid request body: " + err.Error()})
+			return
+		}
+
+		if errs := validatePermissions(dto.Permissions); len(errs) > 0 {
+			c.JSON(400, gin.H{"error": "invalid permissions", "fields": errs})
+			return
+		}
+
+		project, code, err := m.getProject(c, c.Param("project-id"))
+		if err != nil {
+			c.JSON(code, gin.H{"error": err.Error()})
+			return
+		}
+
+		// A custom role can only be made of permissions the caller holds, it could be granted afterwards
+		granted := roleRules(project.Name, roleName, dto.Permissions)
+		if code, err := auth.CheckRoleGrantable(m.enforcer, c, project.Name, roleName, granted); err != nil {
+			c.JSON(code, gin.H{"error": err.Error()})
+			return
+		}
+
+		before := project.DeepCopy()
+
+		rules := []infrastructurev1alpha1.RuleSpec{}
+		for _, r := range project.Spec.Rbac.Rules {
+			if r.V0 != roleName {
+				rules = append(rules, r)
+			}
+		}
+		project.Spec.Rbac.Rules = append(rules, granted...)
+
+		returnedProject, code, err := m.updateProject(c, project)
+		if err != nil {
+			c.JSON(code, gin.H{"error": err.Error()})
+			return
+		}
+
+		audit.Change(c, before, returnedProject)
+
+		for _, role := range projectRoles(returnedProject) {
+			if role.Name == roleName {
+				c.JSON(200, role)
+				return
+			}
+		}
+
+		c.JSON(500, gin.H{"error": "internal error"})
+		return
+	})
+
+	group.DELETE(":project-id", auth.NewAuthzBuilder().E(m.enforcer).T("project-id").R("project").S("user_id").A("delete").Build(), func(c *gin.Context) {
+		projectId := c.Param("project-id")
+
+		if projectId == m.cfg.DefaultAdminProject {
+			c.JSON(403, gin.H{"error": "the default admin project cannot be deleted"})
+			return
+		}
+
+		obj, err := m.client.Resource(gvr).Namespace(m.cfg.Namespace).Get(c, projectId, metav1.GetOptions{})
+		if err != nil {
+			if apierrors.IsNotFound(err) {
+				c.JSON(404, gin.H{"error": "project not found"})
+				return
+			}
+			c.JSON(500, gin.H{"error": "failed to retrieve project: " + err.Error()})
+			return
+		}
+
+		services, err := m.listProjectResources(c, serviceGVR, projectId)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "failed to list services: " + err.Error()})
+			return
+		}
+
+		zones, err := m.listProjectResources(c, zoneGVR, projectId)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "failed to list zones: " + err.Error()})
+			return
+		}
+
+		prefixLists, err := m.listProjectResources(c, prefixListGVR, projectId)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "failed to list prefix lists: " + err.Error()})
+			return
+		}
+
+		if len(services) > 0 || len(zones) > 0 || len(prefixLists) > 0 {
+			if c.Query("cascade") != "true" {
+				c.JSON(409, gin.H{
+					"error":       "project still owns services, zones or prefix lists. Remove them first or retry with ?cascade=true",
+					"services":    services,
+					"zones":       zones,
+					"prefixLists": prefixLists,
+				})
+				return
+			}
+
+			// Services are removed before the zones and prefix lists they may use, the project itself goes last
+			// so a failure part way leaves it visible for a retry
+			for _, name := range services {
+				err := m.client.Resource(serviceGVR).Namespace(m.cfg.Namespace).Delete(c, name, metav1.DeleteOptions{})
+				if err != nil && !apierrors.IsNotFound(err) {
+					c.JSON(500, gin.H{"error": "failed to delete service " + name + ": " + err.Error()})
+					return
+				}
+			}
+
+			for _, name := range zones {
+				err := m.client.Resource(zoneGVR).Namespace(m.cfg.Namespace).Delete(c, name, metav1.DeleteOptions{})
+				if err != nil && !apierrors.IsNotFound(err) {
+					c.JSON(500, gin.H{"error": "failed to delete zone " + name + ": " + err.Error()})
+					return
+				}
+			}
+
+			for _, name := range prefixLists {
+				err := m.client.Resource(prefixListGVR).Namespace(m.cfg.Namespace).Delete(c, name, metav1.DeleteOptions{})
+				if err != nil && !apierrors.IsNotFound(err) {
+					c.JSON(500, gin.H{"error": "failed to delete prefix list " + name + ": " + err.Error()})
+					return
+				}
+			}
+		}
+
+		err = m.client.Resource(gvr).Namespace(m.cfg.Namespace).Delete(c, projectId, metav1.DeleteOptions{})
+		if err != nil {
+			if apierrors.IsNotFound(err) {
+				c.JSON(404, gin.H{"error": "project not found"})
+				return
+			}
+			c.JSON(500, gin.H{"error": "failed to delete project: " + err.Error()})
+			return
+		}
+
+		audit.Change(c, obj, nil)
+
+		c.Status(204)
+		return
+	})
+}
+
+// getProject fetches a project and maps API errors to HTTP status codes
+func (m *Module) getProject(ctx context.Context, name string) (*infrastructurev1alpha1.Project, int, error) {
+	obj, err := m.client.Resource(gvr).Namespace(m.cfg.Namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, 404, fmt.Errorf("project not found")
+		}
+		return nil, 500, fmt.Errorf("failed to retrieve project: %w", err)
+	}
+
+	project := &infrastructurev1alpha1.Project{}
+	err = runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, project)
+	if err != nil {
+		return nil, 500, fmt.Errorf("internal error")
+	}
+
+	return project, 200, nil
+}
+
+// updateProject writes the project back and returns the stored version
+func (m *Module) updateProject(ctx context.Context, project *infrastructurev1alpha1.Project) (*infrastructurev1alpha1.Project, int, error) {
+	objMap, err := runtime.DefaultUnstructuredConverter.ToUnstructured(project)
+	if err != nil {
+		return nil, 500, fmt.Errorf("internal error")
+	}
+
+	updatedObj, err := m.client.Resource(gvr).Namespace(m.cfg.Namespace).Update(ctx, &unstructured.Unstructured{Object: objMap}, metav1.UpdateOptions{})
+	if err != nil {
+		if apierrors.IsConflict(err) {
+			return nil, 409, fmt.Errorf("project was modified concurrently, please retry")
+		}
+		return nil, 500, fmt.Errorf("failed to update project: %w", err)
+	}
+
+	returnedProject := &infrastructurev1alpha1.Project{}
+	err = runtime.DefaultUnstructuredConverter.FromUnstructured(updatedObj.Object, returnedProject)
+	if err != nil {
+		return nil, 500, fmt.Errorf("internal error")
+	}
+
+	return returnedProject, 200, nil
+}
+
+// issuers returns the configured OIDC issuers. Without any a single issuer with the global group prefix is assumed,
+// the way the auth module falls back to OIDC_ISSUER_URL.
+func (m *Module) issuers() []auth.OIDCIssuer {
+	if len(m.cfg.Issuers) > 0 {
+		return m.cfg.Issuers
+	}
+	return []auth.OIDCIssuer{{GroupPrefix: m.cfg.OIDCGroupPrefix}}
+}
+
+// prefixIssuer returns the issuer with the longest prefix subject starts with, prefix picks the group or subject prefix
+func prefixIssuer(issuers []auth.OIDCIssuer, subject string, prefix func(auth.OIDCIssuer) string) (auth.OIDCIssuer, bool) {
+	found := false
+	var match auth.OIDCIssuer
+	for _, issuer := range issuers {
+		if strings.HasPrefix(subject, prefix(issuer)) && (!found || len(prefix(issuer)) > len(prefix(match))) {
+			match = issuer
+			found = true
+		}
+	}
+	return match, found
+}
+
+func groupPrefix(issuer auth.OIDCIssuer) string   { return issuer.GroupPrefix }
+func subjectPrefix(issuer auth.OIDCIssuer) string { return issuer.SubjectPrefix }
+
+// memberSubject returns the subject a member is bound as. With an issuer the name gets its group or subject prefix
+// unless it already starts with it. Without one a group gets the prefix of the only issuer, with several issuers it
+// has to carry the prefix of one of them. Users are bound as given.
+func (m *Module) memberSubject(kind string, issuerURL string, subject string) (string, error) {
+	issuers := m.issuers()
+
+	prefix := subjectPrefix
+	if kind == "group" {
+		prefix = groupPrefix
+	}
+
+	if issuerURL == "" {
+		if kind != "group" {
+			return subject, nil
+		}
+		if len(issuers) > 1 {
+			if _, ok := prefixIssuer(issuers, subject, groupPrefix); !ok {
+				return "", fmt.Errorf("group %s does not carry the group prefix of a configured issuer, pass the issuer it belongs to", subject)
+			}
+			return subject, nil
+		}
+		issuerURL = issuers[0].IssuerURL
+	}
+
+	i := slices.IndexFunc(issuers, func(issuer auth.OIDCIssuer) bool { return issuer.IssuerURL == issuerURL })
+	if i < 0 {
+		return "", fmt.Errorf("issuer %s is not configured", issuerURL)
+	}
+	if strings.HasPrefix(subject, prefix(issuers[i])) {
+		return subject, nil
+	}
+	return prefix(issuers[i]) + subject, nil
+}
+
+// adminSubject returns the subject the default admin user is bound as. It belongs to the first issuer unless it
+// already carries the subject prefix of another one.
+func (m *Module) adminSubject() string {
+	issuers := m.issuers()
+	if issuer, ok := prefixIssuer(issuers, m.cfg.DefaultAdminUser, subjectPrefix); ok && issuer.SubjectPrefix != "" {
+		return m.cfg.DefaultAdminUser
+	}
+	return issuers[0].SubjectPrefix + m.cfg.DefaultAdminUser
+}
+
+// projectMembers lists the role bindings of a project. Subjects carrying the group prefix of an issuer are reported
+// as its groups, other subjects as users of the issuer whose subject prefix they carry.
+func (m *Module) projectMembers(project *infrastructurev1alpha1.Project) []MemberDto {
+	issuers := m.issuers()
+	members := []MemberDto{}
+	for _, g := range project.Spec.Rbac.Groups {
+		member := MemberDto{
+			Subject: g.V0,
+			Kind:    "user",
+			Role:    g.V1,
+		}
+		if issuer, ok := prefixIssuer(issuers, g.V0, groupPrefix); ok && issuer.GroupPrefix != "" {
+			member.Kind = "group"
+			member.Issuer = issuer.IssuerURL
+		} else if issuer, ok := prefixIssuer(issuers, g.V0, subjectPrefix); ok && issuer.SubjectPrefix != "" {
+			member.Issuer = issuer.IssuerURL
+		}
+		members = append(members, member)
+	}
+	return members
+}
+
+// listProjectResources returns the names of the resources labelled with the given project
+func (m *Module) listProjectResources(ctx context.Context, resource schema.GroupVersionResource, project string) ([]string, error) {
+	objList, err := m.client.Resource(resource).Namespace(m.cfg.Namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: "project=" + project,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(objList.Items))
+	for _, item := range objList.Items {
+		names = append(names, item.GetName())
+	}
+
+	return names, nil
 }
 
 func (m *Module) createProject(ctx context.Context, user_id string, created_by string, dto ProjectDto) (infrastructurev1alpha1.Project, int, error) {
@@ -150,40 +690,11 @@ func (m *Module) createProject(ctx context.Context, user_id string, created_by s
 					{
 						PType: "g",
 						V0:    user_id,
-						V1:    "admin",
+						V1:    projectAdminRole,
 						V2:    name,
 					},
 				},
-				Rules: []infrastructurev1alpha1.RuleSpec{
-					{
-						PType: "p",
-						V0:    "admin",
-						V1:    name,
-						V2:    "*",
-						V3:    "create",
-					},
-					{
-						PType: "p",
-						V0:    "admin",
-						V1:    name,
-						V2:    "*",
-						V3:    "read",
-					},
-					{
-						PType: "p",
-						V0:    "admin",
-						V1:    name,
-						V2:    "*",
-						V3:    "update",
-					},
-					{
-						PType: "p",
-						V0:    "admin",
-						V1:    name,
-						V2:    "*",
-						V3:    "delete",
-					},
-				},
+				Rules: templateRules(name),
 			},
 		},
 	}
@@ -0,0 +1,472 @@
+package projects
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/EdgeCDN-X/edgecdnx-api/src/internal/logger"
+	"github.com/EdgeCDN-X/edgecdnx-api/src/modules/auth"
+	infrastructurev1alpha1 "github.com/EdgeCDN-X/edgecdnx-controller/api/v1alpha1"
+	"github.com/casbin/casbin/v3"
+	"github.com/casbin/casbin/v3/model"
+	"github.com/gin-gonic/gin"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+const testNamespace = "edgecdnx"
+
+func newTestEnforcer(t *testing.T) *casbin.SyncedEnforcer {
+	t.Helper()
+
+	casbinModel, err := model.NewModelFromString(auth.RBACWithDomainModel)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	enforcer, err := casbin.NewSyncedEnforcer(casbinModel)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	return enforcer
+}
+
+func newTestModule(t *testing.T, objects ...runtime.Object) (*Module, *dynamicfake.FakeDynamicClient) {
+	t.Helper()
+	logger.Init(false)
+
+	enforcer := newTestEnforcer(t)
+	for _, act := range []string{"create", "read", "update", "delete"} {
+		if _, err := enforcer.AddPolicy("admin", "demo", "*", act); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+	if _, err := enforcer.AddGroupingPolicy("user@example.com", "admin", "demo"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	scheme := runtime.NewScheme()
+	if err := infrastructurev1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	dynClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(
+		scheme,
+		map[schema.GroupVersionResource]string{
+			gvr:           "ProjectList",
+			serviceGVR:    "ServiceList",
+			zoneGVR:       "ZoneList",
+			prefixListGVR: "PrefixListList",
+		},
+		objects...,
+	)
+
+	return &Module{
+		cfg:      Config{Namespace: testNamespace, DefaultAdminProject: "admin"},
+		client:   dynClient,
+		enforcer: enforcer,
+		middlewares: []gin.HandlerFunc{func(c *gin.Context) {
+			c.Set("user_id", "user@example.com")
+			c.Set("groups", "")
+			c.Next()
+		}},
+	}, dynClient
+}
+
+func testProject(name string) *infrastructurev1alpha1.Project {
+	return &infrastructurev1alpha1.Project{
+		TypeMeta:   metav1.TypeMeta{APIVersion: infrastructurev1alpha1.SchemeGroupVersion.String(), Kind: "Project"},
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: testNamespace},
+		Spec:       infrastructurev1alpha1.ProjectSpec{Name: name, Description: "initial"},
+	}
+}
+
+func testProjectWithAdmin(name string, admin string) *infrastructurev1alpha1.Project {
+	project := testProject(name)
+	project.Spec.Rbac = infrastructurev1alpha1.RBACSpec{
+		Groups: []infrastructurev1alpha1.RuleSpec{{PType: "g", V0: admin, V1: "admin", V2: name}},
+		Rules:  []infrastructurev1alpha1.RuleSpec{{PType: "p", V0: "admin", V1: name, V2: "*", V3: "read"}},
+	}
+	return project
+}
+
+func testService(name string, project string) *infrastructurev1alpha1.Service {
+	return &infrastructurev1alpha1.Service{
+		TypeMeta:   metav1.TypeMeta{APIVersion: infrastructurev1alpha1.SchemeGroupVersion.String(), Kind: "Service"},
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: testNamespace, Labels: map[string]string{"project": project}},
+	}
+}
+
+func serve(router *gin.Engine, method string, path string, body string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(method, path, strings.NewReader(body))
+	request.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestPatchProjectUpdatesDescription(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	module, _ := newTestModule(t, testProject("demo"))
+	router := gin.New()
+	module.RegisterRoutes(router)
+
+	recorder := serve(router, http.MethodPatch, "/projects/demo", `{"description":"updated"}`)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("unexpected status code %d: %s", recorder.Code, recorder.Body.String())
+	}
+
+	var project infrastructurev1alpha1.Project
+	if err := json.Unmarshal(recorder.Body.Bytes(), &project); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if project.Spec.Description != "updated" {
+		t.Fatalf("unexpected description %q", project.Spec.Description)
+	}
+	if project.Spec.Name != "demo" {
+		t.Fatalf("expected name to be preserved, got %q", project.Spec.Name)
+	}
+}
+
+func TestDeleteProjectRefusesWhileServicesExist(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	module, dynClient := newTestModule(t, testProject("demo"), testService("web-abc", "demo"))
+	router := gin.New()
+	module.RegisterRoutes(router)
+
+	recorder := serve(router, http.MethodDelete, "/projects/demo", "")
+	if recorder.Code != http.StatusConflict {
+		t.Fatalf("unexpected status code %d", recorder.Code)
+	}
+
+	if _, err := dynClient.Resource(gvr).Namespace(testNamespace).Get(context.Background(), "demo", metav1.GetOptions{}); err != nil {
+		t.Fatalf("expected project to still exist, got %v", err)
+	}
+}
+
+func TestDeleteProjectCascade(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	prefixList := &infrastructurev1alpha1.PrefixList{
+		TypeMeta:   metav1.TypeMeta{APIVersion: infrastructurev1alpha1.SchemeGroupVersion.String(), Kind: "PrefixList"},
+		ObjectMeta: metav1.ObjectMeta{Name: "office", Namespace: testNamespace, Labels: map[string]string{"project": "demo"}},
+	}
+	module, dynClient := newTestModule(t, testProject("demo"), testService("web-abc", "demo"), testService("other-abc", "other"), prefixList)
+	router := gin.New()
+	module.RegisterRoutes(router)
+
+	recorder := serve(router, http.MethodDelete, "/projects/demo?cascade=true", "")
+	if recorder.Code != http.StatusNoContent {
+		t.Fatalf("unexpected status code %d: %s", recorder.Code, recorder.Body.String())
+	}
+
+	if _, err := dynClient.Resource(serviceGVR).Namespace(testNamespace).Get(context.Background(), "web-abc", metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+		t.Fatalf("expected service to be deleted, got %v", err)
+	}
+	if _, err := dynClient.Resource(serviceGVR).Namespace(testNamespace).Get(context.Background(), "other-abc", metav1.GetOptions{}); err != nil {
+		t.Fatalf("expected service of another project to be kept, got %v", err)
+	}
+	if _, err := dynClient.Resource(prefixListGVR).Namespace(testNamespace).Get(context.Background(), "office", metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+		t.Fatalf("expected prefix list to be deleted, got %v", err)
+	}
+	if _, err := dynClient.Resource(gvr).Namespace(testNamespace).Get(context.Background(), "demo", metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+		t.Fatalf("expected project to be deleted, got %v", err)
+	}
+}
+
+func TestAddGroupMemberAppliesPrefix(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	module, _ := newTestModule(t, testProjectWithAdmin("demo", "user@example.com"))
+	module.cfg.OIDCGroupPrefix = "oidc-"
+	router := gin.New()
+	module.RegisterRoutes(router)
+
+	recorder := serve(router, http.MethodPost, "/projects/demo/members", `{"subject":"ops","kind":"group","role":"admin"}`)
+	if recorder.Code != http.StatusCreated {
+		t.Fatalf("unexpected status code %d: %s", recorder.Code, recorder.Body.String())
+	}
+
+	var members []MemberDto
+	if err := json.Unmarshal(recorder.Body.Bytes(), &members); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(members) != 2 {
+		t.Fatalf("expected two members, got %d", len(members))
+	}
+	if members[1].Subject != "oidc-ops" || members[1].Kind != "group" {
+		t.Fatalf("unexpected member %#v", members[1])
+	}
+
+	recorder = serve(router, http.MethodPost, "/projects/demo/members", `{"subject":"someone@example.com","kind":"user","role":"viewer"}`)
+	if recorder.Code != http.StatusBadRequest {
+		t.Fatalf("expected unknown role to be rejected, got %d", recorder.Code)
+	}
+}
+
+func TestMembersResolvePrefixesPerIssuer(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	module, _ := newTestModule(t, testProjectWithAdmin("demo", "user@example.com"))
+	module.cfg.Issuers = []auth.OIDCIssuer{
+		{IssuerURL: "https://employees.example.com", GroupPrefix: "oidc-"},
+		{IssuerURL: "https://customers.example.com", GroupPrefix: "customer-", SubjectPrefix: "customer:"},
+	}
+	router := gin.New()
+	module.RegisterRoutes(router)
+
+	recorder := serve(router, http.MethodPost, "/projects/demo/members", `{"subject":"ops","kind":"group","role":"admin"}`)
+	if recorder.Code != http.StatusBadRequest {
+		t.Fatalf("expected a group without issuer to be rejected, got %d", recorder.Code)
+	}
+
+	recorder = serve(router, http.MethodPost, "/projects/demo/members", `{"subject":"ops","kind":"group","issuer":"https://unknown.example.com","role":"admin"}`)
+	if recorder.Code != http.StatusBadRequest {
+		t.Fatalf("expected an unknown issuer to be rejected, got %d", recorder.Code)
+	}
+
+	recorder = serve(router, http.MethodPost, "/projects/demo/members", `{"subject":"ops","kind":"group","issuer":"https://customers.example.com","role":"admin"}`)
+	if recorder.Code != http.StatusCreated {
+		t.Fatalf("unexpected status code %d: %s", recorder.Code, recorder.Body.String())
+	}
+
+	recorder = serve(router, http.MethodPost, "/projects/demo/members", `{"subject":"bob@example.com","kind":"user","issuer":"https://customers.example.com","role":"admin"}`)
+	if recorder.Code != http.StatusCreated {
+		t.Fatalf("unexpected status code %d: %s", recorder.Code, recorder.Body.String())
+	}
+
+	var members []MemberDto
+	if err := json.Unmarshal(recorder.Body.Bytes(), &members); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	expected := []MemberDto{
+		{Subject: "user@example.com", Kind: "user", Role: "admin"},
+		{Subject: "customer-ops", Kind: "group", Issuer: "https://customers.example.com", Role: "admin"},
+		{Subject: "customer:bob@example.com", Kind: "user", Issuer: "https://customers.example.com", Role: "admin"},
+	}
+	if len(members) != len(expected) {
+		t.Fatalf("unexpected members %#v", members)
+	}
+	for i := range expected {
+		if members[i] != expected[i] {
+			t.Fatalf("unexpected member %#v, expected %#v", members[i], expected[i])
+		}
+	}
+
+	recorder = serve(router, http.MethodDelete, "/projects/demo/members/ops?kind=group&issuer=https://customers.example.com", "")
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("unexpected status code %d: %s", recorder.Code, recorder.Body.String())
+	}
+}
+
+func TestAdminSubjectUsesFirstIssuer(t *testing.T) {
+	module := &Module{cfg: Config{DefaultAdminUser: "admin@example.com", Issuers: []auth.OIDCIssuer{
+		{IssuerURL: "https://employees.example.com", SubjectPrefix: "employee:"},
+		{IssuerURL: "https://customers.example.com", SubjectPrefix: "customer:"},
+	}}}
+	if subject := module.adminSubject(); subject != "employee:admin@example.com" {
+		t.Fatalf("unexpected admin subject %q", subject)
+	}
+
+	module.cfg.DefaultAdminUser = "customer:admin@example.com"
+	if subject := module.adminSubject(); subject != "customer:admin@example.com" {
+		t.Fatalf("unexpected admin subject %q", subject)
+	}
+}
+
+func TestRemoveMemberNormalizesSubject(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	project := testProjectWithAdmin("demo", "user@example.com")
+	project.Spec.Rbac.Rules = append(project.Spec.Rbac.Rules, infrastructurev1alpha1.RuleSpec{PType: "p", V0: "viewer", V1: "demo", V2: "project", V3: "read"})
+	project.Spec.Rbac.Groups = append(project.Spec.Rbac.Groups,
+		infrastructurev1alpha1.RuleSpec{PType: "g", V0: "oidc-ops", V1: "admin", V2: "demo"},
+		infrastructurev1alpha1.RuleSpec{PType: "g", V0: "oidc-ops", V1: "viewer", V2: "demo"},
+	)
+	module, _ := newTestModule(t, project)
+	module.cfg.OIDCGroupPrefix = "oidc-"
+	router := gin.New()
+	module.RegisterRoutes(router)
+
+	recorder := serve(router, http.MethodDelete, "/projects/demo/members/ops", "")
+	if recorder.Code != http.StatusNotFound {
+		t.Fatalf("expected the group not to match a user, got %d", recorder.Code)
+	}
+
+	recorder = serve(router, http.MethodDelete, "/projects/demo/members/ops?kind=group", "")
+	if recorder.Code != http.StatusBadRequest {
+		t.Fatalf("expected several roles to require a role, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+
+	recorder = serve(router, http.MethodDelete, "/projects/demo/members/ops?kind=group&role=viewer", "")
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("unexpected status code %d: %s", recorder.Code, recorder.Body.String())
+	}
+
+	var members []MemberDto
+	if err := json.Unmarshal(recorder.Body.Bytes(), &members); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(members) != 2 || members[1].Subject != "oidc-ops" || members[1].Role != "admin" {
+		t.Fatalf("unexpected members %#v", members)
+	}
+}
+
+func TestAddMemberRequiresGrantableRole(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	project := testProjectWithAdmin("demo", "owner@example.com")
+	project.Spec.Rbac.Rules = append(project.Spec.Rbac.Rules, infrastructurev1alpha1.RuleSpec{PType: "p", V0: "viewer", V1: "demo", V2: "project", V3: "read"})
+	module, _ := newTestModule(t, project)
+	router := gin.New()
+	module.RegisterRoutes(router)
+
+	// The caller may manage members and read the project, nothing else
+	module.enforcer.ClearPolicy()
+	for _, policy := range [][]string{{"manager", "demo", "member", "create"}, {"manager", "demo", "project", "read"}} {
+		if _, err := module.enforcer.AddPolicy(policy); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+	if _, err := module.enforcer.AddGroupingPolicy("user@example.com", "manager", "demo"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	recorder := serve(router, http.MethodPost, "/projects/demo/members", `{"subject":"user@example.com","kind":"user","role":"admin"}`)
+	if recorder.Code != http.StatusForbidden {
+		t.Fatalf("expected escalation to admin to be rejected, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+
+	recorder = serve(router, http.MethodPost, "/projects/demo/members", `{"subject":"someone@example.com","kind":"user","role":"viewer"}`)
+	if recorder.Code != http.StatusCreated {
+		t.Fatalf("unexpected status code %d: %s", recorder.Code, recorder.Body.String())
+	}
+}
+
+func TestRemoveLastAdminIsRejected(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	project := testProjectWithAdmin("demo", "user@example.com")
+	project.Spec.Rbac.Rules = append(project.Spec.Rbac.Rules, infrastructurev1alpha1.RuleSpec{PType: "p", V0: "viewer", V1: "demo", V2: "project", V3: "read"})
+	project.Spec.Rbac.Groups = append(project.Spec.Rbac.Groups, infrastructurev1alpha1.RuleSpec{PType: "g", V0: "user@example.com", V1: "viewer", V2: "demo"})
+	module, _ := newTestModule(t, project)
+	router := gin.New()
+	module.RegisterRoutes(router)
+
+	recorder := serve(router, http.MethodDelete, "/projects/demo/members/user@example.com?role=admin", "")
+	if recorder.Code != http.StatusConflict {
+		t.Fatalf("unexpected status code %d", recorder.Code)
+	}
+
+	// Other roles of the last admin can still be removed
+	recorder = serve(router, http.MethodDelete, "/projects/demo/members/user@example.com?role=viewer", "")
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("unexpected status code %d: %s", recorder.Code, recorder.Body.String())
+	}
+}
+
+func TestRemoveMemberOfProjectWithoutAdmin(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// Projects may be administered through group mappings only, without an admin binding
+	project := testProject("demo")
+	project.Spec.Rbac = infrastructurev1alpha1.RBACSpec{
+		Groups: []infrastructurev1alpha1.RuleSpec{{PType: "g", V0: "someone@example.com", V1: "viewer", V2: "demo"}},
+		Rules:  []infrastructurev1alpha1.RuleSpec{{PType: "p", V0: "viewer", V1: "demo", V2: "project", V3: "read"}},
+	}
+	module, _ := newTestModule(t, project)
+	router := gin.New()
+	module.RegisterRoutes(router)
+
+	recorder := serve(router, http.MethodDelete, "/projects/demo/members/someone@example.com", "")
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("unexpected status code %d: %s", recorder.Code, recorder.Body.String())
+	}
+}
+
+func TestPutRoleValidatesPermissions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	module, _ := newTestModule(t, testProjectWithAdmin("demo", "user@example.com"))
+	router := gin.New()
+	module.RegisterRoutes(router)
+
+	recorder := serve(router, http.MethodPut, "/projects/demo/roles/deployer", `{"permissions":[{"resource":"services","action":"read"},{"resource":"zone","action":"publish"}]}`)
+	if recorder.Code != http.StatusBadRequest {
+		t.Fatalf("unexpected status code %d", recorder.Code)
+	}
+
+	var body struct {
+		Fields map[string]string `json:"fields"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if _, ok := body.Fields["permissions[0].resource"]; !ok {
+		t.Fatalf("expected resource error, got %#v", body.Fields)
+	}
+	if _, ok := body.Fields["permissions[1].action"]; !ok {
+		t.Fatalf("expected action error, got %#v", body.Fields)
+	}
+
+	recorder = serve(router, http.MethodPut, "/projects/demo/roles/deployer", `{"permissions":[{"resource":"service","action":"read"},{"resource":"service","action":"update"},{"resource":"service","action":"read"}]}`)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("unexpected status code %d: %s", recorder.Code, recorder.Body.String())
+	}
+
+	var role RoleDto
+	if err := json.Unmarshal(recorder.Body.Bytes(), &role); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if role.Name != "deployer" || len(role.Permissions) != 2 {
+		t.Fatalf("unexpected role %#v", role)
+	}
+
+	recorder = serve(router, http.MethodPut, "/projects/demo/roles/admin", `{"permissions":[{"resource":"service","action":"read"}]}`)
+	if recorder.Code != http.StatusForbidden {
+		t.Fatalf("expected admin role to be protected, got %d", recorder.Code)
+	}
+
+	// The caller holds no purge permission and can not define a role with it
+	for _, body := range []string{
+		`{"permissions":[{"resource":"service","action":"purge"}]}`,
+		`{"permissions":[{"resource":"*","action":"purge"}]}`,
+	} {
+		recorder = serve(router, http.MethodPut, "/projects/demo/roles/purger", body)
+		if recorder.Code != http.StatusForbidden {
+			t.Fatalf("expected permissions the caller does not hold to be rejected, got %d: %s", recorder.Code, recorder.Body.String())
+		}
+	}
+}
+
+func TestTemplateRulesCoverBuiltinRoles(t *testing.T) {
+	rules := templateRules("demo")
+
+	roles := projectRoles(&infrastructurev1alpha1.Project{Spec: infrastructurev1alpha1.ProjectSpec{Rbac: infrastructurev1alpha1.RBACSpec{Rules: rules}}})
+	if len(roles) != len(builtinRoles) {
+		t.Fatalf("expected %d roles, got %d", len(builtinRoles), len(roles))
+	}
+	for i, role := range roles {
+		if role.Name != builtinRoles[i] {
+			t.Fatalf("unexpected role order %q at %d", role.Name, i)
+		}
+		if errs := validatePermissions(role.Permissions); len(errs) > 0 {
+			t.Fatalf("template %q has invalid permissions %#v", role.Name, errs)
+		}
+	}
+	for _, r := range rules {
+		if r.V1 != "demo" {
+			t.Fatalf("unexpected domain %q", r.V1)
+		}
+	}
+}
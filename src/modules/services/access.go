@@ -0,0 +1,194 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/EdgeCDN-X/edgecdnx-api/src/internal/cidr"
+	"github.com/EdgeCDN-X/edgecdnx-api/src/internal/logger"
+	"github.com/EdgeCDN-X/edgecdnx-api/src/modules/prefixlists"
+	infrastructurev1alpha1 "github.com/EdgeCDN-X/edgecdnx-controller/api/v1alpha1"
+	"go.uber.org/zap"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// accessAnnotation holds the IP and geo restrictions of a service as a JSON object. Inline CIDRs are stored
+// normalised, prefix lists are referenced by name so later changes to a list apply right away. No released
+// controller reads it yet, so access rules are a placeholder that answers 501 unless the controller enforces settingAccess.
+const accessAnnotation = "edgecdnx.com/access"
+
+const (
+	maxAccessPrefixLists = 16
+	maxAccessCidrs       = 1000
+)
+
+var prefixListGVR = schema.GroupVersionResource{
+	Group:    infrastructurev1alpha1.SchemeGroupVersion.Group,
+	Version:  infrastructurev1alpha1.SchemeGroupVersion.Version,
+	Resource: "prefixlists",
+}
+
+// ISO 3166-1 alpha-2 country code
+var countryCodePattern = regexp.MustCompile(`^[A-Z]{2}$`)
+
+func accessRules(service *infrastructurev1alpha1.Service) AccessDto {
+	access := AccessDto{}
+	if raw, ok := service.Annotations[accessAnnotation]; ok {
+		if err := json.Unmarshal([]byte(raw), &access); err != nil {
+			logger.L().Warn("Ignoring invalid access annotation", zap.String("service", service.Name), zap.Error(err))
+			return AccessDto{}
+		}
+	}
+	return access
+}
+
+// normalizeAccess validates the access rules of a service in the project and returns them normalised.
+// Field errors are keyed below prefix, e.g. access.denyCidrs[2], the error is set when the prefix lists
+// could not be looked up.
+func (m *Module) normalizeAccess(ctx context.Context, project string, prefix string, access AccessDto) (AccessDto, map[string]string, error) {
+	errs := map[string]string{}
+	field := func(name string) string {
+		if prefix == "" {
+			return name
+		}
+		return prefix + "." + name
+	}
+
+	normalized := AccessDto{}
+	normalized.AllowCidrs = normalizeCidrs(errs, field("allowCidrs"), access.AllowCidrs)
+	normalized.DenyCidrs = normalizeCidrs(errs, field("denyCidrs"), access.DenyCidrs)
+	for i, value := range access.DenyCidrs {
+		if denied, err := cidr.Parse(value); err == nil && slices.Contains(normalized.AllowCidrs, denied.String()) {
+			errs[fmt.Sprintf("%s[%d]", field("denyCidrs"), i)] = fmt.Sprintf("%s is also allowed", denied)
+		}
+	}
+
+	var err error
+	if normalized.AllowPrefixLists, err = m.checkPrefixLists(ctx, errs, project, field("allowPrefixLists"), access.AllowPrefixLists); err != nil {
+		return AccessDto{}, nil, err
+	}
+	if normalized.DenyPrefixLists, err = m.checkPrefixLists(ctx, errs, project, field("denyPrefixLists"), access.DenyPrefixLists); err != nil {
+		return AccessDto{}, nil, err
+	}
+	for i, name := range access.DenyPrefixLists {
+		if slices.Contains(access.AllowPrefixLists, name) {
+			errs[fmt.Sprintf("%s[%d]", field("denyPrefixLists"), i)] = fmt.Sprintf("prefix list %q is also allowed", name)
+		}
+	}
+
+	normalized.AllowCountries = normalizeCountries(errs, field("allowCountries"), access.AllowCountries)
+	normalized.DenyCountries = normalizeCountries(errs, field("denyCountries"), access.DenyCountries)
+	if len(access.AllowCountries) > 0 && len(access.DenyCountries) > 0 {
+		errs[field("denyCountries")] = "can not be combined with allowCountries, only the listed countries are allowed already"
+	}
+
+	if len(errs) > 0 {
+		return AccessDto{}, errs, nil
+	}
+	return normalized, nil, nil
+}
+
+func normalizeCidrs(errs map[string]string, field string, values []string) []string {
+	prefixes, invalid := cidr.Normalize(values)
+	for i, msg := range invalid {
+		errs[fmt.Sprintf("%s[%d]", field, i)] = msg
+	}
+	if len(prefixes) > maxAccessCidrs {
+		errs[field] = fmt.Sprintf("at most %d ranges are allowed", maxAccessCidrs)
+	}
+	if len(prefixes) == 0 {
+		return nil
+	}
+	return cidr.Strings(prefixes)
+}
+
+// checkPrefixLists makes sure every referenced list exists and belongs to the project
+func (m *Module) checkPrefixLists(ctx context.Context, errs map[string]string, project string, field string, names []string) ([]string, error) {
+	if len(names) > maxAccessPrefixLists {
+		errs[field] = fmt.Sprintf("at most %d prefix lists are allowed", maxAccessPrefixLists)
+		return nil, nil
+	}
+
+	ret := []string{}
+	for i, name := range names {
+		if slices.Contains(ret, name) {
+			continue
+		}
+
+		obj, err := m.client.Resource(prefixListGVR).Namespace(m.cfg.Namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil && !apierrors.IsNotFound(err) {
+			return nil, fmt.Errorf("failed to retrieve prefix list %s: %w", name, err)
+		}
+		if err != nil || obj.GetLabels()["project"] != project {
+			errs[fmt.Sprintf("%s[%d]", field, i)] = fmt.Sprintf("prefix list %q not found", name)
+			continue
+		}
+		ret = append(ret, name)
+	}
+
+	if len(ret) == 0 {
+		return nil, nil
+	}
+	return ret, nil
+}
+
+func normalizeCountries(errs map[string]string, field string, codes []string) []string {
+	ret := []string{}
+	for i, code := range codes {
+		code = strings.ToUpper(strings.TrimSpace(code))
+		if !countryCodePattern.MatchString(code) {
+			errs[fmt.Sprintf("%s[%d]", field, i)] = fmt.Sprintf("invalid country code %q, use ISO 3166-1 alpha-2 codes such as DE", codes[i])
+			continue
+		}
+		if !slices.Contains(ret, code) {
+			ret = append(ret, code)
+		}
+	}
+
+	if len(ret) == 0 {
+		return nil
+	}
+	slices.Sort(ret)
+	return ret
+}
+
+// setAccessRules stores already normalised access rules on the service and labels the service with every
+// prefix list it references, so a list in use can not be deleted. The service is modified in place
+// and has to be written back by the caller.
+func setAccessRules(service *infrastructurev1alpha1.Service, access AccessDto) error {
+	referencePrefix := prefixlists.ReferenceLabel("")
+	for label := range service.Labels {
+		if strings.HasPrefix(label, referencePrefix) {
+			delete(service.Labels, label)
+		}
+	}
+
+	if reflect.DeepEqual(access, AccessDto{}) {
+		delete(service.Annotations, accessAnnotation)
+		return nil
+	}
+
+	raw, err := json.Marshal(access)
+	if err != nil {
+		return fmt.Errorf("failed to encode access rules: %w", err)
+	}
+	if service.Annotations == nil {
+		service.Annotations = map[string]string{}
+	}
+	service.Annotations[accessAnnotation] = string(raw)
+
+	if service.Labels == nil {
+		service.Labels = map[string]string{}
+	}
+	for _, name := range slices.Concat(access.AllowPrefixLists, access.DenyPrefixLists) {
+		service.Labels[prefixlists.ReferenceLabel(name)] = ""
+	}
+	return nil
+}
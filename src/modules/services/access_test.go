@@ -0,0 +1,111 @@
+package services
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/EdgeCDN-X/edgecdnx-api/src/modules/prefixlists"
+	infrastructurev1alpha1 "github.com/EdgeCDN-X/edgecdnx-controller/api/v1alpha1"
+	"github.com/gin-gonic/gin"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func testPrefixList(name string, project string) *infrastructurev1alpha1.PrefixList {
+	return &infrastructurev1alpha1.PrefixList{
+		TypeMeta:   metav1.TypeMeta{APIVersion: infrastructurev1alpha1.SchemeGroupVersion.String(), Kind: "PrefixList"},
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: testNamespace, Labels: map[string]string{"project": project}},
+		Spec:       infrastructurev1alpha1.PrefixListSpec{Source: "Controller"},
+	}
+}
+
+func TestAccessRoutesRejectInvalidRules(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	m, _ := newTestModule(t, testService("web", "demo"), testPrefixList("office", "demo"), testPrefixList("partner", "other"))
+
+	router := gin.New()
+	m.RegisterRoutes(router)
+
+	recorder := serve(router, http.MethodPut, "/project/demo/services/web/access", `{
+		"allowCidrs": ["10.0.0.0/8", "10.0.0.0/33"],
+		"denyCidrs": ["10.0.0.0/8"],
+		"allowPrefixLists": ["office", "missing"],
+		"denyPrefixLists": ["partner", "office"],
+		"allowCountries": ["de", "Germany"],
+		"denyCountries": ["FR"]
+	}`)
+	if recorder.Code != http.StatusBadRequest {
+		t.Fatalf("unexpected status code %d: %s", recorder.Code, recorder.Body.String())
+	}
+
+	var body struct {
+		Fields map[string]string `json:"fields"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	for _, field := range []string{
+		"allowCidrs[1]",
+		"allowPrefixLists[1]",
+		"denyPrefixLists[0]",
+		"denyPrefixLists[1]",
+		"allowCountries[1]",
+		"denyCountries",
+	} {
+		if _, ok := body.Fields[field]; !ok {
+			t.Fatalf("expected error for %s, got %#v", field, body.Fields)
+		}
+	}
+}
+
+func TestAccessRoutesNormalizeAndLabelReferences(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	m, _ := newTestModule(t, testService("web", "demo"), testPrefixList("office", "demo"))
+
+	router := gin.New()
+	m.RegisterRoutes(router)
+
+	recorder := serve(router, http.MethodPut, "/project/demo/services/web/access", `{
+		"allowCidrs": ["10.0.1.0/24", "10.0.0.5/24", "10.0.0.128/25"],
+		"denyCidrs": ["2001:db8::1"],
+		"allowPrefixLists": ["office", "office"],
+		"allowCountries": ["de", "AT", "de"]
+	}`)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("unexpected status code %d: %s", recorder.Code, recorder.Body.String())
+	}
+
+	recorder = serve(router, http.MethodGet, "/project/demo/services/web/access", "")
+	var access AccessDto
+	if err := json.Unmarshal(recorder.Body.Bytes(), &access); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if !slices.Equal(access.AllowCidrs, []string{"10.0.0.0/23"}) || !slices.Equal(access.DenyCidrs, []string{"2001:db8::1/128"}) {
+		t.Fatalf("unexpected ranges %#v", access)
+	}
+	if !slices.Equal(access.AllowPrefixLists, []string{"office"}) || !slices.Equal(access.AllowCountries, []string{"AT", "DE"}) {
+		t.Fatalf("unexpected access rules %#v", access)
+	}
+
+	service := getTestService(t, m, "web")
+	if _, ok := service.Labels[prefixlists.ReferenceLabel("office")]; !ok {
+		t.Fatalf("expected the service to reference the prefix list, got labels %#v", service.Labels)
+	}
+	if service.Labels["project"] != "demo" {
+		t.Fatalf("expected the project label to be kept, got %#v", service.Labels)
+	}
+
+	// An empty object removes all restrictions
+	recorder = serve(router, http.MethodPatch, "/project/demo/services/web", `{"access":{}}`)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("unexpected status code %d: %s", recorder.Code, recorder.Body.String())
+	}
+	service = getTestService(t, m, "web")
+	if _, ok := service.Annotations[accessAnnotation]; ok {
+		t.Fatal("expected access rules to be removed")
+	}
+	if _, ok := service.Labels[prefixlists.ReferenceLabel("office")]; ok {
+		t.Fatal("expected the prefix list reference to be removed")
+	}
+}
@@ -0,0 +1,151 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"time"
+
+	"github.com/EdgeCDN-X/edgecdnx-api/src/internal/logger"
+	infrastructurev1alpha1 "github.com/EdgeCDN-X/edgecdnx-controller/api/v1alpha1"
+	"go.uber.org/zap"
+)
+
+// cacheRulesAnnotation holds the ordered cache rules of a service as a JSON list. The first matching rule wins,
+// requests no rule matches are cached as the origin allows. No released controller reads it yet, so the cache rule
+// routes are a placeholder that answers 501 unless the controller enforces settingCacheRules.
+const cacheRulesAnnotation = "edgecdnx.com/cache-rules"
+
+const maxCacheRules = 50
+
+// Durations longer than this are almost certainly a typo
+const maxCacheDuration = 365 * 24 * time.Hour
+
+// Cookie and header names are HTTP tokens
+var httpTokenPattern = regexp.MustCompile("^[!#$%&'*+.^_`|~0-9A-Za-z-]+$")
+
+var extensionPattern = regexp.MustCompile(`^[a-z0-9]{1,16}$`)
+
+func cacheRules(service *infrastructurev1alpha1.Service) []CacheRuleDto {
+	rules := []CacheRuleDto{}
+	if raw, ok := service.Annotations[cacheRulesAnnotation]; ok {
+		if err := json.Unmarshal([]byte(raw), &rules); err != nil {
+			logger.L().Warn("Ignoring invalid cache rules annotation", zap.String("service", service.Name), zap.Error(err))
+			return []CacheRuleDto{}
+		}
+	}
+	return rules
+}
+
+// setCacheRules stores already validated rules on the service. The service is modified in place
+// and has to be written back by the caller.
+func setCacheRules(service *infrastructurev1alpha1.Service, rules []CacheRuleDto) error {
+	if len(rules) == 0 {
+		delete(service.Annotations, cacheRulesAnnotation)
+		return nil
+	}
+
+	raw, err := json.Marshal(rules)
+	if err != nil {
+		return fmt.Errorf("failed to encode cache rules: %w", err)
+	}
+	if service.Annotations == nil {
+		service.Annotations = map[string]string{}
+	}
+	service.Annotations[cacheRulesAnnotation] = string(raw)
+	return nil
+}
+
+// validateDuration checks an optional duration such as 10m or 1h30m
+func validateDuration(value string, required bool) string {
+	if value == "" {
+		if required {
+			return "is required"
+		}
+		return ""
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return fmt.Sprintf("invalid duration %q, use e.g. 30s, 10m or 1h", value)
+	}
+	if d < 0 || d > maxCacheDuration {
+		return fmt.Sprintf("duration %q must be between 0s and %s", value, maxCacheDuration)
+	}
+	return ""
+}
+
+// validateCacheRules checks every rule and returns one message per offending field.
+// Fields are named after their JSON path below prefix, e.g. cacheRules[2].ttl.
+func validateCacheRules(prefix string, rules []CacheRuleDto) map[string]string {
+	errs := map[string]string{}
+	if len(rules) > maxCacheRules {
+		errs[prefix] = fmt.Sprintf("at most %d cache rules are allowed", maxCacheRules)
+		return errs
+	}
+
+	for i, rule := range rules {
+		field := func(name string) string { return fmt.Sprintf("%s[%d].%s", prefix, i, name) }
+
+		if rule.PathPattern != "" {
+			if rule.PathPattern[0] != '/' {
+				errs[field("pathPattern")] = "must start with /"
+			} else if _, err := path.Match(rule.PathPattern, "/"); err != nil {
+				errs[field("pathPattern")] = fmt.Sprintf("invalid glob %q", rule.PathPattern)
+			}
+		}
+
+		for j, extension := range rule.Extensions {
+			if !extensionPattern.MatchString(extension) {
+				errs[fmt.Sprintf("%s[%d]", field("extensions"), j)] = fmt.Sprintf("invalid extension %q, use lower case without the leading dot", extension)
+			}
+		}
+
+		for j, status := range rule.StatusCodes {
+			if status < 100 || status > 599 {
+				errs[fmt.Sprintf("%s[%d]", field("statusCodes"), j)] = fmt.Sprintf("invalid status code %d", status)
+			}
+		}
+
+		if msg := validateDuration(rule.TTL, true); msg != "" {
+			errs[field("ttl")] = msg
+		}
+		if msg := validateDuration(rule.StaleWhileRevalidate, false); msg != "" {
+			errs[field("staleWhileRevalidate")] = msg
+		}
+		if msg := validateDuration(rule.StaleIfError, false); msg != "" {
+			errs[field("staleIfError")] = msg
+		}
+
+		if rule.OriginCacheControl != "" && rule.OriginCacheControl != "honor" && rule.OriginCacheControl != "ignore" {
+			errs[field("originCacheControl")] = fmt.Sprintf("unknown value %q, must be honor or ignore", rule.OriginCacheControl)
+		}
+
+		for j, cookie := range rule.BypassCookies {
+			if !httpTokenPattern.MatchString(cookie) {
+				errs[fmt.Sprintf("%s[%d]", field("bypassCookies"), j)] = fmt.Sprintf("invalid cookie name %q", cookie)
+			}
+		}
+
+		if rule.CacheKey != nil {
+			for j, header := range rule.CacheKey.Headers {
+				if !httpTokenPattern.MatchString(header) {
+					errs[fmt.Sprintf("%s[%d]", field("cacheKey.headers"), j)] = fmt.Sprintf("invalid header name %q", header)
+				}
+			}
+			for j, param := range rule.CacheKey.QueryParams {
+				if param == "" {
+					errs[fmt.Sprintf("%s[%d]", field("cacheKey.queryParams"), j)] = "must not be empty"
+				}
+			}
+		}
+
+		// A rule without conditions matches everything, rules after it would never apply
+		if rule.PathPattern == "" && len(rule.Extensions) == 0 && len(rule.StatusCodes) == 0 && i < len(rules)-1 {
+			errs[fmt.Sprintf("%s[%d]", prefix, i)] = "matches every request, only the last rule may omit pathPattern, extensions and statusCodes"
+		}
+	}
+
+	return errs
+}
@@ -0,0 +1,93 @@
+package services
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestValidateCacheRules(t *testing.T) {
+	errs := validateCacheRules("cacheRules", []CacheRuleDto{
+		{PathPattern: "/static/*", Extensions: []string{"css", "js"}, TTL: "24h", StaleWhileRevalidate: "1m", OriginCacheControl: "ignore"},
+		{StatusCodes: []int{404}, TTL: "30s", BypassCookies: []string{"session_id"}, CacheKey: &CacheKeyDto{QueryParams: []string{"v"}}},
+		{TTL: "0s"},
+	})
+	if len(errs) > 0 {
+		t.Fatalf("expected no errors, got %#v", errs)
+	}
+
+	errs = validateCacheRules("cacheRules", []CacheRuleDto{
+		{PathPattern: "static/*", Extensions: []string{".css"}, TTL: "1 hour"},
+		{PathPattern: "/[", StatusCodes: []int{700}, StaleIfError: "-1s", OriginCacheControl: "always"},
+		{TTL: "1h", BypassCookies: []string{"bad cookie"}, CacheKey: &CacheKeyDto{Headers: []string{"X Bad"}}},
+		{PathPattern: "/last", TTL: "1h"},
+	})
+
+	for _, field := range []string{
+		"cacheRules[0].pathPattern",
+		"cacheRules[0].extensions[0]",
+		"cacheRules[0].ttl",
+		"cacheRules[1].pathPattern",
+		"cacheRules[1].statusCodes[0]",
+		"cacheRules[1].ttl",
+		"cacheRules[1].staleIfError",
+		"cacheRules[1].originCacheControl",
+		"cacheRules[2].bypassCookies[0]",
+		"cacheRules[2].cacheKey.headers[0]",
+		"cacheRules[2]",
+	} {
+		if _, ok := errs[field]; !ok {
+			t.Fatalf("expected error for %s, got %#v", field, errs)
+		}
+	}
+	if len(errs) != 11 {
+		t.Fatalf("unexpected errors %#v", errs)
+	}
+}
+
+func TestCacheRuleRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	m, _ := newTestModule(t, testService("web", "demo"))
+
+	router := gin.New()
+	m.RegisterRoutes(router)
+
+	recorder := serve(router, http.MethodPut, "/project/demo/services/web/cache-rules", `{"rules":[{"pathPattern":"/img/*","ttl":"forever"}]}`)
+	if recorder.Code != http.StatusBadRequest {
+		t.Fatalf("unexpected status code %d: %s", recorder.Code, recorder.Body.String())
+	}
+	var body struct {
+		Fields map[string]string `json:"fields"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if _, ok := body.Fields["rules[0].ttl"]; !ok {
+		t.Fatalf("expected ttl error, got %#v", body.Fields)
+	}
+
+	recorder = serve(router, http.MethodPut, "/project/demo/services/web/cache-rules", `{"rules":[{"pathPattern":"/img/*","ttl":"1h","staleIfError":"10m"},{"ttl":"5m"}]}`)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("unexpected status code %d: %s", recorder.Code, recorder.Body.String())
+	}
+
+	recorder = serve(router, http.MethodGet, "/project/demo/services/web/cache-rules", "")
+	var rules CacheRulesDto
+	if err := json.Unmarshal(recorder.Body.Bytes(), &rules); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(rules.Rules) != 2 || rules.Rules[0].PathPattern != "/img/*" || rules.Rules[0].StaleIfError != "10m" {
+		t.Fatalf("unexpected rules %#v", rules)
+	}
+
+	// An empty list removes all rules
+	recorder = serve(router, http.MethodPatch, "/project/demo/services/web", `{"cacheRules":[]}`)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("unexpected status code %d: %s", recorder.Code, recorder.Body.String())
+	}
+	if _, ok := getTestService(t, m, "web").Annotations[cacheRulesAnnotation]; ok {
+		t.Fatal("expected cache rules to be removed")
+	}
+}
@@ -0,0 +1,207 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/EdgeCDN-X/edgecdnx-api/src/internal/tlscert"
+	infrastructurev1alpha1 "github.com/EdgeCDN-X/edgecdnx-controller/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// certificateLabel marks Secrets holding certificates uploaded for host aliases
+const certificateLabel = "edgecdnx.com/certificate"
+
+// certificateExpiryWarning is how long before expiry a certificate is reported as expiring soon
+const certificateExpiryWarning = 30 * 24 * time.Hour
+
+// certificateSecretName derives the Secret name from the certificate so uploading the same certificate
+// twice reuses the Secret
+func certificateSecretName(service string, bundle *tlscert.Bundle) string {
+	return service + "-cert-" + tlscert.Describe(bundle.Leaf()).Fingerprint[:12]
+}
+
+// checkCertificateAliases makes sure every alias is verified on the service and covered by the certificate
+func checkCertificateAliases(service *infrastructurev1alpha1.Service, bundle *tlscert.Bundle, aliases []string) map[string]string {
+	errs := map[string]string{}
+	for i, name := range aliases {
+		field := fmt.Sprintf("aliases[%d]", i)
+		verified := false
+		for _, alias := range service.Spec.HostAliases {
+			if alias.Name == name {
+				verified = true
+			}
+		}
+		switch {
+		case !verified && hasHostAlias(service, name):
+			errs[field] = "host alias " + name + " is not verified yet"
+		case !verified:
+			errs[field] = "host alias " + name + " does not exist on the service"
+		case !bundle.Covers(name):
+			errs[field] = "certificate is not valid for " + name
+		}
+	}
+	return errs
+}
+
+// storeCertificate writes the certificate into a TLS Secret and points the aliases at it. The service is modified
+// in place and has to be written back by the caller, Secrets no longer referenced afterwards are returned.
+func (m *Module) storeCertificate(ctx context.Context, service *infrastructurev1alpha1.Service, bundle *tlscert.Bundle, aliases []string) (string, []string, error) {
+	name := certificateSecretName(service.Name, bundle)
+	data := map[string][]byte{
+		corev1.TLSCertKey:       bundle.CertificatePEM,
+		corev1.TLSPrivateKeyKey: bundle.KeyPEM,
+	}
+
+	secrets := m.k8sClient.CoreV1().Secrets(m.cfg.Namespace)
+	secret, err := secrets.Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		if !apierrors.IsNotFound(err) {
+			return "", nil, fmt.Errorf("failed to retrieve certificate: %w", err)
+		}
+
+		_, err = secrets.Create(ctx, &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: m.cfg.Namespace,
+				Labels: map[string]string{
+					"project":              service.Labels["project"],
+					"edgecdnx.com/service": service.Name,
+					certificateLabel:       "true",
+				},
+				// Removed together with the service
+				OwnerReferences: []metav1.OwnerReference{{
+					APIVersion: infrastructurev1alpha1.SchemeGroupVersion.String(),
+					Kind:       "Service",
+					Name:       service.Name,
+					UID:        service.UID,
+				}},
+			},
+			Type: corev1.SecretTypeTLS,
+			Data: data,
+		}, metav1.CreateOptions{})
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to store certificate: %w", err)
+		}
+	} else {
+		secret.Data = data
+		if _, err := secrets.Update(ctx, secret, metav1.UpdateOptions{}); err != nil {
+			return "", nil, fmt.Errorf("failed to store certificate: %w", err)
+		}
+	}
+
+	before := certificateRefs(service)
+	for i := range service.Spec.HostAliases {
+		for _, alias := range aliases {
+			if service.Spec.HostAliases[i].Name == alias {
+				service.Spec.HostAliases[i].Certificate = infrastructurev1alpha1.CertificateSpec{SecretRef: name}
+			}
+		}
+	}
+
+	return name, unreferencedCertificates(before, service), nil
+}
+
+// removeCertificate detaches a certificate from all aliases and reports whether any alias used it.
+// The service is modified in place and has to be written back by the caller.
+func removeCertificate(service *infrastructurev1alpha1.Service, name string) bool {
+	removed := false
+	for i := range service.Spec.HostAliases {
+		if service.Spec.HostAliases[i].Certificate.SecretRef == name {
+			service.Spec.HostAliases[i].Certificate = infrastructurev1alpha1.CertificateSpec{}
+			removed = true
+		}
+	}
+	return removed
+}
+
+// certificateRefs maps the certificate Secrets of a service to the aliases using them
+func certificateRefs(service *infrastructurev1alpha1.Service) map[string][]string {
+	refs := map[string][]string{}
+	for _, alias := range service.Spec.HostAliases {
+		if alias.Certificate.SecretRef != "" {
+			refs[alias.Certificate.SecretRef] = append(refs[alias.Certificate.SecretRef], alias.Name)
+		}
+	}
+	return refs
+}
+
+// unreferencedCertificates lists the Secrets referenced before but no longer by the service
+func unreferencedCertificates(before map[string][]string, service *infrastructurev1alpha1.Service) []string {
+	after := certificateRefs(service)
+	names := []string{}
+	for name := range before {
+		if _, ok := after[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// deleteCertificates removes certificate Secrets no longer used by their service. Failures are only logged
+// by the caller, the Secrets are still cleaned up together with the service.
+func (m *Module) deleteCertificates(ctx context.Context, names []string) error {
+	for _, name := range names {
+		err := m.k8sClient.CoreV1().Secrets(m.cfg.Namespace).Delete(ctx, name, metav1.DeleteOptions{})
+		if err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("failed to delete certificate %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// serviceCertificates describes the uploaded certificates of a service, sorted by name
+func (m *Module) serviceCertificates(ctx context.Context, service *infrastructurev1alpha1.Service, now time.Time) ([]CertificateDto, error) {
+	refs := certificateRefs(service)
+	names := make([]string, 0, len(refs))
+	for name := range refs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	certificates := []CertificateDto{}
+	for _, name := range names {
+		certificate := CertificateDto{Id: name, Aliases: refs[name]}
+
+		secret, err := m.k8sClient.CoreV1().Secrets(m.cfg.Namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			if !apierrors.IsNotFound(err) {
+				return nil, fmt.Errorf("failed to retrieve certificate: %w", err)
+			}
+			certificate.Warning = "certificate secret is missing, upload the certificate again"
+			certificates = append(certificates, certificate)
+			continue
+		}
+
+		leaf, err := tlscert.ParseLeaf(secret.Data[corev1.TLSCertKey])
+		if err != nil {
+			certificate.Warning = "stored certificate can not be parsed: " + err.Error()
+			certificates = append(certificates, certificate)
+			continue
+		}
+
+		certificates = append(certificates, describeCertificate(name, refs[name], tlscert.Describe(leaf), now))
+	}
+	return certificates, nil
+}
+
+func describeCertificate(name string, aliases []string, info tlscert.Info, now time.Time) CertificateDto {
+	certificate := CertificateDto{
+		Id:            name,
+		Aliases:       aliases,
+		Info:          info,
+		ExpiresInDays: int(info.NotAfter.Sub(now).Hours() / 24),
+	}
+	switch remaining := info.NotAfter.Sub(now); {
+	case remaining <= 0:
+		certificate.Warning = "certificate expired at " + info.NotAfter.Format(time.RFC3339)
+	case remaining < certificateExpiryWarning:
+		certificate.Warning = fmt.Sprintf("certificate expires in %d days at %s", certificate.ExpiresInDays, info.NotAfter.Format(time.RFC3339))
+	}
+	return certificate
+}
@@ -0,0 +1,179 @@
+package services
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	infrastructurev1alpha1 "github.com/EdgeCDN-X/edgecdnx-controller/api/v1alpha1"
+	"github.com/gin-gonic/gin"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// selfSignedCertificate returns a PEM certificate and key valid for the DNS names until notAfter
+func selfSignedCertificate(t *testing.T, notAfter time.Time, dnsNames ...string) (string, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: dnsNames[0]},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+		DNSNames:     dnsNames,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	keyDer, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("failed to encode key: %v", err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDer}))
+}
+
+func uploadBody(t *testing.T, certificate string, key string, aliases ...string) string {
+	body, err := json.Marshal(UploadCertificateDto{Certificate: certificate, PrivateKey: key, Aliases: aliases})
+	if err != nil {
+		t.Fatalf("failed to encode body: %v", err)
+	}
+	return string(body)
+}
+
+func TestUploadCertificateForHostAlias(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	service := testService("web", "demo")
+	service.Spec.HostAliases = []infrastructurev1alpha1.HostAliasSpec{{Name: "www.example.com"}, {Name: "static.example.com"}}
+	m, _ := newTestModule(t, service)
+
+	router := gin.New()
+	m.RegisterRoutes(router)
+
+	crt, key := selfSignedCertificate(t, time.Now().Add(10*24*time.Hour), "www.example.com")
+	recorder := serve(router, http.MethodPost, "/project/demo/services/web/certificates", uploadBody(t, crt, key, "WWW.example.com"))
+	if recorder.Code != http.StatusCreated {
+		t.Fatalf("unexpected status code %d: %s", recorder.Code, recorder.Body.String())
+	}
+	var certificate CertificateDto
+	if err := json.Unmarshal(recorder.Body.Bytes(), &certificate); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(certificate.Aliases) != 1 || certificate.ExpiresInDays != 9 || !strings.Contains(certificate.Warning, "expires in 9 days") {
+		t.Fatalf("unexpected certificate %#v", certificate)
+	}
+	if strings.Contains(recorder.Body.String(), "PRIVATE KEY") {
+		t.Fatal("expected the private key not to be returned")
+	}
+
+	secret, err := m.k8sClient.CoreV1().Secrets(testNamespace).Get(context.Background(), certificate.Id, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("expected the certificate secret, got %v", err)
+	}
+	if secret.Type != corev1.SecretTypeTLS || string(secret.Data[corev1.TLSPrivateKeyKey]) != key || secret.OwnerReferences[0].Name != "web" {
+		t.Fatalf("unexpected secret %#v", secret)
+	}
+
+	stored := getTestService(t, m, "web")
+	if stored.Spec.HostAliases[0].Certificate.SecretRef != certificate.Id || stored.Spec.HostAliases[1].Certificate.SecretRef != "" {
+		t.Fatalf("unexpected aliases %#v", stored.Spec.HostAliases)
+	}
+
+	recorder = serve(router, http.MethodGet, "/project/demo/services/web/status", "")
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("unexpected status code %d: %s", recorder.Code, recorder.Body.String())
+	}
+	var details ServiceDetailsDto
+	if err := json.Unmarshal(recorder.Body.Bytes(), &details); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(details.Certificates) != 1 || details.Certificates[0].NotAfter.IsZero() || len(details.Warnings) != 1 {
+		t.Fatalf("unexpected status %#v", details)
+	}
+
+	// A certificate for both aliases replaces the first one, which is no longer used afterwards
+	crt, key = selfSignedCertificate(t, time.Now().Add(90*24*time.Hour), "*.example.com")
+	recorder = serve(router, http.MethodPost, "/project/demo/services/web/certificates", uploadBody(t, crt, key, "www.example.com", "static.example.com"))
+	if recorder.Code != http.StatusCreated {
+		t.Fatalf("unexpected status code %d: %s", recorder.Code, recorder.Body.String())
+	}
+	var wildcard CertificateDto
+	if err := json.Unmarshal(recorder.Body.Bytes(), &wildcard); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(wildcard.Aliases) != 2 || wildcard.Warning != "" {
+		t.Fatalf("unexpected certificate %#v", wildcard)
+	}
+	if _, err := m.k8sClient.CoreV1().Secrets(testNamespace).Get(context.Background(), certificate.Id, metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+		t.Fatalf("expected the replaced certificate to be deleted, got %v", err)
+	}
+
+	recorder = serve(router, http.MethodDelete, "/project/demo/services/web/certificates/"+wildcard.Id, "")
+	if recorder.Code != http.StatusNoContent {
+		t.Fatalf("unexpected status code %d: %s", recorder.Code, recorder.Body.String())
+	}
+	if _, err := m.k8sClient.CoreV1().Secrets(testNamespace).Get(context.Background(), wildcard.Id, metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+		t.Fatalf("expected the certificate to be deleted, got %v", err)
+	}
+	for _, alias := range getTestService(t, m, "web").Spec.HostAliases {
+		if alias.Certificate.SecretRef != "" {
+			t.Fatalf("expected no certificate on %s", alias.Name)
+		}
+	}
+}
+
+func TestUploadCertificateRejectsInvalidCertificates(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	service := testService("web", "demo")
+	service.Spec.HostAliases = []infrastructurev1alpha1.HostAliasSpec{{Name: "www.example.com"}}
+	if err := setPendingHostAliases(service, []pendingHostAlias{{Name: "new.example.com", Method: "cname", CreatedAt: time.Now()}}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	m, _ := newTestModule(t, service)
+
+	router := gin.New()
+	m.RegisterRoutes(router)
+
+	crt, key := selfSignedCertificate(t, time.Now().Add(90*24*time.Hour), "www.example.com", "new.example.com")
+	_, otherKey := selfSignedCertificate(t, time.Now().Add(90*24*time.Hour), "www.example.com")
+
+	for _, tc := range []struct {
+		name  string
+		body  string
+		field string
+	}{
+		{"key mismatch", uploadBody(t, crt, otherKey, "www.example.com"), ""},
+		{"not covered", uploadBody(t, crt, key, "www.example.com", "static.example.com"), "aliases[1]"},
+		{"pending alias", uploadBody(t, crt, key, "new.example.com"), "aliases[0]"},
+		{"no aliases", uploadBody(t, crt, key), ""},
+	} {
+		recorder := serve(router, http.MethodPost, "/project/demo/services/web/certificates", tc.body)
+		if recorder.Code != http.StatusBadRequest {
+			t.Fatalf("%s: unexpected status code %d: %s", tc.name, recorder.Code, recorder.Body.String())
+		}
+		if tc.field != "" && !strings.Contains(recorder.Body.String(), `"`+tc.field+`"`) {
+			t.Fatalf("%s: expected an error for %s, got %s", tc.name, tc.field, recorder.Body.String())
+		}
+	}
+
+	secrets, err := m.k8sClient.CoreV1().Secrets(testNamespace).List(context.Background(), metav1.ListOptions{})
+	if err != nil || len(secrets.Items) != 0 {
+		t.Fatalf("expected no secrets to be stored, got %v, %v", secrets, err)
+	}
+}
@@ -1,10 +1,44 @@
 package services
 
+import (
+	"time"
+
+	"github.com/EdgeCDN-X/edgecdnx-api/src/internal/dnsverify"
+	"github.com/EdgeCDN-X/edgecdnx-api/src/internal/readiness"
+	"github.com/EdgeCDN-X/edgecdnx-api/src/internal/rules"
+	"github.com/EdgeCDN-X/edgecdnx-api/src/internal/tlscert"
+	infrastructurev1alpha1 "github.com/EdgeCDN-X/edgecdnx-controller/api/v1alpha1"
+)
+
+type HealthCheckDto struct {
+	Path string `json:"path" binding:"required,startswith=/"`
+	// Defaults to 10 seconds
+	IntervalSeconds int `json:"intervalSeconds,omitempty" binding:"omitempty,min=1,max=3600"`
+	// Defaults to 5 seconds, has to be shorter than the interval
+	TimeoutSeconds int `json:"timeoutSeconds,omitempty" binding:"omitempty,min=1,max=60"`
+	// Consecutive successes before an origin is healthy again, defaults to 2
+	HealthyThreshold int `json:"healthyThreshold,omitempty" binding:"omitempty,min=1,max=10"`
+	// Consecutive failures before an origin is taken out, defaults to 3
+	UnhealthyThreshold int `json:"unhealthyThreshold,omitempty" binding:"omitempty,min=1,max=10"`
+	// Defaults to any 2xx or 3xx status
+	ExpectedStatuses []int `json:"expectedStatuses,omitempty" binding:"omitempty,dive,min=100,max=599"`
+}
+
 type StaticOriginDto struct {
 	Upstream   string `json:"upstream" binding:"required"`
 	HostHeader string `json:"hostHeader" binding:"required"`
 	Port       int    `json:"port" binding:"min=1,max=65535"`
 	Scheme     string `json:"scheme" binding:"required,oneof=Http Https"`
+	// Weight balances traffic between origins of the same priority, defaults to 1
+	Weight int `json:"weight,omitempty" binding:"omitempty,min=1,max=100"`
+	// Backup origins only receive traffic once no primary origin is healthy
+	Backup      bool            `json:"backup,omitempty"`
+	HealthCheck *HealthCheckDto `json:"healthCheck,omitempty"`
+}
+
+type OriginDto struct {
+	Id string `json:"id"`
+	StaticOriginDto
 }
 
 type S3OriginSpecDto struct {
@@ -21,6 +55,23 @@ type S3OriginSpecDto struct {
 
 type HostAliasDto struct {
 	Name string `json:"name" binding:"required,hostname"`
+	// VerificationMethod is txt, the default, or cname
+	VerificationMethod dnsverify.Method `json:"verificationMethod,omitempty" binding:"omitempty,oneof=txt cname"`
+}
+
+type HostAliasStatusDto struct {
+	Name string `json:"name"`
+	// Status is pending until the DNS challenge passed, only verified aliases are served
+	Status string           `json:"status"`
+	Method dnsverify.Method `json:"method,omitempty"`
+	// RecordName and RecordValue describe the TXT record to create for txt verification
+	RecordName  string `json:"recordName,omitempty"`
+	RecordValue string `json:"recordValue,omitempty"`
+	// CnameTarget is where the alias has to point to for cname verification
+	CnameTarget   string     `json:"cnameTarget,omitempty"`
+	CreatedAt     *time.Time `json:"createdAt,omitempty"`
+	LastCheckedAt *time.Time `json:"lastCheckedAt,omitempty"`
+	LastError     string     `json:"lastError,omitempty"`
 }
 
 type CacheKeyDto struct {
@@ -28,6 +79,31 @@ type CacheKeyDto struct {
 	QueryParams []string `json:"queryParams,omitempty"`
 }
 
+// CacheRuleDto applies when all of its conditions match. Rules are evaluated in order, the first match wins.
+type CacheRuleDto struct {
+	// PathPattern is a glob on the request path, * does not match /
+	PathPattern string `json:"pathPattern,omitempty"`
+	// Extensions of the request path without the leading dot
+	Extensions []string `json:"extensions,omitempty"`
+	// StatusCodes of the origin response
+	StatusCodes []int `json:"statusCodes,omitempty"`
+
+	// TTL, StaleWhileRevalidate and StaleIfError are durations such as 30s, 10m or 1h
+	TTL                  string `json:"ttl"`
+	StaleWhileRevalidate string `json:"staleWhileRevalidate,omitempty"`
+	StaleIfError         string `json:"staleIfError,omitempty"`
+	// OriginCacheControl is honor (default) to let the origin Cache-Control header override TTL, or ignore
+	OriginCacheControl string `json:"originCacheControl,omitempty"`
+	// BypassCookies skips the cache for requests carrying any of these cookies
+	BypassCookies []string `json:"bypassCookies,omitempty"`
+	// CacheKey replaces the cache key modifiers of the service for matching requests
+	CacheKey *CacheKeyDto `json:"cacheKey,omitempty"`
+}
+
+type CacheRulesDto struct {
+	Rules []CacheRuleDto `json:"rules"`
+}
+
 type PathDto struct {
 	Paths   []string `json:"paths" binding:"required"`
 	Rewrite string   `json:"rewrite,omitempty"`
@@ -37,11 +113,19 @@ type ServiceDto struct {
 	Name         string           `json:"name" binding:"required,min=3,max=63"`
 	OriginType   string           `json:"originType" binding:"required,oneof=s3 static"`
 	StaticOrigin *StaticOriginDto `json:"staticOrigin,omitempty"`
+	// StaticOrigins replaces staticOrigin when several origins are used
+	StaticOrigins []StaticOriginDto `json:"staticOrigins,omitempty" binding:"omitempty,dive"`
+	// S3OriginSpec is the single origin of an S3 service, several S3 origins are not supported
 	S3OriginSpec *S3OriginSpecDto `json:"s3OriginSpec,omitempty"`
 	Cache        string           `json:"cache" binding:"required"`
-	HostAliases  []HostAliasDto   `json:"hostAliases,omitempty"`
-	CacheKey     *CacheKeyDto     `json:"cacheKey,omitempty"`
-	Path         PathDto          `json:"path,omitempty"`
+	CacheRules   []CacheRuleDto   `json:"cacheRules,omitempty"`
+	// Rules are the header and redirect rules of the service
+	Rules *rules.Set `json:"rules,omitempty"`
+	// Access holds the IP and geo restrictions of the service
+	Access      *AccessDto     `json:"access,omitempty"`
+	HostAliases []HostAliasDto `json:"hostAliases,omitempty"`
+	CacheKey    *CacheKeyDto   `json:"cacheKey,omitempty"`
+	Path        PathDto        `json:"path,omitempty"`
 
 	SignedUrlsEnabled bool `json:"signedUrlsEnabled"`
 	WafEnabled        bool `json:"wafEnabled"`
@@ -51,19 +135,122 @@ type CreateKeyDto struct {
 	Name string `json:"name" binding:"required,min=3,max=32,alphanum"`
 }
 
+type RotateKeyDto struct {
+	// Name of the new key
+	Name string `json:"name" binding:"required,min=3,max=32,alphanum"`
+	// GracePeriodSeconds overrides how long the previous key keeps validating signed URLs
+	GracePeriodSeconds *int `json:"gracePeriodSeconds,omitempty" binding:"omitempty,min=0,max=2592000"`
+}
+
+type SecureKeyDto struct {
+	Name      string    `json:"name"`
+	Value     string    `json:"value"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type SignUrlDto struct {
+	// Path may carry a query string, only the path itself is signed
+	Path      string    `json:"path" binding:"required,startswith=/"`
+	ExpiresAt time.Time `json:"expiresAt" binding:"required"`
+	ClientIP  string    `json:"clientIp,omitempty" binding:"omitempty,ip"`
+	// KeyName defaults to the newest key of the service
+	KeyName string `json:"keyName,omitempty"`
+	// Host defaults to the service domain, otherwise it has to be one of the host aliases
+	Host string `json:"host,omitempty" binding:"omitempty,hostname"`
+}
+
+type SignedUrlDto struct {
+	URL       string    `json:"url"`
+	KeyName   string    `json:"keyName"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+type VerifyUrlDto struct {
+	URL      string `json:"url" binding:"required,url"`
+	ClientIP string `json:"clientIp,omitempty" binding:"omitempty,ip"`
+}
+
+type VerifyUrlResultDto struct {
+	Valid     bool       `json:"valid"`
+	Reason    string     `json:"reason,omitempty"`
+	KeyName   string     `json:"keyName,omitempty"`
+	ClientIP  string     `json:"clientIp,omitempty"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+// AccessDto restricts who may reach a service. Clients matching a deny entry are always rejected. Once any
+// allow entry is set, only clients matching one are admitted.
+type AccessDto struct {
+	// AllowPrefixLists and DenyPrefixLists reference prefix lists of the project by name
+	AllowPrefixLists []string `json:"allowPrefixLists,omitempty"`
+	DenyPrefixLists  []string `json:"denyPrefixLists,omitempty"`
+	// AllowCidrs and DenyCidrs are IPv4 or IPv6 ranges or single addresses
+	AllowCidrs []string `json:"allowCidrs,omitempty"`
+	DenyCidrs  []string `json:"denyCidrs,omitempty"`
+	// AllowCountries and DenyCountries are ISO 3166-1 alpha-2 codes of the client location, only one of them may be set
+	AllowCountries []string `json:"allowCountries,omitempty"`
+	DenyCountries  []string `json:"denyCountries,omitempty"`
+}
+
+type PurgeDto struct {
+	Type string `json:"type" binding:"required,oneof=url prefix wildcard all"`
+	// Targets are paths or absolute URLs on a host of the service, a trailing * matches anything in wildcard purges.
+	// Purging everything takes no targets.
+	Targets []string `json:"targets,omitempty" binding:"omitempty,max=100"`
+}
+
 // Generic object to update several fields
 type ServiceUpdateDto struct {
-	Cache        string           `json:"cache,omitempty"`
-	CacheKey     *CacheKeyDto     `json:"cacheKey,omitempty"`
+	Cache    string       `json:"cache,omitempty"`
+	CacheKey *CacheKeyDto `json:"cacheKey,omitempty"`
+	// CacheRules replaces all cache rules, an empty list removes them
+	CacheRules []CacheRuleDto `json:"cacheRules,omitempty"`
+	// Rules replaces all header and redirect rules, an empty object removes them
+	Rules *rules.Set `json:"rules,omitempty"`
+	// Access replaces all IP and geo restrictions, an empty object removes them
+	Access       *AccessDto       `json:"access,omitempty"`
 	OriginType   string           `json:"originType,omitempty" binding:"omitempty,oneof=s3 static"`
 	StaticOrigin *StaticOriginDto `json:"staticOrigin,omitempty"`
+	// StaticOrigins replaces all origins of the service
+	StaticOrigins []StaticOriginDto `json:"staticOrigins,omitempty" binding:"omitempty,dive"`
+	// S3OriginSpec is the single origin of an S3 service, several S3 origins are not supported
 	S3OriginSpec *S3OriginSpecDto `json:"s3OriginSpec,omitempty"`
 	WafEnabled   *bool            `json:"wafEnabled,omitempty"`
 	Path         *PathDto         `json:"path,omitempty"`
 }
 
+type UploadCertificateDto struct {
+	// Certificate is the PEM chain, leaf first followed by its intermediates
+	Certificate string `json:"certificate" binding:"required,max=65536"`
+	PrivateKey  string `json:"privateKey" binding:"required,max=16384"`
+	// Aliases are verified host aliases of the service served with this certificate
+	Aliases []string `json:"aliases" binding:"required,min=1,max=100"`
+}
+
+type CertificateDto struct {
+	Id      string   `json:"id"`
+	Aliases []string `json:"aliases"`
+	tlscert.Info
+	ExpiresInDays int `json:"expiresInDays"`
+	// Warning is set when the certificate is expired, expires within 30 days or can not be read
+	Warning string `json:"warning,omitempty"`
+}
+
+// ServiceEventDto is streamed by the watch endpoint for every change of a service or its status
+type ServiceEventDto struct {
+	// Type is ADDED, MODIFIED or DELETED
+	Type      string                          `json:"type"`
+	ServiceId string                          `json:"serviceId"`
+	Service   *infrastructurev1alpha1.Service `json:"service"`
+	// Status is left out for deleted services
+	Status *readiness.Status `json:"status,omitempty"`
+}
+
 type ServiceDetailsDto struct {
-	ServiceId            string `json:"serviceId"`
-	CertificateStatus    any    `json:"certificateStatus,omitempty"`
-	ApplicationSetStatus any    `json:"applicationSetStatus,omitempty"`
+	ServiceId string `json:"serviceId"`
+	// Status is aggregated from the service, its certificate and its deployment to the locations
+	readiness.Status
+	// Certificates lists the certificates uploaded for host aliases
+	Certificates []CertificateDto `json:"certificates"`
+	Warnings     []string         `json:"warnings,omitempty"`
 }
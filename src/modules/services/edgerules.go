@@ -0,0 +1,60 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/EdgeCDN-X/edgecdnx-api/src/internal/logger"
+	"github.com/EdgeCDN-X/edgecdnx-api/src/internal/rules"
+	infrastructurev1alpha1 "github.com/EdgeCDN-X/edgecdnx-controller/api/v1alpha1"
+	"go.uber.org/zap"
+)
+
+// edgeRulesAnnotation holds the header and redirect rules of a service as a JSON object. No released controller
+// reads it yet, so the rule routes are a placeholder that answers 501 unless the controller enforces settingEdgeRules.
+const edgeRulesAnnotation = "edgecdnx.com/edge-rules"
+
+func edgeRules(service *infrastructurev1alpha1.Service) rules.Set {
+	set := rules.Set{}
+	if raw, ok := service.Annotations[edgeRulesAnnotation]; ok {
+		if err := json.Unmarshal([]byte(raw), &set); err != nil {
+			logger.L().Warn("Ignoring invalid edge rules annotation", zap.String("service", service.Name), zap.Error(err))
+			return rules.Set{}
+		}
+	}
+	return set
+}
+
+// compileEdgeRules validates a rule set, errors are keyed below prefix, e.g. rules.redirects[0].source
+func compileEdgeRules(prefix string, set rules.Set) map[string]string {
+	_, errs := rules.Compile(set)
+	if prefix == "" {
+		return errs
+	}
+
+	prefixed := map[string]string{}
+	for field, msg := range errs {
+		prefixed[prefix+"."+field] = msg
+	}
+	return prefixed
+}
+
+// setEdgeRules stores an already compiled rule set on the service. The service is modified in place
+// and has to be written back by the caller.
+func setEdgeRules(service *infrastructurev1alpha1.Service, set rules.Set) error {
+	if reflect.DeepEqual(set, rules.Set{}) {
+		delete(service.Annotations, edgeRulesAnnotation)
+		return nil
+	}
+
+	raw, err := json.Marshal(set)
+	if err != nil {
+		return fmt.Errorf("failed to encode edge rules: %w", err)
+	}
+	if service.Annotations == nil {
+		service.Annotations = map[string]string{}
+	}
+	service.Annotations[edgeRulesAnnotation] = string(raw)
+	return nil
+}
@@ -0,0 +1,66 @@
+package services
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/EdgeCDN-X/edgecdnx-api/src/internal/rules"
+	"github.com/gin-gonic/gin"
+)
+
+func TestEdgeRuleRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	m, _ := newTestModule(t, testService("web", "demo"))
+
+	router := gin.New()
+	m.RegisterRoutes(router)
+
+	recorder := serve(router, http.MethodPut, "/project/demo/services/web/rules", `{"redirects":[{"source":"/old/(.*)","destination":"/new/$2","statusCode":301}]}`)
+	if recorder.Code != http.StatusBadRequest {
+		t.Fatalf("unexpected status code %d: %s", recorder.Code, recorder.Body.String())
+	}
+	var body struct {
+		Fields map[string]string `json:"fields"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if _, ok := body.Fields["redirects[0].destination"]; !ok {
+		t.Fatalf("expected destination error, got %#v", body.Fields)
+	}
+
+	recorder = serve(router, http.MethodPut, "/project/demo/services/web/rules", `{"forceHttps":true,"responseHeaders":[{"action":"remove","name":"Server"}],"redirects":[{"source":"/old/(.*)","destination":"/new/$1","statusCode":301}]}`)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("unexpected status code %d: %s", recorder.Code, recorder.Body.String())
+	}
+
+	recorder = serve(router, http.MethodGet, "/project/demo/services/web/rules", "")
+	var set rules.Set
+	if err := json.Unmarshal(recorder.Body.Bytes(), &set); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if !set.ForceHTTPS || len(set.ResponseHeaders) != 1 || len(set.Redirects) != 1 {
+		t.Fatalf("unexpected rules %#v", set)
+	}
+
+	recorder = serve(router, http.MethodPatch, "/project/demo/services/web", `{"rules":{"requestHeaders":[{"action":"set","name":"Host","value":"evil.example.com"}]}}`)
+	if recorder.Code != http.StatusBadRequest {
+		t.Fatalf("unexpected status code %d: %s", recorder.Code, recorder.Body.String())
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if _, ok := body.Fields["rules.requestHeaders[0].name"]; !ok {
+		t.Fatalf("expected header name error, got %#v", body.Fields)
+	}
+
+	// An empty rule set removes the rules
+	recorder = serve(router, http.MethodPatch, "/project/demo/services/web", `{"rules":{}}`)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("unexpected status code %d: %s", recorder.Code, recorder.Body.String())
+	}
+	if _, ok := getTestService(t, m, "web").Annotations[edgeRulesAnnotation]; ok {
+		t.Fatal("expected rules to be removed")
+	}
+}
@@ -0,0 +1,60 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"github.com/EdgeCDN-X/edgecdnx-api/src/internal/rules"
+)
+
+// Settings stored in annotations only take effect once the controller reads them. They are rejected unless
+// listed in Config.ControllerSettings so a service never reports rules the edges do not apply.
+const (
+	settingAccess         = "access"
+	settingCacheRules     = "cache-rules"
+	settingEdgeRules      = "edge-rules"
+	settingOriginSettings = "origin-settings"
+)
+
+// checkEnforced rejects a non-empty value for a setting the deployed controller does not enforce.
+// Clearing a setting is always allowed.
+func (m *Module) checkEnforced(setting string, value any) (int, error) {
+	if slices.Contains(m.cfg.ControllerSettings, setting) {
+		return 0, nil
+	}
+	// Every setting omits empty fields, an empty setting encodes as null, {} or []
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return 500, fmt.Errorf("failed to encode %s: %w", setting, err)
+	}
+	if slices.Contains([]string{"null", "{}", "[]"}, string(raw)) {
+		return 0, nil
+	}
+	return 501, fmt.Errorf("%s settings are not implemented yet, the deployed controller does not enforce them", setting)
+}
+
+// checkServiceSettings runs checkEnforced on the annotation backed settings of a service request
+func (m *Module) checkServiceSettings(cacheRules []CacheRuleDto, edgeRules *rules.Set, access *AccessDto) (int, error) {
+	for _, setting := range []struct {
+		name  string
+		value any
+	}{{settingCacheRules, cacheRules}, {settingEdgeRules, edgeRules}, {settingAccess, access}} {
+		if code, err := m.checkEnforced(setting.name, setting.value); err != nil {
+			return code, err
+		}
+	}
+	return 0, nil
+}
+
+// checkOriginSettings runs checkEnforced on the weights, backups and health checks of static origins.
+// The default weight of 1 is not a setting, origins without any of them can always be used.
+func (m *Module) checkOriginSettings(origins []StaticOriginDto) (int, error) {
+	settings := []originSettings{}
+	for _, origin := range origins {
+		if origin.Weight > 1 || origin.Backup || origin.HealthCheck != nil {
+			settings = append(settings, originSettings{Weight: origin.Weight, Backup: origin.Backup, HealthCheck: origin.HealthCheck})
+		}
+	}
+	return m.checkEnforced(settingOriginSettings, settings)
+}
@@ -0,0 +1,42 @@
+package services
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestUnenforcedSettingsAreRejected(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	m, _ := newTestModule(t, testService("web", "demo"))
+	m.cfg.ControllerSettings = []string{settingCacheRules}
+
+	router := gin.New()
+	m.RegisterRoutes(router)
+
+	for name, tc := range map[string]struct {
+		method string
+		path   string
+		body   string
+		code   int
+	}{
+		"access":             {http.MethodPut, "/project/demo/services/web/access", `{"denyCidrs":["10.0.0.0/8"]}`, http.StatusNotImplemented},
+		"clear access":       {http.MethodPut, "/project/demo/services/web/access", `{}`, http.StatusOK},
+		"edge rules":         {http.MethodPut, "/project/demo/services/web/rules", `{"forceHttps":true}`, http.StatusNotImplemented},
+		"patch edge rules":   {http.MethodPatch, "/project/demo/services/web", `{"rules":{"forceHttps":true}}`, http.StatusNotImplemented},
+		"patch clear rules":  {http.MethodPatch, "/project/demo/services/web", `{"rules":{}}`, http.StatusOK},
+		"enforced setting":   {http.MethodPut, "/project/demo/services/web/cache-rules", `{"rules":[{"extensions":["jpg"],"ttl":"1h"}]}`, http.StatusOK},
+		"create s3":          {http.MethodPost, "/project/demo/services", `{"name":"assets","originType":"s3","cache":"1h","cacheKey":{},"path":{"paths":["/"]},"s3OriginSpec":{"awsSigsVersion":4,"s3AccessKeyId":"AKIA","s3SecretKey":"s3cr3t","s3BucketName":"bucket","s3Region":"eu-west-1","s3Server":"s3.example.com","s3ServerProto":"Https","s3ServerPort":443,"s3Style":"path"}}`, http.StatusCreated},
+		"patch s3":           {http.MethodPatch, "/project/demo/services/web", `{"originType":"s3","s3OriginSpec":{"awsSigsVersion":4,"s3AccessKeyId":"AKIA","s3SecretKey":"s3cr3t","s3BucketName":"bucket","s3Region":"eu-west-1","s3Server":"s3.example.com","s3ServerProto":"Https","s3ServerPort":443,"s3Style":"path"}}`, http.StatusOK},
+		"origin weight":      {http.MethodPost, "/project/demo/services/web/origins", `{"upstream":"b.example.com","hostHeader":"example.com","port":443,"scheme":"Https","weight":5}`, http.StatusNotImplemented},
+		"origin backup":      {http.MethodPatch, "/project/demo/services/web", `{"staticOrigins":[{"upstream":"a.example.com","hostHeader":"example.com","port":443,"scheme":"Https"},{"upstream":"b.example.com","hostHeader":"example.com","port":443,"scheme":"Https","backup":true}]}`, http.StatusNotImplemented},
+		"origin health":      {http.MethodPost, "/project/demo/services", `{"name":"other","originType":"static","cache":"1h","cacheKey":{},"path":{"paths":["/"]},"staticOrigin":{"upstream":"a.example.com","hostHeader":"example.com","port":443,"scheme":"Https","healthCheck":{"path":"/health"}}}`, http.StatusNotImplemented},
+		"create with access": {http.MethodPost, "/project/demo/services", `{"name":"other","originType":"static","cache":"1h","cacheKey":{},"path":{"paths":["/"]},"staticOrigin":{"upstream":"a.example.com","hostHeader":"example.com","port":443,"scheme":"Https"},"access":{"denyCountries":["FR"]}}`, http.StatusNotImplemented},
+	} {
+		recorder := serve(router, tc.method, tc.path, tc.body)
+		if recorder.Code != tc.code {
+			t.Fatalf("%s: unexpected status code %d: %s", name, recorder.Code, recorder.Body.String())
+		}
+	}
+}
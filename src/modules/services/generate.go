@@ -0,0 +1,66 @@
+package services
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"time"
+
+	infrastructurev1alpha1 "github.com/EdgeCDN-X/edgecdnx-controller/api/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// 16 lowercase letters, about 75 bits
+	domainHostAlphabet = "abcdefghijklmnopqrstuvwxyz"
+	domainHostLength   = 16
+	// The CRD requires signing keys of exactly 32 characters, about 190 bits
+	secureKeyAlphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+	secureKeyLength   = 32
+
+	domainAttempts = 5
+)
+
+// randomString draws every character uniformly from the alphabet using crypto/rand
+func randomString(alphabet string, length int) (string, error) {
+	max := big.NewInt(int64(len(alphabet)))
+	b := make([]byte, length)
+	for i := range b {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		b[i] = alphabet[n.Int64()]
+	}
+	return string(b), nil
+}
+
+func newSecureKey(name string) (infrastructurev1alpha1.SecureKeySpec, error) {
+	value, err := randomString(secureKeyAlphabet, secureKeyLength)
+	if err != nil {
+		return infrastructurev1alpha1.SecureKeySpec{}, fmt.Errorf("failed to generate key: %w", err)
+	}
+
+	return infrastructurev1alpha1.SecureKeySpec{
+		Name:      name,
+		Value:     value,
+		CreatedAt: metav1.Time{Time: time.Now()},
+	}, nil
+}
+
+// generateDomain returns a random host below the service base domain that none of the given domains uses
+func (m *Module) generateDomain(taken map[string]bool) (string, error) {
+	for range domainAttempts {
+		host, err := randomString(domainHostAlphabet, domainHostLength)
+		if err != nil {
+			return "", fmt.Errorf("failed to generate domain: %w", err)
+		}
+
+		domain := fmt.Sprintf("%s.%s", host, m.cfg.ServiceBaseDomain)
+		if !taken[domain] {
+			return domain, nil
+		}
+	}
+
+	return "", fmt.Errorf("failed to generate a unique domain")
+}
@@ -0,0 +1,40 @@
+package services
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNewSecureKey(t *testing.T) {
+	seen := map[string]bool{}
+	for range 100 {
+		key, err := newSecureKey("key1")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if len(key.Value) != secureKeyLength {
+			t.Fatalf("unexpected key length %d", len(key.Value))
+		}
+		if strings.Trim(key.Value, secureKeyAlphabet) != "" {
+			t.Fatalf("unexpected characters in key %q", key.Value)
+		}
+		if seen[key.Value] {
+			t.Fatalf("duplicate key %q", key.Value)
+		}
+		seen[key.Value] = true
+	}
+}
+
+func TestGenerateDomain(t *testing.T) {
+	m := &Module{cfg: Config{ServiceBaseDomain: "cdn.example.com"}}
+
+	domain, err := m.generateDomain(map[string]bool{})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	host, ok := strings.CutSuffix(domain, ".cdn.example.com")
+	if !ok || len(host) != domainHostLength || strings.Trim(host, domainHostAlphabet) != "" {
+		t.Fatalf("unexpected domain %q", domain)
+	}
+}
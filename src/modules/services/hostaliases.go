@@ -0,0 +1,330 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/EdgeCDN-X/edgecdnx-api/src/internal/dnsverify"
+	"github.com/EdgeCDN-X/edgecdnx-api/src/internal/logger"
+	infrastructurev1alpha1 "github.com/EdgeCDN-X/edgecdnx-controller/api/v1alpha1"
+	"go.uber.org/zap"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// pendingHostAliasesAnnotation holds host aliases waiting for DNS verification as a JSON list. The controller
+// serves and issues certificates for every alias in the spec, so aliases only move there once verified.
+const pendingHostAliasesAnnotation = "edgecdnx.com/pending-host-aliases"
+
+const (
+	hostAliasPending  = "pending"
+	hostAliasVerified = "verified"
+)
+
+type pendingHostAlias struct {
+	Name          string           `json:"name"`
+	Method        dnsverify.Method `json:"method"`
+	Token         string           `json:"token,omitempty"`
+	CreatedAt     time.Time        `json:"createdAt"`
+	LastCheckedAt *time.Time       `json:"lastCheckedAt,omitempty"`
+	LastError     string           `json:"lastError,omitempty"`
+}
+
+func pendingHostAliases(service *infrastructurev1alpha1.Service) []pendingHostAlias {
+	pending := []pendingHostAlias{}
+	if raw, ok := service.Annotations[pendingHostAliasesAnnotation]; ok {
+		if err := json.Unmarshal([]byte(raw), &pending); err != nil {
+			logger.L().Warn("Ignoring invalid pending host aliases annotation", zap.String("service", service.Name), zap.Error(err))
+			return []pendingHostAlias{}
+		}
+	}
+	return pending
+}
+
+func setPendingHostAliases(service *infrastructurev1alpha1.Service, pending []pendingHostAlias) error {
+	if len(pending) == 0 {
+		delete(service.Annotations, pendingHostAliasesAnnotation)
+		return nil
+	}
+
+	raw, err := json.Marshal(pending)
+	if err != nil {
+		return fmt.Errorf("failed to encode pending host aliases: %w", err)
+	}
+	if service.Annotations == nil {
+		service.Annotations = map[string]string{}
+	}
+	service.Annotations[pendingHostAliasesAnnotation] = string(raw)
+	return nil
+}
+
+// normalizeHostname lower cases a hostname and drops the trailing dot of a fully qualified name
+func normalizeHostname(name string) string {
+	return strings.ToLower(strings.TrimSuffix(name, "."))
+}
+
+// hostnameOwner returns the service already using a hostname as its domain or as a verified or pending alias
+func hostnameOwner(services []infrastructurev1alpha1.Service, hostname string) (string, bool) {
+	for i := range services {
+		service := &services[i]
+		if strings.EqualFold(service.Spec.Domain, hostname) {
+			return service.Name, true
+		}
+		for _, alias := range service.Spec.HostAliases {
+			if strings.EqualFold(alias.Name, hostname) {
+				return service.Name, true
+			}
+		}
+		for _, alias := range pendingHostAliases(service) {
+			if strings.EqualFold(alias.Name, hostname) {
+				return service.Name, true
+			}
+		}
+	}
+	return "", false
+}
+
+// listAllServices lists the services of every project, hostnames have to be unique across the platform
+func (m *Module) listAllServices(ctx context.Context) ([]infrastructurev1alpha1.Service, error) {
+	objList, err := m.client.Resource(gvr).Namespace(m.cfg.Namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list services: %w", err)
+	}
+
+	services := &infrastructurev1alpha1.ServiceList{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(objList.UnstructuredContent(), services); err != nil {
+		return nil, fmt.Errorf("internal error")
+	}
+	return services.Items, nil
+}
+
+// checkHostAlias validates a new alias against the reserved base domain and every hostname on the platform
+func (m *Module) checkHostAlias(services []infrastructurev1alpha1.Service, hostname string) (int, error) {
+	if hostname == m.cfg.ServiceBaseDomain || strings.HasSuffix(hostname, "."+m.cfg.ServiceBaseDomain) {
+		return 400, fmt.Errorf("hostnames below %s are reserved for generated service domains", m.cfg.ServiceBaseDomain)
+	}
+	if _, taken := hostnameOwner(services, hostname); taken {
+		return 409, fmt.Errorf("host alias %s is already registered with a service", hostname)
+	}
+	return 200, nil
+}
+
+// addPendingHostAlias registers an alias for verification. The service is modified in place
+// and has to be written back by the caller.
+func addPendingHostAlias(service *infrastructurev1alpha1.Service, hostname string, method dnsverify.Method, now time.Time) (pendingHostAlias, error) {
+	if method == "" {
+		method = dnsverify.MethodTXT
+	}
+
+	alias := pendingHostAlias{Name: hostname, Method: method, CreatedAt: now.UTC()}
+	if method == dnsverify.MethodTXT {
+		token, err := dnsverify.NewToken()
+		if err != nil {
+			return pendingHostAlias{}, err
+		}
+		alias.Token = token
+	}
+
+	if err := setPendingHostAliases(service, append(pendingHostAliases(service), alias)); err != nil {
+		return pendingHostAlias{}, err
+	}
+	return alias, nil
+}
+
+// hasHostAlias reports whether the service has a verified or pending alias of that name
+func hasHostAlias(service *infrastructurev1alpha1.Service, hostname string) bool {
+	for _, alias := range service.Spec.HostAliases {
+		if alias.Name == hostname {
+			return true
+		}
+	}
+	for _, alias := range pendingHostAliases(service) {
+		if alias.Name == hostname {
+			return true
+		}
+	}
+	return false
+}
+
+// removeHostAlias drops a verified or pending alias and reports whether it existed
+func removeHostAlias(service *infrastructurev1alpha1.Service, hostname string) (bool, error) {
+	removed := false
+
+	aliases := []infrastructurev1alpha1.HostAliasSpec{}
+	for _, alias := range service.Spec.HostAliases {
+		if alias.Name == hostname {
+			removed = true
+			continue
+		}
+		aliases = append(aliases, alias)
+	}
+	service.Spec.HostAliases = aliases
+
+	pending := []pendingHostAlias{}
+	for _, alias := range pendingHostAliases(service) {
+		if alias.Name == hostname {
+			removed = true
+			continue
+		}
+		pending = append(pending, alias)
+	}
+
+	return removed, setPendingHostAliases(service, pending)
+}
+
+// hostAliasStatuses lists verified aliases followed by the pending ones with their challenge
+func hostAliasStatuses(service *infrastructurev1alpha1.Service) []HostAliasStatusDto {
+	statuses := []HostAliasStatusDto{}
+	for _, alias := range service.Spec.HostAliases {
+		statuses = append(statuses, HostAliasStatusDto{Name: alias.Name, Status: hostAliasVerified})
+	}
+	for _, alias := range pendingHostAliases(service) {
+		statuses = append(statuses, pendingHostAliasStatus(service, alias))
+	}
+	return statuses
+}
+
+func pendingHostAliasStatus(service *infrastructurev1alpha1.Service, alias pendingHostAlias) HostAliasStatusDto {
+	status := HostAliasStatusDto{
+		Name:          alias.Name,
+		Status:        hostAliasPending,
+		Method:        alias.Method,
+		CreatedAt:     &alias.CreatedAt,
+		LastCheckedAt: alias.LastCheckedAt,
+		LastError:     alias.LastError,
+	}
+	switch alias.Method {
+	case dnsverify.MethodTXT:
+		status.RecordName = dnsverify.RecordName(alias.Name)
+		status.RecordValue = alias.Token
+	case dnsverify.MethodCNAME:
+		status.CnameTarget = service.Spec.Domain
+	}
+	return status
+}
+
+// verifyHostAlias checks the challenge of a pending alias and moves it to the spec once it passes. The outcome of
+// the check is recorded on the alias. The service is modified in place and has to be written back by the caller.
+// The returned error is only set when the alias does not exist or the service could not be encoded.
+func (m *Module) verifyHostAlias(ctx context.Context, service *infrastructurev1alpha1.Service, hostname string, now time.Time) (HostAliasStatusDto, error) {
+	for _, alias := range service.Spec.HostAliases {
+		if alias.Name == hostname {
+			return HostAliasStatusDto{Name: alias.Name, Status: hostAliasVerified}, nil
+		}
+	}
+
+	pending := pendingHostAliases(service)
+	i := -1
+	for j, alias := range pending {
+		if alias.Name == hostname {
+			i = j
+		}
+	}
+	if i < 0 {
+		return HostAliasStatusDto{}, fmt.Errorf("host alias not found")
+	}
+
+	alias := &pending[i]
+	checkedAt := now.UTC()
+	alias.LastCheckedAt = &checkedAt
+	alias.LastError = ""
+
+	err := dnsverify.Verify(ctx, m.resolver, dnsverify.Challenge{
+		Hostname: alias.Name,
+		Method:   alias.Method,
+		Token:    alias.Token,
+		Target:   service.Spec.Domain,
+	})
+	if err != nil {
+		if !errors.Is(err, dnsverify.ErrNotVerified) {
+			logger.L().Warn("Host alias verification failed", zap.String("service", service.Name), zap.String("alias", alias.Name), zap.Error(err))
+		}
+		alias.LastError = err.Error()
+		return pendingHostAliasStatus(service, *alias), setPendingHostAliases(service, pending)
+	}
+
+	service.Spec.HostAliases = append(service.Spec.HostAliases, infrastructurev1alpha1.HostAliasSpec{Name: alias.Name})
+	if err := setPendingHostAliases(service, append(pending[:i], pending[i+1:]...)); err != nil {
+		return HostAliasStatusDto{}, err
+	}
+	return HostAliasStatusDto{Name: hostname, Status: hostAliasVerified}, nil
+}
+
+func (m *Module) runHostAliasVerifier(ctx context.Context) {
+	ticker := time.NewTicker(m.cfg.HostAliasCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := m.verifyHostAliases(ctx, time.Now()); err != nil {
+				logger.L().Error("Failed to verify host aliases", zap.Error(err))
+			}
+		}
+	}
+}
+
+// verifyHostAliases checks every pending alias of every service and drops the ones pending for longer than
+// the configured TTL. Conflicting updates are retried on the next run.
+func (m *Module) verifyHostAliases(ctx context.Context, now time.Time) error {
+	services, err := m.listAllServices(ctx)
+	if err != nil {
+		return err
+	}
+
+	for i := range services {
+		service := &services[i]
+		pending := pendingHostAliases(service)
+		if len(pending) == 0 {
+			continue
+		}
+
+		// Only the check time changes while an alias keeps failing the same way, which is not worth a write
+		changed := false
+		verified := []string{}
+		for _, alias := range pending {
+			if m.cfg.HostAliasPendingTTL > 0 && now.Sub(alias.CreatedAt) > m.cfg.HostAliasPendingTTL {
+				if _, err := removeHostAlias(service, alias.Name); err != nil {
+					return err
+				}
+				logger.L().Info("Dropped unverified host alias", zap.String("service", service.Name), zap.String("alias", alias.Name))
+				changed = true
+				continue
+			}
+
+			status, err := m.verifyHostAlias(ctx, service, alias.Name, now)
+			if err != nil {
+				return err
+			}
+			if status.Status == hostAliasVerified {
+				verified = append(verified, alias.Name)
+				changed = true
+			} else if status.LastError != alias.LastError {
+				changed = true
+			}
+		}
+		if !changed {
+			continue
+		}
+
+		if _, err := m.updateService(ctx, service); err != nil {
+			if apierrors.IsConflict(err) {
+				continue
+			}
+			logger.L().Error("Failed to update host aliases", zap.String("service", service.Name), zap.Error(err))
+			continue
+		}
+		if len(verified) > 0 {
+			logger.L().Info("Verified host aliases", zap.String("service", service.Name), zap.Strings("aliases", verified))
+		}
+	}
+
+	return nil
+}
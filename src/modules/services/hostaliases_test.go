@@ -0,0 +1,212 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/EdgeCDN-X/edgecdnx-api/src/internal/dnsverify"
+	infrastructurev1alpha1 "github.com/EdgeCDN-X/edgecdnx-controller/api/v1alpha1"
+	"github.com/gin-gonic/gin"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+type fakeResolver struct {
+	txt   map[string][]string
+	cname map[string]string
+}
+
+func (r *fakeResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	if records, ok := r.txt[name]; ok {
+		return records, nil
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+}
+
+func (r *fakeResolver) LookupCNAME(ctx context.Context, host string) (string, error) {
+	if cname, ok := r.cname[host]; ok {
+		return cname, nil
+	}
+	return "", &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+}
+
+func TestHostAliasIsVerifiedThroughTXTRecord(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	service := testService("web", "demo")
+	service.Spec.Domain = "abc.cdn.example.com"
+	m, _ := newTestModule(t, service)
+	resolver := &fakeResolver{txt: map[string][]string{}}
+	m.resolver = resolver
+
+	router := gin.New()
+	m.RegisterRoutes(router)
+
+	recorder := serve(router, http.MethodPost, "/project/demo/services/web/host-alias", `{"name":"WWW.Example.com"}`)
+	if recorder.Code != http.StatusCreated {
+		t.Fatalf("unexpected status code %d: %s", recorder.Code, recorder.Body.String())
+	}
+	var alias HostAliasStatusDto
+	if err := json.Unmarshal(recorder.Body.Bytes(), &alias); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if alias.Name != "www.example.com" || alias.Status != hostAliasPending || alias.RecordName != "_edgecdnx-challenge.www.example.com" || alias.RecordValue == "" {
+		t.Fatalf("unexpected alias %#v", alias)
+	}
+	if len(getTestService(t, m, "web").Spec.HostAliases) != 0 {
+		t.Fatal("expected a pending alias to stay out of the spec")
+	}
+
+	// Without the record the alias stays pending and reports why
+	recorder = serve(router, http.MethodPost, "/project/demo/services/web/host-alias/www.example.com/verify", "")
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("unexpected status code %d: %s", recorder.Code, recorder.Body.String())
+	}
+	var status HostAliasStatusDto
+	if err := json.Unmarshal(recorder.Body.Bytes(), &status); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if status.Status != hostAliasPending || status.LastError == "" || status.LastCheckedAt == nil {
+		t.Fatalf("unexpected status %#v", status)
+	}
+
+	resolver.txt[alias.RecordName] = []string{alias.RecordValue}
+	recorder = serve(router, http.MethodPost, "/project/demo/services/web/host-alias/www.example.com/verify", "")
+	if err := json.Unmarshal(recorder.Body.Bytes(), &status); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if status.Status != hostAliasVerified {
+		t.Fatalf("unexpected status %#v", status)
+	}
+
+	stored := getTestService(t, m, "web")
+	if len(stored.Spec.HostAliases) != 1 || stored.Spec.HostAliases[0].Name != "www.example.com" {
+		t.Fatalf("expected the alias to be moved to the spec, got %#v", stored.Spec.HostAliases)
+	}
+	if _, ok := stored.Annotations[pendingHostAliasesAnnotation]; ok {
+		t.Fatal("expected no pending aliases to be left")
+	}
+}
+
+func TestHostAliasesAreUniqueAcrossServices(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	other := testService("shop", "other")
+	other.Spec.Domain = "xyz.cdn.example.com"
+	other.Spec.HostAliases = []infrastructurev1alpha1.HostAliasSpec{{Name: "shop.example.com"}}
+	pending := testService("blog", "other")
+	if err := setPendingHostAliases(pending, []pendingHostAlias{{Name: "blog.example.com", Method: dnsverify.MethodTXT, CreatedAt: time.Now()}}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	m, _ := newTestModule(t, testService("web", "demo"), other, pending)
+
+	router := gin.New()
+	m.RegisterRoutes(router)
+
+	for _, tc := range []struct {
+		name string
+		code int
+	}{
+		{"shop.example.com", http.StatusConflict},
+		{"blog.example.com", http.StatusConflict},
+		{"xyz.cdn.example.com", http.StatusBadRequest},
+		{"new.cdn.example.com", http.StatusBadRequest},
+		{"not a hostname at all", http.StatusBadRequest},
+		{"static.example.com", http.StatusCreated},
+		{"STATIC.example.com", http.StatusConflict},
+	} {
+		recorder := serve(router, http.MethodPost, "/project/demo/services/web/host-alias", `{"name":"`+tc.name+`"}`)
+		if recorder.Code != tc.code {
+			t.Fatalf("expected %d for %s, got %d: %s", tc.code, tc.name, recorder.Code, recorder.Body.String())
+		}
+	}
+}
+
+func TestVerifyHostAliasesInBackground(t *testing.T) {
+	service := testService("web", "demo")
+	service.Spec.Domain = "abc.cdn.example.com"
+	now := time.Now()
+	if err := setPendingHostAliases(service, []pendingHostAlias{
+		{Name: "www.example.com", Method: dnsverify.MethodCNAME, CreatedAt: now.Add(-time.Hour)},
+		{Name: "old.example.com", Method: dnsverify.MethodTXT, Token: "edgecdnx-verification=abc", CreatedAt: now.Add(-8 * 24 * time.Hour)},
+		{Name: "later.example.com", Method: dnsverify.MethodCNAME, CreatedAt: now.Add(-time.Hour)},
+	}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	m, fake := newTestModule(t, service)
+	m.cfg.HostAliasPendingTTL = 7 * 24 * time.Hour
+	m.resolver = &fakeResolver{cname: map[string]string{
+		"www.example.com":   "abc.cdn.example.com.",
+		"later.example.com": "somewhere.example.net.",
+	}}
+
+	if err := m.verifyHostAliases(context.Background(), now); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	stored := getTestService(t, m, "web")
+	if len(stored.Spec.HostAliases) != 1 || stored.Spec.HostAliases[0].Name != "www.example.com" {
+		t.Fatalf("unexpected verified aliases %#v", stored.Spec.HostAliases)
+	}
+	left := pendingHostAliases(stored)
+	if len(left) != 1 || left[0].Name != "later.example.com" || left[0].LastError == "" {
+		t.Fatalf("unexpected pending aliases %#v", left)
+	}
+
+	updates := 0
+	fake.PrependReactor("update", "services", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		updates++
+		return false, nil, nil
+	})
+
+	// Failing again the same way only moves the check time, which is not written
+	if err := m.verifyHostAliases(context.Background(), now.Add(time.Minute)); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if updates != 0 {
+		t.Fatalf("expected no updates, got %d", updates)
+	}
+
+	m.resolver = &fakeResolver{}
+	if err := m.verifyHostAliases(context.Background(), now.Add(2*time.Minute)); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if updates != 1 {
+		t.Fatalf("expected the changed error to be written, got %d updates", updates)
+	}
+	if left = pendingHostAliases(getTestService(t, m, "web")); left[0].LastError == "" || !left[0].LastCheckedAt.Equal(now.Add(2*time.Minute).UTC()) {
+		t.Fatalf("unexpected pending aliases %#v", left)
+	}
+}
+
+func TestCreateServiceKeepsHostAliasesPending(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	m, _ := newTestModule(t)
+
+	router := gin.New()
+	m.RegisterRoutes(router)
+
+	recorder := serve(router, http.MethodPost, "/project/demo/services", `{
+		"name": "web",
+		"originType": "static",
+		"staticOrigin": {"upstream": "origin.example.com", "port": 443, "hostHeader": "origin.example.com", "scheme": "Https"},
+		"cache": "1h",
+		"cacheKey": {},
+		"path": {"paths": ["/"]},
+		"hostAliases": [{"name": "www.example.com", "verificationMethod": "cname"}]
+	}`)
+	if recorder.Code != http.StatusCreated {
+		t.Fatalf("unexpected status code %d: %s", recorder.Code, recorder.Body.String())
+	}
+
+	stored := getTestService(t, m, "web-abcde")
+	if len(stored.Spec.HostAliases) != 0 {
+		t.Fatalf("expected no verified aliases, got %#v", stored.Spec.HostAliases)
+	}
+	statuses := hostAliasStatuses(stored)
+	if len(statuses) != 1 || statuses[0].Status != hostAliasPending || statuses[0].CnameTarget != stored.Spec.Domain {
+		t.Fatalf("unexpected aliases %#v", statuses)
+	}
+}
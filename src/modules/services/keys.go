@@ -0,0 +1,134 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/EdgeCDN-X/edgecdnx-api/src/internal/logger"
+	infrastructurev1alpha1 "github.com/EdgeCDN-X/edgecdnx-controller/api/v1alpha1"
+	"go.uber.org/zap"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// retiringKeysAnnotation maps the names of retiring secure keys to the time they are removed, as a JSON object.
+// Retiring keys keep validating signed URLs but are no longer used to sign new ones.
+const retiringKeysAnnotation = "edgecdnx.com/retiring-keys"
+
+// The CRD allows two keys, the active one and one retiring during rotation
+const maxSecureKeys = 2
+
+func retiringKeys(service *infrastructurev1alpha1.Service) map[string]time.Time {
+	retiring := map[string]time.Time{}
+	if raw, ok := service.Annotations[retiringKeysAnnotation]; ok {
+		if err := json.Unmarshal([]byte(raw), &retiring); err != nil {
+			logger.L().Warn("Ignoring invalid retiring keys annotation", zap.String("service", service.Name), zap.Error(err))
+			return map[string]time.Time{}
+		}
+	}
+	return retiring
+}
+
+func setRetiringKeys(service *infrastructurev1alpha1.Service, retiring map[string]time.Time) {
+	if len(retiring) == 0 {
+		delete(service.Annotations, retiringKeysAnnotation)
+		return
+	}
+
+	raw, _ := json.Marshal(retiring)
+	if service.Annotations == nil {
+		service.Annotations = map[string]string{}
+	}
+	service.Annotations[retiringKeysAnnotation] = string(raw)
+}
+
+// removeKey drops a key and its retirement, reporting whether the key existed
+func removeKey(service *infrastructurev1alpha1.Service, name string) bool {
+	keys := []infrastructurev1alpha1.SecureKeySpec{}
+	for _, key := range service.Spec.SecureKeys {
+		if key.Name != name {
+			keys = append(keys, key)
+		}
+	}
+
+	if len(keys) == len(service.Spec.SecureKeys) {
+		return false
+	}
+
+	service.Spec.SecureKeys = keys
+	retiring := retiringKeys(service)
+	delete(retiring, name)
+	setRetiringKeys(service, retiring)
+	return true
+}
+
+// reapExpiredKeys removes retiring keys whose grace period has ended, reporting whether the service changed
+func reapExpiredKeys(service *infrastructurev1alpha1.Service, now time.Time) bool {
+	changed := false
+	for name, retireAt := range retiringKeys(service) {
+		if now.Before(retireAt) {
+			continue
+		}
+		if !removeKey(service, name) {
+			// The key was deleted by hand, only its retirement is left
+			retiring := retiringKeys(service)
+			delete(retiring, name)
+			setRetiringKeys(service, retiring)
+		}
+		changed = true
+	}
+	return changed
+}
+
+func (m *Module) runKeyReaper(ctx context.Context) {
+	ticker := time.NewTicker(m.cfg.KeyReaperInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := m.reapKeys(ctx, time.Now()); err != nil {
+				logger.L().Error("Failed to reap retiring keys", zap.Error(err))
+			}
+		}
+	}
+}
+
+// reapKeys removes expired retiring keys from every service. Conflicting updates are retried on the next run.
+func (m *Module) reapKeys(ctx context.Context, now time.Time) error {
+	objList, err := m.client.Resource(gvr).Namespace(m.cfg.Namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+
+	for _, item := range objList.Items {
+		if _, ok := item.GetAnnotations()[retiringKeysAnnotation]; !ok {
+			continue
+		}
+
+		service := &infrastructurev1alpha1.Service{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(item.Object, service); err != nil {
+			logger.L().Error("Failed to convert service", zap.String("service", item.GetName()), zap.Error(err))
+			continue
+		}
+
+		if !reapExpiredKeys(service, now) {
+			continue
+		}
+
+		if _, err := m.updateService(ctx, service); err != nil {
+			if apierrors.IsConflict(err) {
+				continue
+			}
+			logger.L().Error("Failed to remove retired keys", zap.String("service", service.Name), zap.Error(err))
+			continue
+		}
+		logger.L().Info("Removed retired keys", zap.String("service", service.Name))
+	}
+
+	return nil
+}
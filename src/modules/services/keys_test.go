@@ -0,0 +1,130 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	infrastructurev1alpha1 "github.com/EdgeCDN-X/edgecdnx-controller/api/v1alpha1"
+	"github.com/gin-gonic/gin"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func getTestService(t *testing.T, m *Module, name string) *infrastructurev1alpha1.Service {
+	t.Helper()
+
+	obj, err := m.client.Resource(gvr).Namespace(testNamespace).Get(context.Background(), name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	service := &infrastructurev1alpha1.Service{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, service); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	return service
+}
+
+func TestCreateKeyRejectsDuplicateNames(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	service := testService("web", "demo")
+	service.Spec.SecureKeys = []infrastructurev1alpha1.SecureKeySpec{{Name: "key1", Value: "0123456789abcdef0123456789abcdef"}}
+	m, _ := newTestModule(t, service)
+
+	router := gin.New()
+	m.RegisterRoutes(router)
+
+	recorder := serve(router, http.MethodPost, "/project/demo/services/web/keys", `{"name":"key1"}`)
+	if recorder.Code != http.StatusConflict {
+		t.Fatalf("unexpected status code %d: %s", recorder.Code, recorder.Body.String())
+	}
+
+	recorder = serve(router, http.MethodPost, "/project/demo/services/web/keys/rotate", `{"name":"key1"}`)
+	if recorder.Code != http.StatusConflict {
+		t.Fatalf("unexpected status code %d: %s", recorder.Code, recorder.Body.String())
+	}
+}
+
+func TestRotateKeyRetiresPreviousKey(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	service := testService("web", "demo")
+	service.Spec.SecureKeys = []infrastructurev1alpha1.SecureKeySpec{
+		{Name: "key1", Value: "0123456789abcdef0123456789abcdef", CreatedAt: metav1.NewTime(time.Now().Add(-time.Hour))},
+	}
+	m, _ := newTestModule(t, service)
+	m.cfg.KeyGracePeriod = time.Hour
+
+	router := gin.New()
+	m.RegisterRoutes(router)
+
+	recorder := serve(router, http.MethodPost, "/project/demo/services/web/keys/rotate", `{"name":"key2"}`)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("unexpected status code %d: %s", recorder.Code, recorder.Body.String())
+	}
+
+	var returned infrastructurev1alpha1.Service
+	if err := json.Unmarshal(recorder.Body.Bytes(), &returned); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	for _, key := range returned.Spec.SecureKeys {
+		if key.Name == "key1" && key.Value != "" {
+			t.Fatalf("expected retiring key to be redacted, got %q", key.Value)
+		}
+		if key.Name == "key2" && len(key.Value) != 32 {
+			t.Fatalf("expected new key value in response, got %q", key.Value)
+		}
+	}
+
+	stored := getTestService(t, m, "web")
+	if len(stored.Spec.SecureKeys) != 2 {
+		t.Fatalf("expected both keys during the grace period, got %#v", stored.Spec.SecureKeys)
+	}
+	retireAt, ok := retiringKeys(stored)["key1"]
+	if !ok || retireAt.Before(time.Now().Add(50*time.Minute)) {
+		t.Fatalf("unexpected retirement %#v", retiringKeys(stored))
+	}
+
+	// New URLs are signed with the new key
+	key, ok := signingKey(stored, "")
+	if !ok || key.Name != "key2" {
+		t.Fatalf("expected key2 to sign, got %#v", key)
+	}
+
+	recorder = serve(router, http.MethodPost, "/project/demo/services/web/keys/rotate", `{"name":"key3"}`)
+	if recorder.Code != http.StatusConflict {
+		t.Fatalf("unexpected status code %d: %s", recorder.Code, recorder.Body.String())
+	}
+
+	if err := m.reapKeys(context.Background(), time.Now()); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(getTestService(t, m, "web").Spec.SecureKeys) != 2 {
+		t.Fatal("expected retiring key to survive its grace period")
+	}
+
+	if err := m.reapKeys(context.Background(), time.Now().Add(2*time.Hour)); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	stored = getTestService(t, m, "web")
+	if len(stored.Spec.SecureKeys) != 1 || stored.Spec.SecureKeys[0].Name != "key2" {
+		t.Fatalf("expected only key2 to remain, got %#v", stored.Spec.SecureKeys)
+	}
+	if _, ok := stored.Annotations[retiringKeysAnnotation]; ok {
+		t.Fatal("expected retiring keys annotation to be removed")
+	}
+}
+
+func TestRotateKeyRequiresExistingKey(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	m, _ := newTestModule(t, testService("web", "demo"))
+
+	router := gin.New()
+	m.RegisterRoutes(router)
+
+	recorder := serve(router, http.MethodPost, "/project/demo/services/web/keys/rotate", `{"name":"key1"}`)
+	if recorder.Code != http.StatusBadRequest {
+		t.Fatalf("unexpected status code %d: %s", recorder.Code, recorder.Body.String())
+	}
+}
@@ -1,39 +1,123 @@
 package services
 
 import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/EdgeCDN-X/edgecdnx-api/src/internal/dnsverify"
 	"github.com/EdgeCDN-X/edgecdnx-api/src/internal/logger"
+	"github.com/EdgeCDN-X/edgecdnx-api/src/internal/purge"
+	"github.com/EdgeCDN-X/edgecdnx-api/src/internal/watch"
 	"github.com/EdgeCDN-X/edgecdnx-api/src/modules/app"
 	"github.com/casbin/casbin/v3"
 	"github.com/gin-gonic/gin"
 	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
 )
 
 type Config struct {
 	Namespace         string
 	ServiceBaseDomain string
+	// KeyGracePeriod is how long a rotated key keeps validating signed URLs unless the request overrides it
+	KeyGracePeriod time.Duration
+	// KeyReaperInterval is how often expired retiring keys are removed, 0 disables the reaper
+	KeyReaperInterval time.Duration
+	// PurgePort is the port cache nodes accept PURGE requests on
+	PurgePort int
+	// PurgeTimeout bounds how long a single location may take to purge
+	PurgeTimeout time.Duration
+	// PurgeJobRetention is how long finished purge jobs can be polled
+	PurgeJobRetention time.Duration
+	// HostAliasCheckInterval is how often pending host aliases are verified, 0 disables the background check
+	HostAliasCheckInterval time.Duration
+	// HostAliasPendingTTL is how long a host alias may stay unverified before it is dropped, 0 keeps it forever
+	HostAliasPendingTTL time.Duration
+	// WatchHeartbeat is the interval of keep-alive comments on idle watch streams
+	WatchHeartbeat time.Duration
+	// WatchBufferSize is how many events a watch stream may lag behind before it is disconnected
+	WatchBufferSize int
+	// ControllerSettings lists the annotation backed settings the deployed controller enforces,
+	// see the setting constants in enforced.go
+	ControllerSettings []string
 }
 
 type Module struct {
-	cfg         Config
-	client      *dynamic.DynamicClient
-	middlewares []gin.HandlerFunc
-	enforcer    *casbin.Enforcer
+	cfg          Config
+	client       dynamic.Interface
+	k8sClient    kubernetes.Interface
+	middlewares  []gin.HandlerFunc
+	enforcer     *casbin.SyncedEnforcer
+	stopReaper   context.CancelFunc
+	stopVerifier context.CancelFunc
+	purges       *purge.Store
+	resolver     dnsverify.Resolver
+
+	k8sCache        *app.Cache
+	stopWatch       chan struct{}
+	watchHub        *watch.Hub
+	serviceInformer cache.SharedIndexInformer
 }
 
 func New(cfg Config) *Module {
 	return &Module{cfg: cfg}
 }
 
-func (m *Module) Shutdown() {}
+func (m *Module) Shutdown() {
+	if m.stopReaper != nil {
+		m.stopReaper()
+	}
+	if m.stopVerifier != nil {
+		m.stopVerifier()
+	}
+	if m.stopWatch != nil {
+		close(m.stopWatch)
+	}
+}
 
 func (m *Module) Init() error {
 	logger.L().Info("Initializing module")
-	client, _, err := app.GetK8SDynamicClient()
+	k8sCache, err := app.GetK8SCache(m.cfg.Namespace)
 	if err != nil {
 		return err
 	}
 
-	m.client = client
+	// Reads are served from the shared informer cache, writes go to the API server. The resources the status is
+	// derived from are cached by the watch once they are installed.
+	m.k8sCache = k8sCache
+	m.client = k8sCache.Client(gvr, prefixListGVR, locationGVR)
+
+	k8sClient, _, err := app.GetK8SClient()
+	if err != nil {
+		return err
+	}
+
+	m.k8sClient = k8sClient
+
+	m.purges = purge.NewStore(&purge.HTTPPurger{
+		Client: &http.Client{Timeout: m.cfg.PurgeTimeout},
+		Port:   m.cfg.PurgePort,
+	}, &configMapPurges{client: k8sClient, namespace: m.cfg.Namespace}, m.cfg.PurgeJobRetention, m.cfg.PurgeTimeout)
+
+	if m.cfg.KeyReaperInterval > 0 {
+		ctx, cancel := context.WithCancel(context.Background())
+		m.stopReaper = cancel
+		go m.runKeyReaper(ctx)
+	}
+
+	m.resolver = net.DefaultResolver
+	if m.cfg.HostAliasCheckInterval > 0 {
+		ctx, cancel := context.WithCancel(context.Background())
+		m.stopVerifier = cancel
+		go m.runHostAliasVerifier(ctx)
+	}
+
+	m.stopWatch = make(chan struct{})
+	if err := m.startWatch(m.stopWatch); err != nil {
+		return err
+	}
 
 	return nil
 }
@@ -42,6 +126,6 @@ func (m *Module) SetMiddlewares(middlewares ...gin.HandlerFunc) {
 	m.middlewares = middlewares
 }
 
-func (m *Module) SetEnforcer(enforcer *casbin.Enforcer) {
+func (m *Module) SetEnforcer(enforcer *casbin.SyncedEnforcer) {
 	m.enforcer = enforcer
 }
@@ -0,0 +1,253 @@
+package services
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/EdgeCDN-X/edgecdnx-api/src/internal/logger"
+	"github.com/EdgeCDN-X/edgecdnx-api/src/modules/audit"
+	infrastructurev1alpha1 "github.com/EdgeCDN-X/edgecdnx-controller/api/v1alpha1"
+	"github.com/gin-gonic/gin"
+	"github.com/gosimple/slug"
+	"go.uber.org/zap"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// originSettingsAnnotation holds the weight, priority and health check of every static origin as a JSON object
+// keyed by origin id. The CRD only knows where an origin is, not how traffic is balanced between origins.
+// No released controller reads it yet, so weights, backups and health checks are a placeholder: requests setting
+// them are rejected with 501 unless the controller enforces settingOriginSettings.
+const originSettingsAnnotation = "edgecdnx.com/origin-settings"
+
+const maxStaticOrigins = 16
+
+type originSettings struct {
+	Weight      int             `json:"weight"`
+	Backup      bool            `json:"backup,omitempty"`
+	HealthCheck *HealthCheckDto `json:"healthCheck,omitempty"`
+}
+
+// originID identifies a static origin by where it points, so two entries can never reach the same upstream.
+// The slug keeps the id readable, the hash of upstream and port keeps upstreams such as a.b and a-b apart.
+func originID(origin infrastructurev1alpha1.StaticOriginSpec) string {
+	sum := sha256.Sum256(fmt.Appendf(nil, "%s:%d", strings.ToLower(origin.Upstream), origin.Port))
+	return fmt.Sprintf("%s-%s", legacyOriginID(origin), hex.EncodeToString(sum[:4]))
+}
+
+// legacyOriginID is the id settings were stored under before ids carried a hash
+func legacyOriginID(origin infrastructurev1alpha1.StaticOriginSpec) string {
+	return slug.Make(fmt.Sprintf("%s-%d", origin.Upstream, origin.Port))
+}
+
+func readOriginSettings(service *infrastructurev1alpha1.Service) map[string]originSettings {
+	settings := map[string]originSettings{}
+	if raw, ok := service.Annotations[originSettingsAnnotation]; ok {
+		if err := json.Unmarshal([]byte(raw), &settings); err != nil {
+			logger.L().Warn("Ignoring invalid origin settings annotation", zap.String("service", service.Name), zap.Error(err))
+			return map[string]originSettings{}
+		}
+	}
+	return settings
+}
+
+// requestedOrigins merges the single and the list form of static origins a request may use
+func requestedOrigins(single *StaticOriginDto, list []StaticOriginDto) ([]StaticOriginDto, error) {
+	if single != nil && len(list) > 0 {
+		return nil, fmt.Errorf("staticOrigin and staticOrigins must not be used together")
+	}
+	if single != nil {
+		return []StaticOriginDto{*single}, nil
+	}
+	return list, nil
+}
+
+// staticOrigins returns the static origins of a service together with their settings
+func staticOrigins(service *infrastructurev1alpha1.Service) []OriginDto {
+	settings := readOriginSettings(service)
+
+	origins := []OriginDto{}
+	for _, origin := range service.Spec.StaticOrigins {
+		id := originID(origin)
+		setting, ok := settings[id]
+		if !ok {
+			setting, ok = settings[legacyOriginID(origin)]
+		}
+		if !ok {
+			setting = originSettings{Weight: 1}
+		}
+		origins = append(origins, OriginDto{
+			Id: id,
+			StaticOriginDto: StaticOriginDto{
+				Upstream:    origin.Upstream,
+				HostHeader:  origin.HostHeader,
+				Port:        origin.Port,
+				Scheme:      origin.Scheme,
+				Weight:      setting.Weight,
+				Backup:      setting.Backup,
+				HealthCheck: setting.HealthCheck,
+			},
+		})
+	}
+	return origins
+}
+
+func withHealthCheckDefaults(healthCheck *HealthCheckDto) (*HealthCheckDto, error) {
+	if healthCheck == nil {
+		return nil, nil
+	}
+
+	ret := *healthCheck
+	if ret.IntervalSeconds == 0 {
+		ret.IntervalSeconds = 10
+	}
+	if ret.TimeoutSeconds == 0 {
+		ret.TimeoutSeconds = min(5, ret.IntervalSeconds)
+	}
+	if ret.HealthyThreshold == 0 {
+		ret.HealthyThreshold = 2
+	}
+	if ret.UnhealthyThreshold == 0 {
+		ret.UnhealthyThreshold = 3
+	}
+	if ret.TimeoutSeconds > ret.IntervalSeconds {
+		return nil, fmt.Errorf("health check timeout of %ds exceeds its interval of %ds", ret.TimeoutSeconds, ret.IntervalSeconds)
+	}
+	return &ret, nil
+}
+
+// setStaticOrigins replaces the static origins of a service and their settings.
+// The service is modified in place and has to be written back by the caller.
+func setStaticOrigins(service *infrastructurev1alpha1.Service, origins []StaticOriginDto) error {
+	if len(origins) == 0 {
+		return fmt.Errorf("static services need at least one origin")
+	}
+	if len(origins) > maxStaticOrigins {
+		return fmt.Errorf("services hold at most %d static origins", maxStaticOrigins)
+	}
+
+	specs := []infrastructurev1alpha1.StaticOriginSpec{}
+	settings := map[string]originSettings{}
+	hasPrimary := false
+	for _, origin := range origins {
+		spec := infrastructurev1alpha1.StaticOriginSpec{
+			Upstream:   origin.Upstream,
+			Port:       origin.Port,
+			HostHeader: origin.HostHeader,
+			Scheme:     origin.Scheme,
+		}
+
+		id := originID(spec)
+		if _, ok := settings[id]; ok {
+			return fmt.Errorf("origin %s:%d is defined twice", origin.Upstream, origin.Port)
+		}
+
+		healthCheck, err := withHealthCheckDefaults(origin.HealthCheck)
+		if err != nil {
+			return fmt.Errorf("origin %s:%d: %w", origin.Upstream, origin.Port, err)
+		}
+
+		weight := origin.Weight
+		if weight == 0 {
+			weight = 1
+		}
+
+		specs = append(specs, spec)
+		settings[id] = originSettings{Weight: weight, Backup: origin.Backup, HealthCheck: healthCheck}
+		hasPrimary = hasPrimary || !origin.Backup
+	}
+
+	if !hasPrimary {
+		return fmt.Errorf("at least one origin has to be a primary origin")
+	}
+
+	// The controller sends traffic to the first origin only, which therefore has to be a primary origin
+	slices.SortStableFunc(specs, func(a, b infrastructurev1alpha1.StaticOriginSpec) int {
+		return cmp.Compare(boolRank(settings[originID(a)].Backup), boolRank(settings[originID(b)].Backup))
+	})
+
+	raw, err := json.Marshal(settings)
+	if err != nil {
+		return fmt.Errorf("failed to encode origin settings: %w", err)
+	}
+
+	service.Spec.StaticOrigins = specs
+	if service.Annotations == nil {
+		service.Annotations = map[string]string{}
+	}
+	service.Annotations[originSettingsAnnotation] = string(raw)
+	return nil
+}
+
+func boolRank(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// clearStaticOrigins drops all static origins, e.g. when a service switches to an S3 origin
+func clearStaticOrigins(service *infrastructurev1alpha1.Service) {
+	service.Spec.StaticOrigins = nil
+	delete(service.Annotations, originSettingsAnnotation)
+}
+
+// changeOrigins loads a static service, applies change to its origins and writes the service back.
+// change returns the new origins, or a status code and an error to abort.
+func (m *Module) changeOrigins(c *gin.Context, change func(origins []OriginDto) ([]StaticOriginDto, int, error)) (*infrastructurev1alpha1.Service, int, error) {
+	service, code, err := m.getTypedService(c, c.Param("project-id"), c.Param("service-id"))
+	if err != nil {
+		return nil, code, err
+	}
+	if service.Spec.OriginType != infrastructurev1alpha1.OriginTypeStatic {
+		return nil, 400, fmt.Errorf("origins can only be managed on static services")
+	}
+	before := service.DeepCopy()
+
+	origins, code, err := change(staticOrigins(service))
+	if err != nil {
+		return nil, code, err
+	}
+
+	if err := setStaticOrigins(service, origins); err != nil {
+		return nil, 400, err
+	}
+
+	updatedObj, err := m.updateService(c, service)
+	if err != nil {
+		if apierrors.IsConflict(err) {
+			return nil, 409, fmt.Errorf("service was modified concurrently, please retry")
+		}
+		return nil, 500, err
+	}
+
+	audit.Change(c, before, updatedObj)
+
+	updated := &infrastructurev1alpha1.Service{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(updatedObj.Object, updated); err != nil {
+		return nil, 500, fmt.Errorf("internal error")
+	}
+	return updated, 200, nil
+}
+
+func findOrigin(origins []OriginDto, id string) (int, bool) {
+	for i, origin := range origins {
+		if origin.Id == id {
+			return i, true
+		}
+	}
+	return -1, false
+}
+
+func originDtos(origins []OriginDto) []StaticOriginDto {
+	ret := []StaticOriginDto{}
+	for _, origin := range origins {
+		ret = append(ret, origin.StaticOriginDto)
+	}
+	return ret
+}
@@ -0,0 +1,173 @@
+package services
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	infrastructurev1alpha1 "github.com/EdgeCDN-X/edgecdnx-controller/api/v1alpha1"
+	"github.com/gin-gonic/gin"
+)
+
+func TestCreateServiceWithSeveralOrigins(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	m, _ := newTestModule(t)
+
+	router := gin.New()
+	m.RegisterRoutes(router)
+
+	recorder := serve(router, http.MethodPost, "/project/demo/services", `{"name":"web","originType":"static","cache":"1h","cacheKey":{},"path":{"paths":["/"]},"staticOrigins":[
+		{"upstream":"a.example.com","hostHeader":"example.com","port":443,"scheme":"Https","weight":3,"healthCheck":{"path":"/healthz"}},
+		{"upstream":"b.example.com","hostHeader":"example.com","port":443,"scheme":"Https"},
+		{"upstream":"c.example.com","hostHeader":"example.com","port":443,"scheme":"Https","backup":true}
+	]}`)
+	if recorder.Code != http.StatusCreated {
+		t.Fatalf("unexpected status code %d: %s", recorder.Code, recorder.Body.String())
+	}
+
+	stored := getTestService(t, m, "web-abcde")
+	if len(stored.Spec.StaticOrigins) != 3 {
+		t.Fatalf("expected three origins, got %#v", stored.Spec.StaticOrigins)
+	}
+
+	origins := staticOrigins(stored)
+	if origins[0].Id != originID(stored.Spec.StaticOrigins[0]) || origins[0].Weight != 3 || origins[0].HealthCheck == nil || origins[0].HealthCheck.IntervalSeconds != 10 {
+		t.Fatalf("unexpected first origin %#v", origins[0])
+	}
+	if origins[1].Weight != 1 || origins[1].Backup || !origins[2].Backup {
+		t.Fatalf("unexpected origins %#v", origins)
+	}
+
+	for name, body := range map[string]string{
+		"only backups":    `{"name":"other","originType":"static","cache":"1h","cacheKey":{},"path":{"paths":["/"]},"staticOrigins":[{"upstream":"a.example.com","hostHeader":"example.com","port":443,"scheme":"Https","backup":true}]}`,
+		"duplicate":       `{"name":"other","originType":"static","cache":"1h","cacheKey":{},"path":{"paths":["/"]},"staticOrigins":[{"upstream":"a.example.com","hostHeader":"example.com","port":443,"scheme":"Https"},{"upstream":"a.example.com","hostHeader":"other.com","port":443,"scheme":"Https"}]}`,
+		"missing origin":  `{"name":"other","originType":"static","cache":"1h","cacheKey":{},"path":{"paths":["/"]}}`,
+		"timeout too big": `{"name":"other","originType":"static","cache":"1h","cacheKey":{},"path":{"paths":["/"]},"staticOrigin":{"upstream":"a.example.com","hostHeader":"example.com","port":443,"scheme":"Https","healthCheck":{"path":"/","intervalSeconds":2,"timeoutSeconds":5}}}`,
+	} {
+		recorder = serve(router, http.MethodPost, "/project/demo/services", body)
+		if recorder.Code != http.StatusBadRequest {
+			t.Fatalf("%s: unexpected status code %d: %s", name, recorder.Code, recorder.Body.String())
+		}
+	}
+}
+
+func TestOriginRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	service := testService("web", "demo")
+	service.Spec.OriginType = infrastructurev1alpha1.OriginTypeStatic
+	service.Spec.StaticOrigins = []infrastructurev1alpha1.StaticOriginSpec{
+		{Upstream: "a.example.com", HostHeader: "example.com", Port: 443, Scheme: "Https"},
+	}
+	m, _ := newTestModule(t, service)
+
+	router := gin.New()
+	m.RegisterRoutes(router)
+
+	a := originID(infrastructurev1alpha1.StaticOriginSpec{Upstream: "a.example.com", Port: 443})
+	b := originID(infrastructurev1alpha1.StaticOriginSpec{Upstream: "b.example.com", Port: 8443})
+	c := originID(infrastructurev1alpha1.StaticOriginSpec{Upstream: "c.example.com", Port: 443})
+
+	// Origins created before settings existed are primary origins with weight 1
+	recorder := serve(router, http.MethodGet, "/project/demo/services/web/origins/"+a, "")
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("unexpected status code %d: %s", recorder.Code, recorder.Body.String())
+	}
+	var origin OriginDto
+	if err := json.Unmarshal(recorder.Body.Bytes(), &origin); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if origin.Weight != 1 || origin.Backup {
+		t.Fatalf("unexpected origin %#v", origin)
+	}
+
+	recorder = serve(router, http.MethodPost, "/project/demo/services/web/origins", `{"upstream":"b.example.com","hostHeader":"example.com","port":8443,"scheme":"Https","backup":true}`)
+	if recorder.Code != http.StatusCreated {
+		t.Fatalf("unexpected status code %d: %s", recorder.Code, recorder.Body.String())
+	}
+
+	recorder = serve(router, http.MethodPost, "/project/demo/services/web/origins", `{"upstream":"b.example.com","hostHeader":"example.com","port":8443,"scheme":"Https"}`)
+	if recorder.Code != http.StatusConflict {
+		t.Fatalf("unexpected status code %d: %s", recorder.Code, recorder.Body.String())
+	}
+
+	// The only primary origin can not be removed or demoted
+	recorder = serve(router, http.MethodDelete, "/project/demo/services/web/origins/"+a, "")
+	if recorder.Code != http.StatusBadRequest {
+		t.Fatalf("unexpected status code %d: %s", recorder.Code, recorder.Body.String())
+	}
+
+	// Swap the primary origin for a new upstream
+	recorder = serve(router, http.MethodPut, "/project/demo/services/web/origins/"+a, `{"upstream":"c.example.com","hostHeader":"example.com","port":443,"scheme":"Https","weight":5}`)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("unexpected status code %d: %s", recorder.Code, recorder.Body.String())
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &origin); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if origin.Id != c || origin.Weight != 5 {
+		t.Fatalf("unexpected origin %#v", origin)
+	}
+
+	recorder = serve(router, http.MethodDelete, "/project/demo/services/web/origins/"+b, "")
+	if recorder.Code != http.StatusNoContent {
+		t.Fatalf("unexpected status code %d: %s", recorder.Code, recorder.Body.String())
+	}
+
+	recorder = serve(router, http.MethodGet, "/project/demo/services/web/origins", "")
+	var origins []OriginDto
+	if err := json.Unmarshal(recorder.Body.Bytes(), &origins); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(origins) != 1 || origins[0].Upstream != "c.example.com" {
+		t.Fatalf("unexpected origins %#v", origins)
+	}
+
+	recorder = serve(router, http.MethodGet, "/project/demo/services/web/origins/"+a, "")
+	if recorder.Code != http.StatusNotFound {
+		t.Fatalf("unexpected status code %d", recorder.Code)
+	}
+}
+
+func TestPrimaryOriginComesFirst(t *testing.T) {
+	service := testService("web", "demo")
+	err := setStaticOrigins(service, []StaticOriginDto{
+		{Upstream: "a.example.com", Port: 443, Backup: true},
+		{Upstream: "b.example.com", Port: 443},
+		{Upstream: "c.example.com", Port: 443, Backup: true},
+		{Upstream: "d.example.com", Port: 443},
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	upstreams := []string{}
+	for _, origin := range staticOrigins(service) {
+		upstreams = append(upstreams, origin.Upstream)
+	}
+	if strings.Join(upstreams, ",") != "b.example.com,d.example.com,a.example.com,c.example.com" {
+		t.Fatalf("unexpected origin order %v", upstreams)
+	}
+}
+
+func TestOriginIDsAreUnambiguous(t *testing.T) {
+	service := testService("web", "demo")
+	err := setStaticOrigins(service, []StaticOriginDto{
+		{Upstream: "a.b", Port: 80},
+		{Upstream: "a-b", Port: 80},
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	origins := staticOrigins(service)
+	if len(origins) != 2 || origins[0].Id == origins[1].Id {
+		t.Fatalf("expected distinct ids, got %#v", origins)
+	}
+
+	// Settings stored under the previous ids are still found
+	service.Annotations[originSettingsAnnotation] = `{"a-b-80":{"weight":4}}`
+	origins = staticOrigins(service)
+	if origins[0].Weight != 4 || origins[1].Weight != 4 {
+		t.Fatalf("unexpected origins %#v", origins)
+	}
+}
@@ -0,0 +1,187 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/EdgeCDN-X/edgecdnx-api/src/internal/logger"
+	"github.com/EdgeCDN-X/edgecdnx-api/src/internal/purge"
+	infrastructurev1alpha1 "github.com/EdgeCDN-X/edgecdnx-controller/api/v1alpha1"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes"
+)
+
+var locationGVR = schema.GroupVersionResource{
+	Group:    infrastructurev1alpha1.SchemeGroupVersion.Group,
+	Version:  infrastructurev1alpha1.SchemeGroupVersion.Version,
+	Resource: "locations",
+}
+
+// purgeLocations lists every location with the addresses of all its cache nodes, including nodes in
+// maintenance so they do not serve stale content once they are back
+func (m *Module) purgeLocations(ctx context.Context) ([]purge.Location, error) {
+	objList, err := m.client.Resource(locationGVR).Namespace(m.cfg.Namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list locations: %w", err)
+	}
+
+	locations := []purge.Location{}
+	for _, item := range objList.Items {
+		location := &infrastructurev1alpha1.Location{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(item.Object, location); err != nil {
+			return nil, fmt.Errorf("internal error")
+		}
+
+		nodes := slices.Clone(location.Spec.Nodes)
+		for _, group := range location.Spec.NodeGroups {
+			nodes = append(nodes, group.Nodes...)
+		}
+
+		addresses := []string{}
+		for _, node := range nodes {
+			if node.Ipv4 != "" {
+				addresses = append(addresses, node.Ipv4)
+			} else if node.Ipv6 != "" {
+				addresses = append(addresses, node.Ipv6)
+			}
+		}
+		locations = append(locations, purge.Location{Name: location.Name, Nodes: addresses})
+	}
+
+	return locations, nil
+}
+
+// purgeTargets turns paths and absolute URLs of a purge request into targets. URLs have to point at
+// one of the hosts of the service.
+func purgeTargets(service *infrastructurev1alpha1.Service, targets []string) ([]purge.Target, error) {
+	hosts := serviceHosts(service)
+
+	ret := []purge.Target{}
+	for _, target := range targets {
+		if strings.HasPrefix(target, "/") {
+			ret = append(ret, purge.Target{Path: target})
+			continue
+		}
+
+		u, err := url.Parse(target)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("target %q is neither a path nor an absolute URL", target)
+		}
+		if !slices.Contains(hosts, u.Hostname()) {
+			return nil, fmt.Errorf("host %s of target %q does not belong to the service", u.Hostname(), target)
+		}
+
+		path := u.EscapedPath()
+		if path == "" {
+			path = "/"
+		}
+		if u.RawQuery != "" {
+			path += "?" + u.RawQuery
+		}
+		ret = append(ret, purge.Target{Host: u.Hostname(), Path: path})
+	}
+
+	return ret, nil
+}
+
+// purgeJobLabel marks the ConfigMaps holding purge jobs
+const purgeJobLabel = "edgecdnx.com/purge"
+
+// configMapPurges stores each purge job as JSON in a ConfigMap of the namespace, so every replica can serve it
+type configMapPurges struct {
+	client    kubernetes.Interface
+	namespace string
+}
+
+func purgeJobConfigMapName(id string) string {
+	return "edgecdnx-purge-" + id
+}
+
+func (b *configMapPurges) Save(ctx context.Context, job *purge.Job) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      purgeJobConfigMapName(job.ID),
+			Namespace: b.namespace,
+			Labels: map[string]string{
+				purgeJobLabel:          "true",
+				"project":              job.Project,
+				"edgecdnx.com/service": job.Service,
+			},
+		},
+		Data: map[string]string{"job": string(data)},
+	}
+
+	configMaps := b.client.CoreV1().ConfigMaps(b.namespace)
+	_, err = configMaps.Update(ctx, configMap, metav1.UpdateOptions{})
+	if apierrors.IsNotFound(err) {
+		_, err = configMaps.Create(ctx, configMap, metav1.CreateOptions{})
+	}
+	if err != nil {
+		logger.L().Error("Failed to save purge job", zap.String("purge", job.ID), zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func (b *configMapPurges) Load(ctx context.Context, id string) (*purge.Job, bool, error) {
+	configMap, err := b.client.CoreV1().ConfigMaps(b.namespace).Get(ctx, purgeJobConfigMapName(id), metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to retrieve purge job: %w", err)
+	}
+
+	job, err := purgeJobFromConfigMap(configMap)
+	if err != nil {
+		return nil, false, err
+	}
+	return job, true, nil
+}
+
+func (b *configMapPurges) List(ctx context.Context) ([]*purge.Job, error) {
+	configMaps, err := b.client.CoreV1().ConfigMaps(b.namespace).List(ctx, metav1.ListOptions{LabelSelector: purgeJobLabel + "=true"})
+	if err != nil {
+		return nil, err
+	}
+
+	jobs := []*purge.Job{}
+	for i := range configMaps.Items {
+		job, err := purgeJobFromConfigMap(&configMaps.Items[i])
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+func (b *configMapPurges) Delete(ctx context.Context, id string) error {
+	err := b.client.CoreV1().ConfigMaps(b.namespace).Delete(ctx, purgeJobConfigMapName(id), metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+func purgeJobFromConfigMap(configMap *corev1.ConfigMap) (*purge.Job, error) {
+	job := &purge.Job{}
+	if err := json.Unmarshal([]byte(configMap.Data["job"]), job); err != nil {
+		return nil, fmt.Errorf("invalid purge job %s: %w", configMap.Name, err)
+	}
+	return job, nil
+}
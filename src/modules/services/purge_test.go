@@ -0,0 +1,161 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/EdgeCDN-X/edgecdnx-api/src/internal/purge"
+	"github.com/EdgeCDN-X/edgecdnx-api/src/modules/auth"
+	infrastructurev1alpha1 "github.com/EdgeCDN-X/edgecdnx-controller/api/v1alpha1"
+	"github.com/gin-gonic/gin"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// fakePurger stands in for the edge, locations listed in fail report an error
+type fakePurger struct {
+	mu       sync.Mutex
+	fail     map[string]bool
+	requests map[string]purge.Request
+}
+
+func (p *fakePurger) Purge(ctx context.Context, location purge.Location, req purge.Request) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.requests == nil {
+		p.requests = map[string]purge.Request{}
+	}
+	p.requests[location.Name] = req
+	if p.fail[location.Name] {
+		return fmt.Errorf("location %s is unreachable", location.Name)
+	}
+	return nil
+}
+
+func testLocation(name string, ipv4 string) *infrastructurev1alpha1.Location {
+	return &infrastructurev1alpha1.Location{
+		TypeMeta:   metav1.TypeMeta{APIVersion: infrastructurev1alpha1.SchemeGroupVersion.String(), Kind: "Location"},
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: testNamespace},
+		Spec:       infrastructurev1alpha1.LocationSpec{Nodes: []infrastructurev1alpha1.NodeSpec{{Name: name + "-1", Ipv4: ipv4}}},
+	}
+}
+
+func pollPurge(t *testing.T, router *gin.Engine, path string) purge.Job {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		recorder := serve(router, http.MethodGet, path, "")
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("unexpected status code %d: %s", recorder.Code, recorder.Body.String())
+		}
+		var job purge.Job
+		if err := json.Unmarshal(recorder.Body.Bytes(), &job); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		if job.FinishedAt != nil {
+			return job
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("purge %s did not finish", path)
+	return purge.Job{}
+}
+
+func TestPurgeService(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	service := testService("web", "demo")
+	service.Spec.Domain = "abcdefghijklmnop.cdn.example.com"
+	service.Spec.HostAliases = []infrastructurev1alpha1.HostAliasSpec{{Name: "www.example.com"}}
+	m, _ := newTestModule(t, service, testLocation("fra", "10.0.0.1"), testLocation("sin", "10.0.1.1"))
+
+	purger := &fakePurger{fail: map[string]bool{"sin": true}}
+	backend := &configMapPurges{client: m.k8sClient, namespace: testNamespace}
+	m.purges = purge.NewStore(purger, backend, time.Hour, time.Minute)
+
+	router := gin.New()
+	m.RegisterRoutes(router)
+
+	recorder := serve(router, http.MethodPost, "/project/demo/services/web/purge", `{"type":"url","targets":["/a.jpg","https://www.example.com/b.jpg?v=2"]}`)
+	if recorder.Code != http.StatusAccepted {
+		t.Fatalf("unexpected status code %d: %s", recorder.Code, recorder.Body.String())
+	}
+
+	var job purge.Job
+	if err := json.Unmarshal(recorder.Body.Bytes(), &job); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+
+	job = pollPurge(t, router, recorder.Header().Get("Location"))
+	if job.Status != purge.StatusPartial || len(job.Locations) != 2 || job.Locations[0].Status != purge.StatusSucceeded {
+		t.Fatalf("unexpected job %#v", job)
+	}
+
+	req := purger.requests["fra"]
+	if len(req.Hosts) != 2 || req.Targets[1] != (purge.Target{Host: "www.example.com", Path: "/b.jpg?v=2"}) {
+		t.Fatalf("unexpected request %#v", req)
+	}
+
+	// Another replica serves the job from its ConfigMap
+	replica := *m
+	replica.purges = purge.NewStore(purger, backend, time.Hour, time.Minute)
+	replicaRouter := gin.New()
+	replica.RegisterRoutes(replicaRouter)
+	if saved := pollPurge(t, replicaRouter, "/purges/"+job.ID); saved.Status != purge.StatusPartial || saved.Locations[1].Error == "" {
+		t.Fatalf("unexpected job on the other replica %#v", saved)
+	}
+
+	// Jobs are only visible to callers allowed to read services of their project
+	if _, err := m.enforcer.RemoveFilteredPolicy(0, "user@example.com", "demo", "*", "read"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if recorder = serve(router, http.MethodGet, "/purges/"+job.ID, ""); recorder.Code != http.StatusNotFound {
+		t.Fatalf("expected the job to be hidden without read permission, got %d", recorder.Code)
+	}
+	if _, err := m.enforcer.AddPolicy("user@example.com", "demo", "*", "read"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	for name, body := range map[string]string{
+		"foreign host":       `{"type":"url","targets":["https://evil.example.com/a.jpg"]}`,
+		"all with targets":   `{"type":"all","targets":["/a.jpg"]}`,
+		"wildcard without *": `{"type":"wildcard","targets":["/images/"]}`,
+		"wildcard in middle": `{"type":"wildcard","targets":["/images/*.jpg"]}`,
+		"unknown type":       `{"type":"everything"}`,
+	} {
+		recorder = serve(router, http.MethodPost, "/project/demo/services/web/purge", body)
+		if recorder.Code != http.StatusBadRequest {
+			t.Fatalf("%s: unexpected status code %d: %s", name, recorder.Code, recorder.Body.String())
+		}
+	}
+}
+
+func TestPurgeRequiresPurgePermission(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	m, _ := newTestModule(t, testService("web", "demo"))
+
+	router := gin.New()
+	m.RegisterRoutes(router)
+
+	if _, err := m.enforcer.RemoveFilteredPolicy(0, "user@example.com"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	for _, act := range auth.Actions {
+		if act == "purge" {
+			continue
+		}
+		if _, err := m.enforcer.AddPolicy("user@example.com", "demo", "service", act); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+
+	recorder := serve(router, http.MethodPost, "/project/demo/services/web/purge", `{"type":"all"}`)
+	if recorder.Code != http.StatusForbidden {
+		t.Fatalf("unexpected status code %d", recorder.Code)
+	}
+}
@@ -1,15 +1,26 @@
 package services
 
 import (
+	"context"
 	"fmt"
-	"math/rand"
+	"net/url"
 	"slices"
+	"strings"
 	"time"
 
+	"github.com/EdgeCDN-X/edgecdnx-api/src/internal/logger"
+	"github.com/EdgeCDN-X/edgecdnx-api/src/internal/purge"
+	"github.com/EdgeCDN-X/edgecdnx-api/src/internal/readiness"
+	"github.com/EdgeCDN-X/edgecdnx-api/src/internal/rules"
+	"github.com/EdgeCDN-X/edgecdnx-api/src/internal/signing"
+	"github.com/EdgeCDN-X/edgecdnx-api/src/internal/tlscert"
+	"github.com/EdgeCDN-X/edgecdnx-api/src/internal/watch"
+	"github.com/EdgeCDN-X/edgecdnx-api/src/modules/audit"
 	"github.com/EdgeCDN-X/edgecdnx-api/src/modules/auth"
 	infrastructurev1alpha1 "github.com/EdgeCDN-X/edgecdnx-controller/api/v1alpha1"
 	"github.com/gin-gonic/gin"
 	"github.com/gosimple/slug"
+	"go.uber.org/zap"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
@@ -24,6 +35,33 @@ var gvr = schema.GroupVersionResource{
 }
 
 func (m *Module) RegisterRoutes(r *gin.Engine) {
+	// Purge ids are unique across projects, the job tells which project has to be checked
+	r.Group("purges", m.middlewares...).GET("/:purge-id", func(c *gin.Context) {
+		job, ok, err := m.purges.Get(c, c.Param("purge-id"))
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		if !ok {
+			c.JSON(404, gin.H{"error": "purge not found"})
+			return
+		}
+
+		allowed, err := auth.AuthorizeRequest(m.enforcer, c, job.Project, "service", "read")
+		if err != nil {
+			c.JSON(500, gin.H{"error": "internal error"})
+			return
+		}
+		// Jobs of other projects are not revealed
+		if !allowed {
+			c.JSON(404, gin.H{"error": "purge not found"})
+			return
+		}
+
+		c.JSON(200, job)
+		return
+	})
+
 	group := r.Group("project/:project-id/services", m.middlewares...)
 
 	group.GET("", auth.NewAuthzBuilder().E(m.enforcer).T("project-id").R("service").S("user_id").A("read").Build(), func(c *gin.Context) {
@@ -45,6 +83,7 @@ func (m *Module) RegisterRoutes(r *gin.Engine) {
 				c.JSON(500, gin.H{"error": "internal error"})
 				return
 			}
+			redactService(service)
 			services = append(services, *service)
 		}
 
@@ -52,6 +91,44 @@ func (m *Module) RegisterRoutes(r *gin.Engine) {
 		return
 	})
 
+	group.GET("/watch", auth.NewAuthzBuilder().E(m.enforcer).T("project-id").R("service").S("user_id").A("read").Build(), func(c *gin.Context) {
+		if m.watchHub == nil {
+			c.JSON(503, gin.H{"error": "service watch is not available"})
+			return
+		}
+		project := c.Param("project-id")
+		serviceId := c.Query("serviceId")
+
+		sub, initial, resumed := m.watchHub.Subscribe(watch.LastEventID(c.Request), serviceFilter(project, serviceId))
+		defer m.watchHub.Unsubscribe(sub)
+
+		if !resumed {
+			snapshot, err := m.serviceSnapshot(c, project, serviceId)
+			if err != nil {
+				c.JSON(500, gin.H{"error": err.Error()})
+				return
+			}
+			initial = snapshot
+		}
+
+		err := watch.Serve(c.Request.Context(), c.Writer, sub, initial, watch.StreamOptions{
+			Heartbeat: m.cfg.WatchHeartbeat,
+			Authorize: func() error {
+				allowed, err := auth.AuthorizeRequest(m.enforcer, c, project, "service", "read")
+				if err != nil {
+					return fmt.Errorf("internal error")
+				}
+				if !allowed {
+					return fmt.Errorf("forbidden")
+				}
+				return nil
+			},
+		})
+		if err != nil {
+			logger.L().Debug("Service watch ended", zap.String("project", project), zap.Error(err))
+		}
+	})
+
 	group.POST("", auth.NewAuthzBuilder().E(m.enforcer).T("project-id").R("service").S("user_id").A("create").Build(), func(c *gin.Context) {
 		var dto ServiceDto
 		if err := c.ShouldBindJSON(&dto); err != nil {
@@ -59,10 +136,58 @@ func (m *Module) RegisterRoutes(r *gin.Engine) {
 			return
 		}
 
+		if code, err := m.checkServiceSettings(dto.CacheRules, dto.Rules, dto.Access); err != nil {
+			c.JSON(code, gin.H{"error": err.Error()})
+			return
+		}
+
+		if errs := validateCacheRules("cacheRules", dto.CacheRules); len(errs) > 0 {
+			c.JSON(400, gin.H{"error": "invalid cache rules", "fields": errs})
+			return
+		}
+
+		if dto.Rules != nil {
+			if errs := compileEdgeRules("rules", *dto.Rules); len(errs) > 0 {
+				c.JSON(400, gin.H{"error": "invalid rules", "fields": errs})
+				return
+			}
+		}
+
+		var access AccessDto
+		if dto.Access != nil {
+			normalized, errs, err := m.normalizeAccess(c, c.Param("project-id"), "access", *dto.Access)
+			if err != nil {
+				c.JSON(500, gin.H{"error": err.Error()})
+				return
+			}
+			if len(errs) > 0 {
+				c.JSON(400, gin.H{"error": "invalid access rules", "fields": errs})
+				return
+			}
+			access = normalized
+		}
+
+		origins, err := requestedOrigins(dto.StaticOrigin, dto.StaticOrigins)
+		if err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		if code, err := m.checkOriginSettings(origins); err != nil {
+			c.JSON(code, gin.H{"error": err.Error()})
+			return
+		}
+		if dto.OriginType == "static" && len(origins) == 0 {
+			c.JSON(400, gin.H{"error": "staticOrigin or staticOrigins must be provided when originType is static"})
+			return
+		}
+		if dto.OriginType == "s3" && dto.S3OriginSpec == nil {
+			c.JSON(400, gin.H{"error": "s3OriginSpec must be provided when originType is s3"})
+			return
+		}
+
+		// All services are listed, generated domains have to be unique across projects
 		services := &infrastructurev1alpha1.ServiceList{}
-		objList, err := m.client.Resource(gvr).Namespace(m.cfg.Namespace).List(c, metav1.ListOptions{
-			LabelSelector: "project=" + c.Param("project-id"),
-		})
+		objList, err := m.client.Resource(gvr).Namespace(m.cfg.Namespace).List(c, metav1.ListOptions{})
 		if err != nil {
 			c.JSON(500, gin.H{"error": "failed to list services: " + err.Error()})
 			return
@@ -74,19 +199,31 @@ func (m *Module) RegisterRoutes(r *gin.Engine) {
 			return
 		}
 
+		domains := map[string]bool{}
 		for _, service := range services.Items {
-			if service.Spec.Name == dto.Name {
+			if service.Labels["project"] == c.Param("project-id") && service.Spec.Name == dto.Name {
 				c.JSON(409, gin.H{"error": "service with the same name already exists. Services must have unique names within a Project."})
 				return
 			}
+			domains[service.Spec.Domain] = true
+		}
+
+		domain, err := m.generateDomain(domains)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
 		}
 
-		const letters = "abcdefghijklmnopqrstuvwxyz"
-		b := make([]byte, 16)
-		for i := range b {
-			b[i] = letters[rand.Intn(len(letters))]
+		var secureKeys []infrastructurev1alpha1.SecureKeySpec
+		if dto.SignedUrlsEnabled {
+			key, err := newSecureKey("key1")
+			if err != nil {
+				c.JSON(500, gin.H{"error": err.Error()})
+				return
+			}
+			secureKeys = append(secureKeys, key)
 		}
-		generatedDomainHost := string(b)
+
 		name := slug.Make(dto.Name)
 
 		service := &infrastructurev1alpha1.Service{
@@ -103,21 +240,8 @@ func (m *Module) RegisterRoutes(r *gin.Engine) {
 			},
 			Spec: infrastructurev1alpha1.ServiceSpec{
 				Name:       dto.Name,
-				Domain:     fmt.Sprintf("%s.%s", generatedDomainHost, m.cfg.ServiceBaseDomain),
+				Domain:     domain,
 				OriginType: dto.OriginType,
-				StaticOrigins: func() []infrastructurev1alpha1.StaticOriginSpec {
-					if dto.OriginType == "static" {
-						return []infrastructurev1alpha1.StaticOriginSpec{
-							{
-								Upstream:   dto.StaticOrigin.Upstream,
-								Port:       dto.StaticOrigin.Port,
-								HostHeader: dto.StaticOrigin.HostHeader,
-								Scheme:     dto.StaticOrigin.Scheme,
-							},
-						}
-					}
-					return nil
-				}(),
 				S3OriginSpec: func() []infrastructurev1alpha1.S3OriginSpec {
 					if dto.OriginType == "s3" {
 						return []infrastructurev1alpha1.S3OriginSpec{
@@ -136,25 +260,8 @@ func (m *Module) RegisterRoutes(r *gin.Engine) {
 					}
 					return nil
 				}(),
-				SecureKeys: func() []infrastructurev1alpha1.SecureKeySpec {
-					if dto.SignedUrlsEnabled {
-						return []infrastructurev1alpha1.SecureKeySpec{
-							{
-								Name: "key1",
-								Value: func() string {
-									b := make([]byte, 32)
-									for i := range b {
-										b[i] = letters[rand.Intn(len(letters))]
-									}
-									return string(b)
-								}(),
-								CreatedAt: metav1.Time{Time: time.Now()},
-							},
-						}
-					}
-					return nil
-				}(),
-				Cache: dto.Cache,
+				SecureKeys: secureKeys,
+				Cache:      dto.Cache,
 				Path: infrastructurev1alpha1.PathSpec{
 					Paths:   dto.Path.Paths,
 					Rewrite: dto.Path.Rewrite,
@@ -163,19 +270,53 @@ func (m *Module) RegisterRoutes(r *gin.Engine) {
 					Headers:     dto.CacheKey.Headers,
 					QueryParams: dto.CacheKey.QueryParams,
 				},
-				HostAliases: func() []infrastructurev1alpha1.HostAliasSpec {
-					aliases := []infrastructurev1alpha1.HostAliasSpec{}
-					for _, alias := range dto.HostAliases {
-						aliases = append(aliases, infrastructurev1alpha1.HostAliasSpec{Name: alias.Name})
-					}
-					return aliases
-				}(),
 				Waf: infrastructurev1alpha1.WafSpec{
 					Enabled: dto.WafEnabled,
 				},
 			},
 		}
 
+		if dto.OriginType == "static" {
+			if err := setStaticOrigins(service, origins); err != nil {
+				c.JSON(400, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		if err := setCacheRules(service, dto.CacheRules); err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+
+		if dto.Rules != nil {
+			if err := setEdgeRules(service, *dto.Rules); err != nil {
+				c.JSON(500, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		if err := setAccessRules(service, access); err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+
+		// Host aliases are only served once their DNS challenge passed
+		for _, alias := range dto.HostAliases {
+			hostname := normalizeHostname(alias.Name)
+			if hasHostAlias(service, hostname) {
+				c.JSON(400, gin.H{"error": "host alias " + hostname + " is listed more than once"})
+				return
+			}
+			if code, err := m.checkHostAlias(services.Items, hostname); err != nil {
+				c.JSON(code, gin.H{"error": err.Error()})
+				return
+			}
+			if _, err := addPendingHostAlias(service, hostname, alias.VerificationMethod, time.Now()); err != nil {
+				c.JSON(500, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
 		objMap, err := runtime.DefaultUnstructuredConverter.ToUnstructured(service)
 		if err != nil {
 			c.JSON(500, gin.H{"error": "internal error"})
@@ -211,10 +352,63 @@ func (m *Module) RegisterRoutes(r *gin.Engine) {
 			return
 		}
 
+		if dto.OriginType == "s3" {
+			// The generated name is only known now, the Secret is owned by the service and needs its UID
+			if returnedService.Annotations == nil {
+				returnedService.Annotations = map[string]string{}
+			}
+			returnedService.Annotations[s3CredentialsAnnotation] = s3CredentialsSecretName(returnedService.Name)
+			createdObj, err = m.updateService(c, returnedService)
+			if err == nil {
+				err = m.storeS3Credentials(c, returnedService)
+			}
+			if err != nil {
+				// Do not leave a service behind that has no credentials to reach its origin
+				if delErr := m.client.Resource(gvr).Namespace(ns).Delete(c, returnedService.Name, metav1.DeleteOptions{}); delErr != nil {
+					logger.L().Error("Failed to clean up service after storing S3 credentials failed", zap.String("service", returnedService.Name), zap.Error(delErr))
+				}
+				c.JSON(500, gin.H{"error": err.Error()})
+				return
+			}
+
+			returnedService = &infrastructurev1alpha1.Service{}
+			err = runtime.DefaultUnstructuredConverter.FromUnstructured(createdObj.Object, returnedService)
+			if err != nil {
+				c.JSON(500, gin.H{"error": "internal error"})
+				return
+			}
+		}
+
+		audit.Change(c, nil, createdObj)
+
+		// A generated signing key is only shown in this response
+		keys := slices.Clone(returnedService.Spec.SecureKeys)
+		redactService(returnedService)
+		returnedService.Spec.SecureKeys = keys
+
 		c.JSON(201, returnedService)
 		return
 	})
 
+	group.GET("/:service-id", auth.NewAuthzBuilder().E(m.enforcer).T("project-id").R("service").S("user_id").A("read").Build(), func(c *gin.Context) {
+		obj, code, err := m.getService(c, c.Param("project-id"), c.Param("service-id"))
+		if err != nil {
+			c.JSON(code, gin.H{"error": err.Error()})
+			return
+		}
+
+		service := &infrastructurev1alpha1.Service{}
+		err = runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, service)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "internal error"})
+			return
+		}
+
+		redactService(service)
+		c.JSON(200, service)
+		return
+	})
+
 	group.PATCH("/:service-id", auth.NewAuthzBuilder().E(m.enforcer).T("project-id").R("service").S("user_id").A("update").Build(), func(c *gin.Context) {
 		var dto ServiceUpdateDto
 		if err := c.ShouldBindJSON(&dto); err != nil {
@@ -222,15 +416,16 @@ func (m *Module) RegisterRoutes(r *gin.Engine) {
 			return
 		}
 
+		if code, err := m.checkServiceSettings(dto.CacheRules, dto.Rules, dto.Access); err != nil {
+			c.JSON(code, gin.H{"error": err.Error()})
+			return
+		}
+
 		serviceId := c.Param("service-id")
 
-		obj, err := m.client.Resource(gvr).Namespace(m.cfg.Namespace).Get(c, serviceId, metav1.GetOptions{})
+		obj, code, err := m.getService(c, c.Param("project-id"), serviceId)
 		if err != nil {
-			if apierrors.IsNotFound(err) {
-				c.JSON(404, gin.H{"error": "service not found"})
-				return
-			}
-			c.JSON(500, gin.H{"error": "failed to retrieve service: " + err.Error()})
+			c.JSON(code, gin.H{"error": err.Error()})
 			return
 		}
 
@@ -245,16 +440,64 @@ func (m *Module) RegisterRoutes(r *gin.Engine) {
 			service.Spec.Cache = dto.Cache
 		}
 
+		if dto.CacheRules != nil {
+			if errs := validateCacheRules("cacheRules", dto.CacheRules); len(errs) > 0 {
+				c.JSON(400, gin.H{"error": "invalid cache rules", "fields": errs})
+				return
+			}
+			if err := setCacheRules(service, dto.CacheRules); err != nil {
+				c.JSON(500, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		if dto.Rules != nil {
+			if errs := compileEdgeRules("rules", *dto.Rules); len(errs) > 0 {
+				c.JSON(400, gin.H{"error": "invalid rules", "fields": errs})
+				return
+			}
+			if err := setEdgeRules(service, *dto.Rules); err != nil {
+				c.JSON(500, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		if dto.Access != nil {
+			access, errs, err := m.normalizeAccess(c, c.Param("project-id"), "access", *dto.Access)
+			if err != nil {
+				c.JSON(500, gin.H{"error": err.Error()})
+				return
+			}
+			if len(errs) > 0 {
+				c.JSON(400, gin.H{"error": "invalid access rules", "fields": errs})
+				return
+			}
+			if err := setAccessRules(service, access); err != nil {
+				c.JSON(500, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		origins, err := requestedOrigins(dto.StaticOrigin, dto.StaticOrigins)
+		if err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		if code, err := m.checkOriginSettings(origins); err != nil {
+			c.JSON(code, gin.H{"error": err.Error()})
+			return
+		}
+
 		if dto.OriginType != "" {
 			service.Spec.OriginType = dto.OriginType
 			if dto.OriginType == "static" {
 				service.Spec.S3OriginSpec = nil
-				if dto.StaticOrigin == nil {
-					c.JSON(400, gin.H{"error": "staticOrigin must be provided when originType is static"})
+				if len(origins) == 0 {
+					c.JSON(400, gin.H{"error": "staticOrigin or staticOrigins must be provided when originType is static"})
 					return
 				}
 			} else if dto.OriginType == "s3" {
-				service.Spec.StaticOrigins = nil
+				clearStaticOrigins(service)
 				if dto.S3OriginSpec == nil {
 					c.JSON(400, gin.H{"error": "s3OriginSpec must be provided when originType is s3"})
 					return
@@ -262,14 +505,14 @@ func (m *Module) RegisterRoutes(r *gin.Engine) {
 			}
 		}
 
-		if dto.StaticOrigin != nil {
-			service.Spec.StaticOrigins = []infrastructurev1alpha1.StaticOriginSpec{
-				{
-					Upstream:   dto.StaticOrigin.Upstream,
-					Port:       dto.StaticOrigin.Port,
-					HostHeader: dto.StaticOrigin.HostHeader,
-					Scheme:     dto.StaticOrigin.Scheme,
-				},
+		if len(origins) > 0 {
+			if service.Spec.OriginType != "static" {
+				c.JSON(400, gin.H{"error": "static origins can only be set on static services"})
+				return
+			}
+			if err := setStaticOrigins(service, origins); err != nil {
+				c.JSON(400, gin.H{"error": err.Error()})
+				return
 			}
 		}
 
@@ -287,6 +530,18 @@ func (m *Module) RegisterRoutes(r *gin.Engine) {
 					S3Style:        dto.S3OriginSpec.S3Style,
 				},
 			}
+
+			if service.Annotations == nil {
+				service.Annotations = map[string]string{}
+			}
+			service.Annotations[s3CredentialsAnnotation] = s3CredentialsSecretName(service.Name)
+		}
+
+		// The credentials Secret is removed once the service no longer points at it
+		staleCredentials := ""
+		if len(service.Spec.S3OriginSpec) == 0 {
+			staleCredentials = service.Annotations[s3CredentialsAnnotation]
+			delete(service.Annotations, s3CredentialsAnnotation)
 		}
 
 		if dto.WafEnabled != nil {
@@ -319,10 +574,29 @@ func (m *Module) RegisterRoutes(r *gin.Engine) {
 
 		updatedObj, err := m.client.Resource(gvr).Namespace(m.cfg.Namespace).Update(c, &serviceUnstructured, metav1.UpdateOptions{})
 		if err != nil {
+			if apierrors.IsConflict(err) {
+				c.JSON(409, gin.H{"error": "service was modified concurrently, please retry"})
+				return
+			}
 			c.JSON(500, gin.H{"error": "failed to update service: " + err.Error()})
 			return
 		}
 
+		audit.Change(c, obj, updatedObj)
+
+		if dto.S3OriginSpec != nil {
+			if err := m.storeS3Credentials(c, service); err != nil {
+				c.JSON(500, gin.H{"error": "service was updated but " + err.Error()})
+				return
+			}
+		}
+
+		if staleCredentials != "" {
+			if err := m.deleteS3Credentials(c, staleCredentials); err != nil {
+				logger.L().Warn("Failed to delete unused S3 credentials", zap.String("secret", staleCredentials), zap.Error(err))
+			}
+		}
+
 		returnedService := &infrastructurev1alpha1.Service{}
 		err = runtime.DefaultUnstructuredConverter.FromUnstructured(updatedObj.Object, returnedService)
 		if err != nil {
@@ -330,166 +604,419 @@ func (m *Module) RegisterRoutes(r *gin.Engine) {
 			return
 		}
 
+		redactService(returnedService)
 		c.JSON(200, returnedService)
 		return
 	})
 
-	group.GET("/:service-id/status", auth.NewAuthzBuilder().E(m.enforcer).T("project-id").R("service").S("user_id").A("read").Build(), func(c *gin.Context) {
-		serviceId := c.Param("service-id")
-
-		obj, err := m.client.Resource(gvr).Namespace(m.cfg.Namespace).Get(c, serviceId, metav1.GetOptions{})
+	group.DELETE("/:service-id", auth.NewAuthzBuilder().E(m.enforcer).T("project-id").R("service").S("user_id").A("delete").Build(), func(c *gin.Context) {
+		obj, code, err := m.getService(c, c.Param("project-id"), c.Param("service-id"))
 		if err != nil {
-			if apierrors.IsNotFound(err) {
-				c.JSON(404, gin.H{"error": "service not found"})
-				return
-			}
-			c.JSON(500, gin.H{"error": "failed to retrieve service: " + err.Error()})
+			c.JSON(code, gin.H{"error": err.Error()})
 			return
 		}
 
-		ret := &ServiceDetailsDto{
-			ServiceId: serviceId,
-		}
-
-		// For example, fetching a Certificate CRD from cert-manager
-		certgvr := schema.GroupVersionResource{
-			Group:    "cert-manager.io",
-			Version:  "v1", // or v1alpha2 depending on your cluster
-			Resource: "certificates",
-		}
-
-		obj, err = m.client.Resource(certgvr).Namespace(m.cfg.Namespace).Get(c, serviceId, metav1.GetOptions{})
+		// The UID precondition makes sure a service recreated under the same name in another project is left alone
+		uid := obj.GetUID()
+		err = m.client.Resource(gvr).Namespace(m.cfg.Namespace).Delete(c, obj.GetName(), metav1.DeleteOptions{
+			Preconditions: &metav1.Preconditions{UID: &uid},
+		})
 		if err != nil {
-			if !apierrors.IsNotFound(err) {
-				c.JSON(500, gin.H{"error": "failed to retrieve certificate: " + err.Error()})
+			if apierrors.IsNotFound(err) || apierrors.IsConflict(err) {
+				c.JSON(404, gin.H{"error": "service not found"})
 				return
 			}
-		} else {
-			ret.CertificateStatus = obj.Object["status"]
+			c.JSON(500, gin.H{"error": "failed to delete service: " + err.Error()})
+			return
 		}
 
-		// For example, fetching a Certificate CRD from cert-manager
-		appsetgvr := schema.GroupVersionResource{
-			Group:    "argoproj.io",
-			Version:  "v1alpha1", // or v1 depending on your cluster
-			Resource: "applicationsets",
-		}
+		audit.Change(c, obj, nil)
+
+		c.Status(204)
+		return
+	})
 
-		obj, err = m.client.Resource(appsetgvr).Namespace(m.cfg.Namespace).Get(c, serviceId, metav1.GetOptions{})
+	group.GET("/:service-id/cache-rules", auth.NewAuthzBuilder().E(m.enforcer).T("project-id").R("service").S("user_id").A("read").Build(), func(c *gin.Context) {
+		service, code, err := m.getTypedService(c, c.Param("project-id"), c.Param("service-id"))
 		if err != nil {
-			if !apierrors.IsNotFound(err) {
-				c.JSON(500, gin.H{"error": "failed to retrieve applicationset: " + err.Error()})
-				return
-			}
-		} else {
-			ret.ApplicationSetStatus = obj.Object["status"]
+			c.JSON(code, gin.H{"error": err.Error()})
+			return
 		}
 
-		// Since it's unstructured, you can return obj.Object directly
-		c.JSON(200, ret)
+		c.JSON(200, CacheRulesDto{Rules: cacheRules(service)})
 		return
 	})
 
-	group.POST("/:service-id/keys", auth.NewAuthzBuilder().E(m.enforcer).T("project-id").R("service").S("user_id").A("update").Build(), func(c *gin.Context) {
-		var dto CreateKeyDto
+	group.PUT("/:service-id/cache-rules", auth.NewAuthzBuilder().E(m.enforcer).T("project-id").R("service").S("user_id").A("update").Build(), func(c *gin.Context) {
+		var dto CacheRulesDto
 		if err := c.ShouldBindJSON(&dto); err != nil {
 			c.JSON(400, gin.H{"error": "invalid request body: " + err.Error()})
 			return
 		}
 
-		keyName := dto.Name
-		if keyName == "" {
-			c.JSON(400, gin.H{"error": "key name is required"})
+		if code, err := m.checkEnforced(settingCacheRules, dto.Rules); err != nil {
+			c.JSON(code, gin.H{"error": err.Error()})
 			return
 		}
 
-		serviceId := c.Param("service-id")
+		if errs := validateCacheRules("rules", dto.Rules); len(errs) > 0 {
+			c.JSON(400, gin.H{"error": "invalid cache rules", "fields": errs})
+			return
+		}
 
-		// Check if service exists
-		_, err := m.client.Resource(gvr).Namespace(m.cfg.Namespace).Get(c, serviceId, metav1.GetOptions{})
+		service, code, err := m.getTypedService(c, c.Param("project-id"), c.Param("service-id"))
 		if err != nil {
-			if apierrors.IsNotFound(err) {
-				c.JSON(404, gin.H{"error": "service not found"})
-				return
-			}
-			c.JSON(500, gin.H{"error": "failed to retrieve service: " + err.Error()})
+			c.JSON(code, gin.H{"error": err.Error()})
 			return
 		}
+		before := service.DeepCopy()
 
-		newKey := &infrastructurev1alpha1.SecureKeySpec{
-			Name: keyName,
-			Value: func() string {
-				const letters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
-				b := make([]byte, 32)
-				for i := range b {
-					b[i] = letters[rand.Intn(len(letters))]
-				}
-				return string(b)
-			}(),
-			CreatedAt: metav1.Time{Time: time.Now()},
+		if err := setCacheRules(service, dto.Rules); err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
 		}
 
-		// Create the new key
-		obj, err := m.client.Resource(gvr).Namespace(m.cfg.Namespace).Get(c, serviceId, metav1.GetOptions{})
+		updatedObj, err := m.updateService(c, service)
 		if err != nil {
-			c.JSON(500, gin.H{"error": "failed to retrieve service: " + err.Error()})
+			if apierrors.IsConflict(err) {
+				c.JSON(409, gin.H{"error": "service was modified concurrently, please retry"})
+				return
+			}
+			c.JSON(500, gin.H{"error": err.Error()})
 			return
 		}
 
-		service := &infrastructurev1alpha1.Service{}
-		err = runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, service)
+		audit.Change(c, before, updatedObj)
+
+		c.JSON(200, CacheRulesDto{Rules: cacheRules(service)})
+		return
+	})
+
+	group.GET("/:service-id/rules", auth.NewAuthzBuilder().E(m.enforcer).T("project-id").R("service").S("user_id").A("read").Build(), func(c *gin.Context) {
+		service, code, err := m.getTypedService(c, c.Param("project-id"), c.Param("service-id"))
 		if err != nil {
-			c.JSON(500, gin.H{"error": "internal error"})
+			c.JSON(code, gin.H{"error": err.Error()})
 			return
 		}
 
-		service.Spec.SecureKeys = append(service.Spec.SecureKeys, *newKey)
+		c.JSON(200, edgeRules(service))
+		return
+	})
 
-		objMap, err := runtime.DefaultUnstructuredConverter.ToUnstructured(service)
-		if err != nil {
-			c.JSON(500, gin.H{"error": "internal error"})
+	group.PUT("/:service-id/rules", auth.NewAuthzBuilder().E(m.enforcer).T("project-id").R("service").S("user_id").A("update").Build(), func(c *gin.Context) {
+		var dto rules.Set
+		if err := c.ShouldBindJSON(&dto); err != nil {
+			c.JSON(400, gin.H{"error": "invalid request body: " + err.Error()})
 			return
 		}
 
-		serviceUnstructured := unstructured.Unstructured{
-			Object: objMap,
+		if code, err := m.checkEnforced(settingEdgeRules, dto); err != nil {
+			c.JSON(code, gin.H{"error": err.Error()})
+			return
 		}
 
-		updatedObj, err := m.client.Resource(gvr).Namespace(m.cfg.Namespace).Update(c, &serviceUnstructured, metav1.UpdateOptions{})
-		if err != nil {
-			c.JSON(500, gin.H{"error": "failed to update service with new key: " + err.Error()})
+		if errs := compileEdgeRules("", dto); len(errs) > 0 {
+			c.JSON(400, gin.H{"error": "invalid rules", "fields": errs})
 			return
 		}
 
-		returnedService := &infrastructurev1alpha1.Service{}
-		err = runtime.DefaultUnstructuredConverter.FromUnstructured(updatedObj.Object, returnedService)
+		service, code, err := m.getTypedService(c, c.Param("project-id"), c.Param("service-id"))
 		if err != nil {
-			c.JSON(500, gin.H{"error": "internal error"})
+			c.JSON(code, gin.H{"error": err.Error()})
 			return
 		}
+		before := service.DeepCopy()
 
-		c.JSON(200, returnedService)
-		return
-	})
+		if err := setEdgeRules(service, dto); err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
 
-	group.DELETE("/:service-id/keys/:key-name", auth.NewAuthzBuilder().E(m.enforcer).T("project-id").R("service").S("user_id").A("update").Build(), func(c *gin.Context) {
-		serviceId := c.Param("service-id")
-		keyName := c.Param("key-name")
+		updatedObj, err := m.updateService(c, service)
+		if err != nil {
+			if apierrors.IsConflict(err) {
+				c.JSON(409, gin.H{"error": "service was modified concurrently, please retry"})
+				return
+			}
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+
+		audit.Change(c, before, updatedObj)
 
-		// Check if service exists
-		_, err := m.client.Resource(gvr).Namespace(m.cfg.Namespace).Get(c, serviceId, metav1.GetOptions{})
+		c.JSON(200, edgeRules(service))
+		return
+	})
+
+	group.GET("/:service-id/access", auth.NewAuthzBuilder().E(m.enforcer).T("project-id").R("service").S("user_id").A("read").Build(), func(c *gin.Context) {
+		service, code, err := m.getTypedService(c, c.Param("project-id"), c.Param("service-id"))
 		if err != nil {
-			if apierrors.IsNotFound(err) {
-				c.JSON(404, gin.H{"error": "service not found"})
+			c.JSON(code, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(200, accessRules(service))
+		return
+	})
+
+	group.PUT("/:service-id/access", auth.NewAuthzBuilder().E(m.enforcer).T("project-id").R("service").S("user_id").A("update").Build(), func(c *gin.Context) {
+		var dto AccessDto
+		if err := c.ShouldBindJSON(&dto); err != nil {
+			c.JSON(400, gin.H{"error": "invalid request body: " + err.Error()})
+			return
+		}
+
+		if code, err := m.checkEnforced(settingAccess, dto); err != nil {
+			c.JSON(code, gin.H{"error": err.Error()})
+			return
+		}
+
+		access, errs, err := m.normalizeAccess(c, c.Param("project-id"), "", dto)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		if len(errs) > 0 {
+			c.JSON(400, gin.H{"error": "invalid access rules", "fields": errs})
+			return
+		}
+
+		service, code, err := m.getTypedService(c, c.Param("project-id"), c.Param("service-id"))
+		if err != nil {
+			c.JSON(code, gin.H{"error": err.Error()})
+			return
+		}
+		before := service.DeepCopy()
+
+		if err := setAccessRules(service, access); err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+
+		updatedObj, err := m.updateService(c, service)
+		if err != nil {
+			if apierrors.IsConflict(err) {
+				c.JSON(409, gin.H{"error": "service was modified concurrently, please retry"})
 				return
 			}
-			c.JSON(500, gin.H{"error": "failed to retrieve service: " + err.Error()})
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+
+		audit.Change(c, before, updatedObj)
+
+		c.JSON(200, accessRules(service))
+		return
+	})
+
+	group.GET("/:service-id/origins", auth.NewAuthzBuilder().E(m.enforcer).T("project-id").R("service").S("user_id").A("read").Build(), func(c *gin.Context) {
+		service, code, err := m.getTypedService(c, c.Param("project-id"), c.Param("service-id"))
+		if err != nil {
+			c.JSON(code, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(200, staticOrigins(service))
+		return
+	})
+
+	group.GET("/:service-id/origins/:origin-id", auth.NewAuthzBuilder().E(m.enforcer).T("project-id").R("service").S("user_id").A("read").Build(), func(c *gin.Context) {
+		service, code, err := m.getTypedService(c, c.Param("project-id"), c.Param("service-id"))
+		if err != nil {
+			c.JSON(code, gin.H{"error": err.Error()})
+			return
+		}
+
+		origins := staticOrigins(service)
+		i, ok := findOrigin(origins, c.Param("origin-id"))
+		if !ok {
+			c.JSON(404, gin.H{"error": "origin not found"})
+			return
+		}
+
+		c.JSON(200, origins[i])
+		return
+	})
+
+	group.POST("/:service-id/origins", auth.NewAuthzBuilder().E(m.enforcer).T("project-id").R("service").S("user_id").A("update").Build(), func(c *gin.Context) {
+		var dto StaticOriginDto
+		if err := c.ShouldBindJSON(&dto); err != nil {
+			c.JSON(400, gin.H{"error": "invalid request body: " + err.Error()})
+			return
+		}
+
+		if code, err := m.checkOriginSettings([]StaticOriginDto{dto}); err != nil {
+			c.JSON(code, gin.H{"error": err.Error()})
+			return
+		}
+
+		id := originID(infrastructurev1alpha1.StaticOriginSpec{Upstream: dto.Upstream, Port: dto.Port})
+		service, code, err := m.changeOrigins(c, func(origins []OriginDto) ([]StaticOriginDto, int, error) {
+			if _, ok := findOrigin(origins, id); ok {
+				return nil, 409, fmt.Errorf("origin %s:%d already exists", dto.Upstream, dto.Port)
+			}
+			return append(originDtos(origins), dto), 200, nil
+		})
+		if err != nil {
+			c.JSON(code, gin.H{"error": err.Error()})
+			return
+		}
+
+		origins := staticOrigins(service)
+		i, _ := findOrigin(origins, id)
+		c.JSON(201, origins[i])
+		return
+	})
+
+	group.PUT("/:service-id/origins/:origin-id", auth.NewAuthzBuilder().E(m.enforcer).T("project-id").R("service").S("user_id").A("update").Build(), func(c *gin.Context) {
+		var dto StaticOriginDto
+		if err := c.ShouldBindJSON(&dto); err != nil {
+			c.JSON(400, gin.H{"error": "invalid request body: " + err.Error()})
+			return
+		}
+
+		if code, err := m.checkOriginSettings([]StaticOriginDto{dto}); err != nil {
+			c.JSON(code, gin.H{"error": err.Error()})
+			return
+		}
+
+		// Pointing an origin elsewhere changes its id
+		id := originID(infrastructurev1alpha1.StaticOriginSpec{Upstream: dto.Upstream, Port: dto.Port})
+		service, code, err := m.changeOrigins(c, func(origins []OriginDto) ([]StaticOriginDto, int, error) {
+			i, ok := findOrigin(origins, c.Param("origin-id"))
+			if !ok {
+				return nil, 404, fmt.Errorf("origin not found")
+			}
+			if j, ok := findOrigin(origins, id); ok && j != i {
+				return nil, 409, fmt.Errorf("origin %s:%d already exists", dto.Upstream, dto.Port)
+			}
+			updated := originDtos(origins)
+			updated[i] = dto
+			return updated, 200, nil
+		})
+		if err != nil {
+			c.JSON(code, gin.H{"error": err.Error()})
 			return
 		}
 
-		obj, err := m.client.Resource(gvr).Namespace(m.cfg.Namespace).Get(c, serviceId, metav1.GetOptions{})
+		origins := staticOrigins(service)
+		i, _ := findOrigin(origins, id)
+		c.JSON(200, origins[i])
+		return
+	})
+
+	group.DELETE("/:service-id/origins/:origin-id", auth.NewAuthzBuilder().E(m.enforcer).T("project-id").R("service").S("user_id").A("update").Build(), func(c *gin.Context) {
+		_, code, err := m.changeOrigins(c, func(origins []OriginDto) ([]StaticOriginDto, int, error) {
+			i, ok := findOrigin(origins, c.Param("origin-id"))
+			if !ok {
+				return nil, 404, fmt.Errorf("origin not found")
+			}
+			return slices.Delete(originDtos(origins), i, i+1), 200, nil
+		})
 		if err != nil {
-			c.JSON(500, gin.H{"error": "failed to retrieve service: " + err.Error()})
+			c.JSON(code, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.Status(204)
+		return
+	})
+
+	group.POST("/:service-id/purge", auth.NewAuthzBuilder().E(m.enforcer).T("project-id").R("service").S("user_id").A("purge").Build(), func(c *gin.Context) {
+		var dto PurgeDto
+		if err := c.ShouldBindJSON(&dto); err != nil {
+			c.JSON(400, gin.H{"error": "invalid request body: " + err.Error()})
+			return
+		}
+
+		service, code, err := m.getTypedService(c, c.Param("project-id"), c.Param("service-id"))
+		if err != nil {
+			c.JSON(code, gin.H{"error": err.Error()})
+			return
+		}
+
+		targets, err := purgeTargets(service, dto.Targets)
+		if err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+
+		scope := purge.Scope(dto.Type)
+		if err := purge.Validate(scope, targets); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+
+		locations, err := m.purgeLocations(c)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+
+		job, err := m.purges.Start(c, c.Param("project-id"), purge.Request{
+			Service: service.Name,
+			Hosts:   serviceHosts(service),
+			Scope:   scope,
+			Targets: targets,
+		}, locations)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.Header("Location", "/purges/"+job.ID)
+		c.JSON(202, job)
+		return
+	})
+
+	group.GET("/:service-id/status", auth.NewAuthzBuilder().E(m.enforcer).T("project-id").R("service").S("user_id").A("read").Build(), func(c *gin.Context) {
+		serviceId := c.Param("service-id")
+
+		service, code, err := m.getTypedService(c, c.Param("project-id"), serviceId)
+		if err != nil {
+			c.JSON(code, gin.H{"error": err.Error()})
+			return
+		}
+
+		ret := &ServiceDetailsDto{
+			ServiceId: serviceId,
+		}
+
+		ret.Certificates, err = m.serviceCertificates(c, service, time.Now())
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		for _, certificate := range ret.Certificates {
+			if certificate.Warning != "" {
+				ret.Warnings = append(ret.Warnings, certificate.Id+": "+certificate.Warning)
+			}
+		}
+
+		ret.Status = readiness.Aggregate(c, readiness.Target{Name: service.Name, Namespace: m.cfg.Namespace}, m.statusSources()...)
+
+		c.JSON(200, ret)
+		return
+	})
+
+	group.POST("/:service-id/keys", auth.NewAuthzBuilder().E(m.enforcer).T("project-id").R("service").S("user_id").A("update").Build(), func(c *gin.Context) {
+		var dto CreateKeyDto
+		if err := c.ShouldBindJSON(&dto); err != nil {
+			c.JSON(400, gin.H{"error": "invalid request body: " + err.Error()})
+			return
+		}
+
+		keyName := dto.Name
+		if keyName == "" {
+			c.JSON(400, gin.H{"error": "key name is required"})
+			return
+		}
+
+		serviceId := c.Param("service-id")
+
+		obj, code, err := m.getService(c, c.Param("project-id"), serviceId)
+		if err != nil {
+			c.JSON(code, gin.H{"error": err.Error()})
 			return
 		}
 
@@ -500,20 +1027,25 @@ func (m *Module) RegisterRoutes(r *gin.Engine) {
 			return
 		}
 
-		keys := service.Spec.SecureKeys
-		newKeys := []infrastructurev1alpha1.SecureKeySpec{}
-		for _, key := range keys {
-			if key.Name != keyName {
-				newKeys = append(newKeys, key)
-			}
+		if slices.ContainsFunc(service.Spec.SecureKeys, func(k infrastructurev1alpha1.SecureKeySpec) bool {
+			return k.Name == keyName
+		}) {
+			c.JSON(409, gin.H{"error": "key with the same name already exists"})
+			return
 		}
 
-		if len(keys) == len(newKeys) {
-			c.JSON(404, gin.H{"error": "key not found"})
+		if len(service.Spec.SecureKeys) >= maxSecureKeys {
+			c.JSON(409, gin.H{"error": fmt.Sprintf("services hold at most %d keys, delete or rotate a key first", maxSecureKeys)})
 			return
 		}
 
-		service.Spec.SecureKeys = newKeys
+		newKey, err := newSecureKey(keyName)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+
+		service.Spec.SecureKeys = append(service.Spec.SecureKeys, newKey)
 
 		objMap, err := runtime.DefaultUnstructuredConverter.ToUnstructured(service)
 		if err != nil {
@@ -527,10 +1059,12 @@ func (m *Module) RegisterRoutes(r *gin.Engine) {
 
 		updatedObj, err := m.client.Resource(gvr).Namespace(m.cfg.Namespace).Update(c, &serviceUnstructured, metav1.UpdateOptions{})
 		if err != nil {
-			c.JSON(500, gin.H{"error": "failed to update service after deleting key: " + err.Error()})
+			c.JSON(500, gin.H{"error": "failed to update service with new key: " + err.Error()})
 			return
 		}
 
+		audit.Change(c, obj, updatedObj)
+
 		returnedService := &infrastructurev1alpha1.Service{}
 		err = runtime.DefaultUnstructuredConverter.FromUnstructured(updatedObj.Object, returnedService)
 		if err != nil {
@@ -538,53 +1072,256 @@ func (m *Module) RegisterRoutes(r *gin.Engine) {
 			return
 		}
 
+		// The new key is only shown in this response, afterwards it has to be revealed explicitly
+		redactService(returnedService)
+		for i := range returnedService.Spec.SecureKeys {
+			if returnedService.Spec.SecureKeys[i].Name == newKey.Name {
+				returnedService.Spec.SecureKeys[i].Value = newKey.Value
+			}
+		}
 		c.JSON(200, returnedService)
 		return
 	})
 
-	group.POST("/:service-id/host-alias", auth.NewAuthzBuilder().E(m.enforcer).T("project-id").R("service").S("user_id").A("update").Build(), func(c *gin.Context) {
-		var dto HostAliasDto
+	group.POST("/:service-id/keys/rotate", auth.NewAuthzBuilder().E(m.enforcer).T("project-id").R("service").S("user_id").A("update").Build(), func(c *gin.Context) {
+		var dto RotateKeyDto
 		if err := c.ShouldBindJSON(&dto); err != nil {
+			c.JSON(400, gin.H{"error": "invalid request body: " + err.Error()})
+			return
+		}
 
-			fmt.Printf("%v", dto)
+		gracePeriod := m.cfg.KeyGracePeriod
+		if dto.GracePeriodSeconds != nil {
+			gracePeriod = time.Duration(*dto.GracePeriodSeconds) * time.Second
+		}
 
-			c.JSON(400, gin.H{"error": "invalid request body: " + err.Error()})
+		obj, code, err := m.getService(c, c.Param("project-id"), c.Param("service-id"))
+		if err != nil {
+			c.JSON(code, gin.H{"error": err.Error()})
 			return
 		}
 
-		serviceId := c.Param("service-id")
+		service := &infrastructurev1alpha1.Service{}
+		err = runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, service)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "internal error"})
+			return
+		}
+
+		if len(service.Spec.SecureKeys) == 0 {
+			c.JSON(400, gin.H{"error": "service has no key to rotate, create one first"})
+			return
+		}
+
+		retiring := retiringKeys(service)
+		if len(retiring) > 0 || len(service.Spec.SecureKeys) >= maxSecureKeys {
+			c.JSON(409, gin.H{"error": "a previous rotation is still in progress, wait for the retiring key to expire or delete it"})
+			return
+		}
 
-		// Check if service exists
-		service, err := m.client.Resource(gvr).Namespace(m.cfg.Namespace).Get(c, serviceId, metav1.GetOptions{})
+		if slices.ContainsFunc(service.Spec.SecureKeys, func(k infrastructurev1alpha1.SecureKeySpec) bool {
+			return k.Name == dto.Name
+		}) {
+			c.JSON(409, gin.H{"error": "key with the same name already exists"})
+			return
+		}
+
+		newKey, err := newSecureKey(dto.Name)
 		if err != nil {
-			if apierrors.IsNotFound(err) {
-				c.JSON(404, gin.H{"error": "service not found"})
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+
+		// The new key signs from now on, the previous one keeps validating until the grace period ends
+		retireAt := time.Now().Add(gracePeriod).UTC()
+		for _, key := range service.Spec.SecureKeys {
+			retiring[key.Name] = retireAt
+		}
+		setRetiringKeys(service, retiring)
+		service.Spec.SecureKeys = append(service.Spec.SecureKeys, newKey)
+
+		updatedObj, err := m.updateService(c, service)
+		if err != nil {
+			if apierrors.IsConflict(err) {
+				c.JSON(409, gin.H{"error": "service was modified concurrently, please retry"})
 				return
 			}
-			c.JSON(500, gin.H{"error": "failed to retrieve service: " + err.Error()})
+			c.JSON(500, gin.H{"error": err.Error()})
 			return
 		}
 
-		serviceObj := &infrastructurev1alpha1.Service{}
+		audit.Change(c, obj, updatedObj)
 
-		err = runtime.DefaultUnstructuredConverter.FromUnstructured(service.Object, serviceObj)
+		returnedService := &infrastructurev1alpha1.Service{}
+		err = runtime.DefaultUnstructuredConverter.FromUnstructured(updatedObj.Object, returnedService)
 		if err != nil {
 			c.JSON(500, gin.H{"error": "internal error"})
 			return
 		}
 
-		if slices.ContainsFunc(serviceObj.Spec.HostAliases, func(n infrastructurev1alpha1.HostAliasSpec) bool {
-			return n.Name == dto.Name
-		}) {
-			c.JSON(409, gin.H{"error": "Host Alias already registered with the service"})
+		// As with POST /keys the new key is only shown in this response
+		redactService(returnedService)
+		for i := range returnedService.Spec.SecureKeys {
+			if returnedService.Spec.SecureKeys[i].Name == newKey.Name {
+				returnedService.Spec.SecureKeys[i].Value = newKey.Value
+			}
+		}
+		c.JSON(200, returnedService)
+		return
+	})
+
+	group.GET("/:service-id/keys/:key-name/reveal", auth.NewAuthzBuilder().E(m.enforcer).T("project-id").R("secret").S("user_id").A("read").Build(), func(c *gin.Context) {
+		obj, code, err := m.getService(c, c.Param("project-id"), c.Param("service-id"))
+		if err != nil {
+			c.JSON(code, gin.H{"error": err.Error()})
+			return
+		}
+
+		service := &infrastructurev1alpha1.Service{}
+		err = runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, service)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "internal error"})
 			return
 		}
 
-		serviceObj.Spec.HostAliases = append(serviceObj.Spec.HostAliases, infrastructurev1alpha1.HostAliasSpec{
-			Name: dto.Name,
+		for _, key := range service.Spec.SecureKeys {
+			if key.Name == c.Param("key-name") {
+				c.JSON(200, SecureKeyDto{
+					Name:      key.Name,
+					Value:     key.Value,
+					CreatedAt: key.CreatedAt.Time,
+				})
+				return
+			}
+		}
+
+		c.JSON(404, gin.H{"error": "key not found"})
+		return
+	})
+
+	group.POST("/:service-id/sign", auth.NewAuthzBuilder().E(m.enforcer).T("project-id").R("secret").S("user_id").A("read").Build(), func(c *gin.Context) {
+		var dto SignUrlDto
+		if err := c.ShouldBindJSON(&dto); err != nil {
+			c.JSON(400, gin.H{"error": "invalid request body: " + err.Error()})
+			return
+		}
+
+		if !dto.ExpiresAt.After(time.Now()) {
+			c.JSON(400, gin.H{"error": "expiresAt must be in the future"})
+			return
+		}
+
+		// A relative path would be signed as given but sent with a leading slash, the URL would never verify
+		path, err := url.Parse(dto.Path)
+		if err != nil || path.Scheme != "" || path.Host != "" || !strings.HasPrefix(path.Path, "/") {
+			c.JSON(400, gin.H{"error": "path must be an absolute path without scheme and host"})
+			return
+		}
+
+		service, code, err := m.getTypedService(c, c.Param("project-id"), c.Param("service-id"))
+		if err != nil {
+			c.JSON(code, gin.H{"error": err.Error()})
+			return
+		}
+
+		host := dto.Host
+		if host == "" {
+			host = service.Spec.Domain
+		}
+		if !slices.Contains(serviceHosts(service), host) {
+			c.JSON(400, gin.H{"error": "host " + host + " does not belong to the service"})
+			return
+		}
+
+		key, ok := signingKey(service, dto.KeyName)
+		if !ok {
+			if len(service.Spec.SecureKeys) == 0 {
+				c.JSON(400, gin.H{"error": "signed URLs are not enabled for this service"})
+				return
+			}
+			c.JSON(404, gin.H{"error": "key not found"})
+			return
+		}
+
+		signed := signing.SignURL(&url.URL{Scheme: "https", Host: host, Path: path.Path, RawPath: path.RawPath, RawQuery: path.RawQuery}, key.Value, signing.Params{
+			Expires:  dto.ExpiresAt,
+			KeyName:  key.Name,
+			ClientIP: dto.ClientIP,
+		})
+
+		c.JSON(200, SignedUrlDto{
+			URL:       signed.String(),
+			KeyName:   key.Name,
+			ExpiresAt: time.Unix(dto.ExpiresAt.Unix(), 0).UTC(),
 		})
+		return
+	})
+
+	group.POST("/:service-id/verify", auth.NewAuthzBuilder().E(m.enforcer).T("project-id").R("service").S("user_id").A("read").Build(), func(c *gin.Context) {
+		var dto VerifyUrlDto
+		if err := c.ShouldBindJSON(&dto); err != nil {
+			c.JSON(400, gin.H{"error": "invalid request body: " + err.Error()})
+			return
+		}
+
+		u, err := url.Parse(dto.URL)
+		if err != nil {
+			c.JSON(400, gin.H{"error": "invalid url: " + err.Error()})
+			return
+		}
+
+		service, code, err := m.getTypedService(c, c.Param("project-id"), c.Param("service-id"))
+		if err != nil {
+			c.JSON(code, gin.H{"error": err.Error()})
+			return
+		}
+
+		if !slices.Contains(serviceHosts(service), u.Hostname()) {
+			c.JSON(200, VerifyUrlResultDto{Valid: false, Reason: "host does not belong to the service"})
+			return
+		}
+
+		params, err := signing.Verify(u, dto.ClientIP, time.Now(), func(name string) (string, bool) {
+			key, ok := signingKey(service, name)
+			return key.Value, ok
+		})
+
+		ret := VerifyUrlResultDto{Valid: err == nil, KeyName: params.KeyName, ClientIP: params.ClientIP}
+		if !params.Expires.IsZero() {
+			expiresAt := params.Expires.UTC()
+			ret.ExpiresAt = &expiresAt
+		}
+		if err != nil {
+			ret.Reason = err.Error()
+		}
 
-		objMap, err := runtime.DefaultUnstructuredConverter.ToUnstructured(serviceObj)
+		c.JSON(200, ret)
+		return
+	})
+
+	group.DELETE("/:service-id/keys/:key-name", auth.NewAuthzBuilder().E(m.enforcer).T("project-id").R("service").S("user_id").A("update").Build(), func(c *gin.Context) {
+		serviceId := c.Param("service-id")
+		keyName := c.Param("key-name")
+
+		obj, code, err := m.getService(c, c.Param("project-id"), serviceId)
+		if err != nil {
+			c.JSON(code, gin.H{"error": err.Error()})
+			return
+		}
+
+		service := &infrastructurev1alpha1.Service{}
+		err = runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, service)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "internal error"})
+			return
+		}
+
+		if !removeKey(service, keyName) {
+			c.JSON(404, gin.H{"error": "key not found"})
+			return
+		}
+
+		objMap, err := runtime.DefaultUnstructuredConverter.ToUnstructured(service)
 		if err != nil {
 			c.JSON(500, gin.H{"error": "internal error"})
 			return
@@ -596,10 +1333,12 @@ func (m *Module) RegisterRoutes(r *gin.Engine) {
 
 		updatedObj, err := m.client.Resource(gvr).Namespace(m.cfg.Namespace).Update(c, &serviceUnstructured, metav1.UpdateOptions{})
 		if err != nil {
-			c.JSON(500, gin.H{"error": "failed to add hostAlias to service: " + err.Error()})
+			c.JSON(500, gin.H{"error": "failed to update service after deleting key: " + err.Error()})
 			return
 		}
 
+		audit.Change(c, obj, updatedObj)
+
 		returnedService := &infrastructurev1alpha1.Service{}
 		err = runtime.DefaultUnstructuredConverter.FromUnstructured(updatedObj.Object, returnedService)
 		if err != nil {
@@ -607,63 +1346,244 @@ func (m *Module) RegisterRoutes(r *gin.Engine) {
 			return
 		}
 
+		redactService(returnedService)
 		c.JSON(200, returnedService)
 		return
 	})
 
-	group.DELETE("/:service-id/host-alias/:alias-name", auth.NewAuthzBuilder().E(m.enforcer).T("project-id").R("service").S("user_id").A("update").Build(), func(c *gin.Context) {
-		serviceId := c.Param("service-id")
-		aliasName := c.Param("alias-name")
+	group.GET("/:service-id/certificates", auth.NewAuthzBuilder().E(m.enforcer).T("project-id").R("service").S("user_id").A("read").Build(), func(c *gin.Context) {
+		service, code, err := m.getTypedService(c, c.Param("project-id"), c.Param("service-id"))
+		if err != nil {
+			c.JSON(code, gin.H{"error": err.Error()})
+			return
+		}
 
-		// Check if service exists
-		obj, err := m.client.Resource(gvr).Namespace(m.cfg.Namespace).Get(c, serviceId, metav1.GetOptions{})
+		certificates, err := m.serviceCertificates(c, service, time.Now())
 		if err != nil {
-			if apierrors.IsNotFound(err) {
-				c.JSON(404, gin.H{"error": "service not found"})
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(200, certificates)
+		return
+	})
+
+	group.POST("/:service-id/certificates", auth.NewAuthzBuilder().E(m.enforcer).T("project-id").R("service").S("user_id").A("update").Build(), func(c *gin.Context) {
+		var dto UploadCertificateDto
+		if err := c.ShouldBindJSON(&dto); err != nil {
+			c.JSON(400, gin.H{"error": "invalid request body: " + err.Error()})
+			return
+		}
+
+		now := time.Now()
+		bundle, err := tlscert.Parse([]byte(dto.Certificate), []byte(dto.PrivateKey), now)
+		if err != nil {
+			c.JSON(400, gin.H{"error": "invalid certificate: " + err.Error()})
+			return
+		}
+
+		service, code, err := m.getTypedService(c, c.Param("project-id"), c.Param("service-id"))
+		if err != nil {
+			c.JSON(code, gin.H{"error": err.Error()})
+			return
+		}
+		before := service.DeepCopy()
+
+		aliases := make([]string, len(dto.Aliases))
+		for i, alias := range dto.Aliases {
+			aliases[i] = normalizeHostname(alias)
+		}
+		if errs := checkCertificateAliases(service, bundle, aliases); len(errs) > 0 {
+			c.JSON(400, gin.H{"error": "invalid certificate aliases", "fields": errs})
+			return
+		}
+
+		name, unused, err := m.storeCertificate(c, service, bundle, aliases)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+
+		updatedObj, err := m.updateService(c, service)
+		if err != nil {
+			if apierrors.IsConflict(err) {
+				c.JSON(409, gin.H{"error": "service was modified concurrently, please retry"})
 				return
 			}
-			c.JSON(500, gin.H{"error": "failed to retrieve service: " + err.Error()})
+			c.JSON(500, gin.H{"error": "failed to attach certificate to service: " + err.Error()})
 			return
 		}
 
-		service := &infrastructurev1alpha1.Service{}
-		err = runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, service)
+		audit.Change(c, before, updatedObj)
+
+		if err := m.deleteCertificates(c, unused); err != nil {
+			logger.L().Warn("Failed to delete unused certificates", zap.Strings("secrets", unused), zap.Error(err))
+		}
+
+		c.JSON(201, describeCertificate(name, certificateRefs(service)[name], tlscert.Describe(bundle.Leaf()), now))
+		return
+	})
+
+	group.DELETE("/:service-id/certificates/:certificate-id", auth.NewAuthzBuilder().E(m.enforcer).T("project-id").R("service").S("user_id").A("update").Build(), func(c *gin.Context) {
+		service, code, err := m.getTypedService(c, c.Param("project-id"), c.Param("service-id"))
 		if err != nil {
-			c.JSON(500, gin.H{"error": "internal error"})
+			c.JSON(code, gin.H{"error": err.Error()})
+			return
+		}
+		before := service.DeepCopy()
+
+		name := c.Param("certificate-id")
+		if !removeCertificate(service, name) {
+			c.JSON(404, gin.H{"error": "certificate not found"})
 			return
 		}
 
-		aliases := service.Spec.HostAliases
-		newAliases := []infrastructurev1alpha1.HostAliasSpec{}
-		for _, alias := range aliases {
-			if alias.Name != aliasName {
-				newAliases = append(newAliases, alias)
+		updatedObj, err := m.updateService(c, service)
+		if err != nil {
+			if apierrors.IsConflict(err) {
+				c.JSON(409, gin.H{"error": "service was modified concurrently, please retry"})
+				return
 			}
+			c.JSON(500, gin.H{"error": "failed to detach certificate from service: " + err.Error()})
+			return
+		}
+
+		audit.Change(c, before, updatedObj)
+
+		if err := m.deleteCertificates(c, []string{name}); err != nil {
+			logger.L().Warn("Failed to delete unused certificates", zap.String("secret", name), zap.Error(err))
+		}
+
+		c.Status(204)
+		return
+	})
+
+	group.GET("/:service-id/host-aliases", auth.NewAuthzBuilder().E(m.enforcer).T("project-id").R("service").S("user_id").A("read").Build(), func(c *gin.Context) {
+		service, code, err := m.getTypedService(c, c.Param("project-id"), c.Param("service-id"))
+		if err != nil {
+			c.JSON(code, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(200, hostAliasStatuses(service))
+		return
+	})
+
+	group.POST("/:service-id/host-alias", auth.NewAuthzBuilder().E(m.enforcer).T("project-id").R("service").S("user_id").A("update").Build(), func(c *gin.Context) {
+		var dto HostAliasDto
+		if err := c.ShouldBindJSON(&dto); err != nil {
+			c.JSON(400, gin.H{"error": "invalid request body: " + err.Error()})
+			return
 		}
+		hostname := normalizeHostname(dto.Name)
 
-		if len(aliases) == len(newAliases) {
+		service, code, err := m.getTypedService(c, c.Param("project-id"), c.Param("service-id"))
+		if err != nil {
+			c.JSON(code, gin.H{"error": err.Error()})
+			return
+		}
+		before := service.DeepCopy()
+
+		services, err := m.listAllServices(c)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		if code, err := m.checkHostAlias(services, hostname); err != nil {
+			c.JSON(code, gin.H{"error": err.Error()})
+			return
+		}
+
+		alias, err := addPendingHostAlias(service, hostname, dto.VerificationMethod, time.Now())
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+
+		updatedObj, err := m.updateService(c, service)
+		if err != nil {
+			if apierrors.IsConflict(err) {
+				c.JSON(409, gin.H{"error": "service was modified concurrently, please retry"})
+				return
+			}
+			c.JSON(500, gin.H{"error": "failed to add hostAlias to service: " + err.Error()})
+			return
+		}
+
+		audit.Change(c, before, updatedObj)
+
+		c.JSON(201, pendingHostAliasStatus(service, alias))
+		return
+	})
+
+	group.POST("/:service-id/host-alias/:alias-name/verify", auth.NewAuthzBuilder().E(m.enforcer).T("project-id").R("service").S("user_id").A("update").Build(), func(c *gin.Context) {
+		service, code, err := m.getTypedService(c, c.Param("project-id"), c.Param("service-id"))
+		if err != nil {
+			c.JSON(code, gin.H{"error": err.Error()})
+			return
+		}
+		before := service.DeepCopy()
+
+		hostname := normalizeHostname(c.Param("alias-name"))
+		if !hasHostAlias(service, hostname) {
 			c.JSON(404, gin.H{"error": "Alias not found"})
 			return
 		}
 
-		service.Spec.HostAliases = newAliases
+		status, err := m.verifyHostAlias(c, service, hostname, time.Now())
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
 
-		objMap, err := runtime.DefaultUnstructuredConverter.ToUnstructured(service)
+		updatedObj, err := m.updateService(c, service)
 		if err != nil {
-			c.JSON(500, gin.H{"error": "internal error"})
+			if apierrors.IsConflict(err) {
+				c.JSON(409, gin.H{"error": "service was modified concurrently, please retry"})
+				return
+			}
+			c.JSON(500, gin.H{"error": err.Error()})
 			return
 		}
 
-		serviceUnstructured := unstructured.Unstructured{
-			Object: objMap,
+		audit.Change(c, before, updatedObj)
+
+		c.JSON(200, status)
+		return
+	})
+
+	group.DELETE("/:service-id/host-alias/:alias-name", auth.NewAuthzBuilder().E(m.enforcer).T("project-id").R("service").S("user_id").A("update").Build(), func(c *gin.Context) {
+		service, code, err := m.getTypedService(c, c.Param("project-id"), c.Param("service-id"))
+		if err != nil {
+			c.JSON(code, gin.H{"error": err.Error()})
+			return
 		}
+		before := service.DeepCopy()
 
-		updatedObj, err := m.client.Resource(gvr).Namespace(m.cfg.Namespace).Update(c, &serviceUnstructured, metav1.UpdateOptions{})
+		removed, err := removeHostAlias(service, normalizeHostname(c.Param("alias-name")))
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		if !removed {
+			c.JSON(404, gin.H{"error": "Alias not found"})
+			return
+		}
+
+		updatedObj, err := m.updateService(c, service)
 		if err != nil {
 			c.JSON(500, gin.H{"error": "failed to update service after removing host Alias: " + err.Error()})
 			return
 		}
 
+		audit.Change(c, before, updatedObj)
+
+		if unused := unreferencedCertificates(certificateRefs(before), service); len(unused) > 0 {
+			if err := m.deleteCertificates(c, unused); err != nil {
+				logger.L().Warn("Failed to delete unused certificates", zap.Strings("secrets", unused), zap.Error(err))
+			}
+		}
+
 		returnedService := &infrastructurev1alpha1.Service{}
 		err = runtime.DefaultUnstructuredConverter.FromUnstructured(updatedObj.Object, returnedService)
 		if err != nil {
@@ -671,8 +1591,85 @@ func (m *Module) RegisterRoutes(r *gin.Engine) {
 			return
 		}
 
+		redactService(returnedService)
 		c.JSON(200, returnedService)
 		return
 	})
 
 }
+
+// getService fetches a service of the given project. Services of other projects are reported as not found
+// so their names do not leak across projects.
+func (m *Module) getService(ctx context.Context, project string, name string) (*unstructured.Unstructured, int, error) {
+	obj, err := m.client.Resource(gvr).Namespace(m.cfg.Namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, 404, fmt.Errorf("service not found")
+		}
+		return nil, 500, fmt.Errorf("failed to retrieve service: %w", err)
+	}
+
+	if obj.GetLabels()["project"] != project {
+		return nil, 404, fmt.Errorf("service not found")
+	}
+
+	return obj, 200, nil
+}
+
+// updateService writes the service back and returns the stored object
+func (m *Module) updateService(ctx context.Context, service *infrastructurev1alpha1.Service) (*unstructured.Unstructured, error) {
+	objMap, err := runtime.DefaultUnstructuredConverter.ToUnstructured(service)
+	if err != nil {
+		return nil, fmt.Errorf("internal error")
+	}
+
+	updatedObj, err := m.client.Resource(gvr).Namespace(m.cfg.Namespace).Update(ctx, &unstructured.Unstructured{Object: objMap}, metav1.UpdateOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to update service: %w", err)
+	}
+
+	return updatedObj, nil
+}
+
+// getTypedService is getService converted to a Service
+func (m *Module) getTypedService(ctx context.Context, project string, name string) (*infrastructurev1alpha1.Service, int, error) {
+	obj, code, err := m.getService(ctx, project, name)
+	if err != nil {
+		return nil, code, err
+	}
+
+	service := &infrastructurev1alpha1.Service{}
+	err = runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, service)
+	if err != nil {
+		return nil, 500, fmt.Errorf("internal error")
+	}
+
+	return service, 200, nil
+}
+
+// serviceHosts lists the domain and all host aliases of a service
+func serviceHosts(service *infrastructurev1alpha1.Service) []string {
+	hosts := []string{service.Spec.Domain}
+	for _, alias := range service.Spec.HostAliases {
+		hosts = append(hosts, alias.Name)
+	}
+	return hosts
+}
+
+// signingKey returns the named key, or the newest key when no name is given
+func signingKey(service *infrastructurev1alpha1.Service, name string) (infrastructurev1alpha1.SecureKeySpec, bool) {
+	var found *infrastructurev1alpha1.SecureKeySpec
+	for i, key := range service.Spec.SecureKeys {
+		if name != "" && key.Name != name {
+			continue
+		}
+		if found == nil || key.CreatedAt.After(found.CreatedAt.Time) {
+			found = &service.Spec.SecureKeys[i]
+		}
+	}
+
+	if found == nil {
+		return infrastructurev1alpha1.SecureKeySpec{}, false
+	}
+	return *found, true
+}
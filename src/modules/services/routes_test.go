@@ -0,0 +1,382 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/EdgeCDN-X/edgecdnx-api/src/internal/logger"
+	"github.com/EdgeCDN-X/edgecdnx-api/src/internal/purge"
+	"github.com/EdgeCDN-X/edgecdnx-api/src/internal/readiness"
+	"github.com/EdgeCDN-X/edgecdnx-api/src/modules/app"
+	"github.com/EdgeCDN-X/edgecdnx-api/src/modules/auth"
+	infrastructurev1alpha1 "github.com/EdgeCDN-X/edgecdnx-controller/api/v1alpha1"
+	"github.com/casbin/casbin/v3"
+	"github.com/casbin/casbin/v3/model"
+	"github.com/gin-gonic/gin"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+const testNamespace = "edgecdnx"
+
+func newTestModule(t *testing.T, objects ...runtime.Object) (*Module, *dynamicfake.FakeDynamicClient) {
+	t.Helper()
+	logger.Init(false)
+
+	casbinModel, err := model.NewModelFromString(auth.RBACWithDomainModel)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	enforcer, err := casbin.NewSyncedEnforcer(casbinModel)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	for _, act := range auth.Actions {
+		if _, err := enforcer.AddPolicy("user@example.com", "demo", "*", act); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+
+	// Objects are seeded unstructured and the scheme stays empty, the tracker can only list one representation
+	seed := []runtime.Object{}
+	for _, obj := range objects {
+		content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		seed = append(seed, &unstructured.Unstructured{Object: content})
+	}
+
+	dynClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(
+		runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{
+			gvr:                         "ServiceList",
+			locationGVR:                 "LocationList",
+			readiness.CertificateGVR:    "CertificateList",
+			readiness.ApplicationSetGVR: "ApplicationSetList",
+			readiness.ApplicationGVR:    "ApplicationList",
+		},
+		seed...,
+	)
+	// The fake client does not implement generateName
+	dynClient.PrependReactor("create", "services", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		obj := action.(k8stesting.CreateAction).GetObject().(*unstructured.Unstructured)
+		if obj.GetName() == "" {
+			obj.SetName(obj.GetGenerateName() + "abcde")
+		}
+		return false, nil, nil
+	})
+
+	k8sCache := app.NewCache(dynClient, testNamespace, time.Hour)
+	t.Cleanup(k8sCache.Stop)
+
+	return &Module{
+		cfg: Config{
+			Namespace:          testNamespace,
+			ServiceBaseDomain:  "cdn.example.com",
+			ControllerSettings: []string{settingAccess, settingCacheRules, settingEdgeRules, settingOriginSettings},
+		},
+		k8sCache:  k8sCache,
+		client:    dynClient,
+		k8sClient: k8sfake.NewClientset(),
+		purges:    purge.NewStore(&fakePurger{}, nil, time.Hour, time.Minute),
+		resolver:  &fakeResolver{},
+		enforcer:  enforcer,
+		middlewares: []gin.HandlerFunc{func(c *gin.Context) {
+			c.Set("user_id", "user@example.com")
+			c.Set("groups", "")
+			c.Next()
+		}},
+	}, dynClient
+}
+
+func testService(name string, project string) *infrastructurev1alpha1.Service {
+	return &infrastructurev1alpha1.Service{
+		TypeMeta:   metav1.TypeMeta{APIVersion: infrastructurev1alpha1.SchemeGroupVersion.String(), Kind: "Service"},
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: testNamespace, Labels: map[string]string{"project": project}},
+		Spec:       infrastructurev1alpha1.ServiceSpec{Name: name, Cache: "1h"},
+	}
+}
+
+func serve(router *gin.Engine, method string, path string, body string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(method, path, strings.NewReader(body))
+	request.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestGetAndDeleteService(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	m, client := newTestModule(t, testService("web", "demo"))
+
+	router := gin.New()
+	m.RegisterRoutes(router)
+
+	recorder := serve(router, http.MethodGet, "/project/demo/services/web", "")
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("unexpected status code %d: %s", recorder.Code, recorder.Body.String())
+	}
+
+	recorder = serve(router, http.MethodDelete, "/project/demo/services/web", "")
+	if recorder.Code != http.StatusNoContent {
+		t.Fatalf("unexpected status code %d: %s", recorder.Code, recorder.Body.String())
+	}
+
+	_, err := client.Resource(gvr).Namespace(testNamespace).Get(context.Background(), "web", metav1.GetOptions{})
+	if !apierrors.IsNotFound(err) {
+		t.Fatalf("expected service to be deleted, got %v", err)
+	}
+
+	recorder = serve(router, http.MethodGet, "/project/demo/services/web", "")
+	if recorder.Code != http.StatusNotFound {
+		t.Fatalf("unexpected status code %d", recorder.Code)
+	}
+}
+
+func TestServiceRoutesEnforceProjectOwnership(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	m, client := newTestModule(t, testService("foreign", "other"))
+
+	router := gin.New()
+	m.RegisterRoutes(router)
+
+	for _, req := range []struct {
+		method string
+		path   string
+		body   string
+	}{
+		{http.MethodGet, "/project/demo/services/foreign", ""},
+		{http.MethodPatch, "/project/demo/services/foreign", `{"cache":"2h"}`},
+		{http.MethodDelete, "/project/demo/services/foreign", ""},
+		{http.MethodGet, "/project/demo/services/foreign/status", ""},
+		{http.MethodPost, "/project/demo/services/foreign/keys", `{"name":"key2"}`},
+		{http.MethodDelete, "/project/demo/services/foreign/keys/key1", ""},
+		{http.MethodPost, "/project/demo/services/foreign/host-alias", `{"name":"www.example.com"}`},
+		{http.MethodDelete, "/project/demo/services/foreign/host-alias/www.example.com", ""},
+	} {
+		recorder := serve(router, req.method, req.path, req.body)
+		if recorder.Code != http.StatusNotFound {
+			t.Fatalf("%s %s: unexpected status code %d: %s", req.method, req.path, recorder.Code, recorder.Body.String())
+		}
+	}
+
+	obj, err := client.Resource(gvr).Namespace(testNamespace).Get(context.Background(), "foreign", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("expected service to be left alone, got %v", err)
+	}
+	if cache, _, _ := unstructured.NestedString(obj.Object, "spec", "cache"); cache != "1h" {
+		t.Fatalf("expected service to be unchanged, got cache %q", cache)
+	}
+}
+
+func TestCreateServiceKeepsS3CredentialsOutOfResponses(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	m, client := newTestModule(t)
+
+	router := gin.New()
+	m.RegisterRoutes(router)
+
+	body := `{"name":"assets","originType":"s3","cache":"1h","signedUrlsEnabled":true,"cacheKey":{},"path":{"paths":["/"]},
+		"s3OriginSpec":{"awsSigsVersion":4,"s3AccessKeyId":"AKIA","s3SecretKey":"s3cr3t","s3BucketName":"bucket","s3Region":"eu-west-1","s3Server":"s3.example.com","s3ServerProto":"Https","s3ServerPort":443,"s3Style":"path"}}`
+	recorder := serve(router, http.MethodPost, "/project/demo/services", body)
+	if recorder.Code != http.StatusCreated {
+		t.Fatalf("unexpected status code %d: %s", recorder.Code, recorder.Body.String())
+	}
+	if strings.Contains(recorder.Body.String(), "s3cr3t") {
+		t.Fatalf("expected S3 secret to be redacted: %s", recorder.Body.String())
+	}
+
+	var created infrastructurev1alpha1.Service
+	if err := json.Unmarshal(recorder.Body.Bytes(), &created); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(created.Spec.SecureKeys) != 1 || created.Spec.SecureKeys[0].Value == "" {
+		t.Fatalf("expected the generated key to be shown once, got %#v", created.Spec.SecureKeys)
+	}
+
+	obj, err := client.Resource(gvr).Namespace(testNamespace).Get(context.Background(), created.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	// The controller reads the credentials from the spec
+	origins, _, _ := unstructured.NestedSlice(obj.Object, "spec", "s3OriginSpec")
+	if len(origins) != 1 || origins[0].(map[string]any)["s3SecretKey"] != "s3cr3t" {
+		t.Fatalf("expected S3 secret to be kept in the service, got %v", origins)
+	}
+	secretName := obj.GetAnnotations()[s3CredentialsAnnotation]
+	if secretName != s3CredentialsSecretName(created.Name) {
+		t.Fatalf("unexpected credentials reference %q", secretName)
+	}
+
+	secret, err := m.k8sClient.CoreV1().Secrets(testNamespace).Get(context.Background(), secretName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if string(secret.Data["s3SecretKey"]) != "s3cr3t" || string(secret.Data["s3AccessKeyId"]) != "AKIA" {
+		t.Fatalf("unexpected credentials %#v", secret.Data)
+	}
+	if len(secret.OwnerReferences) != 1 || secret.OwnerReferences[0].Name != created.Name {
+		t.Fatalf("expected credentials to be owned by the service, got %#v", secret.OwnerReferences)
+	}
+
+	recorder = serve(router, http.MethodGet, "/project/demo/services/"+created.Name, "")
+	if strings.Contains(recorder.Body.String(), created.Spec.SecureKeys[0].Value) || strings.Contains(recorder.Body.String(), "s3cr3t") {
+		t.Fatalf("expected credentials to be redacted: %s", recorder.Body.String())
+	}
+	recorder = serve(router, http.MethodGet, "/project/demo/services", "")
+	if strings.Contains(recorder.Body.String(), "s3cr3t") || strings.Contains(recorder.Body.String(), "AKIA") {
+		t.Fatalf("expected credentials to be redacted: %s", recorder.Body.String())
+	}
+
+	// A conflicting update is reported as such and leaves the Secret alone
+	client.PrependReactor("update", "services", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewConflict(gvr.GroupResource(), created.Name, nil)
+	})
+	s3Patch := `{"s3OriginSpec":{"awsSigsVersion":4,"s3AccessKeyId":"AKIA2","s3SecretKey":"n3w","s3BucketName":"bucket","s3Region":"eu-west-1","s3Server":"s3.example.com","s3ServerProto":"Https","s3ServerPort":443,"s3Style":"path"}}`
+	if recorder := serve(router, http.MethodPatch, "/project/demo/services/"+created.Name, s3Patch); recorder.Code != http.StatusConflict {
+		t.Fatalf("unexpected status code %d: %s", recorder.Code, recorder.Body.String())
+	}
+	secret, err = m.k8sClient.CoreV1().Secrets(testNamespace).Get(context.Background(), secretName, metav1.GetOptions{})
+	if err != nil || string(secret.Data["s3SecretKey"]) != "s3cr3t" {
+		t.Fatalf("expected credentials to be unchanged, got %v %#v", err, secret)
+	}
+	client.ReactionChain = client.ReactionChain[1:]
+
+	if recorder := serve(router, http.MethodPatch, "/project/demo/services/"+created.Name, s3Patch); recorder.Code != http.StatusOK {
+		t.Fatalf("unexpected status code %d: %s", recorder.Code, recorder.Body.String())
+	} else if strings.Contains(recorder.Body.String(), "n3w") {
+		t.Fatalf("expected credentials to be redacted: %s", recorder.Body.String())
+	}
+	secret, err = m.k8sClient.CoreV1().Secrets(testNamespace).Get(context.Background(), secretName, metav1.GetOptions{})
+	if err != nil || string(secret.Data["s3SecretKey"]) != "n3w" || string(secret.Data["s3AccessKeyId"]) != "AKIA2" {
+		t.Fatalf("expected credentials to be updated, got %v %#v", err, secret)
+	}
+
+	// Switching to a static origin drops the credentials
+	recorder = serve(router, http.MethodPatch, "/project/demo/services/"+created.Name, `{"originType":"static","staticOrigin":{"upstream":"origin.example.com","hostHeader":"origin.example.com","port":443,"scheme":"Https"}}`)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("unexpected status code %d: %s", recorder.Code, recorder.Body.String())
+	}
+	if _, err := m.k8sClient.CoreV1().Secrets(testNamespace).Get(context.Background(), secretName, metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+		t.Fatalf("expected credentials to be deleted, got %v", err)
+	}
+}
+
+func TestRevealKeyRequiresSecretRead(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	service := testService("web", "demo")
+	service.Spec.SecureKeys = []infrastructurev1alpha1.SecureKeySpec{{Name: "key1", Value: "0123456789abcdef0123456789abcdef"}}
+	m, _ := newTestModule(t, service)
+
+	router := gin.New()
+	m.RegisterRoutes(router)
+
+	recorder := serve(router, http.MethodGet, "/project/demo/services/web", "")
+	if strings.Contains(recorder.Body.String(), "0123456789abcdef") {
+		t.Fatalf("expected signing key to be redacted: %s", recorder.Body.String())
+	}
+
+	recorder = serve(router, http.MethodGet, "/project/demo/services/web/keys/key1/reveal", "")
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("unexpected status code %d: %s", recorder.Code, recorder.Body.String())
+	}
+	var key SecureKeyDto
+	if err := json.Unmarshal(recorder.Body.Bytes(), &key); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if key.Value != "0123456789abcdef0123456789abcdef" {
+		t.Fatalf("unexpected key %#v", key)
+	}
+
+	// Service permissions alone do not reveal keys
+	if _, err := m.enforcer.RemoveFilteredPolicy(0, "user@example.com"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	for _, act := range auth.Actions {
+		if _, err := m.enforcer.AddPolicy("user@example.com", "demo", "service", act); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+
+	recorder = serve(router, http.MethodGet, "/project/demo/services/web/keys/key1/reveal", "")
+	if recorder.Code != http.StatusForbidden {
+		t.Fatalf("unexpected status code %d", recorder.Code)
+	}
+}
+
+func TestSignAndVerifyServiceURL(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	service := testService("web", "demo")
+	service.Spec.Domain = "abcdefghijklmnop.cdn.example.com"
+	service.Spec.HostAliases = []infrastructurev1alpha1.HostAliasSpec{{Name: "www.example.com"}}
+	service.Spec.SecureKeys = []infrastructurev1alpha1.SecureKeySpec{
+		{Name: "old", Value: "0123456789abcdef0123456789abcdef", CreatedAt: metav1.NewTime(time.Now().Add(-time.Hour))},
+		{Name: "new", Value: "fedcba9876543210fedcba9876543210", CreatedAt: metav1.NewTime(time.Now())},
+	}
+	m, _ := newTestModule(t, service)
+
+	router := gin.New()
+	m.RegisterRoutes(router)
+
+	expiresAt := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	recorder := serve(router, http.MethodPost, "/project/demo/services/web/sign", `{"path":"/videos/intro.mp4?quality=hd","expiresAt":"`+expiresAt+`","host":"www.example.com"}`)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("unexpected status code %d: %s", recorder.Code, recorder.Body.String())
+	}
+
+	var signed SignedUrlDto
+	if err := json.Unmarshal(recorder.Body.Bytes(), &signed); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if signed.KeyName != "new" || !strings.HasPrefix(signed.URL, "https://www.example.com/videos/intro.mp4?") {
+		t.Fatalf("unexpected signed url %#v", signed)
+	}
+
+	recorder = serve(router, http.MethodPost, "/project/demo/services/web/verify", `{"url":"`+signed.URL+`"}`)
+	var result VerifyUrlResultDto
+	if err := json.Unmarshal(recorder.Body.Bytes(), &result); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if !result.Valid || result.KeyName != "new" {
+		t.Fatalf("unexpected verification result %#v", result)
+	}
+
+	tampered := strings.Replace(signed.URL, "intro.mp4", "other.mp4", 1)
+	recorder = serve(router, http.MethodPost, "/project/demo/services/web/verify", `{"url":"`+tampered+`"}`)
+	if err := json.Unmarshal(recorder.Body.Bytes(), &result); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if result.Valid {
+		t.Fatal("expected tampered url to be rejected")
+	}
+
+	recorder = serve(router, http.MethodPost, "/project/demo/services/web/sign", `{"path":"/a.mp4","expiresAt":"`+expiresAt+`","host":"evil.example.com"}`)
+	if recorder.Code != http.StatusBadRequest {
+		t.Fatalf("unexpected status code %d", recorder.Code)
+	}
+
+	recorder = serve(router, http.MethodPost, "/project/demo/services/web/sign", `{"path":"/a.mp4","expiresAt":"`+expiresAt+`","keyName":"missing"}`)
+	if recorder.Code != http.StatusNotFound {
+		t.Fatalf("unexpected status code %d", recorder.Code)
+	}
+	// Paths have to be absolute, otherwise the signed path differs from the one in the URL
+	for _, path := range []string{"a.mp4", "//evil.example.com/a.mp4"} {
+		recorder = serve(router, http.MethodPost, "/project/demo/services/web/sign", `{"path":"`+path+`","expiresAt":"`+expiresAt+`"}`)
+		if recorder.Code != http.StatusBadRequest {
+			t.Fatalf("unexpected status code %d for path %q", recorder.Code, path)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	infrastructurev1alpha1 "github.com/EdgeCDN-X/edgecdnx-controller/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// s3CredentialsAnnotation names the Secret holding the S3 credentials of a service, with the keys s3AccessKeyId and
+// s3SecretKey. The controller still reads the credentials from the spec, so they are kept there as well until the CRD
+// references the Secret. API responses never carry them.
+const s3CredentialsAnnotation = "edgecdnx.com/s3-credentials-secret"
+
+func s3CredentialsSecretName(service string) string {
+	return service + "-s3-credentials"
+}
+
+// storeS3Credentials copies the S3 credentials of a written service into the Secret named by its annotation.
+// It runs once the service write succeeded, so a rejected write never leaves the Secret ahead of the service.
+func (m *Module) storeS3Credentials(ctx context.Context, service *infrastructurev1alpha1.Service) error {
+	name := service.Annotations[s3CredentialsAnnotation]
+	if name == "" || len(service.Spec.S3OriginSpec) == 0 {
+		return nil
+	}
+	data := map[string][]byte{
+		"s3AccessKeyId": []byte(service.Spec.S3OriginSpec[0].S3AccessKeyId),
+		"s3SecretKey":   []byte(service.Spec.S3OriginSpec[0].S3SecretKey),
+	}
+
+	secrets := m.k8sClient.CoreV1().Secrets(m.cfg.Namespace)
+	secret, err := secrets.Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		if !apierrors.IsNotFound(err) {
+			return fmt.Errorf("failed to retrieve S3 credentials: %w", err)
+		}
+
+		_, err = secrets.Create(ctx, &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: m.cfg.Namespace,
+				Labels: map[string]string{
+					"project":              service.Labels["project"],
+					"edgecdnx.com/service": service.Name,
+				},
+				// Removed together with the service
+				OwnerReferences: []metav1.OwnerReference{{
+					APIVersion: infrastructurev1alpha1.SchemeGroupVersion.String(),
+					Kind:       "Service",
+					Name:       service.Name,
+					UID:        service.UID,
+				}},
+			},
+			Type: corev1.SecretTypeOpaque,
+			Data: data,
+		}, metav1.CreateOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to store S3 credentials: %w", err)
+		}
+	} else {
+		secret.Data = data
+		if _, err := secrets.Update(ctx, secret, metav1.UpdateOptions{}); err != nil {
+			return fmt.Errorf("failed to store S3 credentials: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// deleteS3Credentials removes a credentials Secret that is no longer referenced by its service
+func (m *Module) deleteS3Credentials(ctx context.Context, name string) error {
+	err := m.k8sClient.CoreV1().Secrets(m.cfg.Namespace).Delete(ctx, name, metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete S3 credentials: %w", err)
+	}
+	return nil
+}
+
+// redactService strips credentials from a service before it is returned. Signing keys are only revealed through the
+// reveal route.
+func redactService(service *infrastructurev1alpha1.Service) {
+	for i := range service.Spec.S3OriginSpec {
+		service.Spec.S3OriginSpec[i].S3AccessKeyId = ""
+		service.Spec.S3OriginSpec[i].S3SecretKey = ""
+	}
+	for i := range service.Spec.SecureKeys {
+		service.Spec.SecureKeys[i].Value = ""
+	}
+	service.Spec.Certificate.Key = ""
+	for i := range service.Spec.HostAliases {
+		service.Spec.HostAliases[i].Certificate.Key = ""
+	}
+}
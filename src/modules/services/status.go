@@ -0,0 +1,16 @@
+package services
+
+import (
+	"github.com/EdgeCDN-X/edgecdnx-api/src/internal/readiness"
+)
+
+// statusSources lists the objects the readiness of a service is derived from, in the order their conditions
+// are reported. The controller creates the Certificate and ApplicationSet under the name of the service.
+func (m *Module) statusSources() []readiness.Source {
+	return []readiness.Source{
+		&readiness.ServiceSource{Client: m.client, GVR: gvr},
+		&readiness.CertificateSource{Client: m.client},
+		&readiness.ApplicationSetSource{Client: m.client},
+		&readiness.ApplicationsSource{Client: m.client},
+	}
+}
@@ -0,0 +1,186 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/EdgeCDN-X/edgecdnx-api/src/internal/logger"
+	"github.com/EdgeCDN-X/edgecdnx-api/src/internal/readiness"
+	"github.com/EdgeCDN-X/edgecdnx-api/src/internal/watch"
+	infrastructurev1alpha1 "github.com/EdgeCDN-X/edgecdnx-controller/api/v1alpha1"
+	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	serviceEventAdded    = "ADDED"
+	serviceEventModified = "MODIFIED"
+	serviceEventDeleted  = "DELETED"
+)
+
+// watchHistorySize is how many events a reconnecting client can resume from
+const watchHistorySize = 1024
+
+// serviceEventTimeout bounds building the status of one service event
+const serviceEventTimeout = 10 * time.Second
+
+// startWatch publishes a service event on every change of a service or the objects its status is derived from, seen
+// through the shared informers. Only the service informer has to sync, the other resources may not be installed.
+func (m *Module) startWatch(stop <-chan struct{}) error {
+	m.watchHub = watch.NewHub(watchHistorySize, m.cfg.WatchBufferSize)
+
+	m.serviceInformer = m.k8sCache.Informer(gvr)
+	m.serviceInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj any) {
+			m.publishServiceEvent(serviceEventAdded, obj)
+		},
+		UpdateFunc: func(oldObj, newObj any) {
+			m.publishServiceEvent(serviceEventModified, newObj)
+		},
+		DeleteFunc: func(obj any) {
+			m.publishServiceEvent(serviceEventDeleted, obj)
+		},
+	})
+
+	// The Certificate and ApplicationSet carry the name of their service, Applications are owned by the ApplicationSet
+	related := cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj any) {
+			m.publishRelatedChange(obj)
+		},
+		UpdateFunc: func(oldObj, newObj any) {
+			m.publishRelatedChange(newObj)
+		},
+		DeleteFunc: func(obj any) {
+			m.publishRelatedChange(obj)
+		},
+	}
+	m.k8sCache.Informer(readiness.CertificateGVR).AddEventHandler(related)
+	m.k8sCache.Informer(readiness.ApplicationSetGVR).AddEventHandler(related)
+	m.k8sCache.Informer(readiness.ApplicationGVR).AddEventHandler(related)
+
+	if !cache.WaitForCacheSync(stop, m.serviceInformer.HasSynced) {
+		return fmt.Errorf("failed to sync service informer cache")
+	}
+	return nil
+}
+
+// unstructuredFromObject unwraps tombstones delivered on missed deletes
+func unstructuredFromObject(obj any) (*unstructured.Unstructured, bool) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	raw, ok := obj.(*unstructured.Unstructured)
+	return raw, ok
+}
+
+func (m *Module) publishServiceEvent(eventType string, obj any) {
+	if m.watchHub.SkipIfIdle() {
+		return
+	}
+	raw, ok := unstructuredFromObject(obj)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), serviceEventTimeout)
+	defer cancel()
+	event, err := m.serviceEvent(ctx, eventType, raw, raw.GetResourceVersion())
+	if err != nil {
+		logger.L().Error("Failed to build service event", zap.String("service", raw.GetName()), zap.Error(err))
+		return
+	}
+	m.watchHub.Publish(event)
+}
+
+func (m *Module) publishRelatedChange(obj any) {
+	if m.watchHub.SkipIfIdle() {
+		return
+	}
+	raw, ok := unstructuredFromObject(obj)
+	if !ok {
+		return
+	}
+
+	name := raw.GetName()
+	if raw.GetKind() == "Application" {
+		name = ""
+		for _, owner := range raw.GetOwnerReferences() {
+			if owner.Kind == "ApplicationSet" {
+				name = owner.Name
+			}
+		}
+	}
+
+	item, exists, err := m.serviceInformer.GetStore().GetByKey(m.cfg.Namespace + "/" + name)
+	if err != nil || !exists {
+		return
+	}
+	service, ok := item.(*unstructured.Unstructured)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), serviceEventTimeout)
+	defer cancel()
+	event, err := m.serviceEvent(ctx, serviceEventModified, service, raw.GetResourceVersion())
+	if err != nil {
+		logger.L().Error("Failed to build service event", zap.String("service", name), zap.Error(err))
+		return
+	}
+	m.watchHub.Publish(event)
+}
+
+// serviceEvent builds the event for a service, the status is left out for deleted services
+func (m *Module) serviceEvent(ctx context.Context, eventType string, raw *unstructured.Unstructured, id string) (watch.Event, error) {
+	service := &infrastructurev1alpha1.Service{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(raw.Object, service); err != nil {
+		return watch.Event{}, fmt.Errorf("failed to convert service: %w", err)
+	}
+	redactService(service)
+
+	data := ServiceEventDto{Type: eventType, ServiceId: service.Name, Service: service}
+	if eventType != serviceEventDeleted {
+		status := readiness.Aggregate(ctx, readiness.Target{Name: service.Name, Namespace: m.cfg.Namespace}, m.statusSources()...)
+		data.Status = &status
+	}
+
+	return watch.Event{ID: id, Type: "service", Scope: service.Labels["project"], Data: data}, nil
+}
+
+// serviceSnapshot lists the current state of the services of a project from the informer cache
+func (m *Module) serviceSnapshot(ctx context.Context, project string, serviceId string) ([]watch.Event, error) {
+	events := []watch.Event{}
+	for _, item := range m.serviceInformer.GetStore().List() {
+		raw, ok := item.(*unstructured.Unstructured)
+		if !ok || raw.GetLabels()["project"] != project || (serviceId != "" && raw.GetName() != serviceId) {
+			continue
+		}
+		event, err := m.serviceEvent(ctx, serviceEventAdded, raw, raw.GetResourceVersion())
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].Data.(ServiceEventDto).ServiceId < events[j].Data.(ServiceEventDto).ServiceId
+	})
+
+	// Marks the end of the initial state, the id lets a client resume without receiving it again
+	id := ""
+	if last, ok := m.watchHub.Last(); ok {
+		id = last.ID
+	}
+	return append(events, watch.Event{ID: id, Type: "synced", Data: map[string]int{"services": len(events)}}), nil
+}
+
+// serviceFilter selects the events of one project and optionally one service
+func serviceFilter(project string, serviceId string) watch.Filter {
+	return func(event watch.Event) bool {
+		data, ok := event.Data.(ServiceEventDto)
+		return ok && event.Scope == project && (serviceId == "" || data.ServiceId == serviceId)
+	}
+}
@@ -0,0 +1,231 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+type sseEvent struct {
+	id        string
+	eventType string
+	data      string
+}
+
+func readSSEEvent(t *testing.T, reader *bufio.Reader) sseEvent {
+	t.Helper()
+
+	event := sseEvent{}
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("failed to read stream: %v", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "" && event.eventType != "":
+			return event
+		case strings.HasPrefix(line, "id: "):
+			event.id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			event.eventType = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			event.data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
+
+func TestWatchServices(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	m, client := newTestModule(t, testService("web", "demo"), testService("shop", "other"))
+	m.cfg.WatchBufferSize = 16
+	m.cfg.WatchHeartbeat = time.Second
+
+	stop := make(chan struct{})
+	defer close(stop)
+	if err := m.startWatch(stop); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	router := gin.New()
+	m.RegisterRoutes(router)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	request, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/project/demo/services/watch", nil)
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK || response.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("unexpected response %d %v", response.StatusCode, response.Header)
+	}
+	reader := bufio.NewReader(response.Body)
+
+	// The current state of the project comes first
+	event := readSSEEvent(t, reader)
+	var data ServiceEventDto
+	if err := json.Unmarshal([]byte(event.data), &data); err != nil {
+		t.Fatalf("failed to decode event: %v", err)
+	}
+	if event.eventType != "service" || data.Type != serviceEventAdded || data.ServiceId != "web" || data.Status == nil {
+		t.Fatalf("unexpected event %#v", event)
+	}
+	if event = readSSEEvent(t, reader); event.eventType != "synced" {
+		t.Fatalf("unexpected event %#v", event)
+	}
+
+	// Changes of other projects are filtered out
+	for _, name := range []string{"shop", "web"} {
+		obj, err := client.Resource(gvr).Namespace(testNamespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if err := unstructured.SetNestedField(obj.Object, "2h", "spec", "cache"); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if _, err := client.Resource(gvr).Namespace(testNamespace).Update(ctx, obj, metav1.UpdateOptions{}); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+
+	event = readSSEEvent(t, reader)
+	if err := json.Unmarshal([]byte(event.data), &data); err != nil {
+		t.Fatalf("failed to decode event: %v", err)
+	}
+	if data.Type != serviceEventModified || data.ServiceId != "web" || data.Service.Spec.Cache != "2h" {
+		t.Fatalf("unexpected event %#v", event)
+	}
+
+	if err := client.Resource(gvr).Namespace(testNamespace).Delete(ctx, "web", metav1.DeleteOptions{}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	event = readSSEEvent(t, reader)
+	data = ServiceEventDto{}
+	if err := json.Unmarshal([]byte(event.data), &data); err != nil {
+		t.Fatalf("failed to decode event: %v", err)
+	}
+	if data.Type != serviceEventDeleted || data.ServiceId != "web" || data.Status != nil {
+		t.Fatalf("unexpected event %#v", event)
+	}
+}
+
+func TestWatchServicesResumeAfterUnwatchedChange(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	m, client := newTestModule(t, testService("web", "demo"))
+	m.cfg.WatchBufferSize = 16
+	m.cfg.WatchHeartbeat = time.Second
+
+	stop := make(chan struct{})
+	defer close(stop)
+	if err := m.startWatch(stop); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	router := gin.New()
+	m.RegisterRoutes(router)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	// The fake client keeps no resource versions, they are the event ids to resume from
+	setCache := func(cache string, resourceVersion string) {
+		t.Helper()
+		obj, err := client.Resource(gvr).Namespace(testNamespace).Get(ctx, "web", metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if err := unstructured.SetNestedField(obj.Object, cache, "spec", "cache"); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		obj.SetResourceVersion(resourceVersion)
+		if _, err := client.Resource(gvr).Namespace(testNamespace).Update(ctx, obj, metav1.UpdateOptions{}); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+	connect := func(lastID string) (*bufio.Reader, context.CancelFunc) {
+		t.Helper()
+		streamCtx, streamCancel := context.WithCancel(ctx)
+		request, _ := http.NewRequestWithContext(streamCtx, http.MethodGet, server.URL+"/project/demo/services/watch", nil)
+		if lastID != "" {
+			request.Header.Set("Last-Event-ID", lastID)
+		}
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		t.Cleanup(func() { response.Body.Close() })
+		return bufio.NewReader(response.Body), streamCancel
+	}
+
+	reader, disconnect := connect("")
+	for _, expected := range []string{"service", "synced"} {
+		if event := readSSEEvent(t, reader); event.eventType != expected {
+			t.Fatalf("unexpected event %#v", event)
+		}
+	}
+	setCache("2h", "2")
+	last := readSSEEvent(t, reader)
+	if last.id != "2" {
+		t.Fatalf("unexpected event %#v", last)
+	}
+	disconnect()
+
+	for m.watchHub.HasSubscribers() {
+		if ctx.Err() != nil {
+			t.Fatal("expected the subscriber to leave")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	// Nobody receives this change, the history can not replay it
+	setCache("3h", "3")
+	for {
+		item, _, _ := m.serviceInformer.GetStore().GetByKey(testNamespace + "/web")
+		if cache, _, _ := unstructured.NestedString(item.(*unstructured.Unstructured).Object, "spec", "cache"); cache == "3h" {
+			break
+		}
+		if ctx.Err() != nil {
+			t.Fatal("expected the informer to see the change")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	reader, disconnect = connect(last.id)
+	defer disconnect()
+	event := readSSEEvent(t, reader)
+	var data ServiceEventDto
+	if err := json.Unmarshal([]byte(event.data), &data); err != nil {
+		t.Fatalf("failed to decode event: %v", err)
+	}
+	if data.Type != serviceEventAdded || data.Service.Spec.Cache != "3h" {
+		t.Fatalf("expected the full state after the missed change, got %#v", event)
+	}
+}
+
+func TestWatchServicesRequiresPermission(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	m, _ := newTestModule(t)
+
+	router := gin.New()
+	m.RegisterRoutes(router)
+
+	if recorder := serve(router, http.MethodGet, "/project/foreign/services/watch", ""); recorder.Code != http.StatusForbidden {
+		t.Fatalf("unexpected status code %d", recorder.Code)
+	}
+	if recorder := serve(router, http.MethodGet, "/project/demo/services/watch", ""); recorder.Code != http.StatusServiceUnavailable {
+		t.Fatalf("unexpected status code %d", recorder.Code)
+	}
+}
@@ -17,9 +17,9 @@ type Config struct {
 
 type Module struct {
 	cfg         Config
-	client      *dynamic.DynamicClient
+	client      dynamic.Interface
 	middlewares []gin.HandlerFunc
-	enforcer    *casbin.Enforcer
+	enforcer    *casbin.SyncedEnforcer
 	baseCfg     *rest.Config
 }
 
@@ -31,12 +31,17 @@ func (m *Module) Shutdown() {}
 
 func (m *Module) Init() error {
 	logger.L().Info("Initializing module")
-	client, baseCfg, err := app.GetK8SDynamicClient()
+	_, baseCfg, err := app.GetK8SDynamicClient()
 	if err != nil {
 		return err
 	}
 
-	m.client = client
+	k8sCache, err := app.GetK8SCache(m.cfg.Namespace)
+	if err != nil {
+		return err
+	}
+
+	m.client = k8sCache.Client(gvr)
 	m.baseCfg = baseCfg
 
 	return nil
@@ -46,7 +51,7 @@ func (m *Module) SetMiddlewares(middlewares ...gin.HandlerFunc) {
 	m.middlewares = middlewares
 }
 
-func (m *Module) SetEnforcer(enforcer *casbin.Enforcer) {
+func (m *Module) SetEnforcer(enforcer *casbin.SyncedEnforcer) {
 	m.enforcer = enforcer
 }
 
@@ -1,6 +1,7 @@
 package zones
 
 import (
+	"github.com/EdgeCDN-X/edgecdnx-api/src/modules/audit"
 	"github.com/EdgeCDN-X/edgecdnx-api/src/modules/auth"
 	infrastructurev1alpha1 "github.com/EdgeCDN-X/edgecdnx-controller/api/v1alpha1"
 	"github.com/gin-gonic/gin"
@@ -92,6 +93,8 @@ func (m *Module) RegisterRoutes(r *gin.Engine) {
 			return
 		}
 
+		audit.Change(c, nil, createdObj)
+
 		createdZone := &infrastructurev1alpha1.Zone{}
 		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(createdObj.UnstructuredContent(), createdZone); err != nil {
 			c.JSON(500, gin.H{"error": "failed to convert created zone: " + err.Error()})